@@ -13,11 +13,13 @@ import (
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/victorivanov/retrocast/internal/api"
 	"github.com/victorivanov/retrocast/internal/auth"
 	"github.com/victorivanov/retrocast/internal/config"
 	"github.com/victorivanov/retrocast/internal/database"
 	"github.com/victorivanov/retrocast/internal/gateway"
+	"github.com/victorivanov/retrocast/internal/livekit"
 	redisclient "github.com/victorivanov/retrocast/internal/redis"
 	"github.com/victorivanov/retrocast/internal/service"
 	"github.com/victorivanov/retrocast/internal/snowflake"
@@ -81,6 +83,8 @@ func main() {
 	readStates := database.NewReadStateRepository(pool)
 	reactions := database.NewReactionRepository(pool)
 	voiceStates := database.NewVoiceStateRepository(pool)
+	threadMembers := database.NewThreadMemberRepository(pool)
+	auditLogs := database.NewAuditLogRepository(pool)
 
 	// --- Storage ---
 
@@ -92,29 +96,53 @@ func main() {
 		os.Exit(1)
 	}
 
+	// --- Voice ---
+
+	// Without a LiveKit URL, voice moderation is only recorded, not enforced
+	// on connected clients.
+	var voiceRooms service.VoiceRooms
+	if cfg.LiveKitURL != "" {
+		voiceRooms = livekit.NewRoomClient(cfg.LiveKitURL, cfg.LiveKitAPIKey, cfg.LiveKitAPISecret)
+	}
+
 	// --- Gateway ---
 
-	gwManager := gateway.NewManager(tokenSvc, guilds, readStates, rdb)
+	gwManager := gateway.NewManager(tokenSvc, users, guilds, readStates, rdb)
+	gwManager.SetResumeWindow(cfg.GatewayResumeWindow)
+	prometheus.MustRegister(gateway.NewCollector(gwManager))
+	gwManager.SetStateRepositories(gateway.StateRepositories{
+		Channels:    channels,
+		Roles:       roles,
+		Members:     members,
+		VoiceStates: voiceStates,
+		DMChannels:  dmChannels,
+	})
 
 	// --- Services ---
 
-	permChecker := service.NewPermissionChecker(guilds, members, roles, overrides)
+	permChecker := service.NewPermissionChecker(guilds, members, roles, overrides, channels)
+	gwManager.SetChannelPermissions(permChecker)
+
+	presenceSvc := gateway.NewPresenceService(rdb)
 
 	authSvc := service.NewAuthService(users, tokenSvc, rdb, sf)
-	userSvc := service.NewUserService(users)
-	guildSvc := service.NewGuildService(guilds, channels, members, roles, sf, gwManager, permChecker)
-	channelSvc := service.NewChannelService(channels, members, sf, gwManager, permChecker)
-	memberSvc := service.NewMemberService(members, guilds, roles, gwManager, permChecker)
-	roleSvc := service.NewRoleService(guilds, roles, members, channels, overrides, sf, gwManager, permChecker)
-	messageSvc := service.NewMessageService(messages, channels, dmChannels, sf, gwManager, permChecker)
+	userSvc := service.NewUserService(users, presenceSvc)
+	auditLogSvc := service.NewAuditLogService(auditLogs, sf, permChecker)
+	guildSvc := service.NewGuildService(guilds, channels, members, roles, sf, gwManager, permChecker, auditLogSvc)
+	channelSvc := service.NewChannelService(channels, members, sf, gwManager, permChecker, auditLogSvc)
+	threadSvc := service.NewThreadService(channels, messages, threadMembers, sf, gwManager, permChecker)
+	memberSvc := service.NewMemberService(members, guilds, roles, gwManager, permChecker, auditLogSvc, presenceSvc)
+	roleSvc := service.NewRoleService(guilds, roles, members, channels, overrides, sf, gwManager, permChecker, auditLogSvc)
+	messageSvc := service.NewMessageService(messages, attachments, channels, dmChannels, members, roles, readStates, sf, minioClient, gwManager, permChecker, presenceSvc)
 	inviteSvc := service.NewInviteService(invites, guilds, members, bans, gwManager, permChecker)
-	banSvc := service.NewBanService(guilds, members, roles, bans, gwManager, permChecker)
+	banSvc := service.NewBanService(guilds, members, roles, bans, gwManager, permChecker, auditLogSvc)
 	dmSvc := service.NewDMService(dmChannels, users, sf, gwManager)
 	uploadSvc := service.NewUploadService(attachments, channels, sf, minioClient, permChecker)
 	readStateSvc := service.NewReadStateService(readStates, channels, dmChannels, permChecker)
 	reactionSvc := service.NewReactionService(reactions, messages, channels, dmChannels, gwManager, permChecker)
 	searchSvc := service.NewSearchService(messages, members, permChecker)
-	voiceSvc := service.NewVoiceService(voiceStates, channels, users, gwManager, permChecker, cfg.LiveKitAPIKey, cfg.LiveKitAPISecret)
+	voiceSvc := service.NewVoiceService(voiceStates, channels, users, gwManager, gwManager, permChecker, auditLogSvc, voiceRooms, cfg.LiveKitURL, cfg.LiveKitAPIKey, cfg.LiveKitAPISecret)
+	gwManager.SetVoiceStates(voiceSvc)
 
 	// --- Handlers ---
 
@@ -122,11 +150,13 @@ func main() {
 	userHandler := api.NewUserHandler(userSvc)
 	guildHandler := api.NewGuildHandler(guildSvc)
 	channelHandler := api.NewChannelHandler(channelSvc)
+	threadHandler := api.NewThreadHandler(threadSvc)
 	memberHandler := api.NewMemberHandler(memberSvc)
 	roleHandler := api.NewRoleHandler(roleSvc)
 	messageHandler := api.NewMessageHandler(messageSvc)
 	inviteHandler := api.NewInviteHandler(inviteSvc)
 	banHandler := api.NewBanHandler(banSvc)
+	auditLogHandler := api.NewAuditLogHandler(auditLogSvc)
 	dmHandler := api.NewDMHandler(dmSvc)
 	uploadHandler := api.NewUploadHandler(uploadSvc)
 	typingHandler := gateway.NewTypingHandler(channels, rdb, gwManager)
@@ -139,6 +169,7 @@ func main() {
 		Auth:         authHandler,
 		Guilds:       guildHandler,
 		Channels:     channelHandler,
+		Threads:      threadHandler,
 		Members:      memberHandler,
 		Users:        userHandler,
 		Messages:     messageHandler,
@@ -146,6 +177,7 @@ func main() {
 		Roles:        roleHandler,
 		Uploads:      uploadHandler,
 		Bans:         banHandler,
+		AuditLogs:    auditLogHandler,
 		DMs:          dmHandler,
 		ReadStates:   readStateHandler,
 		Reactions:    reactionHandler,
@@ -192,6 +224,17 @@ func main() {
 	sigCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
+	go uploadSvc.RunAttachmentJanitor(sigCtx)
+	go threadSvc.RunThreadArchiver(sigCtx)
+	go voiceSvc.RunVoiceStateSweeper(sigCtx)
+
+	if cfg.GatewayCluster {
+		if err := gwManager.StartCluster(sigCtx); err != nil {
+			slog.Error("gateway cluster init failed", "error", err)
+			os.Exit(1)
+		}
+	}
+
 	go func() {
 		slog.Info("retrocast starting", "addr", cfg.ServerAddr)
 		if err := e.Start(cfg.ServerAddr); err != nil && err != http.ErrServerClosed {
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/victorivanov/retrocast/internal/auth"
+	"github.com/victorivanov/retrocast/internal/models"
+	"github.com/victorivanov/retrocast/internal/service"
+)
+
+// AuditLogReasonHeader carries the reason for a moderation action. Clients
+// URL-encode it so that it can hold any text.
+const AuditLogReasonHeader = "X-Audit-Log-Reason"
+
+// AuditLogReasonMiddleware attaches the X-Audit-Log-Reason header to the
+// request context, where services pick it up when writing audit log entries.
+func AuditLogReasonMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		reason := c.Request().Header.Get(AuditLogReasonHeader)
+		if reason == "" {
+			return next(c)
+		}
+		if decoded, err := url.PathUnescape(reason); err == nil {
+			reason = decoded
+		}
+		req := c.Request()
+		c.SetRequest(req.WithContext(service.WithAuditLogReason(req.Context(), reason)))
+		return next(c)
+	}
+}
+
+// AuditLogHandler handles guild audit log endpoints.
+type AuditLogHandler struct {
+	service *service.AuditLogService
+}
+
+// NewAuditLogHandler creates an AuditLogHandler.
+func NewAuditLogHandler(svc *service.AuditLogService) *AuditLogHandler {
+	return &AuditLogHandler{service: svc}
+}
+
+// ListEntries handles GET /api/v1/guilds/:id/audit-logs.
+func (h *AuditLogHandler) ListEntries(c echo.Context) error {
+	guildID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return Error(c, http.StatusBadRequest, "INVALID_ID", "invalid guild ID")
+	}
+
+	callerID := auth.GetUserID(c)
+
+	limit := 50
+	if l := c.QueryParam("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed < 1 || parsed > 100 {
+			return Error(c, http.StatusBadRequest, "INVALID_LIMIT", "limit must be 1-100")
+		}
+		limit = parsed
+	}
+
+	var userID *int64
+	if u := c.QueryParam("user_id"); u != "" {
+		parsed, err := strconv.ParseInt(u, 10, 64)
+		if err != nil {
+			return Error(c, http.StatusBadRequest, "INVALID_USER_ID", "invalid user_id")
+		}
+		userID = &parsed
+	}
+
+	var actionType *models.AuditLogAction
+	if a := c.QueryParam("action_type"); a != "" {
+		parsed, err := strconv.Atoi(a)
+		if err != nil {
+			return Error(c, http.StatusBadRequest, "INVALID_ACTION_TYPE", "invalid action_type")
+		}
+		action := models.AuditLogAction(parsed)
+		actionType = &action
+	}
+
+	var before *int64
+	if b := c.QueryParam("before"); b != "" {
+		parsed, err := strconv.ParseInt(b, 10, 64)
+		if err != nil {
+			return Error(c, http.StatusBadRequest, "INVALID_BEFORE", "invalid before")
+		}
+		before = &parsed
+	}
+
+	entries, err := h.service.ListEntries(c.Request().Context(), guildID, callerID, userID, actionType, before, limit)
+	if err != nil {
+		return mapServiceError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{"data": entries})
+}
@@ -0,0 +1,303 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/victorivanov/retrocast/internal/models"
+	"github.com/victorivanov/retrocast/internal/permissions"
+	"github.com/victorivanov/retrocast/internal/service"
+)
+
+// auditFixture wires guild 1, owned by user 100, with a recording audit log.
+// Members hold the permissions in perms[userID].
+type auditFixture struct {
+	guilds  *mockGuildRepo
+	members *mockMemberRepo
+	roles   *mockRoleRepo
+	entries *mockAuditLogRepo
+	created []models.AuditLogEntry
+}
+
+func newAuditFixture(perms map[int64]permissions.Permission) *auditFixture {
+	f := &auditFixture{
+		guilds: &mockGuildRepo{
+			GetByIDFn: func(_ context.Context, id int64) (*models.Guild, error) {
+				return &models.Guild{ID: id, OwnerID: 100}, nil
+			},
+		},
+		members: &mockMemberRepo{
+			GetByGuildAndUserFn: func(_ context.Context, guildID, userID int64) (*models.Member, error) {
+				return &models.Member{GuildID: guildID, UserID: userID, JoinedAt: time.Now()}, nil
+			},
+		},
+		roles: &mockRoleRepo{
+			GetByMemberFn: func(_ context.Context, _, userID int64) ([]models.Role, error) {
+				return []models.Role{{ID: 10, Position: 1, Permissions: int64(perms[userID])}}, nil
+			},
+			GetByGuildIDFn: func(_ context.Context, _ int64) ([]models.Role, error) {
+				return []models.Role{{ID: 1, Name: "@everyone", IsDefault: true}}, nil
+			},
+		},
+	}
+	f.entries = &mockAuditLogRepo{
+		CreateFn: func(_ context.Context, entry *models.AuditLogEntry) error {
+			f.created = append(f.created, *entry)
+			return nil
+		},
+	}
+	return f
+}
+
+func (f *auditFixture) perms() *service.PermissionChecker {
+	return service.NewPermissionChecker(f.guilds, f.members, f.roles, &mockChannelOverrideRepo{}, &mockChannelRepo{})
+}
+
+func (f *auditFixture) auditLog() *service.AuditLogService {
+	return service.NewAuditLogService(f.entries, testSnowflake(), f.perms())
+}
+
+// onlyEntry returns the single entry written so far.
+func (f *auditFixture) onlyEntry(t *testing.T) models.AuditLogEntry {
+	t.Helper()
+	if len(f.created) != 1 {
+		t.Fatalf("expected 1 audit log entry, got %d: %+v", len(f.created), f.created)
+	}
+	return f.created[0]
+}
+
+func TestBanMember_WritesAuditLogWithHeaderReason(t *testing.T) {
+	f := newAuditFixture(nil)
+	svc := service.NewBanService(f.guilds, f.members, f.roles, &mockBanRepo{}, &mockGateway{}, f.perms(), f.auditLog())
+	h := NewBanHandler(svc)
+
+	c, rec := newTestContext(http.MethodPut, "/api/v1/guilds/1/bans/200", strings.NewReader(`{"reason":"spam"}`))
+	c.Request().Header.Set(AuditLogReasonHeader, "repeated%20raids")
+	c.SetParamNames("id", "user_id")
+	c.SetParamValues("1", "200")
+	setAuthUser(c, 100)
+
+	if err := AuditLogReasonMiddleware(h.BanMember)(c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	entry := f.onlyEntry(t)
+	if entry.ActionType != models.AuditLogMemberBanAdd || entry.GuildID != 1 || entry.UserID != 100 {
+		t.Errorf("entry = %+v", entry)
+	}
+	if entry.TargetID == nil || *entry.TargetID != 200 {
+		t.Errorf("TargetID = %v, want 200", entry.TargetID)
+	}
+	if entry.Reason == nil || *entry.Reason != "repeated raids" {
+		t.Errorf("Reason = %v, want the decoded header", entry.Reason)
+	}
+}
+
+func TestBanMember_AuditLogFallsBackToBanReason(t *testing.T) {
+	f := newAuditFixture(nil)
+	svc := service.NewBanService(f.guilds, f.members, f.roles, &mockBanRepo{}, &mockGateway{}, f.perms(), f.auditLog())
+	h := NewBanHandler(svc)
+
+	c, _ := newTestContext(http.MethodPut, "/api/v1/guilds/1/bans/200", strings.NewReader(`{"reason":"spam"}`))
+	c.SetParamNames("id", "user_id")
+	c.SetParamValues("1", "200")
+	setAuthUser(c, 100)
+
+	if err := AuditLogReasonMiddleware(h.BanMember)(c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if entry := f.onlyEntry(t); entry.Reason == nil || *entry.Reason != "spam" {
+		t.Errorf("Reason = %v, want spam", entry.Reason)
+	}
+}
+
+func TestKickMember_WritesAuditLog(t *testing.T) {
+	f := newAuditFixture(map[int64]permissions.Permission{300: permissions.PermKickMembers})
+	svc := service.NewMemberService(f.members, f.guilds, f.roles, &mockGateway{}, f.perms(), f.auditLog(), nil)
+	h := NewMemberHandler(svc)
+
+	c, rec := newTestContext(http.MethodDelete, "/api/v1/guilds/1/members/200", nil)
+	c.SetParamNames("id", "user_id")
+	c.SetParamValues("1", "200")
+	setAuthUser(c, 300)
+
+	if err := h.KickMember(c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	entry := f.onlyEntry(t)
+	if entry.ActionType != models.AuditLogMemberKick || entry.UserID != 300 || *entry.TargetID != 200 {
+		t.Errorf("entry = %+v", entry)
+	}
+	if entry.Reason != nil {
+		t.Errorf("Reason = %q, want none", *entry.Reason)
+	}
+}
+
+func TestUpdateRole_AuditLogRecordsChangedFields(t *testing.T) {
+	f := newAuditFixture(nil)
+	f.roles.GetByIDFn = func(_ context.Context, id int64) (*models.Role, error) {
+		return &models.Role{ID: id, GuildID: 1, Name: "Mods", Color: 255, Permissions: 4, Position: 2}, nil
+	}
+	svc := service.NewRoleService(f.guilds, f.roles, f.members, &mockChannelRepo{}, &mockChannelOverrideRepo{}, testSnowflake(), &mockGateway{}, f.perms(), f.auditLog())
+	h := NewRoleHandler(svc)
+
+	c, rec := newTestContext(http.MethodPatch, "/api/v1/guilds/1/roles/50", strings.NewReader(`{"name":"Moderators","color":255,"permissions":"36"}`))
+	c.SetParamNames("id", "role_id")
+	c.SetParamValues("1", "50")
+	setAuthUser(c, 100)
+
+	if err := h.UpdateRole(c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	entry := f.onlyEntry(t)
+	if entry.ActionType != models.AuditLogRoleUpdate || *entry.TargetID != 50 {
+		t.Errorf("entry = %+v", entry)
+	}
+	want := []models.AuditLogChange{
+		{Key: "name", OldValue: "Mods", NewValue: "Moderators"},
+		{Key: "permissions", OldValue: "4", NewValue: "36"},
+	}
+	if len(entry.Changes) != len(want) {
+		t.Fatalf("Changes = %+v, want %+v", entry.Changes, want)
+	}
+	for i := range want {
+		if entry.Changes[i] != want[i] {
+			t.Errorf("Changes[%d] = %+v, want %+v", i, entry.Changes[i], want[i])
+		}
+	}
+}
+
+func TestSetChannelOverride_AuditLogCreateThenUpdate(t *testing.T) {
+	f := newAuditFixture(nil)
+	var stored []models.ChannelOverride
+	overrides := &mockChannelOverrideRepo{
+		SetFn: func(_ context.Context, o *models.ChannelOverride) error {
+			stored = []models.ChannelOverride{*o}
+			return nil
+		},
+		GetByChannelFn: func(_ context.Context, _ int64) ([]models.ChannelOverride, error) {
+			return stored, nil
+		},
+	}
+	channels := &mockChannelRepo{
+		GetByIDFn: func(_ context.Context, id int64) (*models.Channel, error) {
+			return &models.Channel{ID: id, GuildID: 1, Type: models.ChannelTypeText}, nil
+		},
+	}
+	f.roles.GetByIDFn = func(_ context.Context, id int64) (*models.Role, error) {
+		return &models.Role{ID: id, GuildID: 1}, nil
+	}
+	svc := service.NewRoleService(f.guilds, f.roles, f.members, channels, overrides, testSnowflake(), &mockGateway{}, f.perms(), f.auditLog())
+	h := NewRoleHandler(svc)
+
+	for _, body := range []string{`{"allow":"1","deny":"0"}`, `{"allow":"1","deny":"2"}`} {
+		c, rec := newTestContext(http.MethodPut, "/api/v1/channels/20/permissions/10", strings.NewReader(body))
+		c.SetParamNames("id", "target_id")
+		c.SetParamValues("20", "10")
+		setAuthUser(c, 100)
+		if err := h.SetChannelOverride(c); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	if len(f.created) != 2 {
+		t.Fatalf("expected 2 audit log entries, got %d", len(f.created))
+	}
+	if f.created[0].ActionType != models.AuditLogChannelOverwriteCreate || f.created[1].ActionType != models.AuditLogChannelOverwriteUpdate {
+		t.Errorf("actions = %d, %d; want create then update", f.created[0].ActionType, f.created[1].ActionType)
+	}
+	update := f.created[1]
+	if *update.TargetID != 20 || update.Options["id"] != "10" || update.Options["type"] != "0" {
+		t.Errorf("update entry = %+v", update)
+	}
+	if len(update.Changes) != 1 || update.Changes[0] != (models.AuditLogChange{Key: "deny", OldValue: "0", NewValue: "2"}) {
+		t.Errorf("update changes = %+v, want only deny", update.Changes)
+	}
+}
+
+func TestListAuditLog(t *testing.T) {
+	f := newAuditFixture(map[int64]permissions.Permission{
+		300: permissions.PermViewAuditLog,
+		400: permissions.PermManageGuild,
+		500: permissions.PermKickMembers,
+	})
+	var gotUserID *int64
+	var gotAction *models.AuditLogAction
+	var gotBefore *int64
+	var gotLimit int
+	f.entries.GetByGuildIDFn = func(_ context.Context, _ int64, userID *int64, actionType *models.AuditLogAction, before *int64, limit int) ([]models.AuditLogEntry, error) {
+		gotUserID, gotAction, gotBefore, gotLimit = userID, actionType, before, limit
+		return []models.AuditLogEntry{{ID: 1, GuildID: 1, UserID: 100, ActionType: models.AuditLogMemberKick}}, nil
+	}
+	h := NewAuditLogHandler(f.auditLog())
+
+	tests := []struct {
+		name     string
+		callerID int64
+		query    string
+		want     int
+	}{
+		{"owner", 100, "", http.StatusOK},
+		{"view audit log", 300, "", http.StatusOK},
+		{"manage guild", 400, "", http.StatusOK},
+		{"missing permission", 500, "", http.StatusForbidden},
+		{"invalid action type", 100, "?action_type=kick", http.StatusBadRequest},
+		{"invalid before", 100, "?before=x", http.StatusBadRequest},
+		{"invalid limit", 100, "?limit=500", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, rec := newTestContext(http.MethodGet, "/api/v1/guilds/1/audit-logs"+tt.query, nil)
+			c.SetParamNames("id")
+			c.SetParamValues("1")
+			setAuthUser(c, tt.callerID)
+
+			if err := h.ListEntries(c); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if rec.Code != tt.want {
+				t.Fatalf("expected %d, got %d: %s", tt.want, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	c, rec := newTestContext(http.MethodGet, "/api/v1/guilds/1/audit-logs?user_id=100&action_type=20&before=999&limit=10", nil)
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	setAuthUser(c, 300)
+	if err := h.ListEntries(c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotUserID == nil || *gotUserID != 100 || gotAction == nil || *gotAction != models.AuditLogMemberKick ||
+		gotBefore == nil || *gotBefore != 999 || gotLimit != 10 {
+		t.Errorf("filters = user %v, action %v, before %v, limit %d", gotUserID, gotAction, gotBefore, gotLimit)
+	}
+
+	var resp struct {
+		Data []models.AuditLogEntry `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(resp.Data) != 1 || resp.Data[0].ActionType != models.AuditLogMemberKick {
+		t.Errorf("data = %+v", resp.Data)
+	}
+}
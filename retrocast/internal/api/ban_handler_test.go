@@ -20,8 +20,8 @@ func newBanHandler(
 	bans *mockBanRepo,
 	gw *mockGateway,
 ) *BanHandler {
-	perms := service.NewPermissionChecker(guilds, members, roles, &mockChannelOverrideRepo{})
-	svc := service.NewBanService(guilds, members, roles, bans, gw, perms)
+	perms := service.NewPermissionChecker(guilds, members, roles, &mockChannelOverrideRepo{}, &mockChannelRepo{})
+	svc := service.NewBanService(guilds, members, roles, bans, gw, perms, service.NewAuditLogService(&mockAuditLogRepo{}, testSnowflake(), perms))
 	return NewBanHandler(svc)
 }
 
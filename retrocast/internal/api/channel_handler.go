@@ -21,10 +21,12 @@ func NewChannelHandler(svc *service.ChannelService) *ChannelHandler {
 }
 
 type createChannelRequest struct {
-	Name     string             `json:"name"`
-	Type     models.ChannelType `json:"type"`
-	Topic    *string            `json:"topic"`
-	ParentID *int64             `json:"parent_id,string"`
+	Name      string             `json:"name"`
+	Type      models.ChannelType `json:"type"`
+	Topic     *string            `json:"topic"`
+	ParentID  *int64             `json:"parent_id,string"`
+	Bitrate   *int               `json:"bitrate"`
+	UserLimit *int               `json:"user_limit"`
 }
 
 // CreateChannel handles POST /api/v1/guilds/:id/channels.
@@ -41,7 +43,7 @@ func (h *ChannelHandler) CreateChannel(c echo.Context) error {
 		return errorJSON(c, http.StatusBadRequest, "INVALID_BODY", "invalid request body")
 	}
 
-	ch, err := h.service.CreateChannel(c.Request().Context(), guildID, userID, req.Name, req.Type, req.Topic, req.ParentID)
+	ch, err := h.service.CreateChannel(c.Request().Context(), guildID, userID, req.Name, req.Type, req.Topic, req.ParentID, req.Bitrate, req.UserLimit)
 	if err != nil {
 		return mapServiceError(c, err)
 	}
@@ -84,9 +86,11 @@ func (h *ChannelHandler) GetChannel(c echo.Context) error {
 }
 
 type updateChannelRequest struct {
-	Name     *string `json:"name"`
-	Topic    *string `json:"topic"`
-	Position *int    `json:"position"`
+	Name      *string `json:"name"`
+	Topic     *string `json:"topic"`
+	Position  *int    `json:"position"`
+	Bitrate   *int    `json:"bitrate"`
+	UserLimit *int    `json:"user_limit"`
 }
 
 // UpdateChannel handles PATCH /api/v1/channels/:id.
@@ -103,7 +107,7 @@ func (h *ChannelHandler) UpdateChannel(c echo.Context) error {
 		return errorJSON(c, http.StatusBadRequest, "INVALID_BODY", "invalid request body")
 	}
 
-	ch, err := h.service.UpdateChannel(c.Request().Context(), channelID, userID, req.Name, req.Topic, req.Position)
+	ch, err := h.service.UpdateChannel(c.Request().Context(), channelID, userID, req.Name, req.Topic, req.Position, req.Bitrate, req.UserLimit)
 	if err != nil {
 		return mapServiceError(c, err)
 	}
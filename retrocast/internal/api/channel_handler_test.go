@@ -7,6 +7,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/victorivanov/retrocast/internal/gateway"
 	"github.com/victorivanov/retrocast/internal/models"
 	"github.com/victorivanov/retrocast/internal/permissions"
 	"github.com/victorivanov/retrocast/internal/service"
@@ -23,8 +24,8 @@ func newTestChannelHandler(
 ) *ChannelHandler {
 	gw := &mockGateway{}
 	sf := testSnowflake()
-	perms := service.NewPermissionChecker(guilds, members, roles, overrides)
-	svc := service.NewChannelService(channels, members, sf, gw, perms)
+	perms := service.NewPermissionChecker(guilds, members, roles, overrides, &mockChannelRepo{})
+	svc := service.NewChannelService(channels, members, sf, gw, perms, service.NewAuditLogService(&mockAuditLogRepo{}, sf, perms))
 	return NewChannelHandler(svc)
 }
 
@@ -259,6 +260,111 @@ func TestUpdateChannel_WithPermission(t *testing.T) {
 	}
 }
 
+func TestCreateChannel_VoiceSettings(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		wantStatus    int
+		wantBitrate   int
+		wantUserLimit int
+	}{
+		{"voice defaults", `{"name":"voice","type":2}`, http.StatusCreated, 64000, 0},
+		{"pairing room", `{"name":"pair","type":2,"bitrate":96000,"user_limit":2}`, http.StatusCreated, 96000, 2},
+		{"stage", `{"name":"demo-day","type":13,"user_limit":50}`, http.StatusCreated, 64000, 50},
+		{"bitrate too low", `{"name":"voice","type":2,"bitrate":1000}`, http.StatusBadRequest, 0, 0},
+		{"user limit too high", `{"name":"voice","type":2,"user_limit":100}`, http.StatusBadRequest, 0, 0},
+		{"negative user limit", `{"name":"voice","type":2,"user_limit":-1}`, http.StatusBadRequest, 0, 0},
+		{"text channel", `{"name":"text","type":0,"user_limit":2}`, http.StatusBadRequest, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var created *models.Channel
+			channels := &mockChannelRepo{
+				GetByGuildIDFn: func(_ context.Context, _ int64) ([]models.Channel, error) {
+					return []models.Channel{}, nil
+				},
+				CreateFn: func(_ context.Context, ch *models.Channel) error {
+					created = ch
+					return nil
+				},
+			}
+			h := allowAllChannelHandler(channels, &mockMemberRepo{})
+
+			c, rec := newTestContext(http.MethodPost, "/api/v1/guilds/500/channels", strings.NewReader(tt.body))
+			c.SetParamNames("id")
+			c.SetParamValues("500")
+			setAuthUser(c, 1000)
+
+			if err := h.CreateChannel(c); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusCreated {
+				if created != nil {
+					t.Error("expected no channel to be created")
+				}
+				return
+			}
+			if created.Bitrate != tt.wantBitrate || created.UserLimit != tt.wantUserLimit {
+				t.Errorf("expected bitrate %d and user limit %d, got %d and %d", tt.wantBitrate, tt.wantUserLimit, created.Bitrate, created.UserLimit)
+			}
+		})
+	}
+}
+
+func TestUpdateChannel_VoiceSettings(t *testing.T) {
+	tests := []struct {
+		name          string
+		chType        models.ChannelType
+		body          string
+		wantStatus    int
+		wantUserLimit int
+	}{
+		{"set user limit", models.ChannelTypeVoice, `{"user_limit":2}`, http.StatusOK, 2},
+		{"remove user limit", models.ChannelTypeVoice, `{"user_limit":0}`, http.StatusOK, 0},
+		{"bitrate too high", models.ChannelTypeVoice, `{"bitrate":128000}`, http.StatusBadRequest, 0},
+		{"text channel", models.ChannelTypeText, `{"bitrate":64000}`, http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var updated *models.Channel
+			channels := &mockChannelRepo{
+				GetByIDFn: func(_ context.Context, id int64) (*models.Channel, error) {
+					return &models.Channel{ID: id, GuildID: 500, Name: "room", Type: tt.chType, Bitrate: 64000, UserLimit: 5}, nil
+				},
+				UpdateFn: func(_ context.Context, ch *models.Channel) error {
+					updated = ch
+					return nil
+				},
+			}
+			h := allowAllChannelHandler(channels, &mockMemberRepo{})
+
+			c, rec := newTestContext(http.MethodPatch, "/api/v1/channels/100", strings.NewReader(tt.body))
+			c.SetParamNames("id")
+			c.SetParamValues("100")
+			setAuthUser(c, 1000)
+
+			if err := h.UpdateChannel(c); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				if updated != nil {
+					t.Error("expected the channel not to be updated")
+				}
+				return
+			}
+			if updated.UserLimit != tt.wantUserLimit || updated.Bitrate != 64000 {
+				t.Errorf("expected user limit %d at bitrate 64000, got %d at %d", tt.wantUserLimit, updated.UserLimit, updated.Bitrate)
+			}
+		})
+	}
+}
+
 func TestDeleteChannel_WithPermission(t *testing.T) {
 	const channelID int64 = 100
 	const guildID int64 = 500
@@ -295,3 +401,99 @@ func TestDeleteChannel_WithPermission(t *testing.T) {
 		t.Error("expected channel delete to be called")
 	}
 }
+
+func TestDeleteChannel_PrivateChannelNotifiesViewersOnly(t *testing.T) {
+	const channelID int64 = 100
+	const guildID int64 = 500
+	const everyoneRoleID int64 = 1
+	const staffRoleID int64 = 2
+	const staffID int64 = 2001
+	const memberID int64 = 2002
+
+	deleted := false
+	channels := &mockChannelRepo{
+		GetByIDFn: func(_ context.Context, id int64) (*models.Channel, error) {
+			if id == channelID && !deleted {
+				return &models.Channel{ID: channelID, GuildID: guildID, Name: "staff"}, nil
+			}
+			return nil, nil
+		},
+		DeleteFn: func(_ context.Context, _ int64) error {
+			deleted = true
+			return nil
+		},
+	}
+	guilds := &mockGuildRepo{
+		GetByIDFn: func(_ context.Context, id int64) (*models.Guild, error) {
+			return &models.Guild{ID: id, OwnerID: 1000}, nil
+		},
+	}
+	members := &mockMemberRepo{
+		GetByGuildAndUserFn: func(_ context.Context, gID, uID int64) (*models.Member, error) {
+			return &models.Member{GuildID: gID, UserID: uID}, nil
+		},
+		GetUserIDsByGuildFn: func(_ context.Context, _ int64) ([]int64, error) {
+			return []int64{1000, staffID, memberID}, nil
+		},
+	}
+	roles := &mockRoleRepo{
+		GetByGuildIDFn: func(_ context.Context, _ int64) ([]models.Role, error) {
+			return []models.Role{
+				{ID: everyoneRoleID, IsDefault: true, Permissions: int64(permissions.PermViewChannel)},
+				{ID: staffRoleID},
+			}, nil
+		},
+		GetByMemberFn: func(_ context.Context, _, userID int64) ([]models.Role, error) {
+			if userID == staffID {
+				return []models.Role{{ID: staffRoleID}}, nil
+			}
+			return nil, nil
+		},
+	}
+	overrides := &mockChannelOverrideRepo{
+		GetByChannelFn: func(_ context.Context, id int64) ([]models.ChannelOverride, error) {
+			if deleted {
+				return nil, nil
+			}
+			return []models.ChannelOverride{
+				{ChannelID: id, TargetID: everyoneRoleID, Type: models.OverrideTypeRole, Deny: int64(permissions.PermViewChannel)},
+				{ChannelID: id, TargetID: staffRoleID, Type: models.OverrideTypeRole, Allow: int64(permissions.PermViewChannel)},
+			}, nil
+		},
+	}
+
+	gw := &mockGateway{}
+	sf := testSnowflake()
+	perms := service.NewPermissionChecker(guilds, members, roles, overrides, channels)
+	svc := service.NewChannelService(channels, members, sf, gw, perms, service.NewAuditLogService(&mockAuditLogRepo{}, sf, perms))
+	h := NewChannelHandler(svc)
+
+	c, rec := newTestContext(http.MethodDelete, "/api/v1/channels/100", nil)
+	c.SetParamNames("id")
+	c.SetParamValues("100")
+	setAuthUser(c, 1000)
+
+	if err := h.DeleteChannel(c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusNoContent, rec.Code, rec.Body.String())
+	}
+
+	var deletes []dispatchedEvent
+	for _, ev := range gw.events {
+		if ev.Event == gateway.EventChannelDelete {
+			deletes = append(deletes, ev)
+		}
+	}
+	if len(deletes) != 1 || deletes[0].GuildID != guildID || deletes[0].UserIDs == nil {
+		t.Fatalf("CHANNEL_DELETE dispatches = %+v, want one to the channel's viewers in guild %d", deletes, guildID)
+	}
+	notified := map[int64]bool{}
+	for _, userID := range deletes[0].UserIDs {
+		notified[userID] = true
+	}
+	if len(notified) != 2 || !notified[1000] || !notified[staffID] {
+		t.Errorf("CHANNEL_DELETE sent to %v, want owner and staff only", deletes[0].UserIDs)
+	}
+}
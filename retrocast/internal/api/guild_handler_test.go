@@ -21,8 +21,8 @@ func newTestGuildHandler(
 ) *GuildHandler {
 	gw := &mockGateway{}
 	sf := testSnowflake()
-	perms := service.NewPermissionChecker(guilds, members, roles, &mockChannelOverrideRepo{})
-	svc := service.NewGuildService(guilds, channels, members, roles, sf, gw, perms)
+	perms := service.NewPermissionChecker(guilds, members, roles, &mockChannelOverrideRepo{}, &mockChannelRepo{})
+	svc := service.NewGuildService(guilds, channels, members, roles, sf, gw, perms, service.NewAuditLogService(&mockAuditLogRepo{}, sf, perms))
 	return NewGuildHandler(svc)
 }
 
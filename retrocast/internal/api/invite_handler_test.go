@@ -8,6 +8,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/victorivanov/retrocast/internal/gateway"
 	"github.com/victorivanov/retrocast/internal/models"
 	"github.com/victorivanov/retrocast/internal/service"
 )
@@ -20,7 +21,7 @@ func newInviteHandler(
 	bans *mockBanRepo,
 	gw *mockGateway,
 ) *InviteHandler {
-	perms := service.NewPermissionChecker(guilds, members, roles, &mockChannelOverrideRepo{})
+	perms := service.NewPermissionChecker(guilds, members, roles, &mockChannelOverrideRepo{}, &mockChannelRepo{})
 	svc := service.NewInviteService(invites, guilds, members, bans, gw, perms)
 	return NewInviteHandler(svc)
 }
@@ -212,6 +213,16 @@ func TestAcceptInvite_Success(t *testing.T) {
 	if !usesIncremented {
 		t.Error("expected uses to be incremented")
 	}
+
+	var joined bool
+	for _, ev := range gw.events {
+		if ev.Event == gateway.EventGuildCreate && ev.UserID == 200 && ev.GuildID == 1 {
+			joined = true
+		}
+	}
+	if !joined {
+		t.Error("expected the new member to be joined to the guild on the gateway")
+	}
 }
 
 func TestAcceptInvite_AlreadyMember(t *testing.T) {
@@ -19,8 +19,8 @@ func newMemberHandler(
 	roles *mockRoleRepo,
 	gw *mockGateway,
 ) *MemberHandler {
-	perms := service.NewPermissionChecker(guilds, members, roles, &mockChannelOverrideRepo{})
-	svc := service.NewMemberService(members, guilds, roles, gw, perms)
+	perms := service.NewPermissionChecker(guilds, members, roles, &mockChannelOverrideRepo{}, &mockChannelRepo{})
+	svc := service.NewMemberService(members, guilds, roles, gw, perms, service.NewAuditLogService(&mockAuditLogRepo{}, testSnowflake(), perms), nil)
 	return NewMemberHandler(svc)
 }
 
@@ -80,6 +80,48 @@ func TestListMembers_AsMember(t *testing.T) {
 	}
 }
 
+func TestListMembers_IncludesPresences(t *testing.T) {
+	members := &mockMemberRepo{
+		GetByGuildAndUserFn: func(ctx context.Context, guildID, userID int64) (*models.Member, error) {
+			return &models.Member{GuildID: guildID, UserID: userID}, nil
+		},
+		GetByGuildIDFn: func(ctx context.Context, guildID int64, limit, offset int) ([]models.Member, error) {
+			return []models.Member{{GuildID: 1, UserID: 100}, {GuildID: 1, UserID: 200}}, nil
+		},
+	}
+	guilds := &mockGuildRepo{}
+	roles := &mockRoleRepo{}
+	perms := service.NewPermissionChecker(guilds, members, roles, &mockChannelOverrideRepo{}, &mockChannelRepo{})
+	presences := mockPresences{200: {Status: "idle", CustomStatus: &models.CustomStatus{Text: "brb"}}}
+	svc := service.NewMemberService(members, guilds, roles, &mockGateway{}, perms, service.NewAuditLogService(&mockAuditLogRepo{}, testSnowflake(), perms), presences)
+	h := NewMemberHandler(svc)
+
+	c, rec := newTestContext(http.MethodGet, "/api/v1/guilds/1/members", nil)
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	setAuthUser(c, 100)
+
+	if err := h.ListMembers(c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var resp struct {
+		Data []models.Member `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+	if len(resp.Data) != 2 {
+		t.Fatalf("expected 2 members, got %d", len(resp.Data))
+	}
+	if resp.Data[0].Presence != nil {
+		t.Errorf("member 100 has presence %+v, want none", resp.Data[0].Presence)
+	}
+	if p := resp.Data[1].Presence; p == nil || p.Status != "idle" || p.CustomStatus == nil || p.CustomStatus.Text != "brb" {
+		t.Errorf("member 200 presence = %+v, want idle with custom status 'brb'", p)
+	}
+}
+
 func TestListMembers_NotMember(t *testing.T) {
 	gw := &mockGateway{}
 	members := &mockMemberRepo{
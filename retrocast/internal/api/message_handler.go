@@ -6,6 +6,7 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"github.com/victorivanov/retrocast/internal/auth"
+	"github.com/victorivanov/retrocast/internal/models"
 	"github.com/victorivanov/retrocast/internal/service"
 )
 
@@ -20,7 +21,9 @@ func NewMessageHandler(svc *service.MessageService) *MessageHandler {
 }
 
 type sendMessageRequest struct {
-	Content string `json:"content"`
+	Content          string                   `json:"content"`
+	AttachmentIDs    []string                 `json:"attachment_ids"`
+	MessageReference *models.MessageReference `json:"message_reference"`
 }
 
 // SendMessage handles POST /api/v1/channels/:id/messages.
@@ -37,7 +40,7 @@ func (h *MessageHandler) SendMessage(c echo.Context) error {
 		return Error(c, http.StatusBadRequest, "INVALID_BODY", "invalid request body")
 	}
 
-	full, err := h.service.SendMessage(c.Request().Context(), channelID, userID, req.Content)
+	full, err := h.service.SendMessage(c.Request().Context(), channelID, userID, req.Content, req.AttachmentIDs, req.MessageReference)
 	if err != nil {
 		return mapServiceError(c, err)
 	}
@@ -153,3 +156,62 @@ func (h *MessageHandler) DeleteMessage(c echo.Context) error {
 
 	return c.NoContent(http.StatusNoContent)
 }
+
+// GetPinnedMessages handles GET /api/v1/channels/:id/pins.
+func (h *MessageHandler) GetPinnedMessages(c echo.Context) error {
+	channelID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return Error(c, http.StatusBadRequest, "INVALID_ID", "invalid channel ID")
+	}
+
+	userID := auth.GetUserID(c)
+
+	messages, err := h.service.GetPinnedMessages(c.Request().Context(), channelID, userID)
+	if err != nil {
+		return mapServiceError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, messages)
+}
+
+// PinMessage handles PUT /api/v1/channels/:id/pins/:message_id.
+func (h *MessageHandler) PinMessage(c echo.Context) error {
+	channelID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return Error(c, http.StatusBadRequest, "INVALID_ID", "invalid channel ID")
+	}
+
+	msgID, err := strconv.ParseInt(c.Param("message_id"), 10, 64)
+	if err != nil {
+		return Error(c, http.StatusBadRequest, "INVALID_ID", "invalid message ID")
+	}
+
+	userID := auth.GetUserID(c)
+
+	if err := h.service.PinMessage(c.Request().Context(), channelID, msgID, userID); err != nil {
+		return mapServiceError(c, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// UnpinMessage handles DELETE /api/v1/channels/:id/pins/:message_id.
+func (h *MessageHandler) UnpinMessage(c echo.Context) error {
+	channelID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return Error(c, http.StatusBadRequest, "INVALID_ID", "invalid channel ID")
+	}
+
+	msgID, err := strconv.ParseInt(c.Param("message_id"), 10, 64)
+	if err != nil {
+		return Error(c, http.StatusBadRequest, "INVALID_ID", "invalid message ID")
+	}
+
+	userID := auth.GetUserID(c)
+
+	if err := h.service.UnpinMessage(c.Request().Context(), channelID, msgID, userID); err != nil {
+		return mapServiceError(c, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -4,10 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/labstack/echo/v4"
+	"github.com/victorivanov/retrocast/internal/database"
 	"github.com/victorivanov/retrocast/internal/gateway"
 	"github.com/victorivanov/retrocast/internal/models"
 	"github.com/victorivanov/retrocast/internal/permissions"
@@ -37,8 +40,40 @@ func newMessageHandler(
 	overrides *mockChannelOverrideRepo,
 	gw *mockGateway,
 ) *MessageHandler {
-	perms := service.NewPermissionChecker(guilds, mems, roles, overrides)
-	svc := service.NewMessageService(msgs, chs, &mockDMChannelRepo{}, testSnowflake(), gw, perms)
+	return newMessageHandlerWithAttachments(msgs, &mockAttachmentRepo{}, chs, mems, roles, guilds, overrides, gw)
+}
+
+// newMessageHandlerWithAttachments is newMessageHandler with a caller-supplied attachment repo.
+func newMessageHandlerWithAttachments(
+	msgs *mockMessageRepo,
+	att *mockAttachmentRepo,
+	chs *mockChannelRepo,
+	mems *mockMemberRepo,
+	roles *mockRoleRepo,
+	guilds *mockGuildRepo,
+	overrides *mockChannelOverrideRepo,
+	gw *mockGateway,
+) *MessageHandler {
+	perms := service.NewPermissionChecker(guilds, mems, roles, overrides, chs)
+	svc := service.NewMessageService(msgs, att, chs, &mockDMChannelRepo{}, mems, roles, &mockReadStateRepo{}, testSnowflake(), &mockStorage{}, gw, perms, nil)
+	return NewMessageHandler(svc)
+}
+
+// newMessageHandlerWithMentions is newMessageHandler with caller-supplied
+// read state and presence dependencies, for mention tests.
+func newMessageHandlerWithMentions(
+	msgs *mockMessageRepo,
+	chs *mockChannelRepo,
+	mems *mockMemberRepo,
+	roles *mockRoleRepo,
+	guilds *mockGuildRepo,
+	overrides *mockChannelOverrideRepo,
+	readStates *mockReadStateRepo,
+	presence service.PresenceReader,
+	gw *mockGateway,
+) *MessageHandler {
+	perms := service.NewPermissionChecker(guilds, mems, roles, overrides, chs)
+	svc := service.NewMessageService(msgs, &mockAttachmentRepo{}, chs, &mockDMChannelRepo{}, mems, roles, readStates, testSnowflake(), &mockStorage{}, gw, perms, presence)
 	return NewMessageHandler(svc)
 }
 
@@ -118,7 +153,7 @@ func TestSendMessage_Success(t *testing.T) {
 	if rec.Code != http.StatusCreated {
 		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
 	}
-	if len(gw.events) != 1 || gw.events[0].Event != gateway.EventMessageCreate {
+	if len(gw.events) != 1 || gw.events[0].Event != gateway.EventMessageCreate || gw.events[0].ChannelID != testChannelID {
 		t.Fatalf("expected MESSAGE_CREATE event, got %+v", gw.events)
 	}
 }
@@ -189,7 +224,7 @@ func TestSendMessage_ChannelOverrideDeny(t *testing.T) {
 
 	overrides.GetByChannelFn = func(_ context.Context, _ int64) ([]models.ChannelOverride, error) {
 		return []models.ChannelOverride{
-			{ChannelID: testChannelID, RoleID: testRoleID, Allow: 0, Deny: int64(permissions.PermSendMessages)},
+			{ChannelID: testChannelID, TargetID: testRoleID, Allow: 0, Deny: int64(permissions.PermSendMessages)},
 		}, nil
 	}
 
@@ -210,13 +245,39 @@ func TestSendMessage_ChannelOverrideDeny(t *testing.T) {
 	}
 }
 
+func TestSendMessage_MemberOverrideDeny(t *testing.T) {
+	// The @everyone override allows SendMessages, but the caller's own
+	// override denies it; another member's override must not matter.
+	guilds, members, roles, overrides := permMocks(permissions.PermViewChannel)
+
+	overrides.GetByChannelFn = func(_ context.Context, _ int64) ([]models.ChannelOverride, error) {
+		return []models.ChannelOverride{
+			{ChannelID: testChannelID, TargetID: testRoleID, Allow: int64(permissions.PermSendMessages)},
+			{ChannelID: testChannelID, TargetID: testUserID, Type: models.OverrideTypeMember, Deny: int64(permissions.PermSendMessages)},
+			{ChannelID: testChannelID, TargetID: 3001, Type: models.OverrideTypeMember, Allow: int64(permissions.PermSendMessages)},
+		}, nil
+	}
+
+	h := newMessageHandler(&mockMessageRepo{}, channelMock(), members, roles, guilds, overrides, &mockGateway{})
+
+	c, rec := newTestContext(http.MethodPost, "/api/v1/channels/2000/messages", strings.NewReader(`{"content":"hello"}`))
+	c.SetParamNames("id")
+	c.SetParamValues("2000")
+	setAuthUser(c, testUserID)
+
+	_ = h.SendMessage(c)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 (member override deny), got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
 func TestSendMessage_ChannelOverrideAllow(t *testing.T) {
 	// @everyone role does NOT have SendMessages at guild level, but channel override allows it.
 	guilds, members, roles, overrides := permMocks(permissions.PermViewChannel) // no SendMessages in base
 
 	overrides.GetByChannelFn = func(_ context.Context, _ int64) ([]models.ChannelOverride, error) {
 		return []models.ChannelOverride{
-			{ChannelID: testChannelID, RoleID: testRoleID, Allow: int64(permissions.PermSendMessages), Deny: 0},
+			{ChannelID: testChannelID, TargetID: testRoleID, Allow: int64(permissions.PermSendMessages), Deny: 0},
 		}, nil
 	}
 
@@ -251,6 +312,476 @@ func TestSendMessage_ChannelOverrideAllow(t *testing.T) {
 	}
 }
 
+func TestSendMessage_WithAttachments(t *testing.T) {
+	guilds, members, roles, overrides := permMocks(permissions.PermSendMessages | permissions.PermAttachFiles | permissions.PermViewChannel)
+	channels := channelMock()
+	gw := &mockGateway{}
+
+	var claimed []int64
+	msgs := &mockMessageRepo{
+		CreateFn: func(_ context.Context, _ *models.Message) error {
+			t.Fatal("Create should not be called when attachments are supplied")
+			return nil
+		},
+		CreateWithAttachmentsFn: func(_ context.Context, msg *models.Message, ids []int64) error {
+			claimed = ids
+			return nil
+		},
+		GetByIDFn: func(_ context.Context, id int64) (*models.MessageWithAuthor, error) {
+			return &models.MessageWithAuthor{
+				Message: models.Message{ID: id, ChannelID: testChannelID, AuthorID: testUserID, CreatedAt: time.Now()},
+			}, nil
+		},
+	}
+	att := &mockAttachmentRepo{
+		GetByMessageIDsFn: func(_ context.Context, ids []int64) ([]models.Attachment, error) {
+			return []models.Attachment{
+				{ID: 7001, MessageID: ids[0], Filename: "a.png", StorageKey: "attachments/2000/7001/a.png"},
+				{ID: 7002, MessageID: ids[0], Filename: "b.png", StorageKey: "attachments/2000/7002/b.png"},
+			}, nil
+		},
+	}
+
+	h := newMessageHandlerWithAttachments(msgs, att, channels, members, roles, guilds, overrides, gw)
+
+	// Content may be empty when the message carries attachments.
+	c, rec := newTestContext(http.MethodPost, "/api/v1/channels/2000/messages",
+		strings.NewReader(`{"content":"","attachment_ids":["7001","7002"]}`))
+	c.SetParamNames("id")
+	c.SetParamValues("2000")
+	setAuthUser(c, testUserID)
+
+	if err := h.SendMessage(c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if len(claimed) != 2 || claimed[0] != 7001 || claimed[1] != 7002 {
+		t.Fatalf("claimed attachments = %v, want [7001 7002]", claimed)
+	}
+
+	var result models.MessageWithAuthor
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if len(result.Attachments) != 2 {
+		t.Fatalf("expected 2 attachments, got %d", len(result.Attachments))
+	}
+	if result.Attachments[0].URL == "" {
+		t.Error("expected attachment URL to be populated")
+	}
+
+	if len(gw.events) != 1 || gw.events[0].Event != gateway.EventMessageCreate {
+		t.Fatalf("expected MESSAGE_CREATE event, got %+v", gw.events)
+	}
+	dispatched, ok := gw.events[0].Data.(*models.MessageWithAuthor)
+	if !ok || len(dispatched.Attachments) != 2 {
+		t.Fatalf("MESSAGE_CREATE should carry 2 attachments, got %+v", gw.events[0].Data)
+	}
+}
+
+func TestSendMessage_AttachmentsUnavailable(t *testing.T) {
+	guilds, members, roles, overrides := permMocks(permissions.PermSendMessages | permissions.PermAttachFiles | permissions.PermViewChannel)
+	channels := channelMock()
+	gw := &mockGateway{}
+	msgs := &mockMessageRepo{
+		CreateWithAttachmentsFn: func(_ context.Context, _ *models.Message, _ []int64) error {
+			return database.ErrAttachmentsUnavailable
+		},
+	}
+
+	h := newMessageHandler(msgs, channels, members, roles, guilds, overrides, gw)
+
+	c, rec := newTestContext(http.MethodPost, "/api/v1/channels/2000/messages",
+		strings.NewReader(`{"content":"look","attachment_ids":["7001"]}`))
+	c.SetParamNames("id")
+	c.SetParamValues("2000")
+	setAuthUser(c, testUserID)
+
+	_ = h.SendMessage(c)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), "INVALID_ATTACHMENTS") {
+		t.Errorf("expected INVALID_ATTACHMENTS error, got %s", rec.Body.String())
+	}
+	if len(gw.events) != 0 {
+		t.Errorf("expected no events, got %d", len(gw.events))
+	}
+}
+
+func TestSendMessage_AttachmentsRequireAttachFiles(t *testing.T) {
+	guilds, members, roles, overrides := permMocks(permissions.PermSendMessages | permissions.PermViewChannel)
+	channels := channelMock()
+	gw := &mockGateway{}
+	msgs := &mockMessageRepo{}
+
+	h := newMessageHandler(msgs, channels, members, roles, guilds, overrides, gw)
+
+	c, rec := newTestContext(http.MethodPost, "/api/v1/channels/2000/messages",
+		strings.NewReader(`{"content":"look","attachment_ids":["7001"]}`))
+	c.SetParamNames("id")
+	c.SetParamValues("2000")
+	setAuthUser(c, testUserID)
+
+	_ = h.SendMessage(c)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestSendMessage_DuplicateAttachmentIDs(t *testing.T) {
+	guilds, members, roles, overrides := permMocks(permissions.PermSendMessages | permissions.PermAttachFiles | permissions.PermViewChannel)
+	channels := channelMock()
+	gw := &mockGateway{}
+	msgs := &mockMessageRepo{}
+
+	h := newMessageHandler(msgs, channels, members, roles, guilds, overrides, gw)
+
+	c, rec := newTestContext(http.MethodPost, "/api/v1/channels/2000/messages",
+		strings.NewReader(`{"attachment_ids":["7001","7001"]}`))
+	c.SetParamNames("id")
+	c.SetParamValues("2000")
+	setAuthUser(c, testUserID)
+
+	_ = h.SendMessage(c)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Mention tests
+// ---------------------------------------------------------------------------
+
+// mockPresence implements service.PresenceReader from a fixed status map.
+type mockPresence map[int64]string
+
+func (p mockPresence) GetStatuses(_ context.Context, userIDs []int64) (map[int64]string, error) {
+	statuses := make(map[int64]string)
+	for _, id := range userIDs {
+		if status, ok := p[id]; ok {
+			statuses[id] = status
+		}
+	}
+	return statuses, nil
+}
+
+// mentionFixture wires a message handler whose repos record the created
+// message and every mention count increment.
+type mentionFixture struct {
+	h         *MessageHandler
+	gw        *mockGateway
+	msgs      *mockMessageRepo
+	members   *mockMemberRepo
+	roles     *mockRoleRepo
+	overrides *mockChannelOverrideRepo
+	created   *models.Message
+	mentioned []int64
+}
+
+func newMentionFixture(t *testing.T, everyonePerms permissions.Permission, presence service.PresenceReader) *mentionFixture {
+	t.Helper()
+	f := &mentionFixture{gw: &mockGateway{}}
+	guilds, members, roles, overrides := permMocks(everyonePerms)
+	f.members, f.roles, f.overrides = members, roles, overrides
+
+	msgs := &mockMessageRepo{
+		CreateFn: func(_ context.Context, msg *models.Message) error {
+			f.created = msg
+			return nil
+		},
+		GetByIDFn: func(_ context.Context, _ int64) (*models.MessageWithAuthor, error) {
+			return &models.MessageWithAuthor{Message: *f.created}, nil
+		},
+	}
+	f.msgs = msgs
+	readStates := &mockReadStateRepo{
+		IncrementMentionCountsFn: func(_ context.Context, channelID int64, userIDs []int64) error {
+			if channelID != testChannelID {
+				t.Errorf("mention counted in channel %d, want %d", channelID, testChannelID)
+			}
+			if f.mentioned != nil {
+				t.Error("mention counts incremented more than once for a message")
+			}
+			f.mentioned = userIDs
+			return nil
+		},
+	}
+
+	f.h = newMessageHandlerWithMentions(msgs, channelMock(), members, roles, guilds, overrides, readStates, presence, f.gw)
+	return f
+}
+
+func (f *mentionFixture) send(t *testing.T, content string) {
+	t.Helper()
+	body, _ := json.Marshal(map[string]string{"content": content})
+	c, rec := newTestContext(http.MethodPost, "/api/v1/channels/2000/messages", strings.NewReader(string(body)))
+	c.SetParamNames("id")
+	c.SetParamValues("2000")
+	setAuthUser(c, testUserID)
+
+	if err := f.h.SendMessage(c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func sameIDs(got, want []int64) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	seen := make(map[int64]bool, len(got))
+	for _, id := range got {
+		seen[id] = true
+	}
+	for _, id := range want {
+		if !seen[id] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSendMessage_UserMentions(t *testing.T) {
+	f := newMentionFixture(t, permissions.PermSendMessages|permissions.PermViewChannel, nil)
+	// User 3002 is not a member of the guild.
+	f.members.GetByGuildAndUserFn = func(_ context.Context, guildID, userID int64) (*models.Member, error) {
+		if userID == 3002 {
+			return nil, nil
+		}
+		return &models.Member{GuildID: guildID, UserID: userID}, nil
+	}
+
+	f.send(t, "hey <@3001>, <@!3001> and <@3002>, also me <@3000>")
+
+	if !sameIDs(f.created.Mentions, []int64{3001, testUserID}) {
+		t.Errorf("mentions = %v, want [3001 3000]", f.created.Mentions)
+	}
+	if !sameIDs(f.mentioned, []int64{3001}) {
+		t.Errorf("mention counts incremented for %v, want [3001]", f.mentioned)
+	}
+
+	dispatched, ok := f.gw.events[0].Data.(*models.MessageWithAuthor)
+	if !ok || !sameIDs(dispatched.Mentions, f.created.Mentions) {
+		t.Fatalf("MESSAGE_CREATE should carry mentions, got %+v", f.gw.events[0].Data)
+	}
+}
+
+func TestSendMessage_MentionSkipsUsersWhoCannotViewChannel(t *testing.T) {
+	f := newMentionFixture(t, permissions.PermSendMessages|permissions.PermViewChannel, nil)
+	const hiddenRoleID int64 = 6001
+	f.roles.GetByMemberFn = func(_ context.Context, _, userID int64) ([]models.Role, error) {
+		if userID == 3001 {
+			return []models.Role{{ID: hiddenRoleID, GuildID: testGuildID}}, nil
+		}
+		return nil, nil
+	}
+	f.overrides.GetByChannelFn = func(_ context.Context, _ int64) ([]models.ChannelOverride, error) {
+		return []models.ChannelOverride{{ChannelID: testChannelID, TargetID: hiddenRoleID, Deny: int64(permissions.PermViewChannel)}}, nil
+	}
+
+	f.send(t, "<@3001> <@3003>")
+
+	if !sameIDs(f.mentioned, []int64{3003}) {
+		t.Errorf("mention counts incremented for %v, want [3003]", f.mentioned)
+	}
+}
+
+func TestSendMessage_EveryoneRequiresMentionEveryone(t *testing.T) {
+	f := newMentionFixture(t, permissions.PermSendMessages|permissions.PermViewChannel, nil)
+	f.members.GetUserIDsByGuildFn = func(_ context.Context, _ int64) ([]int64, error) {
+		t.Fatal("guild members should not be expanded without MENTION_EVERYONE")
+		return nil, nil
+	}
+
+	f.send(t, "@everyone look")
+
+	if f.created.MentionEveryone {
+		t.Error("mention_everyone should be false without MENTION_EVERYONE")
+	}
+	if len(f.mentioned) != 0 {
+		t.Errorf("mention counts incremented for %v, want none", f.mentioned)
+	}
+}
+
+func TestSendMessage_EveryoneNotifiesAllMembers(t *testing.T) {
+	f := newMentionFixture(t, permissions.PermSendMessages|permissions.PermViewChannel|permissions.PermMentionEveryone, nil)
+	f.members.GetUserIDsByGuildFn = func(_ context.Context, _ int64) ([]int64, error) {
+		return []int64{testUserID, 3001, 3002}, nil
+	}
+
+	f.send(t, "@everyone look")
+
+	if !f.created.MentionEveryone {
+		t.Error("mention_everyone should be true")
+	}
+	if !sameIDs(f.mentioned, []int64{3001, 3002}) {
+		t.Errorf("mention counts incremented for %v, want [3001 3002]", f.mentioned)
+	}
+}
+
+func TestSendMessage_HereNotifiesOnlineMembers(t *testing.T) {
+	presence := mockPresence{3001: "online", 3002: "offline", 3003: "dnd"}
+	f := newMentionFixture(t, permissions.PermSendMessages|permissions.PermViewChannel|permissions.PermMentionEveryone, presence)
+	f.members.GetUserIDsByGuildFn = func(_ context.Context, _ int64) ([]int64, error) {
+		return []int64{testUserID, 3001, 3002, 3003, 3004}, nil
+	}
+
+	f.send(t, "@here standup")
+
+	if !f.created.MentionEveryone {
+		t.Error("mention_everyone should be true for @here")
+	}
+	if !sameIDs(f.mentioned, []int64{3001, 3003}) {
+		t.Errorf("mention counts incremented for %v, want [3001 3003]", f.mentioned)
+	}
+}
+
+func TestSendMessage_RoleMentions(t *testing.T) {
+	const modsRoleID int64 = 6002
+	f := newMentionFixture(t, permissions.PermSendMessages|permissions.PermViewChannel, nil)
+	f.roles.GetByGuildIDFn = func(_ context.Context, _ int64) ([]models.Role, error) {
+		return []models.Role{
+			{ID: testRoleID, GuildID: testGuildID, Name: "@everyone", Permissions: int64(permissions.PermSendMessages | permissions.PermViewChannel), IsDefault: true},
+			{ID: modsRoleID, GuildID: testGuildID, Name: "mods"},
+		}, nil
+	}
+	f.members.GetUserIDsByRolesFn = func(_ context.Context, _ int64, roleIDs []int64) ([]int64, error) {
+		if !sameIDs(roleIDs, []int64{modsRoleID}) {
+			t.Errorf("expanded roles %v, want [%d]", roleIDs, modsRoleID)
+		}
+		return []int64{3001, 3002}, nil
+	}
+
+	// 9999999 is not a role of this guild.
+	f.send(t, "ping <@&6002> <@&9999999>")
+
+	if !sameIDs(f.created.MentionRoles, []int64{modsRoleID}) {
+		t.Errorf("mention_roles = %v, want [%d]", f.created.MentionRoles, modsRoleID)
+	}
+	if !sameIDs(f.mentioned, []int64{3001, 3002}) {
+		t.Errorf("mention counts incremented for %v, want [3001 3002]", f.mentioned)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Reply tests
+// ---------------------------------------------------------------------------
+
+const (
+	testReplyTargetID  int64 = 5001
+	testReplyAuthorID  int64 = 3005
+	testOtherChannelID int64 = 2001
+)
+
+// withReplyTarget makes GetByID return a message by testReplyAuthorID in
+// channelID for testReplyTargetID, and the sent message otherwise.
+func (f *mentionFixture) withReplyTarget(channelID int64) {
+	f.msgs.GetByIDFn = func(_ context.Context, id int64) (*models.MessageWithAuthor, error) {
+		if id == testReplyTargetID {
+			return &models.MessageWithAuthor{Message: models.Message{
+				ID: testReplyTargetID, ChannelID: channelID, AuthorID: testReplyAuthorID, Content: "original",
+			}}, nil
+		}
+		if f.created == nil {
+			return nil, nil
+		}
+		return &models.MessageWithAuthor{Message: *f.created}, nil
+	}
+}
+
+func (f *mentionFixture) reply(t *testing.T, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	c, rec := newTestContext(http.MethodPost, "/api/v1/channels/2000/messages", strings.NewReader(body))
+	c.SetParamNames("id")
+	c.SetParamValues("2000")
+	setAuthUser(c, testUserID)
+
+	if err := f.h.SendMessage(c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return rec
+}
+
+func TestSendMessage_ReplyMentionsOriginalAuthor(t *testing.T) {
+	f := newMentionFixture(t, permissions.PermSendMessages|permissions.PermViewChannel|permissions.PermReadMessageHistory, nil)
+	f.withReplyTarget(testChannelID)
+
+	rec := f.reply(t, `{"content":"agreed","message_reference":{"message_id":"5001"}}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	ref := f.created.MessageReference
+	if ref == nil || ref.MessageID != testReplyTargetID || ref.ChannelID != testChannelID {
+		t.Fatalf("message_reference = %+v, want message %d in channel %d", ref, testReplyTargetID, testChannelID)
+	}
+	if !sameIDs(f.created.Mentions, []int64{testReplyAuthorID}) {
+		t.Errorf("mentions = %v, want [%d]", f.created.Mentions, testReplyAuthorID)
+	}
+	if !sameIDs(f.mentioned, []int64{testReplyAuthorID}) {
+		t.Errorf("mention counts incremented for %v, want [%d]", f.mentioned, testReplyAuthorID)
+	}
+}
+
+func TestSendMessage_ReplyToOwnMessageDoesNotMention(t *testing.T) {
+	f := newMentionFixture(t, permissions.PermSendMessages|permissions.PermViewChannel|permissions.PermReadMessageHistory, nil)
+	f.msgs.GetByIDFn = func(_ context.Context, id int64) (*models.MessageWithAuthor, error) {
+		if id == testReplyTargetID {
+			return &models.MessageWithAuthor{Message: models.Message{ID: id, ChannelID: testChannelID, AuthorID: testUserID}}, nil
+		}
+		return &models.MessageWithAuthor{Message: *f.created}, nil
+	}
+
+	rec := f.reply(t, `{"content":"also","message_reference":{"message_id":"5001"}}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if len(f.created.Mentions) != 0 || len(f.mentioned) != 0 {
+		t.Errorf("mentions = %v, counted = %v, want none", f.created.Mentions, f.mentioned)
+	}
+}
+
+func TestSendMessage_ReplyRejectsInvalidReference(t *testing.T) {
+	tests := []struct {
+		name          string
+		targetChannel int64
+		body          string
+	}{
+		{"other channel in reference", testChannelID, `{"content":"x","message_reference":{"channel_id":"2001","message_id":"5001"}}`},
+		{"message in other channel", testOtherChannelID, `{"content":"x","message_reference":{"message_id":"5001"}}`},
+		{"unknown message", testChannelID, `{"content":"x","message_reference":{"message_id":"5999"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newMentionFixture(t, permissions.PermSendMessages|permissions.PermViewChannel|permissions.PermReadMessageHistory, nil)
+			f.withReplyTarget(tt.targetChannel)
+
+			rec := f.reply(t, tt.body)
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("expected 400, got %d: %s", rec.Code, rec.Body.String())
+			}
+			if f.created != nil {
+				t.Error("message should not be created")
+			}
+		})
+	}
+}
+
+func TestSendMessage_ReplyRequiresReadMessageHistory(t *testing.T) {
+	f := newMentionFixture(t, permissions.PermSendMessages|permissions.PermViewChannel, nil)
+	f.withReplyTarget(testChannelID)
+
+	rec := f.reply(t, `{"content":"agreed","message_reference":{"message_id":"5001"}}`)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
 // ---------------------------------------------------------------------------
 // GetMessages tests
 // ---------------------------------------------------------------------------
@@ -592,3 +1123,195 @@ func TestDeleteMessage_NoPermission(t *testing.T) {
 		t.Fatalf("expected 403, got %d: %s", rec.Code, rec.Body.String())
 	}
 }
+
+// ---------------------------------------------------------------------------
+// Pin tests
+// ---------------------------------------------------------------------------
+
+// pinContext builds a request context for /channels/:id/pins/:message_id.
+func pinContext(method, channelID, msgID string, userID int64) (echo.Context, *httptest.ResponseRecorder) {
+	c, rec := newTestContext(method, "/api/v1/channels/"+channelID+"/pins/"+msgID, nil)
+	c.SetParamNames("id", "message_id")
+	c.SetParamValues(channelID, msgID)
+	setAuthUser(c, userID)
+	return c, rec
+}
+
+func pinMessageRepo(channelID int64, pinned bool) *mockMessageRepo {
+	return &mockMessageRepo{
+		GetByIDFn: func(_ context.Context, id int64) (*models.MessageWithAuthor, error) {
+			return &models.MessageWithAuthor{
+				Message: models.Message{ID: id, ChannelID: channelID, AuthorID: 7777, Content: "pin me"},
+				Pinned:  pinned,
+			}, nil
+		},
+	}
+}
+
+func TestPinMessage_WithManageMessages(t *testing.T) {
+	guilds, members, roles, overrides := permMocks(permissions.PermViewChannel | permissions.PermManageMessages)
+	gw := &mockGateway{}
+	msgs := pinMessageRepo(testChannelID, false)
+	var pinnedID int64
+	var pinLimit int
+	msgs.PinFn = func(_ context.Context, channelID, messageID int64, limit int) error {
+		pinnedID, pinLimit = messageID, limit
+		return nil
+	}
+
+	h := newMessageHandler(msgs, channelMock(), members, roles, guilds, overrides, gw)
+	c, rec := pinContext(http.MethodPut, "2000", "5000", testUserID)
+	if err := h.PinMessage(c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if pinnedID != testMsgID || pinLimit != 50 {
+		t.Errorf("Pin(%d, limit %d), want message %d with limit 50", pinnedID, pinLimit, testMsgID)
+	}
+
+	if len(gw.events) != 1 || gw.events[0].Event != gateway.EventChannelPinsUpdate {
+		t.Fatalf("expected CHANNEL_PINS_UPDATE, got %+v", gw.events)
+	}
+	data := gw.events[0].Data.(gateway.ChannelPinsUpdateData)
+	if data.ChannelID != testChannelID || data.GuildID != testGuildID {
+		t.Errorf("CHANNEL_PINS_UPDATE = %+v", data)
+	}
+}
+
+func TestPinMessage_RequiresManageMessages(t *testing.T) {
+	guilds, members, roles, overrides := permMocks(permissions.PermViewChannel | permissions.PermSendMessages)
+	msgs := pinMessageRepo(testChannelID, false)
+	msgs.PinFn = func(_ context.Context, _, _ int64, _ int) error {
+		t.Fatal("Pin should not be called")
+		return nil
+	}
+
+	h := newMessageHandler(msgs, channelMock(), members, roles, guilds, overrides, &mockGateway{})
+	c, rec := pinContext(http.MethodPut, "2000", "5000", testUserID)
+	if err := h.PinMessage(c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestPinMessage_LimitReached(t *testing.T) {
+	guilds, members, roles, overrides := permMocks(permissions.PermViewChannel | permissions.PermManageMessages)
+	gw := &mockGateway{}
+	msgs := pinMessageRepo(testChannelID, false)
+	msgs.PinFn = func(_ context.Context, _, _ int64, _ int) error {
+		return database.ErrPinLimitReached
+	}
+
+	h := newMessageHandler(msgs, channelMock(), members, roles, guilds, overrides, gw)
+	c, rec := pinContext(http.MethodPut, "2000", "5000", testUserID)
+	if err := h.PinMessage(c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if len(gw.events) != 0 {
+		t.Errorf("expected no events, got %+v", gw.events)
+	}
+}
+
+func TestPinMessage_MessageInOtherChannel(t *testing.T) {
+	guilds, members, roles, overrides := permMocks(permissions.PermViewChannel | permissions.PermManageMessages)
+	h := newMessageHandler(pinMessageRepo(2001, false), channelMock(), members, roles, guilds, overrides, &mockGateway{})
+
+	c, rec := pinContext(http.MethodPut, "2000", "5000", testUserID)
+	if err := h.PinMessage(c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestPinMessage_DMRecipient(t *testing.T) {
+	const dmChannelID int64 = 8000
+	gw := &mockGateway{}
+	msgs := pinMessageRepo(dmChannelID, false)
+	pinned := false
+	msgs.PinFn = func(_ context.Context, _, _ int64, _ int) error {
+		pinned = true
+		return nil
+	}
+	dms := &mockDMChannelRepo{
+		GetByIDFn: func(_ context.Context, id int64) (*models.DMChannel, error) {
+			return &models.DMChannel{ID: id, Type: models.DMTypeDM, Recipients: []models.User{{ID: testUserID}, {ID: 7777}}}, nil
+		},
+		IsRecipientFn: func(_ context.Context, _, userID int64) (bool, error) {
+			return userID == testUserID || userID == 7777, nil
+		},
+	}
+	perms := service.NewPermissionChecker(&mockGuildRepo{}, &mockMemberRepo{}, &mockRoleRepo{}, &mockChannelOverrideRepo{}, &mockChannelRepo{})
+	svc := service.NewMessageService(msgs, &mockAttachmentRepo{}, &mockChannelRepo{}, dms, &mockMemberRepo{}, &mockRoleRepo{}, &mockReadStateRepo{}, testSnowflake(), &mockStorage{}, gw, perms, nil)
+	h := NewMessageHandler(svc)
+
+	c, rec := pinContext(http.MethodPut, "8000", "5000", testUserID)
+	if err := h.PinMessage(c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rec.Code != http.StatusNoContent || !pinned {
+		t.Fatalf("expected 204 and a pin, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if len(gw.events) != 2 {
+		t.Fatalf("expected CHANNEL_PINS_UPDATE for both recipients, got %+v", gw.events)
+	}
+	for _, e := range gw.events {
+		if e.Event != gateway.EventChannelPinsUpdate || e.Data.(gateway.ChannelPinsUpdateData).GuildID != 0 {
+			t.Errorf("unexpected event %+v", e)
+		}
+	}
+}
+
+func TestUnpinMessage_NotPinnedIsNoop(t *testing.T) {
+	guilds, members, roles, overrides := permMocks(permissions.PermViewChannel | permissions.PermManageMessages)
+	gw := &mockGateway{}
+	h := newMessageHandler(pinMessageRepo(testChannelID, false), channelMock(), members, roles, guilds, overrides, gw)
+
+	c, rec := pinContext(http.MethodDelete, "2000", "5000", testUserID)
+	if err := h.UnpinMessage(c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if len(gw.events) != 0 {
+		t.Errorf("expected no events, got %+v", gw.events)
+	}
+}
+
+func TestGetPinnedMessages(t *testing.T) {
+	guilds, members, roles, overrides := permMocks(permissions.PermViewChannel | permissions.PermReadMessageHistory)
+	msgs := &mockMessageRepo{
+		GetPinnedFn: func(_ context.Context, channelID int64) ([]models.MessageWithAuthor, error) {
+			return []models.MessageWithAuthor{{Message: models.Message{ID: testMsgID, ChannelID: channelID}, Pinned: true}}, nil
+		},
+	}
+	h := newMessageHandler(msgs, channelMock(), members, roles, guilds, overrides, &mockGateway{})
+
+	c, rec := newTestContext(http.MethodGet, "/api/v1/channels/2000/pins", nil)
+	c.SetParamNames("id")
+	c.SetParamValues("2000")
+	setAuthUser(c, testUserID)
+	if err := h.GetPinnedMessages(c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var got []models.MessageWithAuthor
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(got) != 1 || !got[0].Pinned {
+		t.Errorf("pins = %+v, want one pinned message", got)
+	}
+}
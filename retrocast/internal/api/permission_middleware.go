@@ -146,8 +146,8 @@ func RequireChannelPermission(
 				return errorJSON(c, http.StatusInternalServerError, "INTERNAL", "internal server error")
 			}
 
-			// Separate @everyone override from role-specific overrides.
-			var everyoneOverride *models.ChannelOverride
+			// Separate the @everyone, role-specific and member overrides.
+			var everyoneOverride, memberOverride *models.ChannelOverride
 			var roleOverrides []models.ChannelOverride
 
 			// Build a set of member's role IDs for fast lookup.
@@ -157,14 +157,18 @@ func RequireChannelPermission(
 			}
 
 			for i := range channelOverrides {
-				if channelOverrides[i].RoleID == everyoneRole.ID {
+				if channelOverrides[i].Type == models.OverrideTypeMember {
+					if channelOverrides[i].TargetID == userID {
+						memberOverride = &channelOverrides[i]
+					}
+				} else if channelOverrides[i].TargetID == everyoneRole.ID {
 					everyoneOverride = &channelOverrides[i]
-				} else if memberRoleIDs[channelOverrides[i].RoleID] {
+				} else if memberRoleIDs[channelOverrides[i].TargetID] {
 					roleOverrides = append(roleOverrides, channelOverrides[i])
 				}
 			}
 
-			channelPerms := permissions.ComputeChannelPermissions(basePerms, everyoneOverride, roleOverrides)
+			channelPerms := permissions.ComputeChannelPermissions(basePerms, everyoneOverride, roleOverrides, memberOverride)
 
 			if !channelPerms.Has(perm) {
 				return errorJSON(c, http.StatusForbidden, "FORBIDDEN", "you do not have permission to perform this action")
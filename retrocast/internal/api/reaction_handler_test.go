@@ -27,7 +27,7 @@ func newReactionHandler(
 	overrides *mockChannelOverrideRepo,
 	gw *mockGateway,
 ) *ReactionHandler {
-	perms := service.NewPermissionChecker(guilds, mems, roles, overrides)
+	perms := service.NewPermissionChecker(guilds, mems, roles, overrides, &mockChannelRepo{})
 	svc := service.NewReactionService(reactions, msgs, chs, &mockDMChannelRepo{}, gw, perms)
 	return NewReactionHandler(svc)
 }
@@ -74,7 +74,7 @@ func TestAddReaction_Success(t *testing.T) {
 	if rec.Code != http.StatusNoContent {
 		t.Fatalf("expected 204, got %d: %s", rec.Code, rec.Body.String())
 	}
-	if len(gw.events) != 1 || gw.events[0].Event != gateway.EventMessageReactionAdd {
+	if len(gw.events) != 1 || gw.events[0].Event != gateway.EventMessageReactionAdd || gw.events[0].ChannelID != testChannelID {
 		t.Fatalf("expected MESSAGE_REACTION_ADD event, got %+v", gw.events)
 	}
 }
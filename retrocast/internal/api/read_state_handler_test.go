@@ -22,7 +22,7 @@ func newReadStateHandler(
 	roles *mockRoleRepo,
 	overrides *mockChannelOverrideRepo,
 ) *ReadStateHandler {
-	perms := service.NewPermissionChecker(guilds, members, roles, overrides)
+	perms := service.NewPermissionChecker(guilds, members, roles, overrides, &mockChannelRepo{})
 	svc := service.NewReadStateService(rs, chs, dms, perms)
 	return NewReadStateHandler(svc)
 }
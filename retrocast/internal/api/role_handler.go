@@ -6,6 +6,7 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"github.com/victorivanov/retrocast/internal/auth"
+	"github.com/victorivanov/retrocast/internal/models"
 	"github.com/victorivanov/retrocast/internal/service"
 )
 
@@ -171,28 +172,31 @@ func (h *RoleHandler) RemoveRole(c echo.Context) error {
 }
 
 type setOverrideRequest struct {
-	Allow int64 `json:"allow,string"`
-	Deny  int64 `json:"deny,string"`
+	Type  models.OverrideType `json:"type"`
+	Allow int64               `json:"allow,string"`
+	Deny  int64               `json:"deny,string"`
 }
 
-// SetChannelOverride handles PUT /api/v1/channels/:id/permissions/:role_id.
+// SetChannelOverride handles PUT /api/v1/channels/:id/permissions/:target_id.
 func (h *RoleHandler) SetChannelOverride(c echo.Context) error {
 	channelID, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
 		return errorJSON(c, http.StatusBadRequest, "INVALID_ID", "invalid channel id")
 	}
 
-	roleID, err := strconv.ParseInt(c.Param("role_id"), 10, 64)
+	targetID, err := strconv.ParseInt(c.Param("target_id"), 10, 64)
 	if err != nil {
-		return errorJSON(c, http.StatusBadRequest, "INVALID_ID", "invalid role id")
+		return errorJSON(c, http.StatusBadRequest, "INVALID_ID", "invalid target id")
 	}
 
+	actorID := auth.GetUserID(c)
+
 	var req setOverrideRequest
 	if err := c.Bind(&req); err != nil {
 		return errorJSON(c, http.StatusBadRequest, "INVALID_BODY", "invalid request body")
 	}
 
-	override, err := h.service.SetChannelOverride(c.Request().Context(), channelID, roleID, req.Allow, req.Deny)
+	override, err := h.service.SetChannelOverride(c.Request().Context(), channelID, actorID, targetID, req.Type, req.Allow, req.Deny)
 	if err != nil {
 		return mapServiceError(c, err)
 	}
@@ -200,19 +204,21 @@ func (h *RoleHandler) SetChannelOverride(c echo.Context) error {
 	return c.JSON(http.StatusOK, override)
 }
 
-// DeleteChannelOverride handles DELETE /api/v1/channels/:id/permissions/:role_id.
+// DeleteChannelOverride handles DELETE /api/v1/channels/:id/permissions/:target_id.
 func (h *RoleHandler) DeleteChannelOverride(c echo.Context) error {
 	channelID, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
 		return errorJSON(c, http.StatusBadRequest, "INVALID_ID", "invalid channel id")
 	}
 
-	roleID, err := strconv.ParseInt(c.Param("role_id"), 10, 64)
+	targetID, err := strconv.ParseInt(c.Param("target_id"), 10, 64)
 	if err != nil {
-		return errorJSON(c, http.StatusBadRequest, "INVALID_ID", "invalid role id")
+		return errorJSON(c, http.StatusBadRequest, "INVALID_ID", "invalid target id")
 	}
 
-	if err := h.service.DeleteChannelOverride(c.Request().Context(), channelID, roleID); err != nil {
+	actorID := auth.GetUserID(c)
+
+	if err := h.service.DeleteChannelOverride(c.Request().Context(), channelID, actorID, targetID); err != nil {
 		return mapServiceError(c, err)
 	}
 
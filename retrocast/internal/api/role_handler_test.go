@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"net/http"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -19,8 +20,8 @@ func newRoleHandler(
 	overrides *mockChannelOverrideRepo,
 	gw *mockGateway,
 ) *RoleHandler {
-	perms := service.NewPermissionChecker(guilds, members, roles, overrides)
-	svc := service.NewRoleService(guilds, roles, members, channels, overrides, testSnowflake(), gw, perms)
+	perms := service.NewPermissionChecker(guilds, members, roles, overrides, &mockChannelRepo{})
+	svc := service.NewRoleService(guilds, roles, members, channels, overrides, testSnowflake(), gw, perms, service.NewAuditLogService(&mockAuditLogRepo{}, testSnowflake(), perms))
 	return NewRoleHandler(svc)
 }
 
@@ -339,3 +340,88 @@ func TestRemoveRole_Success(t *testing.T) {
 		t.Error("expected role to be removed")
 	}
 }
+
+func TestSetChannelOverride_Targets(t *testing.T) {
+	guilds := &mockGuildRepo{
+		GetByIDFn: func(ctx context.Context, id int64) (*models.Guild, error) {
+			return &models.Guild{ID: 1, OwnerID: 100}, nil
+		},
+	}
+	channels := &mockChannelRepo{
+		GetByIDFn: func(ctx context.Context, id int64) (*models.Channel, error) {
+			return &models.Channel{ID: id, GuildID: 1, Type: models.ChannelTypeText}, nil
+		},
+	}
+	roles := &mockRoleRepo{
+		GetByIDFn: func(ctx context.Context, id int64) (*models.Role, error) {
+			switch id {
+			case 20:
+				return &models.Role{ID: 20, GuildID: 1}, nil
+			case 21:
+				return &models.Role{ID: 21, GuildID: 2}, nil
+			}
+			return nil, nil
+		},
+	}
+	members := &mockMemberRepo{
+		GetByGuildAndUserFn: func(ctx context.Context, guildID, userID int64) (*models.Member, error) {
+			if userID == 200 {
+				return &models.Member{GuildID: guildID, UserID: userID}, nil
+			}
+			return nil, nil
+		},
+	}
+
+	tests := []struct {
+		name     string
+		targetID string
+		body     string
+		want     int
+		wantType models.OverrideType
+	}{
+		{"role by default", "20", `{"allow":"1","deny":"0"}`, http.StatusOK, models.OverrideTypeRole},
+		{"member", "200", `{"type":1,"allow":"0","deny":"1"}`, http.StatusOK, models.OverrideTypeMember},
+		{"role from another guild", "21", `{"type":0,"allow":"1"}`, http.StatusNotFound, 0},
+		{"user is not a member", "201", `{"type":1,"deny":"1"}`, http.StatusNotFound, 0},
+		{"member id as role", "200", `{"type":0,"deny":"1"}`, http.StatusNotFound, 0},
+		{"unknown type", "20", `{"type":2,"deny":"1"}`, http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stored *models.ChannelOverride
+			overrides := &mockChannelOverrideRepo{
+				SetFn: func(ctx context.Context, o *models.ChannelOverride) error {
+					stored = o
+					return nil
+				},
+			}
+			h := newRoleHandler(guilds, roles, members, channels, overrides, &mockGateway{})
+
+			c, rec := newTestContext(http.MethodPut, "/api/v1/channels/10/permissions/"+tt.targetID, strings.NewReader(tt.body))
+			c.SetParamNames("id", "target_id")
+			c.SetParamValues("10", tt.targetID)
+			setAuthUser(c, 100)
+
+			if err := h.SetChannelOverride(c); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if rec.Code != tt.want {
+				t.Fatalf("expected %d, got %d: %s", tt.want, rec.Code, rec.Body.String())
+			}
+			if tt.want != http.StatusOK {
+				if stored != nil {
+					t.Errorf("override stored despite error: %+v", stored)
+				}
+				return
+			}
+
+			var resp models.ChannelOverride
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if stored == nil || stored.Type != tt.wantType || resp.Type != tt.wantType || strconv.FormatInt(resp.TargetID, 10) != tt.targetID {
+				t.Errorf("stored %+v, response %+v", stored, resp)
+			}
+		})
+	}
+}
@@ -41,6 +41,7 @@ type Dependencies struct {
 	Auth     *AuthHandler
 	Guilds   *GuildHandler
 	Channels *ChannelHandler
+	Threads  *ThreadHandler
 	Members  *MemberHandler
 	Users    *UserHandler
 	Messages *MessageHandler
@@ -48,6 +49,7 @@ type Dependencies struct {
 	Roles    *RoleHandler
 	Uploads  *UploadHandler
 	Bans     *BanHandler
+	AuditLogs  *AuditLogHandler
 	DMs        *DMHandler
 	ReadStates *ReadStateHandler
 	Reactions  *ReactionHandler
@@ -111,10 +113,14 @@ func SetupRouter(e *echo.Echo, deps *Dependencies) {
 	// Public invite info — no auth required
 	v1.GET("/invites/:code", deps.Invites.GetInvite)
 
+	// LiveKit webhooks — authenticated by their signature
+	v1.POST("/voice/webhook", deps.Voice.LiveKitWebhook)
+
 	// Protected routes — require JWT auth + general rate limit
 	authMw := deps.TokenService.Middleware()
 	protected := v1.Group("", authMw,
 		RateLimitMiddleware(deps.Redis, 50, time.Minute),
+		AuditLogReasonMiddleware,
 	)
 
 	// Auth (protected)
@@ -147,6 +153,15 @@ func SetupRouter(e *echo.Echo, deps *Dependencies) {
 	protected.PATCH("/channels/:id", deps.Channels.UpdateChannel)
 	protected.DELETE("/channels/:id", deps.Channels.DeleteChannel)
 
+	// Threads
+	protected.POST("/channels/:id/threads", deps.Threads.CreateThread)
+	protected.GET("/channels/:id/threads", deps.Threads.ListThreads)
+	protected.POST("/channels/:id/messages/:message_id/threads", deps.Threads.CreateThreadFromMessage)
+	protected.PATCH("/threads/:id", deps.Threads.UpdateThread)
+	protected.GET("/threads/:id/members", deps.Threads.ListThreadMembers)
+	protected.PUT("/threads/:id/members/@me", deps.Threads.JoinThread)
+	protected.DELETE("/threads/:id/members/@me", deps.Threads.LeaveThread)
+
 	// Members
 	protected.GET("/guilds/:id/members", deps.Members.ListMembers)
 	protected.GET("/guilds/:id/members/:user_id", deps.Members.GetMember)
@@ -164,8 +179,8 @@ func SetupRouter(e *echo.Echo, deps *Dependencies) {
 	protected.DELETE("/guilds/:id/members/:user_id/roles/:role_id", deps.Roles.RemoveRole)
 
 	// Channel permission overrides
-	protected.PUT("/channels/:id/permissions/:role_id", deps.Roles.SetChannelOverride)
-	protected.DELETE("/channels/:id/permissions/:role_id", deps.Roles.DeleteChannelOverride)
+	protected.PUT("/channels/:id/permissions/:target_id", deps.Roles.SetChannelOverride)
+	protected.DELETE("/channels/:id/permissions/:target_id", deps.Roles.DeleteChannelOverride)
 
 	// Messages
 	protected.POST("/channels/:id/messages", deps.Messages.SendMessage)
@@ -174,6 +189,11 @@ func SetupRouter(e *echo.Echo, deps *Dependencies) {
 	protected.PATCH("/channels/:id/messages/:message_id", deps.Messages.EditMessage)
 	protected.DELETE("/channels/:id/messages/:message_id", deps.Messages.DeleteMessage)
 
+	// Pins
+	protected.GET("/channels/:id/pins", deps.Messages.GetPinnedMessages)
+	protected.PUT("/channels/:id/pins/:message_id", deps.Messages.PinMessage)
+	protected.DELETE("/channels/:id/pins/:message_id", deps.Messages.UnpinMessage)
+
 	// Message search
 	protected.GET("/guilds/:id/messages/search", deps.Search.SearchMessages)
 
@@ -186,6 +206,9 @@ func SetupRouter(e *echo.Echo, deps *Dependencies) {
 	protected.POST("/channels/:id/voice/join", deps.Voice.JoinVoice)
 	protected.POST("/channels/:id/voice/leave", deps.Voice.LeaveVoice)
 	protected.GET("/channels/:id/voice/states", deps.Voice.GetVoiceStates)
+	protected.PATCH("/guilds/:id/voice-states/@me", deps.Voice.UpdateSelfVoiceState)
+	protected.PATCH("/guilds/:id/voice-states/:user_id", deps.Voice.UpdateVoiceState)
+	protected.DELETE("/guilds/:id/voice-states/:user_id", deps.Voice.DisconnectVoiceMember)
 
 	// Attachments
 	protected.POST("/channels/:id/attachments", deps.Uploads.Upload)
@@ -201,6 +224,9 @@ func SetupRouter(e *echo.Echo, deps *Dependencies) {
 	protected.DELETE("/guilds/:id/bans/:user_id", deps.Bans.UnbanMember)
 	protected.GET("/guilds/:id/bans", deps.Bans.ListBans)
 
+	// Audit log
+	protected.GET("/guilds/:id/audit-logs", deps.AuditLogs.ListEntries)
+
 	// Invites (protected)
 	protected.POST("/guilds/:id/invites", deps.Invites.CreateInvite)
 	protected.GET("/guilds/:id/invites", deps.Invites.ListInvites)
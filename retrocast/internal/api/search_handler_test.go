@@ -20,7 +20,7 @@ func newSearchHandler(
 	roles *mockRoleRepo,
 	overrides *mockChannelOverrideRepo,
 ) *SearchHandler {
-	perms := service.NewPermissionChecker(guilds, mems, roles, overrides)
+	perms := service.NewPermissionChecker(guilds, mems, roles, overrides, &mockChannelRepo{})
 	svc := service.NewSearchService(msgs, mems, perms)
 	return NewSearchHandler(svc)
 }
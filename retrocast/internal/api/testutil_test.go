@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/victorivanov/retrocast/internal/gateway"
 	"github.com/victorivanov/retrocast/internal/models"
 	"github.com/victorivanov/retrocast/internal/snowflake"
 )
@@ -40,8 +41,10 @@ func testSnowflake() *snowflake.Generator {
 
 type dispatchedEvent struct {
 	GuildID      int64
+	ChannelID    int64
 	UserID       int64
 	ExceptUserID int64
+	UserIDs      []int64
 	Event        string
 	Data         any
 }
@@ -69,10 +72,32 @@ func (m *mockGateway) DispatchToGuildExcept(guildID int64, exceptUserID int64, e
 	m.events = append(m.events, dispatchedEvent{GuildID: guildID, ExceptUserID: exceptUserID, Event: event, Data: data})
 }
 
+func (m *mockGateway) DispatchToChannel(guildID, channelID int64, event string, data interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, dispatchedEvent{GuildID: guildID, ChannelID: channelID, Event: event, Data: data})
+}
+
+func (m *mockGateway) DispatchToGuildMembers(guildID int64, userIDs []int64, event string, data interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, dispatchedEvent{GuildID: guildID, UserIDs: userIDs, Event: event, Data: data})
+}
+
+func (m *mockGateway) InvalidateGuildPermissions(guildID int64) {}
+
+func (m *mockGateway) InvalidateMemberPermissions(guildID, userID int64) {}
+
 func (m *mockGateway) SubscribeToGuild(userID, guildID int64) {}
 
 func (m *mockGateway) UnsubscribeFromGuild(userID, guildID int64) {}
 
+func (m *mockGateway) JoinGuild(userID, guildID int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, dispatchedEvent{GuildID: guildID, UserID: userID, Event: gateway.EventGuildCreate})
+}
+
 // ---------------------------------------------------------------------------
 // Mock repositories
 // ---------------------------------------------------------------------------
@@ -170,6 +195,9 @@ type mockChannelRepo struct {
 	CreateFn     func(ctx context.Context, channel *models.Channel) error
 	GetByIDFn    func(ctx context.Context, id int64) (*models.Channel, error)
 	GetByGuildIDFn func(ctx context.Context, guildID int64) ([]models.Channel, error)
+	GetThreadsByParentFn        func(ctx context.Context, parentID int64, archived bool) ([]models.Channel, error)
+	GetThreadByStarterMessageFn func(ctx context.Context, messageID int64) (*models.Channel, error)
+	ArchiveInactiveThreadsFn    func(ctx context.Context, now time.Time) ([]models.Channel, error)
 	UpdateFn     func(ctx context.Context, channel *models.Channel) error
 	DeleteFn     func(ctx context.Context, id int64) error
 }
@@ -195,6 +223,27 @@ func (m *mockChannelRepo) GetByGuildID(ctx context.Context, guildID int64) ([]mo
 	return nil, nil
 }
 
+func (m *mockChannelRepo) GetThreadsByParent(ctx context.Context, parentID int64, archived bool) ([]models.Channel, error) {
+	if m.GetThreadsByParentFn != nil {
+		return m.GetThreadsByParentFn(ctx, parentID, archived)
+	}
+	return nil, nil
+}
+
+func (m *mockChannelRepo) GetThreadByStarterMessage(ctx context.Context, messageID int64) (*models.Channel, error) {
+	if m.GetThreadByStarterMessageFn != nil {
+		return m.GetThreadByStarterMessageFn(ctx, messageID)
+	}
+	return nil, nil
+}
+
+func (m *mockChannelRepo) ArchiveInactiveThreads(ctx context.Context, now time.Time) ([]models.Channel, error) {
+	if m.ArchiveInactiveThreadsFn != nil {
+		return m.ArchiveInactiveThreadsFn(ctx, now)
+	}
+	return nil, nil
+}
+
 func (m *mockChannelRepo) Update(ctx context.Context, channel *models.Channel) error {
 	if m.UpdateFn != nil {
 		return m.UpdateFn(ctx, channel)
@@ -209,6 +258,34 @@ func (m *mockChannelRepo) Delete(ctx context.Context, id int64) error {
 	return nil
 }
 
+// mockThreadMemberRepo implements database.ThreadMemberRepository.
+type mockThreadMemberRepo struct {
+	AddFn         func(ctx context.Context, threadID, userID int64) (bool, error)
+	RemoveFn      func(ctx context.Context, threadID, userID int64) (bool, error)
+	GetByThreadFn func(ctx context.Context, threadID int64) ([]models.ThreadMember, error)
+}
+
+func (m *mockThreadMemberRepo) Add(ctx context.Context, threadID, userID int64) (bool, error) {
+	if m.AddFn != nil {
+		return m.AddFn(ctx, threadID, userID)
+	}
+	return false, nil
+}
+
+func (m *mockThreadMemberRepo) Remove(ctx context.Context, threadID, userID int64) (bool, error) {
+	if m.RemoveFn != nil {
+		return m.RemoveFn(ctx, threadID, userID)
+	}
+	return false, nil
+}
+
+func (m *mockThreadMemberRepo) GetByThread(ctx context.Context, threadID int64) ([]models.ThreadMember, error) {
+	if m.GetByThreadFn != nil {
+		return m.GetByThreadFn(ctx, threadID)
+	}
+	return nil, nil
+}
+
 // mockRoleRepo implements database.RoleRepository.
 type mockRoleRepo struct {
 	CreateFn     func(ctx context.Context, role *models.Role) error
@@ -217,6 +294,7 @@ type mockRoleRepo struct {
 	UpdateFn     func(ctx context.Context, role *models.Role) error
 	DeleteFn     func(ctx context.Context, id int64) error
 	GetByMemberFn func(ctx context.Context, guildID, userID int64) ([]models.Role, error)
+	GetByMembersFn func(ctx context.Context, guildID int64, userIDs []int64) (map[int64][]models.Role, error)
 }
 
 func (m *mockRoleRepo) Create(ctx context.Context, role *models.Role) error {
@@ -261,11 +339,35 @@ func (m *mockRoleRepo) GetByMember(ctx context.Context, guildID, userID int64) (
 	return nil, nil
 }
 
+// GetByMembers falls back to GetByMember for each user, so tests that stub
+// single-member lookups also cover batch callers.
+func (m *mockRoleRepo) GetByMembers(ctx context.Context, guildID int64, userIDs []int64) (map[int64][]models.Role, error) {
+	if m.GetByMembersFn != nil {
+		return m.GetByMembersFn(ctx, guildID, userIDs)
+	}
+	roles := make(map[int64][]models.Role)
+	for _, userID := range userIDs {
+		r, err := m.GetByMember(ctx, guildID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if len(r) > 0 {
+			roles[userID] = r
+		}
+	}
+	return roles, nil
+}
+
 // mockMemberRepo implements database.MemberRepository.
 type mockMemberRepo struct {
 	CreateFn         func(ctx context.Context, member *models.Member) error
 	GetByGuildAndUserFn func(ctx context.Context, guildID, userID int64) (*models.Member, error)
 	GetByGuildIDFn   func(ctx context.Context, guildID int64, limit, offset int) ([]models.Member, error)
+	GetUserIDsByGuildFn func(ctx context.Context, guildID int64) ([]int64, error)
+	GetUserIDsByRolesFn func(ctx context.Context, guildID int64, roleIDs []int64) ([]int64, error)
+	FilterUserIDsFn  func(ctx context.Context, guildID int64, userIDs []int64) ([]int64, error)
+	SearchByUsernameFn func(ctx context.Context, guildID int64, prefix string, limit int) ([]models.MemberWithUser, error)
+	GetByUserIDsFn   func(ctx context.Context, guildID int64, userIDs []int64) ([]models.MemberWithUser, error)
 	UpdateFn         func(ctx context.Context, member *models.Member) error
 	DeleteFn         func(ctx context.Context, guildID, userID int64) error
 	AddRoleFn        func(ctx context.Context, guildID, userID, roleID int64) error
@@ -293,6 +395,53 @@ func (m *mockMemberRepo) GetByGuildID(ctx context.Context, guildID int64, limit,
 	return nil, nil
 }
 
+func (m *mockMemberRepo) GetUserIDsByGuild(ctx context.Context, guildID int64) ([]int64, error) {
+	if m.GetUserIDsByGuildFn != nil {
+		return m.GetUserIDsByGuildFn(ctx, guildID)
+	}
+	return nil, nil
+}
+
+func (m *mockMemberRepo) GetUserIDsByRoles(ctx context.Context, guildID int64, roleIDs []int64) ([]int64, error) {
+	if m.GetUserIDsByRolesFn != nil {
+		return m.GetUserIDsByRolesFn(ctx, guildID, roleIDs)
+	}
+	return nil, nil
+}
+
+// FilterUserIDs falls back to GetByGuildAndUser for each user, so tests that
+// stub single-member lookups also cover batch callers.
+func (m *mockMemberRepo) FilterUserIDs(ctx context.Context, guildID int64, userIDs []int64) ([]int64, error) {
+	if m.FilterUserIDsFn != nil {
+		return m.FilterUserIDsFn(ctx, guildID, userIDs)
+	}
+	var members []int64
+	for _, userID := range userIDs {
+		member, err := m.GetByGuildAndUser(ctx, guildID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if member != nil {
+			members = append(members, userID)
+		}
+	}
+	return members, nil
+}
+
+func (m *mockMemberRepo) SearchByUsername(ctx context.Context, guildID int64, prefix string, limit int) ([]models.MemberWithUser, error) {
+	if m.SearchByUsernameFn != nil {
+		return m.SearchByUsernameFn(ctx, guildID, prefix, limit)
+	}
+	return nil, nil
+}
+
+func (m *mockMemberRepo) GetByUserIDs(ctx context.Context, guildID int64, userIDs []int64) ([]models.MemberWithUser, error) {
+	if m.GetByUserIDsFn != nil {
+		return m.GetByUserIDsFn(ctx, guildID, userIDs)
+	}
+	return nil, nil
+}
+
 func (m *mockMemberRepo) Update(ctx context.Context, member *models.Member) error {
 	if m.UpdateFn != nil {
 		return m.UpdateFn(ctx, member)
@@ -324,10 +473,14 @@ func (m *mockMemberRepo) RemoveRole(ctx context.Context, guildID, userID, roleID
 // mockMessageRepo implements database.MessageRepository.
 type mockMessageRepo struct {
 	CreateFn         func(ctx context.Context, msg *models.Message) error
+	CreateWithAttachmentsFn func(ctx context.Context, msg *models.Message, attachmentIDs []int64) error
 	GetByIDFn        func(ctx context.Context, id int64) (*models.MessageWithAuthor, error)
 	GetByChannelIDFn func(ctx context.Context, channelID int64, before *int64, limit int) ([]models.MessageWithAuthor, error)
 	UpdateFn         func(ctx context.Context, msg *models.Message) error
 	DeleteFn         func(ctx context.Context, id int64) error
+	PinFn            func(ctx context.Context, channelID, messageID int64, limit int) error
+	UnpinFn          func(ctx context.Context, messageID int64) (bool, error)
+	GetPinnedFn      func(ctx context.Context, channelID int64) ([]models.MessageWithAuthor, error)
 	SearchMessagesFn func(ctx context.Context, guildID int64, query string, authorID *int64, before *time.Time, after *time.Time, limit int) ([]models.MessageWithAuthor, error)
 }
 
@@ -338,6 +491,13 @@ func (m *mockMessageRepo) Create(ctx context.Context, msg *models.Message) error
 	return nil
 }
 
+func (m *mockMessageRepo) CreateWithAttachments(ctx context.Context, msg *models.Message, attachmentIDs []int64) error {
+	if m.CreateWithAttachmentsFn != nil {
+		return m.CreateWithAttachmentsFn(ctx, msg, attachmentIDs)
+	}
+	return nil
+}
+
 func (m *mockMessageRepo) GetByID(ctx context.Context, id int64) (*models.MessageWithAuthor, error) {
 	if m.GetByIDFn != nil {
 		return m.GetByIDFn(ctx, id)
@@ -366,6 +526,27 @@ func (m *mockMessageRepo) Delete(ctx context.Context, id int64) error {
 	return nil
 }
 
+func (m *mockMessageRepo) Pin(ctx context.Context, channelID, messageID int64, limit int) error {
+	if m.PinFn != nil {
+		return m.PinFn(ctx, channelID, messageID, limit)
+	}
+	return nil
+}
+
+func (m *mockMessageRepo) Unpin(ctx context.Context, messageID int64) (bool, error) {
+	if m.UnpinFn != nil {
+		return m.UnpinFn(ctx, messageID)
+	}
+	return false, nil
+}
+
+func (m *mockMessageRepo) GetPinned(ctx context.Context, channelID int64) ([]models.MessageWithAuthor, error) {
+	if m.GetPinnedFn != nil {
+		return m.GetPinnedFn(ctx, channelID)
+	}
+	return nil, nil
+}
+
 func (m *mockMessageRepo) SearchMessages(ctx context.Context, guildID int64, query string, authorID *int64, before *time.Time, after *time.Time, limit int) ([]models.MessageWithAuthor, error) {
 	if m.SearchMessagesFn != nil {
 		return m.SearchMessagesFn(ctx, guildID, query, authorID, before, after, limit)
@@ -421,6 +602,7 @@ func (m *mockInviteRepo) Delete(ctx context.Context, code string) error {
 type mockChannelOverrideRepo struct {
 	SetFn          func(ctx context.Context, override *models.ChannelOverride) error
 	GetByChannelFn func(ctx context.Context, channelID int64) ([]models.ChannelOverride, error)
+	GetByChannelsFn func(ctx context.Context, channelIDs []int64) ([]models.ChannelOverride, error)
 	DeleteFn       func(ctx context.Context, channelID, roleID int64) error
 }
 
@@ -438,6 +620,23 @@ func (m *mockChannelOverrideRepo) GetByChannel(ctx context.Context, channelID in
 	return nil, nil
 }
 
+// GetByChannels falls back to GetByChannel for each channel, so tests that
+// stub single-channel lookups also cover batch callers.
+func (m *mockChannelOverrideRepo) GetByChannels(ctx context.Context, channelIDs []int64) ([]models.ChannelOverride, error) {
+	if m.GetByChannelsFn != nil {
+		return m.GetByChannelsFn(ctx, channelIDs)
+	}
+	var overrides []models.ChannelOverride
+	for _, id := range channelIDs {
+		o, err := m.GetByChannel(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		overrides = append(overrides, o...)
+	}
+	return overrides, nil
+}
+
 func (m *mockChannelOverrideRepo) Delete(ctx context.Context, channelID, roleID int64) error {
 	if m.DeleteFn != nil {
 		return m.DeleteFn(ctx, channelID, roleID)
@@ -481,6 +680,26 @@ func (m *mockBanRepo) Delete(ctx context.Context, guildID, userID int64) error {
 	return nil
 }
 
+// mockAuditLogRepo implements database.AuditLogRepository.
+type mockAuditLogRepo struct {
+	CreateFn       func(ctx context.Context, entry *models.AuditLogEntry) error
+	GetByGuildIDFn func(ctx context.Context, guildID int64, userID *int64, actionType *models.AuditLogAction, before *int64, limit int) ([]models.AuditLogEntry, error)
+}
+
+func (m *mockAuditLogRepo) Create(ctx context.Context, entry *models.AuditLogEntry) error {
+	if m.CreateFn != nil {
+		return m.CreateFn(ctx, entry)
+	}
+	return nil
+}
+
+func (m *mockAuditLogRepo) GetByGuildID(ctx context.Context, guildID int64, userID *int64, actionType *models.AuditLogAction, before *int64, limit int) ([]models.AuditLogEntry, error) {
+	if m.GetByGuildIDFn != nil {
+		return m.GetByGuildIDFn(ctx, guildID, userID, actionType, before, limit)
+	}
+	return nil, nil
+}
+
 // mockDMChannelRepo implements database.DMChannelRepository.
 type mockDMChannelRepo struct {
 	CreateFn          func(ctx context.Context, dm *models.DMChannel) error
@@ -499,6 +718,7 @@ type mockReadStateRepo struct {
 	GetByUserFn           func(ctx context.Context, userID int64) ([]models.ReadState, error)
 	GetByUserAndChannelFn func(ctx context.Context, userID, channelID int64) (*models.ReadState, error)
 	IncrementMentionCountFn func(ctx context.Context, userID, channelID int64) error
+	IncrementMentionCountsFn func(ctx context.Context, channelID int64, userIDs []int64) error
 }
 
 func (m *mockReadStateRepo) Upsert(ctx context.Context, userID, channelID, lastMessageID int64) error {
@@ -529,6 +749,18 @@ func (m *mockReadStateRepo) IncrementMentionCount(ctx context.Context, userID, c
 	return nil
 }
 
+func (m *mockReadStateRepo) IncrementMentionCounts(ctx context.Context, channelID int64, userIDs []int64) error {
+	if m.IncrementMentionCountsFn != nil {
+		return m.IncrementMentionCountsFn(ctx, channelID, userIDs)
+	}
+	for _, userID := range userIDs {
+		if err := m.IncrementMentionCount(ctx, userID, channelID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // mockReactionRepo implements database.ReactionRepository.
 type mockReactionRepo struct {
 	AddFn                func(ctx context.Context, messageID, userID int64, emoji string) error
@@ -636,6 +868,9 @@ type mockVoiceStateRepo struct {
 	GetByChannelFn func(ctx context.Context, channelID int64) ([]models.VoiceState, error)
 	GetByGuildFn   func(ctx context.Context, guildID int64) ([]models.VoiceState, error)
 	GetByUserFn    func(ctx context.Context, guildID, userID int64) (*models.VoiceState, error)
+
+	GetJoinedBeforeFn func(ctx context.Context, before time.Time) ([]models.VoiceState, error)
+	DeleteByChannelFn func(ctx context.Context, channelID int64) ([]models.VoiceState, error)
 }
 
 func (m *mockVoiceStateRepo) Upsert(ctx context.Context, state *models.VoiceState) error {
@@ -672,3 +907,17 @@ func (m *mockVoiceStateRepo) GetByUser(ctx context.Context, guildID, userID int6
 	}
 	return nil, nil
 }
+
+func (m *mockVoiceStateRepo) GetJoinedBefore(ctx context.Context, before time.Time) ([]models.VoiceState, error) {
+	if m.GetJoinedBeforeFn != nil {
+		return m.GetJoinedBeforeFn(ctx, before)
+	}
+	return nil, nil
+}
+
+func (m *mockVoiceStateRepo) DeleteByChannel(ctx context.Context, channelID int64) ([]models.VoiceState, error) {
+	if m.DeleteByChannelFn != nil {
+		return m.DeleteByChannelFn(ctx, channelID)
+	}
+	return nil, nil
+}
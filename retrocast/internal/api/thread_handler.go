@@ -0,0 +1,169 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/victorivanov/retrocast/internal/auth"
+	"github.com/victorivanov/retrocast/internal/service"
+)
+
+// ThreadHandler handles thread endpoints.
+type ThreadHandler struct {
+	service *service.ThreadService
+}
+
+// NewThreadHandler creates a ThreadHandler.
+func NewThreadHandler(svc *service.ThreadService) *ThreadHandler {
+	return &ThreadHandler{service: svc}
+}
+
+type createThreadRequest struct {
+	Name                string `json:"name"`
+	AutoArchiveDuration *int   `json:"auto_archive_duration"`
+}
+
+// CreateThread handles POST /api/v1/channels/:id/threads.
+func (h *ThreadHandler) CreateThread(c echo.Context) error {
+	channelID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return errorJSON(c, http.StatusBadRequest, "INVALID_ID", "invalid channel ID")
+	}
+
+	userID := auth.GetUserID(c)
+
+	var req createThreadRequest
+	if err := c.Bind(&req); err != nil {
+		return errorJSON(c, http.StatusBadRequest, "INVALID_BODY", "invalid request body")
+	}
+
+	thread, err := h.service.CreateThread(c.Request().Context(), channelID, userID, req.Name, req.AutoArchiveDuration)
+	if err != nil {
+		return mapServiceError(c, err)
+	}
+
+	return c.JSON(http.StatusCreated, map[string]any{"data": thread})
+}
+
+// CreateThreadFromMessage handles POST /api/v1/channels/:id/messages/:message_id/threads.
+func (h *ThreadHandler) CreateThreadFromMessage(c echo.Context) error {
+	channelID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return errorJSON(c, http.StatusBadRequest, "INVALID_ID", "invalid channel ID")
+	}
+
+	messageID, err := strconv.ParseInt(c.Param("message_id"), 10, 64)
+	if err != nil {
+		return errorJSON(c, http.StatusBadRequest, "INVALID_ID", "invalid message ID")
+	}
+
+	userID := auth.GetUserID(c)
+
+	var req createThreadRequest
+	if err := c.Bind(&req); err != nil {
+		return errorJSON(c, http.StatusBadRequest, "INVALID_BODY", "invalid request body")
+	}
+
+	thread, err := h.service.CreateThreadFromMessage(c.Request().Context(), channelID, messageID, userID, req.Name, req.AutoArchiveDuration)
+	if err != nil {
+		return mapServiceError(c, err)
+	}
+
+	return c.JSON(http.StatusCreated, map[string]any{"data": thread})
+}
+
+// ListThreads handles GET /api/v1/channels/:id/threads.
+func (h *ThreadHandler) ListThreads(c echo.Context) error {
+	channelID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return errorJSON(c, http.StatusBadRequest, "INVALID_ID", "invalid channel ID")
+	}
+
+	userID := auth.GetUserID(c)
+	archived := c.QueryParam("archived") == "true"
+
+	threads, err := h.service.ListThreads(c.Request().Context(), channelID, userID, archived)
+	if err != nil {
+		return mapServiceError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{"data": threads})
+}
+
+type updateThreadRequest struct {
+	Name                *string `json:"name"`
+	Archived            *bool   `json:"archived"`
+	AutoArchiveDuration *int    `json:"auto_archive_duration"`
+}
+
+// UpdateThread handles PATCH /api/v1/threads/:id.
+func (h *ThreadHandler) UpdateThread(c echo.Context) error {
+	threadID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return errorJSON(c, http.StatusBadRequest, "INVALID_ID", "invalid thread ID")
+	}
+
+	userID := auth.GetUserID(c)
+
+	var req updateThreadRequest
+	if err := c.Bind(&req); err != nil {
+		return errorJSON(c, http.StatusBadRequest, "INVALID_BODY", "invalid request body")
+	}
+
+	thread, err := h.service.UpdateThread(c.Request().Context(), threadID, userID, req.Name, req.Archived, req.AutoArchiveDuration)
+	if err != nil {
+		return mapServiceError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{"data": thread})
+}
+
+// ListThreadMembers handles GET /api/v1/threads/:id/members.
+func (h *ThreadHandler) ListThreadMembers(c echo.Context) error {
+	threadID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return errorJSON(c, http.StatusBadRequest, "INVALID_ID", "invalid thread ID")
+	}
+
+	userID := auth.GetUserID(c)
+
+	members, err := h.service.ListThreadMembers(c.Request().Context(), threadID, userID)
+	if err != nil {
+		return mapServiceError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{"data": members})
+}
+
+// JoinThread handles PUT /api/v1/threads/:id/members/@me.
+func (h *ThreadHandler) JoinThread(c echo.Context) error {
+	threadID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return errorJSON(c, http.StatusBadRequest, "INVALID_ID", "invalid thread ID")
+	}
+
+	userID := auth.GetUserID(c)
+
+	if err := h.service.JoinThread(c.Request().Context(), threadID, userID); err != nil {
+		return mapServiceError(c, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// LeaveThread handles DELETE /api/v1/threads/:id/members/@me.
+func (h *ThreadHandler) LeaveThread(c echo.Context) error {
+	threadID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return errorJSON(c, http.StatusBadRequest, "INVALID_ID", "invalid thread ID")
+	}
+
+	userID := auth.GetUserID(c)
+
+	if err := h.service.LeaveThread(c.Request().Context(), threadID, userID); err != nil {
+		return mapServiceError(c, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
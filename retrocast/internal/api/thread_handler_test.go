@@ -0,0 +1,412 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/victorivanov/retrocast/internal/database"
+	"github.com/victorivanov/retrocast/internal/gateway"
+	"github.com/victorivanov/retrocast/internal/models"
+	"github.com/victorivanov/retrocast/internal/permissions"
+	"github.com/victorivanov/retrocast/internal/service"
+)
+
+const testThreadID int64 = 2100
+
+// threadFixture wires a ThreadHandler and a MessageHandler to shared mocks:
+// testChannelID is a text channel, testVoiceChannelID a voice channel and
+// testThreadID a thread under testChannelID owned by testUserID.
+type threadFixture struct {
+	h         *ThreadHandler
+	messages  *MessageHandler
+	gw        *mockGateway
+	channels  *mockChannelRepo
+	msgs      *mockMessageRepo
+	members   *mockThreadMemberRepo
+	roles     *mockRoleRepo
+	overrides *mockChannelOverrideRepo
+	thread    *models.Channel
+	created   *models.Channel
+	updated   *models.Channel
+}
+
+func newThreadFixture(t *testing.T, everyonePerms permissions.Permission) *threadFixture {
+	t.Helper()
+	parentID := testChannelID
+	f := &threadFixture{
+		gw: &mockGateway{},
+		thread: &models.Channel{
+			ID: testThreadID, GuildID: testGuildID, Name: "side-topic", Type: models.ChannelTypeThread, ParentID: &parentID,
+			Thread: &models.ThreadMetadata{OwnerID: testUserID, AutoArchiveDuration: 1440, ArchiveTimestamp: time.Now()},
+		},
+	}
+	guilds, mems, roles, overrides := permMocks(everyonePerms)
+	f.roles, f.overrides = roles, overrides
+
+	f.channels = &mockChannelRepo{
+		GetByIDFn: func(_ context.Context, id int64) (*models.Channel, error) {
+			switch id {
+			case testChannelID:
+				return &models.Channel{ID: testChannelID, GuildID: testGuildID, Name: "general", Type: models.ChannelTypeText}, nil
+			case testVoiceChannelID:
+				return &models.Channel{ID: testVoiceChannelID, GuildID: testGuildID, Name: "voice", Type: models.ChannelTypeVoice}, nil
+			case testThreadID:
+				th := *f.thread
+				meta := *f.thread.Thread
+				th.Thread = &meta
+				return &th, nil
+			}
+			return nil, nil
+		},
+		CreateFn: func(_ context.Context, ch *models.Channel) error {
+			f.created = ch
+			return nil
+		},
+		UpdateFn: func(_ context.Context, ch *models.Channel) error {
+			f.updated = ch
+			return nil
+		},
+	}
+	f.msgs = &mockMessageRepo{
+		GetByIDFn: func(_ context.Context, id int64) (*models.MessageWithAuthor, error) {
+			return &models.MessageWithAuthor{Message: models.Message{ID: id, ChannelID: testChannelID, AuthorID: 3001, Content: "what does everyone think about the new logo?"}}, nil
+		},
+	}
+	f.members = &mockThreadMemberRepo{
+		AddFn: func(_ context.Context, _, _ int64) (bool, error) { return true, nil },
+		GetByThreadFn: func(_ context.Context, threadID int64) ([]models.ThreadMember, error) {
+			return []models.ThreadMember{{ThreadID: threadID, UserID: testUserID, JoinedAt: time.Now()}}, nil
+		},
+	}
+
+	perms := service.NewPermissionChecker(guilds, mems, roles, overrides, f.channels)
+	f.h = NewThreadHandler(service.NewThreadService(f.channels, f.msgs, f.members, testSnowflake(), f.gw, perms))
+	msgSvc := service.NewMessageService(f.msgs, &mockAttachmentRepo{}, f.channels, &mockDMChannelRepo{}, mems, roles, &mockReadStateRepo{}, testSnowflake(), &mockStorage{}, f.gw, perms, nil)
+	f.messages = NewMessageHandler(msgSvc)
+	return f
+}
+
+// call runs handler with the given path params and JSON body as userID.
+func (f *threadFixture) call(t *testing.T, handler echo.HandlerFunc, method, body string, userID int64, params ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	c, rec := newTestContext(method, "/", strings.NewReader(body))
+	var names, values []string
+	for i := 0; i+1 < len(params); i += 2 {
+		names = append(names, params[i])
+		values = append(values, params[i+1])
+	}
+	c.SetParamNames(names...)
+	c.SetParamValues(values...)
+	setAuthUser(c, userID)
+
+	if err := handler(c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return rec
+}
+
+func (f *threadFixture) eventNames() []string {
+	var names []string
+	for _, e := range f.gw.events {
+		names = append(names, e.Event)
+	}
+	return names
+}
+
+func decodeChannel(t *testing.T, rec *httptest.ResponseRecorder) models.Channel {
+	t.Helper()
+	var resp struct {
+		Data models.Channel `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	return resp.Data
+}
+
+const threadTestPerms = permissions.PermViewChannel | permissions.PermSendMessages | permissions.PermReadMessageHistory
+
+// ---------------------------------------------------------------------------
+// CreateThread tests
+// ---------------------------------------------------------------------------
+
+func TestCreateThread_Success(t *testing.T) {
+	f := newThreadFixture(t, threadTestPerms)
+
+	rec := f.call(t, f.h.CreateThread, http.MethodPost, `{"name":"logo-feedback"}`, testUserID, "id", "2000")
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	got := decodeChannel(t, rec)
+	if got.Type != models.ChannelTypeThread || got.ParentID == nil || *got.ParentID != testChannelID {
+		t.Errorf("thread = %+v, want type %d under %d", got, models.ChannelTypeThread, testChannelID)
+	}
+	if got.Thread == nil || got.Thread.OwnerID != testUserID || got.Thread.AutoArchiveDuration != 1440 || got.Thread.Archived {
+		t.Errorf("thread_metadata = %+v", got.Thread)
+	}
+
+	names := f.eventNames()
+	if len(names) != 2 || names[0] != gateway.EventThreadCreate || names[1] != gateway.EventThreadMembersUpdate {
+		t.Fatalf("events = %v, want [THREAD_CREATE THREAD_MEMBERS_UPDATE]", names)
+	}
+	update := f.gw.events[1].Data.(gateway.ThreadMembersUpdateData)
+	if update.ID != f.created.ID || update.MemberCount != 1 || len(update.AddedMembers) != 1 || update.AddedMembers[0].UserID != testUserID {
+		t.Errorf("THREAD_MEMBERS_UPDATE = %+v", update)
+	}
+}
+
+func TestCreateThread_Validation(t *testing.T) {
+	tests := []struct {
+		name   string
+		parent string
+		body   string
+		want   int
+	}{
+		{"voice parent", "7000", `{"name":"x"}`, http.StatusBadRequest},
+		{"thread parent", "2100", `{"name":"x"}`, http.StatusBadRequest},
+		{"missing name", "2000", `{}`, http.StatusBadRequest},
+		{"bad auto archive duration", "2000", `{"name":"x","auto_archive_duration":30}`, http.StatusBadRequest},
+		{"unknown parent", "2999", `{"name":"x"}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newThreadFixture(t, threadTestPerms)
+			rec := f.call(t, f.h.CreateThread, http.MethodPost, tt.body, testUserID, "id", tt.parent)
+			if rec.Code != tt.want {
+				t.Fatalf("expected %d, got %d: %s", tt.want, rec.Code, rec.Body.String())
+			}
+			if f.created != nil {
+				t.Error("thread should not be created")
+			}
+		})
+	}
+}
+
+func TestCreateThread_RequiresSendMessagesInParent(t *testing.T) {
+	f := newThreadFixture(t, threadTestPerms)
+	f.overrides.GetByChannelFn = func(_ context.Context, channelID int64) ([]models.ChannelOverride, error) {
+		return []models.ChannelOverride{{ChannelID: channelID, TargetID: testRoleID, Deny: int64(permissions.PermSendMessages)}}, nil
+	}
+
+	rec := f.call(t, f.h.CreateThread, http.MethodPost, `{"name":"x"}`, testUserID, "id", "2000")
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestCreateThreadFromMessage_Success(t *testing.T) {
+	f := newThreadFixture(t, threadTestPerms)
+
+	rec := f.call(t, f.h.CreateThreadFromMessage, http.MethodPost, `{}`, testUserID, "id", "2000", "message_id", "5000")
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	got := decodeChannel(t, rec)
+	if got.Thread == nil || got.Thread.StarterMessageID == nil || *got.Thread.StarterMessageID != testMsgID {
+		t.Errorf("thread_metadata = %+v, want starter message %d", got.Thread, testMsgID)
+	}
+	if got.Name != "what does everyone think about the new logo?" {
+		t.Errorf("name = %q, want the message content", got.Name)
+	}
+}
+
+func TestCreateThreadFromMessage_MessageInOtherChannel(t *testing.T) {
+	f := newThreadFixture(t, threadTestPerms)
+	f.msgs.GetByIDFn = func(_ context.Context, id int64) (*models.MessageWithAuthor, error) {
+		return &models.MessageWithAuthor{Message: models.Message{ID: id, ChannelID: 2001}}, nil
+	}
+
+	rec := f.call(t, f.h.CreateThreadFromMessage, http.MethodPost, `{"name":"x"}`, testUserID, "id", "2000", "message_id", "5000")
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestCreateThreadFromMessage_AlreadyStarted(t *testing.T) {
+	f := newThreadFixture(t, threadTestPerms)
+	f.channels.GetThreadByStarterMessageFn = func(_ context.Context, _ int64) (*models.Channel, error) {
+		return f.thread, nil
+	}
+
+	rec := f.call(t, f.h.CreateThreadFromMessage, http.MethodPost, `{"name":"x"}`, testUserID, "id", "2000", "message_id", "5000")
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestCreateThreadFromMessage_ConcurrentlyStarted(t *testing.T) {
+	f := newThreadFixture(t, threadTestPerms)
+	// Another request created the thread between the check and the insert.
+	f.channels.CreateFn = func(context.Context, *models.Channel) error {
+		return database.ErrThreadAlreadyExists
+	}
+
+	rec := f.call(t, f.h.CreateThreadFromMessage, http.MethodPost, `{"name":"x"}`, testUserID, "id", "2000", "message_id", "5000")
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+	if resp.Error.Code != "THREAD_ALREADY_EXISTS" {
+		t.Errorf("expected THREAD_ALREADY_EXISTS, got %s", resp.Error.Code)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Permission inheritance tests
+// ---------------------------------------------------------------------------
+
+func TestThread_InheritsParentOverrides(t *testing.T) {
+	f := newThreadFixture(t, threadTestPerms)
+	var requested []int64
+	f.overrides.GetByChannelFn = func(_ context.Context, channelID int64) ([]models.ChannelOverride, error) {
+		requested = append(requested, channelID)
+		if channelID == testChannelID {
+			return []models.ChannelOverride{{ChannelID: channelID, TargetID: testRoleID, Deny: int64(permissions.PermSendMessages)}}, nil
+		}
+		return nil, nil
+	}
+
+	rec := f.call(t, f.messages.SendMessage, http.MethodPost, `{"content":"hi"}`, testUserID, "id", "2100")
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d: %s", rec.Code, rec.Body.String())
+	}
+	for _, id := range requested {
+		if id != testChannelID {
+			t.Errorf("overrides loaded for channel %d, want only the parent %d", id, testChannelID)
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+// UpdateThread tests
+// ---------------------------------------------------------------------------
+
+func TestUpdateThread_OwnerCanArchive(t *testing.T) {
+	f := newThreadFixture(t, threadTestPerms)
+	before := f.thread.Thread.ArchiveTimestamp
+
+	rec := f.call(t, f.h.UpdateThread, http.MethodPatch, `{"archived":true,"auto_archive_duration":60}`, testUserID, "id", "2100")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if f.updated == nil || !f.updated.Thread.Archived || f.updated.Thread.AutoArchiveDuration != 60 {
+		t.Fatalf("stored thread = %+v", f.updated)
+	}
+	if !f.updated.Thread.ArchiveTimestamp.After(before) {
+		t.Error("archive_timestamp should be bumped when archiving")
+	}
+	if names := f.eventNames(); len(names) != 1 || names[0] != gateway.EventThreadUpdate {
+		t.Errorf("events = %v, want [THREAD_UPDATE]", names)
+	}
+}
+
+func TestUpdateThread_RequiresOwnerOrManageThreads(t *testing.T) {
+	f := newThreadFixture(t, threadTestPerms)
+	rec := f.call(t, f.h.UpdateThread, http.MethodPatch, `{"name":"renamed"}`, 3001, "id", "2100")
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	f = newThreadFixture(t, threadTestPerms|permissions.PermManageThreads)
+	rec = f.call(t, f.h.UpdateThread, http.MethodPatch, `{"name":"renamed"}`, 3001, "id", "2100")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 with MANAGE_THREADS, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := decodeChannel(t, rec); got.Name != "renamed" {
+		t.Errorf("name = %q, want %q", got.Name, "renamed")
+	}
+}
+
+func TestUpdateThread_NotAThread(t *testing.T) {
+	f := newThreadFixture(t, threadTestPerms)
+	rec := f.call(t, f.h.UpdateThread, http.MethodPatch, `{"archived":true}`, testUserID, "id", "2000")
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestSendMessage_UnarchivesThread(t *testing.T) {
+	f := newThreadFixture(t, threadTestPerms)
+	f.thread.Thread.Archived = true
+	f.msgs.GetByIDFn = func(_ context.Context, id int64) (*models.MessageWithAuthor, error) {
+		return &models.MessageWithAuthor{Message: models.Message{ID: id, ChannelID: testThreadID, AuthorID: testUserID, Content: "hi"}}, nil
+	}
+
+	rec := f.call(t, f.messages.SendMessage, http.MethodPost, `{"content":"hi"}`, testUserID, "id", "2100")
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if f.updated == nil || f.updated.Thread.Archived {
+		t.Fatalf("thread should be stored unarchived, got %+v", f.updated)
+	}
+	names := f.eventNames()
+	if len(names) != 2 || names[0] != gateway.EventThreadUpdate || names[1] != gateway.EventMessageCreate {
+		t.Errorf("events = %v, want [THREAD_UPDATE MESSAGE_CREATE]", names)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Thread member tests
+// ---------------------------------------------------------------------------
+
+func TestJoinThread_DispatchesMembersUpdate(t *testing.T) {
+	f := newThreadFixture(t, threadTestPerms)
+	var joined int64
+	f.members.AddFn = func(_ context.Context, threadID, userID int64) (bool, error) {
+		joined = userID
+		return true, nil
+	}
+	f.members.GetByThreadFn = func(_ context.Context, threadID int64) ([]models.ThreadMember, error) {
+		return []models.ThreadMember{{ThreadID: threadID, UserID: testUserID}, {ThreadID: threadID, UserID: 3001}}, nil
+	}
+
+	rec := f.call(t, f.h.JoinThread, http.MethodPut, "", 3001, "id", "2100")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if joined != 3001 {
+		t.Errorf("joined user = %d, want 3001", joined)
+	}
+
+	if len(f.gw.events) != 1 || f.gw.events[0].Event != gateway.EventThreadMembersUpdate {
+		t.Fatalf("events = %v, want [THREAD_MEMBERS_UPDATE]", f.eventNames())
+	}
+	update := f.gw.events[0].Data.(gateway.ThreadMembersUpdateData)
+	if update.MemberCount != 2 || len(update.AddedMembers) != 1 || update.AddedMembers[0].UserID != 3001 {
+		t.Errorf("THREAD_MEMBERS_UPDATE = %+v", update)
+	}
+}
+
+func TestLeaveThread(t *testing.T) {
+	f := newThreadFixture(t, threadTestPerms)
+	f.members.RemoveFn = func(_ context.Context, _, _ int64) (bool, error) { return true, nil }
+
+	rec := f.call(t, f.h.LeaveThread, http.MethodDelete, "", testUserID, "id", "2100")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", rec.Code, rec.Body.String())
+	}
+	update := f.gw.events[0].Data.(gateway.ThreadMembersUpdateData)
+	if len(update.RemovedMemberIDs) != 1 || update.RemovedMemberIDs[0] != testUserID {
+		t.Errorf("removed_member_ids = %v, want [%d]", update.RemovedMemberIDs, testUserID)
+	}
+
+	// Leaving a thread one is not in is a no-op.
+	f = newThreadFixture(t, threadTestPerms)
+	rec = f.call(t, f.h.LeaveThread, http.MethodDelete, "", 3001, "id", "2100")
+	if rec.Code != http.StatusNoContent || len(f.gw.events) != 0 {
+		t.Errorf("got %d with events %v, want 204 and no events", rec.Code, f.eventNames())
+	}
+}
@@ -4,11 +4,13 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -55,9 +57,12 @@ func (m *mockStorage) Delete(ctx context.Context, key string) error {
 // ---------------------------------------------------------------------------
 
 type mockAttachmentRepo struct {
-	CreateFn         func(ctx context.Context, a *models.Attachment) error
-	GetByMessageIDFn func(ctx context.Context, messageID int64) ([]models.Attachment, error)
-	DeleteFn         func(ctx context.Context, id int64) error
+	CreateFn             func(ctx context.Context, a *models.Attachment) error
+	GetByMessageIDFn     func(ctx context.Context, messageID int64) ([]models.Attachment, error)
+	GetByMessageIDsFn    func(ctx context.Context, messageIDs []int64) ([]models.Attachment, error)
+	GetUnclaimedBeforeFn func(ctx context.Context, cutoff time.Time, limit int) ([]models.Attachment, error)
+	DeleteFn             func(ctx context.Context, id int64) error
+	MarkUnclaimedForDeletionFn func(ctx context.Context, id int64) (bool, error)
 }
 
 func (m *mockAttachmentRepo) Create(ctx context.Context, a *models.Attachment) error {
@@ -74,6 +79,20 @@ func (m *mockAttachmentRepo) GetByMessageID(ctx context.Context, messageID int64
 	return nil, nil
 }
 
+func (m *mockAttachmentRepo) GetByMessageIDs(ctx context.Context, messageIDs []int64) ([]models.Attachment, error) {
+	if m.GetByMessageIDsFn != nil {
+		return m.GetByMessageIDsFn(ctx, messageIDs)
+	}
+	return nil, nil
+}
+
+func (m *mockAttachmentRepo) GetUnclaimedBefore(ctx context.Context, cutoff time.Time, limit int) ([]models.Attachment, error) {
+	if m.GetUnclaimedBeforeFn != nil {
+		return m.GetUnclaimedBeforeFn(ctx, cutoff, limit)
+	}
+	return nil, nil
+}
+
 func (m *mockAttachmentRepo) Delete(ctx context.Context, id int64) error {
 	if m.DeleteFn != nil {
 		return m.DeleteFn(ctx, id)
@@ -81,6 +100,13 @@ func (m *mockAttachmentRepo) Delete(ctx context.Context, id int64) error {
 	return nil
 }
 
+func (m *mockAttachmentRepo) MarkUnclaimedForDeletion(ctx context.Context, id int64) (bool, error) {
+	if m.MarkUnclaimedForDeletionFn != nil {
+		return m.MarkUnclaimedForDeletionFn(ctx, id)
+	}
+	return true, nil
+}
+
 // ---------------------------------------------------------------------------
 // Helpers
 // ---------------------------------------------------------------------------
@@ -94,7 +120,7 @@ func newUploadHandler(
 	overrides *mockChannelOverrideRepo,
 	store *mockStorage,
 ) *UploadHandler {
-	perms := service.NewPermissionChecker(guilds, mems, roles, overrides)
+	perms := service.NewPermissionChecker(guilds, mems, roles, overrides, &mockChannelRepo{})
 	svc := service.NewUploadService(att, chs, testSnowflake(), store, perms)
 	return NewUploadHandler(svc)
 }
@@ -302,3 +328,158 @@ func TestUpload_ChannelNotFound(t *testing.T) {
 
 // Suppress "unused" warning for time import — used by permMocks in testutil_test.go.
 var _ = time.Now
+
+// ---------------------------------------------------------------------------
+// Unclaimed attachment janitor
+// ---------------------------------------------------------------------------
+
+func TestPruneUnclaimedAttachments_RemovesObjectsAndRows(t *testing.T) {
+	stale := []models.Attachment{
+		{ID: 1, StorageKey: "attachments/2000/1/a.png"},
+		{ID: 2, StorageKey: "attachments/2000/2/b.png"},
+		{ID: 3, StorageKey: "attachments/2000/3/c.png"},
+	}
+
+	var deletedKeys []string
+	var deletedIDs []int64
+	store := &mockStorage{
+		DeleteFn: func(_ context.Context, key string) error {
+			deletedKeys = append(deletedKeys, key)
+			return nil
+		},
+	}
+	cutoff := time.Now().Add(-time.Hour)
+	att := &mockAttachmentRepo{
+		GetUnclaimedBeforeFn: func(_ context.Context, before time.Time, _ int) ([]models.Attachment, error) {
+			if !before.Equal(cutoff) {
+				t.Errorf("cutoff = %v, want %v", before, cutoff)
+			}
+			return stale, nil
+		},
+		MarkUnclaimedForDeletionFn: func(_ context.Context, id int64) (bool, error) {
+			// Attachment 2 was claimed by a message after being listed.
+			return id != 2, nil
+		},
+		DeleteFn: func(_ context.Context, id int64) error {
+			deletedIDs = append(deletedIDs, id)
+			return nil
+		},
+	}
+
+	guilds, members, roles, overrides := permMocks(0)
+	perms := service.NewPermissionChecker(guilds, members, roles, overrides, &mockChannelRepo{})
+	svc := service.NewUploadService(att, channelMock(), testSnowflake(), store, perms)
+
+	removed, err := svc.PruneUnclaimedAttachments(context.Background(), cutoff)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if removed != 2 {
+		t.Fatalf("removed = %d, want 2", removed)
+	}
+	if len(deletedIDs) != 2 || deletedIDs[0] != 1 || deletedIDs[1] != 3 {
+		t.Errorf("deleted rows = %v, want [1 3]", deletedIDs)
+	}
+	// The claimed attachment's object is kept.
+	if len(deletedKeys) != 2 || deletedKeys[0] != "attachments/2000/1/a.png" || deletedKeys[1] != "attachments/2000/3/c.png" {
+		t.Errorf("deleted objects = %v, want a.png and c.png", deletedKeys)
+	}
+}
+
+func TestPruneUnclaimedAttachments_KeepsRowWhenObjectDeleteFails(t *testing.T) {
+	stale := []models.Attachment{
+		{ID: 1, StorageKey: "attachments/2000/1/a.png"},
+		{ID: 2, StorageKey: "attachments/2000/2/b.png"},
+	}
+
+	storageDown := true
+	store := &mockStorage{
+		DeleteFn: func(_ context.Context, key string) error {
+			if storageDown && key == "attachments/2000/2/b.png" {
+				return errors.New("storage unavailable")
+			}
+			return nil
+		},
+	}
+	var marked, deletedIDs []int64
+	att := &mockAttachmentRepo{
+		GetUnclaimedBeforeFn: func(context.Context, time.Time, int) ([]models.Attachment, error) {
+			return slices.DeleteFunc(slices.Clone(stale), func(a models.Attachment) bool {
+				return slices.Contains(deletedIDs, a.ID)
+			}), nil
+		},
+		MarkUnclaimedForDeletionFn: func(_ context.Context, id int64) (bool, error) {
+			marked = append(marked, id)
+			return true, nil
+		},
+		DeleteFn: func(_ context.Context, id int64) error {
+			deletedIDs = append(deletedIDs, id)
+			return nil
+		},
+	}
+
+	guilds, members, roles, overrides := permMocks(0)
+	perms := service.NewPermissionChecker(guilds, members, roles, overrides, &mockChannelRepo{})
+	svc := service.NewUploadService(att, channelMock(), testSnowflake(), store, perms)
+
+	removed, err := svc.PruneUnclaimedAttachments(context.Background(), time.Now())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if removed != 1 || len(deletedIDs) != 1 || deletedIDs[0] != 1 {
+		t.Fatalf("removed = %d, deleted rows = %v; want only row 1", removed, deletedIDs)
+	}
+	if len(marked) != 2 {
+		t.Errorf("marked = %v, want both rows pending deletion", marked)
+	}
+
+	// The row whose object survived is retried on the next run.
+	storageDown = false
+	removed, err = svc.PruneUnclaimedAttachments(context.Background(), time.Now())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if removed != 1 || len(deletedIDs) != 2 || deletedIDs[1] != 2 {
+		t.Errorf("retry removed = %d, deleted rows = %v; want row 2 removed", removed, deletedIDs)
+	}
+}
+
+func TestUpload_RecordsUploaderAndChannel(t *testing.T) {
+	guilds, members, roles, overrides := permMocks(permissions.PermAttachFiles | permissions.PermViewChannel)
+	channels := channelMock()
+	store := &mockStorage{}
+
+	var created *models.Attachment
+	att := &mockAttachmentRepo{
+		CreateFn: func(_ context.Context, a *models.Attachment) error {
+			created = a
+			return nil
+		},
+	}
+
+	h := newUploadHandler(att, channels, members, roles, guilds, overrides, store)
+
+	c, rec := newMultipartContext(t, "photo.png", "image/png", []byte("fake png data"))
+	c.SetParamNames("id")
+	c.SetParamValues("2000")
+	setAuthUser(c, testUserID)
+
+	if err := h.Upload(c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if created == nil {
+		t.Fatal("attachment was not persisted")
+	}
+	if created.MessageID != 0 {
+		t.Errorf("MessageID = %d, want 0 (unclaimed)", created.MessageID)
+	}
+	if created.UploaderID != testUserID || created.ChannelID != testChannelID {
+		t.Errorf("uploader/channel = %d/%d, want %d/%d", created.UploaderID, created.ChannelID, testUserID, testChannelID)
+	}
+	if created.CreatedAt.IsZero() {
+		t.Error("CreatedAt should be set")
+	}
+}
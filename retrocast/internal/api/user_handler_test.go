@@ -21,7 +21,7 @@ func TestGetMe(t *testing.T) {
 			return nil, nil
 		},
 	}
-	svc := service.NewUserService(users)
+	svc := service.NewUserService(users, nil)
 	h := NewUserHandler(svc)
 
 	c, rec := newTestContext(http.MethodGet, "/api/v1/users/@me", nil)
@@ -51,7 +51,7 @@ func TestGetMe(t *testing.T) {
 
 func TestGetMe_NotFound(t *testing.T) {
 	users := &mockUserRepo{} // GetByIDFn returns nil, nil by default
-	svc := service.NewUserService(users)
+	svc := service.NewUserService(users, nil)
 	h := NewUserHandler(svc)
 
 	c, rec := newTestContext(http.MethodGet, "/api/v1/users/@me", nil)
@@ -80,7 +80,7 @@ func TestGetMe_InternalError(t *testing.T) {
 			return nil, fmt.Errorf("db connection lost")
 		},
 	}
-	svc := service.NewUserService(users)
+	svc := service.NewUserService(users, nil)
 	h := NewUserHandler(svc)
 
 	c, rec := newTestContext(http.MethodGet, "/api/v1/users/@me", nil)
@@ -112,7 +112,7 @@ func TestUpdateMe(t *testing.T) {
 			return nil
 		},
 	}
-	svc := service.NewUserService(users)
+	svc := service.NewUserService(users, nil)
 	h := NewUserHandler(svc)
 
 	body := strings.NewReader(`{"display_name":"New Name"}`)
@@ -158,7 +158,7 @@ func TestUpdateMe_AvatarHash(t *testing.T) {
 			return nil
 		},
 	}
-	svc := service.NewUserService(users)
+	svc := service.NewUserService(users, nil)
 	h := NewUserHandler(svc)
 
 	body := strings.NewReader(`{"avatar":"abc123"}`)
@@ -186,7 +186,7 @@ func TestUpdateMe_EmptyBody(t *testing.T) {
 			return nil, nil
 		},
 	}
-	svc := service.NewUserService(users)
+	svc := service.NewUserService(users, nil)
 	h := NewUserHandler(svc)
 
 	// Empty JSON object: no fields to update, but bind succeeds. Update is still called.
@@ -212,7 +212,7 @@ func TestUpdateMe_DisplayNameTooLong(t *testing.T) {
 			return nil, nil
 		},
 	}
-	svc := service.NewUserService(users)
+	svc := service.NewUserService(users, nil)
 	h := NewUserHandler(svc)
 
 	longName := strings.Repeat("a", 33)
@@ -246,7 +246,7 @@ func TestUpdateMe_DisplayNameEmpty(t *testing.T) {
 			return nil, nil
 		},
 	}
-	svc := service.NewUserService(users)
+	svc := service.NewUserService(users, nil)
 	h := NewUserHandler(svc)
 
 	body := strings.NewReader(`{"display_name":""}`)
@@ -269,3 +269,55 @@ func TestUpdateMe_DisplayNameEmpty(t *testing.T) {
 		t.Errorf("expected error code 'INVALID_DISPLAY_NAME', got %q", errResp.Error.Code)
 	}
 }
+
+// mockPresences implements service.PresenceLoader from a fixed presence map.
+type mockPresences map[int64]models.Presence
+
+func (p mockPresences) GetPresences(_ context.Context, userIDs []int64) (map[int64]models.Presence, error) {
+	found := make(map[int64]models.Presence)
+	for _, id := range userIDs {
+		if presence, ok := p[id]; ok {
+			found[id] = presence
+		}
+	}
+	return found, nil
+}
+
+func TestGetMe_IncludesPresence(t *testing.T) {
+	users := &mockUserRepo{
+		GetByIDFn: func(_ context.Context, id int64) (*models.User, error) {
+			return &models.User{ID: id, Username: "testuser"}, nil
+		},
+	}
+	emoji := "🎧"
+	presences := mockPresences{1: {
+		Status:       "dnd",
+		CustomStatus: &models.CustomStatus{Text: "focusing", Emoji: &emoji},
+		Activities:   []models.Activity{{Type: models.ActivityListening, Name: "lofi"}},
+	}}
+	h := NewUserHandler(service.NewUserService(users, presences))
+
+	c, rec := newTestContext(http.MethodGet, "/api/v1/users/@me", nil)
+	setAuthUser(c, 1)
+
+	if err := h.GetMe(c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var resp struct {
+		Data models.User `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	p := resp.Data.Presence
+	if p == nil {
+		t.Fatal("expected a presence")
+	}
+	if p.Status != "dnd" || p.CustomStatus == nil || p.CustomStatus.Text != "focusing" || *p.CustomStatus.Emoji != emoji {
+		t.Errorf("presence = %+v, want dnd with custom status 'focusing'", p)
+	}
+	if len(p.Activities) != 1 || p.Activities[0] != (models.Activity{Type: models.ActivityListening, Name: "lofi"}) {
+		t.Errorf("activities = %+v, want listening to lofi", p.Activities)
+	}
+}
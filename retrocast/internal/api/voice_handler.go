@@ -1,6 +1,7 @@
 package api
 
 import (
+	"io"
 	"net/http"
 	"strconv"
 
@@ -68,3 +69,111 @@ func (h *VoiceHandler) GetVoiceStates(c echo.Context) error {
 
 	return c.JSON(http.StatusOK, states)
 }
+
+type updateVoiceStateRequest struct {
+	Mute      *bool  `json:"mute"`
+	Deaf      *bool  `json:"deaf"`
+	Suppress  *bool  `json:"suppress"`
+	ChannelID *int64 `json:"channel_id,string"`
+}
+
+// UpdateVoiceState handles PATCH /api/v1/guilds/:id/voice-states/:user_id.
+func (h *VoiceHandler) UpdateVoiceState(c echo.Context) error {
+	guildID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return Error(c, http.StatusBadRequest, "INVALID_ID", "invalid guild ID")
+	}
+
+	targetUserID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+	if err != nil {
+		return Error(c, http.StatusBadRequest, "INVALID_ID", "invalid user ID")
+	}
+
+	var req updateVoiceStateRequest
+	if err := c.Bind(&req); err != nil {
+		return Error(c, http.StatusBadRequest, "INVALID_BODY", "invalid request body")
+	}
+
+	callerID := auth.GetUserID(c)
+
+	state, err := h.service.UpdateMemberVoiceState(c.Request().Context(), guildID, callerID, targetUserID, service.UpdateVoiceStateParams{
+		Mute:      req.Mute,
+		Deaf:      req.Deaf,
+		Suppress:  req.Suppress,
+		ChannelID: req.ChannelID,
+	})
+	if err != nil {
+		return mapServiceError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, state)
+}
+
+type updateSelfVoiceStateRequest struct {
+	RequestToSpeak *bool `json:"request_to_speak"`
+	Suppress       *bool `json:"suppress"`
+}
+
+// UpdateSelfVoiceState handles PATCH /api/v1/guilds/:id/voice-states/@me.
+func (h *VoiceHandler) UpdateSelfVoiceState(c echo.Context) error {
+	guildID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return Error(c, http.StatusBadRequest, "INVALID_ID", "invalid guild ID")
+	}
+
+	var req updateSelfVoiceStateRequest
+	if err := c.Bind(&req); err != nil {
+		return Error(c, http.StatusBadRequest, "INVALID_BODY", "invalid request body")
+	}
+
+	userID := auth.GetUserID(c)
+
+	state, err := h.service.UpdateSelfVoiceState(c.Request().Context(), guildID, userID, service.UpdateSelfVoiceStateParams{
+		RequestToSpeak: req.RequestToSpeak,
+		Suppress:       req.Suppress,
+	})
+	if err != nil {
+		return mapServiceError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, state)
+}
+
+// DisconnectVoiceMember handles DELETE /api/v1/guilds/:id/voice-states/:user_id.
+func (h *VoiceHandler) DisconnectVoiceMember(c echo.Context) error {
+	guildID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return Error(c, http.StatusBadRequest, "INVALID_ID", "invalid guild ID")
+	}
+
+	targetUserID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+	if err != nil {
+		return Error(c, http.StatusBadRequest, "INVALID_ID", "invalid user ID")
+	}
+
+	callerID := auth.GetUserID(c)
+
+	if err := h.service.DisconnectMember(c.Request().Context(), guildID, callerID, targetUserID); err != nil {
+		return mapServiceError(c, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// maxWebhookBody bounds the size of a LiveKit webhook body.
+const maxWebhookBody = 1 << 20
+
+// LiveKitWebhook handles POST /api/v1/voice/webhook, called by the LiveKit
+// server and authenticated by its signature.
+func (h *VoiceHandler) LiveKitWebhook(c echo.Context) error {
+	body, err := io.ReadAll(io.LimitReader(c.Request().Body, maxWebhookBody))
+	if err != nil {
+		return Error(c, http.StatusBadRequest, "INVALID_BODY", "invalid request body")
+	}
+
+	if err := h.service.HandleLiveKitWebhook(c.Request().Context(), body, c.Request().Header.Get(echo.HeaderAuthorization)); err != nil {
+		return mapServiceError(c, err)
+	}
+
+	return c.NoContent(http.StatusOK)
+}
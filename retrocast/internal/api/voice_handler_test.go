@@ -2,11 +2,20 @@ package api
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/victorivanov/retrocast/internal/gateway"
 	"github.com/victorivanov/retrocast/internal/models"
 	"github.com/victorivanov/retrocast/internal/permissions"
 	"github.com/victorivanov/retrocast/internal/service"
@@ -27,8 +36,26 @@ func newVoiceHandler(
 	roles *mockRoleRepo,
 	overrides *mockChannelOverrideRepo,
 ) *VoiceHandler {
-	perms := service.NewPermissionChecker(guilds, members, roles, overrides)
-	svc := service.NewVoiceService(voiceStates, channels, users, gw, perms, "test-api-key", "test-api-secret")
+	return newVoiceHandlerWith(voiceStates, channels, users, gw, guilds, members, roles, overrides, nil, nil)
+}
+
+// newVoiceHandlerWith is newVoiceHandler with moderation enforced through
+// rooms and gateway sessions reported by sessions.
+func newVoiceHandlerWith(
+	voiceStates *mockVoiceStateRepo,
+	channels *mockChannelRepo,
+	users *mockUserRepo,
+	gw *mockGateway,
+	guilds *mockGuildRepo,
+	members *mockMemberRepo,
+	roles *mockRoleRepo,
+	overrides *mockChannelOverrideRepo,
+	rooms service.VoiceRooms,
+	sessions service.SessionTracker,
+) *VoiceHandler {
+	perms := service.NewPermissionChecker(guilds, members, roles, overrides, &mockChannelRepo{})
+	audit := service.NewAuditLogService(&mockAuditLogRepo{}, testSnowflake(), perms)
+	svc := service.NewVoiceService(voiceStates, channels, users, gw, sessions, perms, audit, rooms, "ws://livekit.test", "test-api-key", "test-api-secret")
 	return NewVoiceHandler(svc)
 }
 
@@ -394,3 +421,982 @@ func TestGetVoiceStates_EmptyChannel(t *testing.T) {
 		t.Fatalf("expected 0 states, got %d", len(states))
 	}
 }
+
+func TestJoinVoice_KeepsServerMute(t *testing.T) {
+	guilds, members, roles, overrides := voicePermMocks(permissions.PermConnect | permissions.PermViewChannel)
+	users := &mockUserRepo{
+		GetByIDFn: func(_ context.Context, id int64) (*models.User, error) {
+			return &models.User{ID: testUserID, Username: "testuser"}, nil
+		},
+	}
+	var upserted models.VoiceState
+	voiceStates := &mockVoiceStateRepo{
+		GetByUserFn: func(_ context.Context, guildID, userID int64) (*models.VoiceState, error) {
+			return &models.VoiceState{GuildID: testGuildID, ChannelID: testVoiceChannelID + 1, UserID: testUserID, SessionID: "voice-7001", Mute: true}, nil
+		},
+		UpsertFn: func(_ context.Context, state *models.VoiceState) error {
+			upserted = *state
+			return nil
+		},
+	}
+
+	h := newVoiceHandler(voiceStates, voiceChannelMock(), users, &mockGateway{}, guilds, members, roles, overrides)
+
+	c, rec := newTestContext(http.MethodPost, "/api/v1/channels/7000/voice/join", nil)
+	c.SetParamNames("id")
+	c.SetParamValues("7000")
+	setAuthUser(c, testUserID)
+
+	if err := h.JoinVoice(c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if !upserted.Mute || upserted.Deaf {
+		t.Errorf("upserted mute=%v deaf=%v, want the server mute carried over", upserted.Mute, upserted.Deaf)
+	}
+
+	var resp service.JoinChannelResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(resp.Token, claims, func(*jwt.Token) (any, error) { return []byte("test-api-secret"), nil }); err != nil {
+		t.Fatalf("failed to parse token: %v", err)
+	}
+	video, _ := claims["video"].(map[string]any)
+	if video["canPublish"] != false || video["canSubscribe"] != true {
+		t.Errorf("video grant = %v, want publishing denied and subscribing allowed", video)
+	}
+}
+
+func TestJoinVoice_UserLimit(t *testing.T) {
+	others := []models.VoiceState{
+		{GuildID: testGuildID, ChannelID: testVoiceChannelID, UserID: testVoiceTargetID},
+		{GuildID: testGuildID, ChannelID: testVoiceChannelID, UserID: testVoiceTargetID + 1},
+	}
+
+	tests := []struct {
+		name       string
+		perms      permissions.Permission
+		inChannel  []models.VoiceState
+		rejoining  bool
+		wantStatus int
+		wantMax    int
+	}{
+		{"room left", permissions.PermConnect, others[:1], false, http.StatusOK, 2},
+		{"full", permissions.PermConnect, others, false, http.StatusForbidden, 0},
+		{"full but may move members", permissions.PermConnect | permissions.PermMoveMembers, others, false, http.StatusOK, 3},
+		{"full but already in it", permissions.PermConnect, others, true, http.StatusOK, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guilds, members, roles, overrides := voicePermMocks(tt.perms | permissions.PermViewChannel)
+			channels := &mockChannelRepo{
+				GetByIDFn: func(_ context.Context, id int64) (*models.Channel, error) {
+					return &models.Channel{ID: testVoiceChannelID, GuildID: testGuildID, Name: "pairing", Type: models.ChannelTypeVoice, Bitrate: 96000, UserLimit: 2}, nil
+				},
+			}
+			users := &mockUserRepo{
+				GetByIDFn: func(_ context.Context, id int64) (*models.User, error) {
+					return &models.User{ID: testUserID, Username: "testuser"}, nil
+				},
+			}
+			var upserted bool
+			voiceStates := &mockVoiceStateRepo{
+				GetByUserFn: func(_ context.Context, guildID, userID int64) (*models.VoiceState, error) {
+					if tt.rejoining {
+						return &models.VoiceState{GuildID: testGuildID, ChannelID: testVoiceChannelID, UserID: testUserID}, nil
+					}
+					return nil, nil
+				},
+				GetByChannelFn: func(_ context.Context, channelID int64) ([]models.VoiceState, error) {
+					if upserted && !tt.rejoining {
+						return append(tt.inChannel[:len(tt.inChannel):len(tt.inChannel)], models.VoiceState{UserID: testUserID}), nil
+					}
+					return tt.inChannel, nil
+				},
+				UpsertFn: func(_ context.Context, state *models.VoiceState) error {
+					upserted = true
+					return nil
+				},
+			}
+
+			rooms := &mockVoiceRooms{}
+			h := newVoiceHandlerWith(voiceStates, channels, users, &mockGateway{}, guilds, members, roles, overrides, rooms, nil)
+
+			c, rec := newTestContext(http.MethodPost, "/api/v1/channels/7000/voice/join", nil)
+			c.SetParamNames("id")
+			c.SetParamValues("7000")
+			setAuthUser(c, testUserID)
+
+			if err := h.JoinVoice(c); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				if upserted {
+					t.Error("expected no voice state to be upserted")
+				}
+				if len(rooms.created) != 0 {
+					t.Errorf("rooms created = %v, want none", rooms.created)
+				}
+				return
+			}
+
+			var resp service.JoinChannelResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("failed to unmarshal response: %v", err)
+			}
+			if resp.Bitrate != 96000 {
+				t.Errorf("bitrate = %d, want the channel's 96000", resp.Bitrate)
+			}
+			if want := fmt.Sprintf("voice-7000 max=%d", tt.wantMax); len(rooms.created) != 1 || rooms.created[0] != want {
+				t.Errorf("rooms created = %v, want [%s]", rooms.created, want)
+			}
+		})
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Voice moderation tests
+// ---------------------------------------------------------------------------
+
+const testVoiceTargetID int64 = 8000
+
+type mockVoiceRooms struct {
+	created []string
+	updated []string
+	removed []string
+}
+
+func (m *mockVoiceRooms) CreateRoom(_ context.Context, room string, maxParticipants int) error {
+	m.created = append(m.created, fmt.Sprintf("%s max=%d", room, maxParticipants))
+	return nil
+}
+
+func (m *mockVoiceRooms) SetParticipantPermissions(_ context.Context, room, identity string, canPublish, canSubscribe bool) error {
+	m.updated = append(m.updated, fmt.Sprintf("%s/%s publish=%v subscribe=%v", room, identity, canPublish, canSubscribe))
+	return nil
+}
+
+func (m *mockVoiceRooms) RemoveParticipant(_ context.Context, room, identity string) error {
+	m.removed = append(m.removed, room+"/"+identity)
+	return nil
+}
+
+// voiceModerationMocks gives testUserID a role at callerPosition granting
+// perms, and testVoiceTargetID a role at targetPosition. The target is in
+// testVoiceChannelID.
+func voiceModerationMocks(perms permissions.Permission, callerPosition, targetPosition int) (*mockGuildRepo, *mockMemberRepo, *mockRoleRepo, *mockChannelOverrideRepo, *mockVoiceStateRepo) {
+	guilds, members, roles, overrides := voicePermMocks(permissions.PermConnect | permissions.PermViewChannel)
+	roles.GetByMemberFn = func(_ context.Context, _, userID int64) ([]models.Role, error) {
+		if userID == testVoiceTargetID {
+			return []models.Role{{ID: testRoleID + 2, GuildID: testGuildID, Position: targetPosition}}, nil
+		}
+		return []models.Role{{ID: testRoleID + 1, GuildID: testGuildID, Position: callerPosition, Permissions: int64(perms)}}, nil
+	}
+	voiceStates := &mockVoiceStateRepo{
+		GetByUserFn: func(_ context.Context, guildID, userID int64) (*models.VoiceState, error) {
+			return &models.VoiceState{GuildID: testGuildID, ChannelID: testVoiceChannelID, UserID: userID, SessionID: "voice-7000", JoinedAt: time.Now()}, nil
+		},
+	}
+	return guilds, members, roles, overrides, voiceStates
+}
+
+func patchVoiceState(t *testing.T, h *VoiceHandler, callerID, targetID int64, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	c, rec := newTestContext(http.MethodPatch, "/api/v1/guilds/1000/voice-states/8000", strings.NewReader(body))
+	c.SetParamNames("id", "user_id")
+	c.SetParamValues("1000", strconv.FormatInt(targetID, 10))
+	setAuthUser(c, callerID)
+	if err := h.UpdateVoiceState(c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return rec
+}
+
+func TestUpdateVoiceState_ServerMuteAndDeafen(t *testing.T) {
+	guilds, members, roles, overrides, voiceStates := voiceModerationMocks(permissions.PermMuteMembers|permissions.PermDeafenMembers, 2, 1)
+	var upserted models.VoiceState
+	voiceStates.UpsertFn = func(_ context.Context, state *models.VoiceState) error {
+		upserted = *state
+		return nil
+	}
+	gw := &mockGateway{}
+	rooms := &mockVoiceRooms{}
+
+	h := newVoiceHandlerWith(voiceStates, voiceChannelMock(), &mockUserRepo{}, gw, guilds, members, roles, overrides, rooms, nil)
+
+	rec := patchVoiceState(t, h, testUserID, testVoiceTargetID, `{"mute":true,"deaf":true}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if !upserted.Mute || !upserted.Deaf {
+		t.Errorf("upserted mute=%v deaf=%v, want both set", upserted.Mute, upserted.Deaf)
+	}
+	if want := "voice-7000/8000 publish=false subscribe=false"; len(rooms.updated) != 1 || rooms.updated[0] != want {
+		t.Errorf("participant updates = %v, want [%s]", rooms.updated, want)
+	}
+	if len(gw.events) != 1 || gw.events[0].Event != "VOICE_STATE_UPDATE" {
+		t.Fatalf("events = %+v, want one VOICE_STATE_UPDATE", gw.events)
+	}
+}
+
+func TestUpdateVoiceState_Move(t *testing.T) {
+	guilds, members, roles, overrides, voiceStates := voiceModerationMocks(permissions.PermMoveMembers, 2, 1)
+	var upserted models.VoiceState
+	voiceStates.UpsertFn = func(_ context.Context, state *models.VoiceState) error {
+		upserted = *state
+		return nil
+	}
+	channels := &mockChannelRepo{
+		GetByIDFn: func(_ context.Context, id int64) (*models.Channel, error) {
+			return &models.Channel{ID: id, GuildID: testGuildID, Name: "voice", Type: models.ChannelTypeVoice, Bitrate: 64000, UserLimit: 1}, nil
+		},
+	}
+	voiceStates.GetByChannelFn = func(_ context.Context, channelID int64) ([]models.VoiceState, error) {
+		return []models.VoiceState{upserted}, nil
+	}
+	rooms := &mockVoiceRooms{}
+	gw := &mockGateway{}
+
+	h := newVoiceHandlerWith(voiceStates, channels, voiceTargetUserMock(), gw, guilds, members, roles, overrides, rooms, nil)
+
+	rec := patchVoiceState(t, h, testUserID, testVoiceTargetID, `{"channel_id":"7001"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if upserted.ChannelID != testVoiceChannelID+1 || upserted.SessionID != "voice-7001" {
+		t.Errorf("upserted channel %d session %q, want 7001 and voice-7001", upserted.ChannelID, upserted.SessionID)
+	}
+	if len(rooms.removed) != 1 || rooms.removed[0] != "voice-7000/8000" {
+		t.Errorf("removed participants = %v, want [voice-7000/8000]", rooms.removed)
+	}
+	if len(rooms.created) != 1 || rooms.created[0] != "voice-7001 max=1" {
+		t.Errorf("rooms created = %v, want [voice-7001 max=1]", rooms.created)
+	}
+
+	// The moved member is told where to reconnect.
+	var server *gateway.VoiceServerUpdateData
+	for _, ev := range gw.events {
+		if ev.Event == gateway.EventVoiceServerUpdate {
+			if ev.UserID != testVoiceTargetID {
+				t.Errorf("VOICE_SERVER_UPDATE sent to user %d, want %d", ev.UserID, testVoiceTargetID)
+			}
+			server, _ = ev.Data.(*gateway.VoiceServerUpdateData)
+		}
+	}
+	if server == nil {
+		t.Fatal("expected a VOICE_SERVER_UPDATE for the moved member")
+	}
+	if server.ChannelID != testVoiceChannelID+1 || server.Endpoint != "ws://livekit.test" || server.Bitrate != 64000 {
+		t.Errorf("VOICE_SERVER_UPDATE = %+v, want channel 7001 on ws://livekit.test at 64000", server)
+	}
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(server.Token, claims, func(*jwt.Token) (any, error) { return []byte("test-api-secret"), nil }); err != nil {
+		t.Fatalf("failed to parse token: %v", err)
+	}
+	video, _ := claims["video"].(map[string]any)
+	if video["room"] != "voice-7001" || claims["sub"] != "8000" {
+		t.Errorf("token claims = %v, want user 8000 in room voice-7001", claims)
+	}
+}
+
+// voiceTargetUserMock returns testVoiceTargetID's user.
+func voiceTargetUserMock() *mockUserRepo {
+	return &mockUserRepo{
+		GetByIDFn: func(_ context.Context, id int64) (*models.User, error) {
+			return &models.User{ID: id, Username: "target"}, nil
+		},
+	}
+}
+
+func TestUpdateVoiceState_MoveToTextChannel(t *testing.T) {
+	guilds, members, roles, overrides, voiceStates := voiceModerationMocks(permissions.PermMoveMembers, 2, 1)
+	channels := &mockChannelRepo{
+		GetByIDFn: func(_ context.Context, id int64) (*models.Channel, error) {
+			return &models.Channel{ID: id, GuildID: testGuildID, Name: "general", Type: models.ChannelTypeText}, nil
+		},
+	}
+
+	h := newVoiceHandler(voiceStates, channels, &mockUserRepo{}, &mockGateway{}, guilds, members, roles, overrides)
+
+	rec := patchVoiceState(t, h, testUserID, testVoiceTargetID, `{"channel_id":"2000"}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestUpdateVoiceState_Rejected(t *testing.T) {
+	tests := []struct {
+		name     string
+		perms    permissions.Permission
+		callerID int64
+		targetID int64
+		body     string
+		status   int
+		code     string
+	}{
+		{"empty body", permissions.PermMuteMembers, testUserID, testVoiceTargetID, `{}`, http.StatusBadRequest, "INVALID_BODY"},
+		{"mute without MUTE_MEMBERS", permissions.PermDeafenMembers, testUserID, testVoiceTargetID, `{"mute":true}`, http.StatusForbidden, "MISSING_PERMISSIONS"},
+		{"deafen without DEAFEN_MEMBERS", permissions.PermMuteMembers, testUserID, testVoiceTargetID, `{"deaf":true}`, http.StatusForbidden, "MISSING_PERMISSIONS"},
+		{"target with an equal role", permissions.PermMuteMembers, testUserID, testVoiceTargetID, `{"mute":true}`, http.StatusForbidden, "ROLE_HIERARCHY"},
+		{"guild owner", permissions.PermMuteMembers, testUserID, testOwnerID, `{"mute":true}`, http.StatusForbidden, "FORBIDDEN"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			targetPosition := 1
+			if tt.code == "ROLE_HIERARCHY" {
+				targetPosition = 2
+			}
+			guilds, members, roles, overrides, voiceStates := voiceModerationMocks(tt.perms, 2, targetPosition)
+			voiceStates.UpsertFn = func(context.Context, *models.VoiceState) error {
+				t.Error("voice state must not be updated")
+				return nil
+			}
+
+			h := newVoiceHandler(voiceStates, voiceChannelMock(), &mockUserRepo{}, &mockGateway{}, guilds, members, roles, overrides)
+
+			rec := patchVoiceState(t, h, tt.callerID, tt.targetID, tt.body)
+			if rec.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			var resp ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("failed to unmarshal: %v", err)
+			}
+			if resp.Error.Code != tt.code {
+				t.Errorf("expected %s, got %s", tt.code, resp.Error.Code)
+			}
+		})
+	}
+}
+
+func TestDisconnectVoiceMember_Success(t *testing.T) {
+	guilds, members, roles, overrides, voiceStates := voiceModerationMocks(permissions.PermMoveMembers, 2, 1)
+	var deleted bool
+	voiceStates.DeleteFn = func(_ context.Context, guildID, userID int64) error {
+		deleted = userID == testVoiceTargetID
+		return nil
+	}
+	gw := &mockGateway{}
+	rooms := &mockVoiceRooms{}
+
+	h := newVoiceHandlerWith(voiceStates, voiceChannelMock(), &mockUserRepo{}, gw, guilds, members, roles, overrides, rooms, nil)
+
+	c, rec := newTestContext(http.MethodDelete, "/api/v1/guilds/1000/voice-states/8000", nil)
+	c.SetParamNames("id", "user_id")
+	c.SetParamValues("1000", "8000")
+	setAuthUser(c, testUserID)
+
+	if err := h.DisconnectVoiceMember(c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if !deleted {
+		t.Error("expected the target's voice state to be deleted")
+	}
+	if len(rooms.removed) != 1 || rooms.removed[0] != "voice-7000/8000" {
+		t.Errorf("removed participants = %v, want [voice-7000/8000]", rooms.removed)
+	}
+	if len(gw.events) != 1 || gw.events[0].Event != "VOICE_STATE_UPDATE" {
+		t.Fatalf("events = %+v, want one VOICE_STATE_UPDATE", gw.events)
+	}
+}
+
+func TestDisconnectVoiceMember_NoPermission(t *testing.T) {
+	guilds, members, roles, overrides, voiceStates := voiceModerationMocks(permissions.PermMuteMembers, 2, 1)
+	voiceStates.DeleteFn = func(context.Context, int64, int64) error {
+		t.Error("voice state must not be deleted")
+		return nil
+	}
+
+	h := newVoiceHandler(voiceStates, voiceChannelMock(), &mockUserRepo{}, &mockGateway{}, guilds, members, roles, overrides)
+
+	c, rec := newTestContext(http.MethodDelete, "/api/v1/guilds/1000/voice-states/8000", nil)
+	c.SetParamNames("id", "user_id")
+	c.SetParamValues("1000", "8000")
+	setAuthUser(c, testUserID)
+
+	if err := h.DisconnectVoiceMember(c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Gateway voice state update tests
+// ---------------------------------------------------------------------------
+
+func TestUpdateVoiceState_GatewayJoin(t *testing.T) {
+	guilds, members, roles, overrides := voicePermMocks(permissions.PermConnect | permissions.PermViewChannel)
+	users := &mockUserRepo{
+		GetByIDFn: func(_ context.Context, id int64) (*models.User, error) {
+			return &models.User{ID: testUserID, Username: "testuser"}, nil
+		},
+	}
+	var upserted models.VoiceState
+	voiceStates := &mockVoiceStateRepo{
+		UpsertFn: func(_ context.Context, state *models.VoiceState) error {
+			upserted = *state
+			return nil
+		},
+	}
+	gw := &mockGateway{}
+
+	h := newVoiceHandler(voiceStates, voiceChannelMock(), users, gw, guilds, members, roles, overrides)
+
+	channelID := testVoiceChannelID
+	server, err := h.service.UpdateVoiceState(context.Background(), testGuildID, testUserID, &channelID, true, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if server == nil || server.Token == "" || server.Endpoint != "ws://livekit.test" || server.ChannelID != testVoiceChannelID {
+		t.Fatalf("voice server = %+v, want a token for channel 7000 on ws://livekit.test", server)
+	}
+	if upserted.ChannelID != testVoiceChannelID || !upserted.SelfMute || upserted.SelfDeaf {
+		t.Errorf("upserted %+v, want channel 7000 self-muted", upserted)
+	}
+	if len(gw.events) != 1 || gw.events[0].Event != "VOICE_STATE_UPDATE" {
+		t.Fatalf("events = %+v, want one VOICE_STATE_UPDATE", gw.events)
+	}
+}
+
+func TestUpdateVoiceState_GatewaySelfDeafen(t *testing.T) {
+	guilds, members, roles, overrides := voicePermMocks(permissions.PermConnect | permissions.PermViewChannel)
+	var upserted models.VoiceState
+	voiceStates := &mockVoiceStateRepo{
+		GetByUserFn: func(_ context.Context, guildID, userID int64) (*models.VoiceState, error) {
+			return &models.VoiceState{GuildID: testGuildID, ChannelID: testVoiceChannelID, UserID: testUserID, SessionID: "voice-7000", Mute: true}, nil
+		},
+		UpsertFn: func(_ context.Context, state *models.VoiceState) error {
+			upserted = *state
+			return nil
+		},
+	}
+	gw := &mockGateway{}
+
+	h := newVoiceHandler(voiceStates, voiceChannelMock(), &mockUserRepo{}, gw, guilds, members, roles, overrides)
+
+	channelID := testVoiceChannelID
+	server, err := h.service.UpdateVoiceState(context.Background(), testGuildID, testUserID, &channelID, false, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if server != nil {
+		t.Errorf("voice server = %+v, want none without a channel change", server)
+	}
+	if !upserted.SelfDeaf || !upserted.Mute {
+		t.Errorf("upserted %+v, want self-deafened and still server-muted", upserted)
+	}
+	if len(gw.events) != 1 {
+		t.Fatalf("events = %+v, want one VOICE_STATE_UPDATE", gw.events)
+	}
+}
+
+func TestUpdateVoiceState_GatewayLeave(t *testing.T) {
+	guilds, members, roles, overrides := voicePermMocks(permissions.PermConnect | permissions.PermViewChannel)
+	var deleted bool
+	voiceStates := &mockVoiceStateRepo{
+		GetByUserFn: func(_ context.Context, guildID, userID int64) (*models.VoiceState, error) {
+			return &models.VoiceState{GuildID: testGuildID, ChannelID: testVoiceChannelID, UserID: testUserID, SessionID: "voice-7000"}, nil
+		},
+		DeleteFn: func(_ context.Context, guildID, userID int64) error {
+			deleted = true
+			return nil
+		},
+	}
+	gw := &mockGateway{}
+	rooms := &mockVoiceRooms{}
+
+	h := newVoiceHandlerWith(voiceStates, voiceChannelMock(), &mockUserRepo{}, gw, guilds, members, roles, overrides, rooms, nil)
+
+	server, err := h.service.UpdateVoiceState(context.Background(), testGuildID, testUserID, nil, false, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if server != nil || !deleted {
+		t.Errorf("server = %+v, deleted = %v; want no server and the state deleted", server, deleted)
+	}
+	if len(rooms.removed) != 1 || rooms.removed[0] != "voice-7000/3000" {
+		t.Errorf("removed participants = %v, want [voice-7000/3000]", rooms.removed)
+	}
+	if len(gw.events) != 1 || gw.events[0].Event != "VOICE_STATE_UPDATE" {
+		t.Fatalf("events = %+v, want one VOICE_STATE_UPDATE", gw.events)
+	}
+}
+
+func TestUpdateVoiceState_GatewayChannelInOtherGuild(t *testing.T) {
+	guilds, members, roles, overrides := voicePermMocks(permissions.PermConnect | permissions.PermViewChannel)
+	voiceStates := &mockVoiceStateRepo{
+		UpsertFn: func(context.Context, *models.VoiceState) error {
+			t.Error("voice state must not be updated")
+			return nil
+		},
+	}
+
+	h := newVoiceHandler(voiceStates, voiceChannelMock(), &mockUserRepo{}, &mockGateway{}, guilds, members, roles, overrides)
+
+	channelID := testVoiceChannelID
+	if _, err := h.service.UpdateVoiceState(context.Background(), testGuildID+1, testUserID, &channelID, false, false); err == nil {
+		t.Fatal("expected an error for a channel outside the guild")
+	}
+}
+
+// ---------------------------------------------------------------------------
+// LiveKit webhook and ghost sweep tests
+// ---------------------------------------------------------------------------
+
+// signWebhook signs body the way the LiveKit server does.
+func signWebhook(t *testing.T, body, secret string) string {
+	t.Helper()
+	sum := sha256.Sum256([]byte(body))
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss":    "test-api-key",
+		"exp":    time.Now().Add(5 * time.Minute).Unix(),
+		"sha256": base64.StdEncoding.EncodeToString(sum[:]),
+	}).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatalf("sign webhook: %v", err)
+	}
+	return token
+}
+
+func postWebhook(t *testing.T, h *VoiceHandler, body, authorization string) *httptest.ResponseRecorder {
+	t.Helper()
+	c, rec := newTestContext(http.MethodPost, "/api/v1/voice/webhook", strings.NewReader(body))
+	c.Request().Header.Set(echo.HeaderAuthorization, authorization)
+	if err := h.LiveKitWebhook(c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return rec
+}
+
+func participantEvent(event string, joinedAt time.Time) string {
+	return fmt.Sprintf(`{"event":%q,"room":{"sid":"RM_1","name":"voice-7000"},"participant":{"sid":"PA_1","identity":"3000","joinedAt":"%d"},"id":"EV_1","createdAt":"%d"}`,
+		event, joinedAt.Unix(), time.Now().Unix())
+}
+
+func TestLiveKitWebhook_ParticipantLeft(t *testing.T) {
+	joined := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name          string
+		stateJoinedAt time.Time
+		wantRemoved   bool
+	}{
+		{"removes the voice state", joined.Add(-time.Second), true},
+		{"keeps the state of a client that rejoined", joined.Add(time.Minute), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var deleted bool
+			voiceStates := &mockVoiceStateRepo{
+				GetByUserFn: func(_ context.Context, guildID, userID int64) (*models.VoiceState, error) {
+					return &models.VoiceState{GuildID: testGuildID, ChannelID: testVoiceChannelID, UserID: testUserID, SessionID: "voice-7000", JoinedAt: tt.stateJoinedAt}, nil
+				},
+				DeleteFn: func(_ context.Context, guildID, userID int64) error {
+					deleted = guildID == testGuildID && userID == testUserID
+					return nil
+				},
+			}
+			gw := &mockGateway{}
+
+			h := newVoiceHandler(voiceStates, voiceChannelMock(), &mockUserRepo{}, gw, &mockGuildRepo{}, &mockMemberRepo{}, &mockRoleRepo{}, &mockChannelOverrideRepo{})
+
+			body := participantEvent("participant_left", joined)
+			rec := postWebhook(t, h, body, signWebhook(t, body, "test-api-secret"))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+			}
+			if deleted != tt.wantRemoved {
+				t.Errorf("deleted = %v, want %v", deleted, tt.wantRemoved)
+			}
+			wantEvents := 0
+			if tt.wantRemoved {
+				wantEvents = 1
+			}
+			if len(gw.events) != wantEvents {
+				t.Errorf("events = %+v, want %d", gw.events, wantEvents)
+			}
+		})
+	}
+}
+
+func TestLiveKitWebhook_ParticipantJoinedWithoutVoiceState(t *testing.T) {
+	rooms := &mockVoiceRooms{}
+	h := newVoiceHandlerWith(&mockVoiceStateRepo{}, voiceChannelMock(), &mockUserRepo{}, &mockGateway{}, &mockGuildRepo{}, &mockMemberRepo{}, &mockRoleRepo{}, &mockChannelOverrideRepo{}, rooms, nil)
+
+	body := participantEvent("participant_joined", time.Now())
+	rec := postWebhook(t, h, body, signWebhook(t, body, "test-api-secret"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if len(rooms.removed) != 1 || rooms.removed[0] != "voice-7000/3000" {
+		t.Errorf("removed participants = %v, want [voice-7000/3000]", rooms.removed)
+	}
+}
+
+func TestLiveKitWebhook_RoomFinished(t *testing.T) {
+	voiceStates := &mockVoiceStateRepo{
+		DeleteByChannelFn: func(_ context.Context, channelID int64) ([]models.VoiceState, error) {
+			if channelID != testVoiceChannelID {
+				t.Errorf("channel = %d, want %d", channelID, testVoiceChannelID)
+			}
+			return []models.VoiceState{
+				{GuildID: testGuildID, ChannelID: testVoiceChannelID, UserID: testUserID},
+				{GuildID: testGuildID, ChannelID: testVoiceChannelID, UserID: testVoiceTargetID},
+			}, nil
+		},
+	}
+	gw := &mockGateway{}
+	h := newVoiceHandler(voiceStates, voiceChannelMock(), &mockUserRepo{}, gw, &mockGuildRepo{}, &mockMemberRepo{}, &mockRoleRepo{}, &mockChannelOverrideRepo{})
+
+	body := `{"event":"room_finished","room":{"sid":"RM_1","name":"voice-7000"},"id":"EV_2"}`
+	rec := postWebhook(t, h, body, signWebhook(t, body, "test-api-secret"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if len(gw.events) != 2 {
+		t.Fatalf("events = %+v, want a VOICE_STATE_UPDATE per removed state", gw.events)
+	}
+}
+
+func TestLiveKitWebhook_InvalidSignature(t *testing.T) {
+	voiceStates := &mockVoiceStateRepo{
+		DeleteFn: func(context.Context, int64, int64) error {
+			t.Error("voice state must not be deleted")
+			return nil
+		},
+	}
+	h := newVoiceHandler(voiceStates, voiceChannelMock(), &mockUserRepo{}, &mockGateway{}, &mockGuildRepo{}, &mockMemberRepo{}, &mockRoleRepo{}, &mockChannelOverrideRepo{})
+
+	body := participantEvent("participant_left", time.Now())
+	tests := []struct {
+		name          string
+		body          string
+		authorization string
+	}{
+		{"wrong secret", body, signWebhook(t, body, "wrong-secret")},
+		{"tampered body", strings.Replace(body, "3000", "3001", 1), signWebhook(t, body, "test-api-secret")},
+		{"missing", body, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := postWebhook(t, h, tt.body, tt.authorization)
+			if rec.Code != http.StatusUnauthorized {
+				t.Fatalf("expected 401, got %d: %s", rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+type mockSessions map[int64]bool
+
+func (m mockSessions) HasSession(userID int64) bool { return m[userID] }
+
+func TestSweepGhostVoiceStates(t *testing.T) {
+	cutoff := time.Now().Add(-time.Minute)
+	var deleted []int64
+	voiceStates := &mockVoiceStateRepo{
+		GetJoinedBeforeFn: func(_ context.Context, before time.Time) ([]models.VoiceState, error) {
+			if !before.Equal(cutoff) {
+				t.Errorf("before = %v, want %v", before, cutoff)
+			}
+			return []models.VoiceState{
+				{GuildID: testGuildID, ChannelID: testVoiceChannelID, UserID: testUserID, SessionID: "voice-7000"},
+				{GuildID: testGuildID, ChannelID: testVoiceChannelID, UserID: testVoiceTargetID, SessionID: "voice-7000"},
+			}, nil
+		},
+		DeleteFn: func(_ context.Context, guildID, userID int64) error {
+			deleted = append(deleted, userID)
+			return nil
+		},
+	}
+	gw := &mockGateway{}
+	rooms := &mockVoiceRooms{}
+	h := newVoiceHandlerWith(voiceStates, voiceChannelMock(), &mockUserRepo{}, gw, &mockGuildRepo{}, &mockMemberRepo{}, &mockRoleRepo{}, &mockChannelOverrideRepo{}, rooms, mockSessions{testUserID: true})
+
+	removed, err := h.service.SweepGhostVoiceStates(context.Background(), cutoff)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if removed != 1 || len(deleted) != 1 || deleted[0] != testVoiceTargetID {
+		t.Fatalf("removed %d, deleted %v; want only the user without a session", removed, deleted)
+	}
+	if len(rooms.removed) != 1 || rooms.removed[0] != "voice-7000/8000" {
+		t.Errorf("removed participants = %v, want [voice-7000/8000]", rooms.removed)
+	}
+	if len(gw.events) != 1 || gw.events[0].Event != "VOICE_STATE_UPDATE" {
+		t.Errorf("events = %+v, want one VOICE_STATE_UPDATE", gw.events)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Stage channel tests
+// ---------------------------------------------------------------------------
+
+func stageChannelMock() *mockChannelRepo {
+	return &mockChannelRepo{
+		GetByIDFn: func(_ context.Context, id int64) (*models.Channel, error) {
+			return &models.Channel{ID: testVoiceChannelID, GuildID: testGuildID, Name: "demo-day", Type: models.ChannelTypeStage, Bitrate: 64000}, nil
+		},
+	}
+}
+
+func patchSelfVoiceState(t *testing.T, h *VoiceHandler, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	c, rec := newTestContext(http.MethodPatch, "/api/v1/guilds/1000/voice-states/@me", strings.NewReader(body))
+	c.SetParamNames("id")
+	c.SetParamValues("1000")
+	setAuthUser(c, testUserID)
+	if err := h.UpdateSelfVoiceState(c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return rec
+}
+
+func TestJoinVoice_StageListener(t *testing.T) {
+	guilds, members, roles, overrides := voicePermMocks(permissions.PermConnect | permissions.PermViewChannel)
+	users := &mockUserRepo{
+		GetByIDFn: func(_ context.Context, id int64) (*models.User, error) {
+			return &models.User{ID: testUserID, Username: "testuser"}, nil
+		},
+	}
+	var upserted models.VoiceState
+	voiceStates := &mockVoiceStateRepo{
+		UpsertFn: func(_ context.Context, state *models.VoiceState) error {
+			upserted = *state
+			return nil
+		},
+	}
+
+	h := newVoiceHandler(voiceStates, stageChannelMock(), users, &mockGateway{}, guilds, members, roles, overrides)
+
+	channelID := testVoiceChannelID
+	server, err := h.service.UpdateVoiceState(context.Background(), testGuildID, testUserID, &channelID, false, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !upserted.Suppress || upserted.RequestToSpeakAt != nil {
+		t.Errorf("upserted %+v, want a suppressed listener without a raised hand", upserted)
+	}
+
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(server.Token, claims, func(*jwt.Token) (any, error) { return []byte("test-api-secret"), nil }); err != nil {
+		t.Fatalf("failed to parse token: %v", err)
+	}
+	video, _ := claims["video"].(map[string]any)
+	if video["canPublish"] != false || video["canSubscribe"] != true {
+		t.Errorf("video grant = %v, want publishing denied and subscribing allowed", video)
+	}
+}
+
+func TestUpdateSelfVoiceState(t *testing.T) {
+	raisedAt := time.Now().Add(-time.Minute)
+
+	tests := []struct {
+		name         string
+		perms        permissions.Permission
+		suppress     bool
+		raised       *time.Time
+		body         string
+		status       int
+		wantSuppress bool
+		wantRaised   bool
+		wantUpdate   string
+	}{
+		{"raise hand", 0, true, nil, `{"request_to_speak":true}`, http.StatusOK, true, true, ""},
+		{"lower hand", 0, true, &raisedAt, `{"request_to_speak":false}`, http.StatusOK, true, false, ""},
+		{"step down to the audience", 0, false, nil, `{"suppress":true}`, http.StatusOK, true, false, "voice-7000/3000 publish=false subscribe=true"},
+		{"moderator takes the stage", permissions.PermMuteMembers, true, &raisedAt, `{"suppress":false}`, http.StatusOK, false, false, "voice-7000/3000 publish=true subscribe=true"},
+		{"listener takes the stage", 0, true, nil, `{"suppress":false}`, http.StatusForbidden, false, false, ""},
+		{"speaker raises hand", 0, false, nil, `{"request_to_speak":true}`, http.StatusBadRequest, false, false, ""},
+		{"empty body", 0, true, nil, `{}`, http.StatusBadRequest, false, false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guilds, members, roles, overrides := voicePermMocks(tt.perms | permissions.PermConnect | permissions.PermViewChannel)
+			var upserted *models.VoiceState
+			voiceStates := &mockVoiceStateRepo{
+				GetByUserFn: func(_ context.Context, guildID, userID int64) (*models.VoiceState, error) {
+					return &models.VoiceState{GuildID: testGuildID, ChannelID: testVoiceChannelID, UserID: userID, SessionID: "voice-7000", Suppress: tt.suppress, RequestToSpeakAt: tt.raised}, nil
+				},
+				UpsertFn: func(_ context.Context, state *models.VoiceState) error {
+					upserted = state
+					return nil
+				},
+			}
+			gw := &mockGateway{}
+			rooms := &mockVoiceRooms{}
+
+			h := newVoiceHandlerWith(voiceStates, stageChannelMock(), &mockUserRepo{}, gw, guilds, members, roles, overrides, rooms, nil)
+
+			rec := patchSelfVoiceState(t, h, tt.body)
+			if rec.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			if tt.status != http.StatusOK {
+				if upserted != nil {
+					t.Error("voice state must not be updated")
+				}
+				return
+			}
+			if upserted == nil {
+				t.Fatal("expected the voice state to be updated")
+			}
+			if upserted.Suppress != tt.wantSuppress || (upserted.RequestToSpeakAt != nil) != tt.wantRaised {
+				t.Errorf("upserted suppress=%v request_to_speak_at=%v, want suppress=%v raised=%v", upserted.Suppress, upserted.RequestToSpeakAt, tt.wantSuppress, tt.wantRaised)
+			}
+			if tt.wantUpdate == "" && len(rooms.updated) != 0 || tt.wantUpdate != "" && (len(rooms.updated) != 1 || rooms.updated[0] != tt.wantUpdate) {
+				t.Errorf("participant updates = %v, want %q", rooms.updated, tt.wantUpdate)
+			}
+			if len(gw.events) != 1 || gw.events[0].Event != "VOICE_STATE_UPDATE" {
+				t.Fatalf("events = %+v, want one VOICE_STATE_UPDATE", gw.events)
+			}
+		})
+	}
+}
+
+func TestUpdateSelfVoiceState_RaisedHandKeepsItsPlace(t *testing.T) {
+	guilds, members, roles, overrides := voicePermMocks(permissions.PermConnect | permissions.PermViewChannel)
+	raisedAt := time.Now().Add(-time.Minute)
+	voiceStates := &mockVoiceStateRepo{
+		GetByUserFn: func(_ context.Context, guildID, userID int64) (*models.VoiceState, error) {
+			return &models.VoiceState{GuildID: testGuildID, ChannelID: testVoiceChannelID, UserID: userID, Suppress: true, RequestToSpeakAt: &raisedAt}, nil
+		},
+		UpsertFn: func(context.Context, *models.VoiceState) error {
+			t.Error("voice state must not be updated")
+			return nil
+		},
+	}
+	gw := &mockGateway{}
+
+	h := newVoiceHandler(voiceStates, stageChannelMock(), &mockUserRepo{}, gw, guilds, members, roles, overrides)
+
+	rec := patchSelfVoiceState(t, h, `{"request_to_speak":true}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if len(gw.events) != 0 {
+		t.Errorf("events = %+v, want none", gw.events)
+	}
+}
+
+func TestUpdateSelfVoiceState_NotStageChannel(t *testing.T) {
+	guilds, members, roles, overrides := voicePermMocks(permissions.PermConnect | permissions.PermViewChannel)
+	voiceStates := &mockVoiceStateRepo{
+		GetByUserFn: func(_ context.Context, guildID, userID int64) (*models.VoiceState, error) {
+			return &models.VoiceState{GuildID: testGuildID, ChannelID: testVoiceChannelID, UserID: userID}, nil
+		},
+	}
+
+	h := newVoiceHandler(voiceStates, voiceChannelMock(), &mockUserRepo{}, &mockGateway{}, guilds, members, roles, overrides)
+
+	rec := patchSelfVoiceState(t, h, `{"request_to_speak":true}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestUpdateVoiceState_InviteToSpeak(t *testing.T) {
+	// The target outranks the moderator: inviting them to speak is allowed
+	// all the same.
+	guilds, members, roles, overrides, voiceStates := voiceModerationMocks(permissions.PermMuteMembers, 1, 2)
+	raisedAt := time.Now().Add(-time.Minute)
+	voiceStates.GetByUserFn = func(_ context.Context, guildID, userID int64) (*models.VoiceState, error) {
+		return &models.VoiceState{GuildID: testGuildID, ChannelID: testVoiceChannelID, UserID: userID, SessionID: "voice-7000", Suppress: true, RequestToSpeakAt: &raisedAt}, nil
+	}
+	var upserted models.VoiceState
+	voiceStates.UpsertFn = func(_ context.Context, state *models.VoiceState) error {
+		upserted = *state
+		return nil
+	}
+	gw := &mockGateway{}
+	rooms := &mockVoiceRooms{}
+
+	h := newVoiceHandlerWith(voiceStates, stageChannelMock(), &mockUserRepo{}, gw, guilds, members, roles, overrides, rooms, nil)
+
+	rec := patchVoiceState(t, h, testUserID, testVoiceTargetID, `{"suppress":false}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if upserted.Suppress || upserted.RequestToSpeakAt != nil {
+		t.Errorf("upserted %+v, want a speaker with the hand lowered", upserted)
+	}
+	if want := "voice-7000/8000 publish=true subscribe=true"; len(rooms.updated) != 1 || rooms.updated[0] != want {
+		t.Errorf("participant updates = %v, want [%s]", rooms.updated, want)
+	}
+	if len(gw.events) != 1 || gw.events[0].Event != "VOICE_STATE_UPDATE" {
+		t.Fatalf("events = %+v, want one VOICE_STATE_UPDATE", gw.events)
+	}
+
+	// Sending them back to the audience is moderation and needs a higher role.
+	rec = patchVoiceState(t, h, testUserID, testVoiceTargetID, `{"suppress":true}`)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestUpdateVoiceState_SuppressRejected(t *testing.T) {
+	tests := []struct {
+		name     string
+		perms    permissions.Permission
+		channels *mockChannelRepo
+		status   int
+		code     string
+	}{
+		{"voice channel", permissions.PermMuteMembers, voiceChannelMock(), http.StatusBadRequest, "NOT_STAGE_CHANNEL"},
+		{"without MUTE_MEMBERS", permissions.PermDeafenMembers, stageChannelMock(), http.StatusForbidden, "MISSING_PERMISSIONS"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guilds, members, roles, overrides, voiceStates := voiceModerationMocks(tt.perms, 2, 1)
+			voiceStates.UpsertFn = func(context.Context, *models.VoiceState) error {
+				t.Error("voice state must not be updated")
+				return nil
+			}
+
+			h := newVoiceHandler(voiceStates, tt.channels, &mockUserRepo{}, &mockGateway{}, guilds, members, roles, overrides)
+
+			rec := patchVoiceState(t, h, testUserID, testVoiceTargetID, `{"suppress":false}`)
+			if rec.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			var resp ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("failed to unmarshal: %v", err)
+			}
+			if resp.Error.Code != tt.code {
+				t.Errorf("expected %s, got %s", tt.code, resp.Error.Code)
+			}
+		})
+	}
+}
+
+func TestUpdateVoiceState_MoveToStage(t *testing.T) {
+	guilds, members, roles, overrides, voiceStates := voiceModerationMocks(permissions.PermMoveMembers, 2, 1)
+	var upserted models.VoiceState
+	voiceStates.UpsertFn = func(_ context.Context, state *models.VoiceState) error {
+		upserted = *state
+		return nil
+	}
+
+	h := newVoiceHandler(voiceStates, stageChannelMock(), voiceTargetUserMock(), &mockGateway{}, guilds, members, roles, overrides)
+
+	rec := patchVoiceState(t, h, testUserID, testVoiceTargetID, `{"channel_id":"7001"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if upserted.ChannelID != testVoiceChannelID+1 || !upserted.Suppress {
+		t.Errorf("upserted %+v, want a suppressed listener in channel 7001", upserted)
+	}
+}
@@ -20,37 +20,42 @@ import (
 	"log/slog"
 	"os"
 	"strings"
+	"time"
 )
 
 type Config struct {
-	DatabaseURL      string
-	RedisURL         string
-	JWTSecret        string
-	ServerAddr       string
-	LogLevel         slog.Level
-	LiveKitURL       string
-	LiveKitAPIKey    string
-	LiveKitAPISecret string
-	MinIOEndpoint    string
-	MinIOAccessKey   string
-	MinIOSecretKey   string
+	DatabaseURL         string
+	RedisURL            string
+	JWTSecret           string
+	ServerAddr          string
+	LogLevel            slog.Level
+	LiveKitURL          string
+	LiveKitAPIKey       string
+	LiveKitAPISecret    string
+	MinIOEndpoint       string
+	MinIOAccessKey      string
+	MinIOSecretKey      string
+	GatewayCluster      bool
+	GatewayResumeWindow time.Duration
 }
 
 func Load() *Config {
 	fileVals := loadConfigFile()
 
 	cfg := &Config{
-		DatabaseURL:      resolve("DATABASE_URL", fileVals, ""),
-		RedisURL:         resolve("REDIS_URL", fileVals, "redis://localhost:6379"),
-		JWTSecret:        resolve("JWT_SECRET", fileVals, ""),
-		ServerAddr:       resolve("SERVER_ADDR", fileVals, ":8080"),
-		LogLevel:         parseLogLevel(resolve("LOG_LEVEL", fileVals, "")),
-		LiveKitURL:       resolve("LIVEKIT_URL", fileVals, ""),
-		LiveKitAPIKey:    resolve("LIVEKIT_API_KEY", fileVals, ""),
-		LiveKitAPISecret: resolve("LIVEKIT_API_SECRET", fileVals, ""),
-		MinIOEndpoint:    resolve("MINIO_ENDPOINT", fileVals, ""),
-		MinIOAccessKey:   resolve("MINIO_ACCESS_KEY", fileVals, ""),
-		MinIOSecretKey:   resolve("MINIO_SECRET_KEY", fileVals, ""),
+		DatabaseURL:         resolve("DATABASE_URL", fileVals, ""),
+		RedisURL:            resolve("REDIS_URL", fileVals, "redis://localhost:6379"),
+		JWTSecret:           resolve("JWT_SECRET", fileVals, ""),
+		ServerAddr:          resolve("SERVER_ADDR", fileVals, ":8080"),
+		LogLevel:            parseLogLevel(resolve("LOG_LEVEL", fileVals, "")),
+		LiveKitURL:          resolve("LIVEKIT_URL", fileVals, ""),
+		LiveKitAPIKey:       resolve("LIVEKIT_API_KEY", fileVals, ""),
+		LiveKitAPISecret:    resolve("LIVEKIT_API_SECRET", fileVals, ""),
+		MinIOEndpoint:       resolve("MINIO_ENDPOINT", fileVals, ""),
+		MinIOAccessKey:      resolve("MINIO_ACCESS_KEY", fileVals, ""),
+		MinIOSecretKey:      resolve("MINIO_SECRET_KEY", fileVals, ""),
+		GatewayCluster:      parseBool(resolve("GATEWAY_CLUSTER", fileVals, "")),
+		GatewayResumeWindow: parseDuration(resolve("GATEWAY_RESUME_WINDOW", fileVals, ""), 2*time.Minute),
 	}
 
 	var missing []string
@@ -149,3 +154,22 @@ func parseLogLevel(s string) slog.Level {
 		return slog.LevelInfo
 	}
 }
+
+func parseBool(s string) bool {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "1", "true", "yes", "on":
+		return true
+	default:
+		return false
+	}
+}
+
+// parseDuration parses a Go duration string such as "90s" or "2m", falling
+// back to def when s is empty or invalid.
+func parseDuration(s string, def time.Duration) time.Duration {
+	d, err := time.ParseDuration(strings.TrimSpace(s))
+	if err != nil || d < 0 {
+		return def
+	}
+	return d
+}
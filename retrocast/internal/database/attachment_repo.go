@@ -2,11 +2,19 @@ package database
 
 import (
 	"context"
+	"errors"
+	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/victorivanov/retrocast/internal/models"
 )
 
+// ErrAttachmentsUnavailable is returned when a message tries to claim
+// attachments that do not exist, belong to another uploader or channel, or
+// are already bound to a message.
+var ErrAttachmentsUnavailable = errors.New("attachments unavailable")
+
 type attachmentRepo struct {
 	pool *pgxpool.Pool
 }
@@ -15,18 +23,21 @@ func NewAttachmentRepository(pool *pgxpool.Pool) AttachmentRepository {
 	return &attachmentRepo{pool: pool}
 }
 
+const attachmentColumns = `id, COALESCE(message_id, 0), COALESCE(channel_id, 0), COALESCE(uploader_id, 0),
+		        filename, content_type, size, storage_key, created_at`
+
 func (r *attachmentRepo) Create(ctx context.Context, a *models.Attachment) error {
 	_, err := r.pool.Exec(ctx,
-		`INSERT INTO attachments (id, message_id, filename, content_type, size, storage_key)
-		 VALUES ($1, $2, $3, $4, $5, $6)`,
-		a.ID, a.MessageID, a.Filename, a.ContentType, a.Size, a.StorageKey,
+		`INSERT INTO attachments (id, message_id, channel_id, uploader_id, filename, content_type, size, storage_key, created_at)
+		 VALUES ($1, NULLIF($2, 0), NULLIF($3, 0), NULLIF($4, 0), $5, $6, $7, $8, $9)`,
+		a.ID, a.MessageID, a.ChannelID, a.UploaderID, a.Filename, a.ContentType, a.Size, a.StorageKey, a.CreatedAt,
 	)
 	return err
 }
 
 func (r *attachmentRepo) GetByMessageID(ctx context.Context, messageID int64) ([]models.Attachment, error) {
 	rows, err := r.pool.Query(ctx,
-		`SELECT id, message_id, filename, content_type, size, storage_key
+		`SELECT `+attachmentColumns+`
 		 FROM attachments
 		 WHERE message_id = $1
 		 ORDER BY id`, messageID,
@@ -34,20 +45,68 @@ func (r *attachmentRepo) GetByMessageID(ctx context.Context, messageID int64) ([
 	if err != nil {
 		return nil, err
 	}
+	return scanAttachments(rows)
+}
+
+func (r *attachmentRepo) GetByMessageIDs(ctx context.Context, messageIDs []int64) ([]models.Attachment, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT `+attachmentColumns+`
+		 FROM attachments
+		 WHERE message_id = ANY($1)
+		 ORDER BY message_id, id`, messageIDs,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanAttachments(rows)
+}
+
+func (r *attachmentRepo) GetUnclaimedBefore(ctx context.Context, cutoff time.Time, limit int) ([]models.Attachment, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT `+attachmentColumns+`
+		 FROM attachments
+		 WHERE message_id IS NULL AND created_at < $1
+		 ORDER BY created_at
+		 LIMIT $2`, cutoff, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanAttachments(rows)
+}
+
+func (r *attachmentRepo) Delete(ctx context.Context, id int64) error {
+	_, err := r.pool.Exec(ctx, `DELETE FROM attachments WHERE id = $1`, id)
+	return err
+}
+
+// MarkUnclaimedForDeletion marks an attachment that is not bound to a message
+// as pending deletion, so that no message can claim it any more, and reports
+// whether it did; a row claimed since it was listed is left alone. Marking a
+// row that is already pending deletion succeeds again.
+func (r *attachmentRepo) MarkUnclaimedForDeletion(ctx context.Context, id int64) (bool, error) {
+	tag, err := r.pool.Exec(ctx,
+		`UPDATE attachments SET pending_deletion = TRUE WHERE id = $1 AND message_id IS NULL`, id,
+	)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func scanAttachments(rows pgx.Rows) ([]models.Attachment, error) {
 	defer rows.Close()
 
 	var attachments []models.Attachment
 	for rows.Next() {
 		var a models.Attachment
-		if err := rows.Scan(&a.ID, &a.MessageID, &a.Filename, &a.ContentType, &a.Size, &a.StorageKey); err != nil {
+		if err := rows.Scan(
+			&a.ID, &a.MessageID, &a.ChannelID, &a.UploaderID,
+			&a.Filename, &a.ContentType, &a.Size, &a.StorageKey, &a.CreatedAt,
+		); err != nil {
 			return nil, err
 		}
 		attachments = append(attachments, a)
 	}
 	return attachments, rows.Err()
 }
-
-func (r *attachmentRepo) Delete(ctx context.Context, id int64) error {
-	_, err := r.pool.Exec(ctx, `DELETE FROM attachments WHERE id = $1`, id)
-	return err
-}
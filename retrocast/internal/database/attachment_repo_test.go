@@ -2,6 +2,7 @@ package database
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
@@ -149,6 +150,158 @@ func TestAttachmentRepo_Delete(t *testing.T) {
 	}
 }
 
+func TestAttachmentRepo_ClaimByMessage(t *testing.T) {
+	pool := testPool(t)
+	userRepo := NewUserRepository(pool)
+	guildRepo := NewGuildRepository(pool)
+	channelRepo := NewChannelRepository(pool)
+	messageRepo := NewMessageRepository(pool)
+	repo := NewAttachmentRepository(pool)
+	ctx := context.Background()
+
+	owner := createTestUserSimple(t, userRepo)
+	guild := createTestGuild(t, guildRepo, owner.ID)
+	ch := createTestChannel(t, channelRepo, guild.ID)
+	att := createTestUpload(t, repo, ch.ID, owner.ID, time.Now())
+
+	msg := &models.Message{
+		ID:        nextID(),
+		ChannelID: ch.ID,
+		AuthorID:  owner.ID,
+		CreatedAt: time.Now().Truncate(time.Microsecond),
+	}
+	if err := messageRepo.CreateWithAttachments(ctx, msg, []int64{att.ID}); err != nil {
+		t.Fatalf("CreateWithAttachments: %v", err)
+	}
+	t.Cleanup(func() { _ = messageRepo.Delete(ctx, msg.ID) })
+
+	attachments, err := repo.GetByMessageIDs(ctx, []int64{msg.ID})
+	if err != nil {
+		t.Fatalf("GetByMessageIDs: %v", err)
+	}
+	if len(attachments) != 1 || attachments[0].ID != att.ID {
+		t.Fatalf("expected attachment %d bound to message, got %+v", att.ID, attachments)
+	}
+
+	// A second message cannot claim the same upload, and is not created.
+	second := &models.Message{
+		ID:        nextID(),
+		ChannelID: ch.ID,
+		AuthorID:  owner.ID,
+		CreatedAt: time.Now().Truncate(time.Microsecond),
+	}
+	err = messageRepo.CreateWithAttachments(ctx, second, []int64{att.ID})
+	if !errors.Is(err, ErrAttachmentsUnavailable) {
+		t.Fatalf("second claim error = %v, want ErrAttachmentsUnavailable", err)
+	}
+	got, err := messageRepo.GetByID(ctx, second.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if got != nil {
+		t.Error("message should not exist after a failed claim")
+	}
+}
+
+func TestAttachmentRepo_ClaimRejectsOtherUploader(t *testing.T) {
+	pool := testPool(t)
+	userRepo := NewUserRepository(pool)
+	guildRepo := NewGuildRepository(pool)
+	channelRepo := NewChannelRepository(pool)
+	messageRepo := NewMessageRepository(pool)
+	repo := NewAttachmentRepository(pool)
+	ctx := context.Background()
+
+	owner := createTestUserSimple(t, userRepo)
+	other := createTestUserSimple(t, userRepo)
+	guild := createTestGuild(t, guildRepo, owner.ID)
+	ch := createTestChannel(t, channelRepo, guild.ID)
+	att := createTestUpload(t, repo, ch.ID, owner.ID, time.Now())
+
+	msg := &models.Message{
+		ID:        nextID(),
+		ChannelID: ch.ID,
+		AuthorID:  other.ID,
+		Content:   "stolen",
+		CreatedAt: time.Now().Truncate(time.Microsecond),
+	}
+	err := messageRepo.CreateWithAttachments(ctx, msg, []int64{att.ID})
+	if !errors.Is(err, ErrAttachmentsUnavailable) {
+		t.Fatalf("error = %v, want ErrAttachmentsUnavailable", err)
+	}
+}
+
+func TestAttachmentRepo_GetUnclaimedBefore(t *testing.T) {
+	pool := testPool(t)
+	userRepo := NewUserRepository(pool)
+	guildRepo := NewGuildRepository(pool)
+	channelRepo := NewChannelRepository(pool)
+	messageRepo := NewMessageRepository(pool)
+	repo := NewAttachmentRepository(pool)
+	ctx := context.Background()
+
+	owner := createTestUserSimple(t, userRepo)
+	guild := createTestGuild(t, guildRepo, owner.ID)
+	ch := createTestChannel(t, channelRepo, guild.ID)
+	msg := createTestMessage(t, messageRepo, ch.ID, owner.ID)
+
+	stale := createTestUpload(t, repo, ch.ID, owner.ID, time.Now().Add(-48*time.Hour))
+	fresh := createTestUpload(t, repo, ch.ID, owner.ID, time.Now())
+	claimed := &models.Attachment{
+		ID:          nextID(),
+		MessageID:   msg.ID,
+		Filename:    "claimed.txt",
+		ContentType: "text/plain",
+		Size:        1,
+		StorageKey:  "uploads/test/claimed",
+		CreatedAt:   time.Now().Add(-48 * time.Hour),
+	}
+	if err := repo.Create(ctx, claimed); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	t.Cleanup(func() { _ = repo.Delete(ctx, claimed.ID) })
+
+	attachments, err := repo.GetUnclaimedBefore(ctx, time.Now().Add(-24*time.Hour), 1000)
+	if err != nil {
+		t.Fatalf("GetUnclaimedBefore: %v", err)
+	}
+
+	found := map[int64]bool{}
+	for _, a := range attachments {
+		found[a.ID] = true
+	}
+	if !found[stale.ID] {
+		t.Error("stale unclaimed attachment not returned")
+	}
+	if found[fresh.ID] {
+		t.Error("fresh attachment should not be returned")
+	}
+	if found[claimed.ID] {
+		t.Error("claimed attachment should not be returned")
+	}
+}
+
+// createTestUpload inserts an unclaimed attachment and registers cleanup.
+func createTestUpload(t *testing.T, repo AttachmentRepository, channelID, uploaderID int64, createdAt time.Time) *models.Attachment {
+	t.Helper()
+	ctx := context.Background()
+	att := &models.Attachment{
+		ID:          nextID(),
+		ChannelID:   channelID,
+		UploaderID:  uploaderID,
+		Filename:    "upload.png",
+		ContentType: "image/png",
+		Size:        42,
+		StorageKey:  "uploads/test/upload.png",
+		CreatedAt:   createdAt.Truncate(time.Microsecond),
+	}
+	if err := repo.Create(ctx, att); err != nil {
+		t.Fatalf("createTestUpload: %v", err)
+	}
+	t.Cleanup(func() { _ = repo.Delete(ctx, att.ID) })
+	return att
+}
+
 // createTestMessage inserts a message and registers cleanup.
 func createTestMessage(t *testing.T, repo MessageRepository, channelID, authorID int64) *models.Message {
 	t.Helper()
@@ -166,3 +319,59 @@ func createTestMessage(t *testing.T, repo MessageRepository, channelID, authorID
 	t.Cleanup(func() { _ = repo.Delete(ctx, msg.ID) })
 	return msg
 }
+
+func TestAttachmentRepo_MarkUnclaimedForDeletion(t *testing.T) {
+	pool := testPool(t)
+	userRepo := NewUserRepository(pool)
+	guildRepo := NewGuildRepository(pool)
+	channelRepo := NewChannelRepository(pool)
+	messageRepo := NewMessageRepository(pool)
+	repo := NewAttachmentRepository(pool)
+	ctx := context.Background()
+
+	owner := createTestUserSimple(t, userRepo)
+	guild := createTestGuild(t, guildRepo, owner.ID)
+	ch := createTestChannel(t, channelRepo, guild.ID)
+	unclaimed := createTestUpload(t, repo, ch.ID, owner.ID, time.Now())
+	claimed := createTestUpload(t, repo, ch.ID, owner.ID, time.Now())
+
+	msg := &models.Message{
+		ID:        nextID(),
+		ChannelID: ch.ID,
+		AuthorID:  owner.ID,
+		CreatedAt: time.Now().Truncate(time.Microsecond),
+	}
+	if err := messageRepo.CreateWithAttachments(ctx, msg, []int64{claimed.ID}); err != nil {
+		t.Fatalf("CreateWithAttachments: %v", err)
+	}
+	t.Cleanup(func() { _ = messageRepo.Delete(ctx, msg.ID) })
+
+	marked, err := repo.MarkUnclaimedForDeletion(ctx, unclaimed.ID)
+	if err != nil || !marked {
+		t.Fatalf("MarkUnclaimedForDeletion(unclaimed) = %v, %v; want true", marked, err)
+	}
+	marked, err = repo.MarkUnclaimedForDeletion(ctx, claimed.ID)
+	if err != nil || marked {
+		t.Fatalf("MarkUnclaimedForDeletion(claimed) = %v, %v; want false", marked, err)
+	}
+
+	// An upload pending deletion can't be claimed.
+	late := &models.Message{
+		ID:        nextID(),
+		ChannelID: ch.ID,
+		AuthorID:  owner.ID,
+		CreatedAt: time.Now().Truncate(time.Microsecond),
+	}
+	err = messageRepo.CreateWithAttachments(ctx, late, []int64{unclaimed.ID})
+	if !errors.Is(err, ErrAttachmentsUnavailable) {
+		t.Fatalf("claiming a marked upload: error = %v, want ErrAttachmentsUnavailable", err)
+	}
+
+	attachments, err := repo.GetByMessageID(ctx, msg.ID)
+	if err != nil {
+		t.Fatalf("GetByMessageID: %v", err)
+	}
+	if len(attachments) != 1 || attachments[0].ID != claimed.ID {
+		t.Errorf("expected the claimed attachment to remain, got %+v", attachments)
+	}
+}
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/victorivanov/retrocast/internal/models"
+)
+
+type auditLogRepo struct {
+	pool *pgxpool.Pool
+}
+
+func NewAuditLogRepository(pool *pgxpool.Pool) AuditLogRepository {
+	return &auditLogRepo{pool: pool}
+}
+
+func (r *auditLogRepo) Create(ctx context.Context, entry *models.AuditLogEntry) error {
+	_, err := r.pool.Exec(ctx,
+		`INSERT INTO audit_log_entries (id, guild_id, user_id, target_id, action_type, changes, options, reason, created_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		entry.ID, entry.GuildID, entry.UserID, entry.TargetID, entry.ActionType,
+		entry.Changes, entry.Options, entry.Reason, entry.CreatedAt,
+	)
+	return err
+}
+
+// GetByGuildID returns a guild's audit log entries, newest first. userID and
+// actionType filter by actor and action; before restricts the page to entries
+// older than that ID.
+func (r *auditLogRepo) GetByGuildID(ctx context.Context, guildID int64, userID *int64, actionType *models.AuditLogAction, before *int64, limit int) ([]models.AuditLogEntry, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT id, guild_id, user_id, target_id, action_type, changes, options, reason, created_at
+		 FROM audit_log_entries
+		 WHERE guild_id = $1
+		   AND ($2::BIGINT IS NULL OR user_id = $2)
+		   AND ($3::INT IS NULL OR action_type = $3)
+		   AND ($4::BIGINT IS NULL OR id < $4)
+		 ORDER BY id DESC
+		 LIMIT $5`,
+		guildID, userID, actionType, before, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []models.AuditLogEntry
+	for rows.Next() {
+		var e models.AuditLogEntry
+		if err := rows.Scan(
+			&e.ID, &e.GuildID, &e.UserID, &e.TargetID, &e.ActionType,
+			&e.Changes, &e.Options, &e.Reason, &e.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,72 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/victorivanov/retrocast/internal/models"
+)
+
+func TestAuditLogRepo(t *testing.T) {
+	pool := testPool(t)
+	userRepo := NewUserRepository(pool)
+	guildRepo := NewGuildRepository(pool)
+	repo := NewAuditLogRepository(pool)
+	ctx := context.Background()
+
+	owner := createTestUserSimple(t, userRepo)
+	mod := createTestUserSimple(t, userRepo)
+	guild := createTestGuild(t, guildRepo, owner.ID)
+
+	reason := "spam"
+	target := int64(42)
+	entries := []*models.AuditLogEntry{
+		{ID: nextID(), GuildID: guild.ID, UserID: owner.ID, TargetID: &guild.ID, ActionType: models.AuditLogGuildUpdate,
+			Changes: []models.AuditLogChange{{Key: "name", OldValue: "old", NewValue: "new"}}},
+		{ID: nextID(), GuildID: guild.ID, UserID: mod.ID, TargetID: &target, ActionType: models.AuditLogMemberKick,
+			Changes: []models.AuditLogChange{}, Reason: &reason},
+		{ID: nextID(), GuildID: guild.ID, UserID: mod.ID, TargetID: &target, ActionType: models.AuditLogChannelOverwriteDelete,
+			Changes: []models.AuditLogChange{{Key: "allow", OldValue: "1"}}, Options: map[string]string{"id": "7", "type": "role"}},
+	}
+	for _, e := range entries {
+		e.CreatedAt = time.Now()
+		if err := repo.Create(ctx, e); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	all, err := repo.GetByGuildID(ctx, guild.ID, nil, nil, nil, 50)
+	if err != nil {
+		t.Fatalf("GetByGuildID: %v", err)
+	}
+	if len(all) != 3 || all[0].ID != entries[2].ID || all[2].ID != entries[0].ID {
+		t.Fatalf("GetByGuildID returned %d entries, want 3 newest first", len(all))
+	}
+	if c := all[2].Changes; len(c) != 1 || c[0].Key != "name" || c[0].OldValue != "old" || c[0].NewValue != "new" {
+		t.Errorf("Changes = %+v", c)
+	}
+	if all[1].Reason == nil || *all[1].Reason != reason || all[1].Options != nil {
+		t.Errorf("kick entry = %+v", all[1])
+	}
+	if all[0].Options["type"] != "role" {
+		t.Errorf("Options = %+v", all[0].Options)
+	}
+
+	action := models.AuditLogMemberKick
+	byAction, err := repo.GetByGuildID(ctx, guild.ID, &mod.ID, &action, nil, 50)
+	if err != nil {
+		t.Fatalf("GetByGuildID filtered: %v", err)
+	}
+	if len(byAction) != 1 || byAction[0].ID != entries[1].ID {
+		t.Errorf("filtered by actor and action: got %d entries", len(byAction))
+	}
+
+	page, err := repo.GetByGuildID(ctx, guild.ID, nil, nil, &entries[2].ID, 1)
+	if err != nil {
+		t.Fatalf("GetByGuildID before: %v", err)
+	}
+	if len(page) != 1 || page[0].ID != entries[1].ID {
+		t.Errorf("page before newest: got %d entries", len(page))
+	}
+}
@@ -3,6 +3,7 @@ package database
 import (
 	"context"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/victorivanov/retrocast/internal/models"
 )
@@ -15,31 +16,58 @@ func NewChannelOverrideRepository(pool *pgxpool.Pool) ChannelOverrideRepository
 	return &channelOverrideRepo{pool: pool}
 }
 
+// Set creates or replaces the override for override.TargetID. Role overrides
+// are stored in role_id and member overrides in user_id.
 func (r *channelOverrideRepo) Set(ctx context.Context, override *models.ChannelOverride) error {
+	var roleID, userID *int64
+	if override.Type == models.OverrideTypeMember {
+		userID = &override.TargetID
+	} else {
+		roleID = &override.TargetID
+	}
+
 	_, err := r.pool.Exec(ctx,
-		`INSERT INTO channel_overrides (channel_id, role_id, allow_perms, deny_perms)
-		 VALUES ($1, $2, $3, $4)
-		 ON CONFLICT (channel_id, role_id)
-		 DO UPDATE SET allow_perms = EXCLUDED.allow_perms, deny_perms = EXCLUDED.deny_perms`,
-		override.ChannelID, override.RoleID, override.Allow, override.Deny,
+		`INSERT INTO channel_overrides (channel_id, role_id, user_id, allow_perms, deny_perms)
+		 VALUES ($1, $2, $3, $4, $5)
+		 ON CONFLICT (channel_id, COALESCE(role_id, user_id))
+		 DO UPDATE SET role_id = EXCLUDED.role_id, user_id = EXCLUDED.user_id,
+		               allow_perms = EXCLUDED.allow_perms, deny_perms = EXCLUDED.deny_perms`,
+		override.ChannelID, roleID, userID, override.Allow, override.Deny,
 	)
 	return err
 }
 
+// selectChannelOverrides selects overrides with their target and type;
+// callers add the WHERE clause.
+const selectChannelOverrides = `SELECT channel_id, COALESCE(role_id, user_id),
+	        CASE WHEN user_id IS NULL THEN 0 ELSE 1 END,
+	        allow_perms, deny_perms
+	 FROM channel_overrides`
+
 func (r *channelOverrideRepo) GetByChannel(ctx context.Context, channelID int64) ([]models.ChannelOverride, error) {
-	rows, err := r.pool.Query(ctx,
-		`SELECT channel_id, role_id, allow_perms, deny_perms
-		 FROM channel_overrides WHERE channel_id = $1`, channelID,
-	)
+	rows, err := r.pool.Query(ctx, selectChannelOverrides+` WHERE channel_id = $1`, channelID)
 	if err != nil {
 		return nil, err
 	}
+	return scanChannelOverrides(rows)
+}
+
+// GetByChannels returns the overrides of all the given channels.
+func (r *channelOverrideRepo) GetByChannels(ctx context.Context, channelIDs []int64) ([]models.ChannelOverride, error) {
+	rows, err := r.pool.Query(ctx, selectChannelOverrides+` WHERE channel_id = ANY($1)`, channelIDs)
+	if err != nil {
+		return nil, err
+	}
+	return scanChannelOverrides(rows)
+}
+
+func scanChannelOverrides(rows pgx.Rows) ([]models.ChannelOverride, error) {
 	defer rows.Close()
 
 	var overrides []models.ChannelOverride
 	for rows.Next() {
 		var o models.ChannelOverride
-		if err := rows.Scan(&o.ChannelID, &o.RoleID, &o.Allow, &o.Deny); err != nil {
+		if err := rows.Scan(&o.ChannelID, &o.TargetID, &o.Type, &o.Allow, &o.Deny); err != nil {
 			return nil, err
 		}
 		overrides = append(overrides, o)
@@ -47,10 +75,10 @@ func (r *channelOverrideRepo) GetByChannel(ctx context.Context, channelID int64)
 	return overrides, rows.Err()
 }
 
-func (r *channelOverrideRepo) Delete(ctx context.Context, channelID, roleID int64) error {
+func (r *channelOverrideRepo) Delete(ctx context.Context, channelID, targetID int64) error {
 	_, err := r.pool.Exec(ctx,
-		`DELETE FROM channel_overrides WHERE channel_id = $1 AND role_id = $2`,
-		channelID, roleID,
+		`DELETE FROM channel_overrides WHERE channel_id = $1 AND COALESCE(role_id, user_id) = $2`,
+		channelID, targetID,
 	)
 	return err
 }
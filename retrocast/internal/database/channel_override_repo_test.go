@@ -23,7 +23,7 @@ func TestChannelOverrideRepo_Set(t *testing.T) {
 
 	override := &models.ChannelOverride{
 		ChannelID: ch.ID,
-		RoleID:    role.ID,
+		TargetID:  role.ID,
 		Allow:     0x10,
 		Deny:      0x20,
 	}
@@ -42,7 +42,7 @@ func TestChannelOverrideRepo_Set(t *testing.T) {
 
 	found := false
 	for _, o := range overrides {
-		if o.RoleID == role.ID {
+		if o.TargetID == role.ID {
 			found = true
 			if o.Allow != 0x10 {
 				t.Errorf("Allow = %d, want %d", o.Allow, 0x10)
@@ -73,7 +73,7 @@ func TestChannelOverrideRepo_Set_Upsert(t *testing.T) {
 
 	override := &models.ChannelOverride{
 		ChannelID: ch.ID,
-		RoleID:    role.ID,
+		TargetID:  role.ID,
 		Allow:     0x10,
 		Deny:      0x20,
 	}
@@ -95,7 +95,7 @@ func TestChannelOverrideRepo_Set_Upsert(t *testing.T) {
 	}
 
 	for _, o := range overrides {
-		if o.RoleID == role.ID {
+		if o.TargetID == role.ID {
 			if o.Allow != 0x30 {
 				t.Errorf("Allow = %d, want %d", o.Allow, 0x30)
 			}
@@ -120,6 +120,43 @@ func TestChannelOverrideRepo_GetByChannel_Empty(t *testing.T) {
 	}
 }
 
+func TestChannelOverrideRepo_GetByChannels(t *testing.T) {
+	pool := testPool(t)
+	userRepo := NewUserRepository(pool)
+	guildRepo := NewGuildRepository(pool)
+	channelRepo := NewChannelRepository(pool)
+	roleRepo := NewRoleRepository(pool)
+	repo := NewChannelOverrideRepository(pool)
+	ctx := context.Background()
+
+	owner := createTestUserSimple(t, userRepo)
+	guild := createTestGuild(t, guildRepo, owner.ID)
+	first := createTestChannel(t, channelRepo, guild.ID)
+	second := createTestChannel(t, channelRepo, guild.ID)
+	role := createTestRole(t, roleRepo, guild.ID)
+
+	for _, ch := range []*models.Channel{first, second} {
+		if err := repo.Set(ctx, &models.ChannelOverride{ChannelID: ch.ID, TargetID: role.ID, Deny: 0x400}); err != nil {
+			t.Fatalf("Set: %v", err)
+		}
+		chID := ch.ID
+		t.Cleanup(func() { _ = repo.Delete(ctx, chID, role.ID) })
+	}
+
+	overrides, err := repo.GetByChannels(ctx, []int64{first.ID, second.ID})
+	if err != nil {
+		t.Fatalf("GetByChannels: %v", err)
+	}
+	if len(overrides) != 2 {
+		t.Fatalf("GetByChannels returned %d overrides, want 2", len(overrides))
+	}
+	for _, o := range overrides {
+		if o.TargetID != role.ID || o.Deny != 0x400 {
+			t.Errorf("unexpected override %+v", o)
+		}
+	}
+}
+
 func TestChannelOverrideRepo_Delete(t *testing.T) {
 	pool := testPool(t)
 	userRepo := NewUserRepository(pool)
@@ -136,7 +173,7 @@ func TestChannelOverrideRepo_Delete(t *testing.T) {
 
 	override := &models.ChannelOverride{
 		ChannelID: ch.ID,
-		RoleID:    role.ID,
+		TargetID:  role.ID,
 		Allow:     0x10,
 		Deny:      0x20,
 	}
@@ -153,7 +190,7 @@ func TestChannelOverrideRepo_Delete(t *testing.T) {
 		t.Fatalf("GetByChannel: %v", err)
 	}
 	for _, o := range overrides {
-		if o.RoleID == role.ID {
+		if o.TargetID == role.ID {
 			t.Error("override still present after Delete")
 		}
 	}
@@ -174,3 +211,62 @@ func createTestRole(t *testing.T, repo RoleRepository, guildID int64) *models.Ro
 	t.Cleanup(func() { _ = repo.Delete(ctx, role.ID) })
 	return role
 }
+
+func TestChannelOverrideRepo_MemberOverride(t *testing.T) {
+	pool := testPool(t)
+	userRepo := NewUserRepository(pool)
+	guildRepo := NewGuildRepository(pool)
+	channelRepo := NewChannelRepository(pool)
+	roleRepo := NewRoleRepository(pool)
+	repo := NewChannelOverrideRepository(pool)
+	ctx := context.Background()
+
+	owner := createTestUserSimple(t, userRepo)
+	member := createTestUserSimple(t, userRepo)
+	guild := createTestGuild(t, guildRepo, owner.ID)
+	ch := createTestChannel(t, channelRepo, guild.ID)
+	role := createTestRole(t, roleRepo, guild.ID)
+
+	for _, o := range []*models.ChannelOverride{
+		{ChannelID: ch.ID, TargetID: role.ID, Type: models.OverrideTypeRole, Allow: 0x1},
+		{ChannelID: ch.ID, TargetID: member.ID, Type: models.OverrideTypeMember, Deny: 0x2},
+		{ChannelID: ch.ID, TargetID: member.ID, Type: models.OverrideTypeMember, Deny: 0x4},
+	} {
+		if err := repo.Set(ctx, o); err != nil {
+			t.Fatalf("Set(%+v): %v", o, err)
+		}
+	}
+
+	overrides, err := repo.GetByChannel(ctx, ch.ID)
+	if err != nil {
+		t.Fatalf("GetByChannel: %v", err)
+	}
+	if len(overrides) != 2 {
+		t.Fatalf("GetByChannel returned %d overrides, want 2", len(overrides))
+	}
+	for _, o := range overrides {
+		switch o.TargetID {
+		case role.ID:
+			if o.Type != models.OverrideTypeRole || o.Allow != 0x1 {
+				t.Errorf("role override = %+v", o)
+			}
+		case member.ID:
+			if o.Type != models.OverrideTypeMember || o.Deny != 0x4 {
+				t.Errorf("member override = %+v", o)
+			}
+		default:
+			t.Errorf("unexpected override %+v", o)
+		}
+	}
+
+	if err := repo.Delete(ctx, ch.ID, member.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	overrides, err = repo.GetByChannel(ctx, ch.ID)
+	if err != nil {
+		t.Fatalf("GetByChannel after Delete: %v", err)
+	}
+	if len(overrides) != 1 || overrides[0].TargetID != role.ID {
+		t.Errorf("after Delete: %+v", overrides)
+	}
+}
@@ -2,12 +2,23 @@ package database
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/victorivanov/retrocast/internal/models"
 )
 
+const channelColumns = `id, guild_id, name, type, position, topic, parent_id,
+	owner_id, starter_message_id, archived, auto_archive_duration, archive_timestamp,
+	bitrate, user_limit`
+
+// ErrThreadAlreadyExists is returned when creating a thread from a message
+// that has already started one.
+var ErrThreadAlreadyExists = errors.New("thread already exists")
+
 type channelRepo struct {
 	pool *pgxpool.Pool
 }
@@ -16,59 +27,170 @@ func NewChannelRepository(pool *pgxpool.Pool) ChannelRepository {
 	return &channelRepo{pool: pool}
 }
 
+// scanChannel scans a row selected with channelColumns. Thread metadata is
+// only set on thread channels.
+func scanChannel(row pgx.Row) (models.Channel, error) {
+	var ch models.Channel
+	var (
+		ownerID             *int64
+		starterMessageID    *int64
+		archived            bool
+		autoArchiveDuration *int
+		archiveTimestamp    *time.Time
+	)
+	if err := row.Scan(&ch.ID, &ch.GuildID, &ch.Name, &ch.Type, &ch.Position, &ch.Topic, &ch.ParentID,
+		&ownerID, &starterMessageID, &archived, &autoArchiveDuration, &archiveTimestamp,
+		&ch.Bitrate, &ch.UserLimit); err != nil {
+		return ch, err
+	}
+	if ch.Type == models.ChannelTypeThread {
+		ch.Thread = &models.ThreadMetadata{
+			StarterMessageID: starterMessageID,
+			Archived:         archived,
+		}
+		if ownerID != nil {
+			ch.Thread.OwnerID = *ownerID
+		}
+		if autoArchiveDuration != nil {
+			ch.Thread.AutoArchiveDuration = *autoArchiveDuration
+		}
+		if archiveTimestamp != nil {
+			ch.Thread.ArchiveTimestamp = *archiveTimestamp
+		}
+	}
+	return ch, nil
+}
+
+func scanChannels(rows pgx.Rows) ([]models.Channel, error) {
+	defer rows.Close()
+
+	var channels []models.Channel
+	for rows.Next() {
+		ch, err := scanChannel(rows)
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, ch)
+	}
+	return channels, rows.Err()
+}
+
+// threadArgs returns the thread column values for ch, all NULL for channels
+// that are not threads.
+func threadArgs(ch *models.Channel) (ownerID, starterMessageID *int64, archived bool, autoArchiveDuration *int, archiveTimestamp *time.Time) {
+	t := ch.Thread
+	if t == nil {
+		return nil, nil, false, nil, nil
+	}
+	return &t.OwnerID, t.StarterMessageID, t.Archived, &t.AutoArchiveDuration, &t.ArchiveTimestamp
+}
+
 func (r *channelRepo) Create(ctx context.Context, ch *models.Channel) error {
+	ownerID, starterMessageID, archived, autoArchiveDuration, archiveTimestamp := threadArgs(ch)
 	_, err := r.pool.Exec(ctx,
-		`INSERT INTO channels (id, guild_id, name, type, position, topic, parent_id)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		`INSERT INTO channels (`+channelColumns+`)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`,
 		ch.ID, ch.GuildID, ch.Name, ch.Type, ch.Position, ch.Topic, ch.ParentID,
+		ownerID, starterMessageID, archived, autoArchiveDuration, archiveTimestamp,
+		ch.Bitrate, ch.UserLimit,
 	)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "channels_starter_message_id_key" {
+		return ErrThreadAlreadyExists
+	}
 	return err
 }
 
 func (r *channelRepo) GetByID(ctx context.Context, id int64) (*models.Channel, error) {
-	ch := &models.Channel{}
-	err := r.pool.QueryRow(ctx,
-		`SELECT id, guild_id, name, type, position, topic, parent_id
-		 FROM channels WHERE id = $1`, id,
-	).Scan(&ch.ID, &ch.GuildID, &ch.Name, &ch.Type, &ch.Position, &ch.Topic, &ch.ParentID)
+	ch, err := scanChannel(r.pool.QueryRow(ctx,
+		`SELECT `+channelColumns+` FROM channels WHERE id = $1`, id,
+	))
 	if err == pgx.ErrNoRows {
 		return nil, nil
 	}
-	return ch, err
+	if err != nil {
+		return nil, err
+	}
+	return &ch, nil
 }
 
+// GetByGuildID returns the guild's channels, excluding threads.
 func (r *channelRepo) GetByGuildID(ctx context.Context, guildID int64) ([]models.Channel, error) {
 	rows, err := r.pool.Query(ctx,
-		`SELECT id, guild_id, name, type, position, topic, parent_id
-		 FROM channels WHERE guild_id = $1
-		 ORDER BY position, id`, guildID,
+		`SELECT `+channelColumns+`
+		 FROM channels WHERE guild_id = $1 AND type <> $2
+		 ORDER BY position, id`, guildID, models.ChannelTypeThread,
 	)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	return scanChannels(rows)
+}
 
-	var channels []models.Channel
-	for rows.Next() {
-		var ch models.Channel
-		if err := rows.Scan(&ch.ID, &ch.GuildID, &ch.Name, &ch.Type, &ch.Position, &ch.Topic, &ch.ParentID); err != nil {
-			return nil, err
-		}
-		channels = append(channels, ch)
+// GetThreadsByParent returns the archived or active threads of a channel,
+// newest first.
+func (r *channelRepo) GetThreadsByParent(ctx context.Context, parentID int64, archived bool) ([]models.Channel, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT `+channelColumns+`
+		 FROM channels WHERE parent_id = $1 AND type = $2 AND archived = $3
+		 ORDER BY id DESC`, parentID, models.ChannelTypeThread, archived,
+	)
+	if err != nil {
+		return nil, err
 	}
-	return channels, rows.Err()
+	return scanChannels(rows)
+}
+
+func (r *channelRepo) GetThreadByStarterMessage(ctx context.Context, messageID int64) (*models.Channel, error) {
+	ch, err := scanChannel(r.pool.QueryRow(ctx,
+		`SELECT `+channelColumns+` FROM channels WHERE starter_message_id = $1`, messageID,
+	))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ch, nil
+}
+
+// ArchiveInactiveThreads archives every active thread whose last message (or
+// archive timestamp, if later) is older than its auto-archive duration at
+// now, and returns the archived threads.
+func (r *channelRepo) ArchiveInactiveThreads(ctx context.Context, now time.Time) ([]models.Channel, error) {
+	rows, err := r.pool.Query(ctx,
+		`UPDATE channels c SET archived = TRUE, archive_timestamp = $2
+		 WHERE c.type = $1 AND NOT c.archived
+		   AND GREATEST(c.archive_timestamp,
+		                (SELECT MAX(m.created_at) FROM messages m WHERE m.channel_id = c.id))
+		       <= $2 - make_interval(mins => c.auto_archive_duration)
+		 RETURNING `+channelColumns, models.ChannelTypeThread, now,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanChannels(rows)
 }
 
 func (r *channelRepo) Update(ctx context.Context, ch *models.Channel) error {
+	ownerID, starterMessageID, archived, autoArchiveDuration, archiveTimestamp := threadArgs(ch)
 	_, err := r.pool.Exec(ctx,
-		`UPDATE channels SET name = $2, type = $3, position = $4, topic = $5, parent_id = $6
+		`UPDATE channels SET name = $2, type = $3, position = $4, topic = $5, parent_id = $6,
+		     owner_id = $7, starter_message_id = $8, archived = $9, auto_archive_duration = $10, archive_timestamp = $11,
+		     bitrate = $12, user_limit = $13
 		 WHERE id = $1`,
 		ch.ID, ch.Name, ch.Type, ch.Position, ch.Topic, ch.ParentID,
+		ownerID, starterMessageID, archived, autoArchiveDuration, archiveTimestamp,
+		ch.Bitrate, ch.UserLimit,
 	)
 	return err
 }
 
+// Delete removes a channel together with its threads.
 func (r *channelRepo) Delete(ctx context.Context, id int64) error {
-	_, err := r.pool.Exec(ctx, `DELETE FROM channels WHERE id = $1`, id)
+	_, err := r.pool.Exec(ctx,
+		`DELETE FROM channels WHERE id = $1 OR (parent_id = $1 AND type = $2)`,
+		id, models.ChannelTypeThread,
+	)
 	return err
 }
@@ -2,6 +2,7 @@ package database
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
@@ -204,6 +205,97 @@ func TestChannelRepo_Delete(t *testing.T) {
 }
 
 // createTestGuild inserts a guild and registers cleanup.
+func TestChannelRepo_Threads(t *testing.T) {
+	pool := testPool(t)
+	userRepo := NewUserRepository(pool)
+	guildRepo := NewGuildRepository(pool)
+	repo := NewChannelRepository(pool)
+	ctx := context.Background()
+
+	owner := createTestUserSimple(t, userRepo)
+	guild := createTestGuild(t, guildRepo, owner.ID)
+	parent := createTestChannel(t, repo, guild.ID)
+
+	starter := nextID()
+	thread := &models.Channel{
+		ID:       nextID(),
+		GuildID:  guild.ID,
+		Name:     parent.Name, // thread names may repeat channel names
+		Type:     models.ChannelTypeThread,
+		ParentID: &parent.ID,
+		Thread: &models.ThreadMetadata{
+			OwnerID:             owner.ID,
+			StarterMessageID:    &starter,
+			AutoArchiveDuration: 60,
+			ArchiveTimestamp:    time.Now().Add(-2 * time.Hour).Truncate(time.Microsecond),
+		},
+	}
+	if err := repo.Create(ctx, thread); err != nil {
+		t.Fatalf("Create thread: %v", err)
+	}
+	t.Cleanup(func() { _ = repo.Delete(ctx, thread.ID) })
+
+	got, err := repo.GetThreadByStarterMessage(ctx, starter)
+	if err != nil {
+		t.Fatalf("GetThreadByStarterMessage: %v", err)
+	}
+	if got == nil || got.ID != thread.ID || got.Thread == nil || got.Thread.OwnerID != owner.ID || got.Thread.AutoArchiveDuration != 60 {
+		t.Fatalf("GetThreadByStarterMessage = %+v", got)
+	}
+
+	// A message starts at most one thread.
+	again := *thread
+	again.ID = nextID()
+	if err := repo.Create(ctx, &again); !errors.Is(err, ErrThreadAlreadyExists) {
+		t.Fatalf("second thread from the same message: err = %v, want ErrThreadAlreadyExists", err)
+	}
+
+	channels, err := repo.GetByGuildID(ctx, guild.ID)
+	if err != nil {
+		t.Fatalf("GetByGuildID: %v", err)
+	}
+	for _, ch := range channels {
+		if ch.ID == thread.ID {
+			t.Error("GetByGuildID should not list threads")
+		}
+	}
+
+	active, err := repo.GetThreadsByParent(ctx, parent.ID, false)
+	if err != nil {
+		t.Fatalf("GetThreadsByParent: %v", err)
+	}
+	if len(active) != 1 || active[0].ID != thread.ID {
+		t.Fatalf("active threads = %+v, want [%d]", active, thread.ID)
+	}
+
+	// The thread has had no messages for two hours, longer than its
+	// one-hour auto-archive duration.
+	archived, err := repo.ArchiveInactiveThreads(ctx, time.Now())
+	if err != nil {
+		t.Fatalf("ArchiveInactiveThreads: %v", err)
+	}
+	found := false
+	for _, ch := range archived {
+		if ch.ID == thread.ID {
+			found = ch.Thread.Archived
+		}
+	}
+	if !found {
+		t.Fatalf("thread %d was not archived: %+v", thread.ID, archived)
+	}
+	if active, _ = repo.GetThreadsByParent(ctx, parent.ID, false); len(active) != 0 {
+		t.Errorf("active threads after archiving = %+v, want none", active)
+	}
+
+	// Deleting the parent deletes its threads.
+	if err := repo.Delete(ctx, parent.ID); err != nil {
+		t.Fatalf("Delete parent: %v", err)
+	}
+	if got, _ := repo.GetByID(ctx, thread.ID); got != nil {
+		t.Error("thread should be deleted with its parent")
+	}
+}
+
 func createTestGuild(t *testing.T, repo GuildRepository, ownerID int64) *models.Guild {
 	t.Helper()
 	ctx := context.Background()
@@ -2,6 +2,7 @@ package database
 
 import (
 	"context"
+	"strings"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -74,6 +75,120 @@ func (r *memberRepo) GetByGuildID(ctx context.Context, guildID int64, limit, off
 	return members, rows.Err()
 }
 
+// GetUserIDsByGuild returns the IDs of every member of a guild.
+func (r *memberRepo) GetUserIDsByGuild(ctx context.Context, guildID int64) ([]int64, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT user_id FROM members WHERE guild_id = $1`, guildID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanUserIDs(rows)
+}
+
+// GetUserIDsByRoles returns the IDs of the guild members holding any of the
+// given roles.
+func (r *memberRepo) GetUserIDsByRoles(ctx context.Context, guildID int64, roleIDs []int64) ([]int64, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT DISTINCT user_id FROM member_roles
+		 WHERE guild_id = $1 AND role_id = ANY($2)`,
+		guildID, roleIDs,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanUserIDs(rows)
+}
+
+// FilterUserIDs returns the users among userIDs that are members of the
+// guild.
+func (r *memberRepo) FilterUserIDs(ctx context.Context, guildID int64, userIDs []int64) ([]int64, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT user_id FROM members
+		 WHERE guild_id = $1 AND user_id = ANY($2)`,
+		guildID, userIDs,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanUserIDs(rows)
+}
+
+// selectMembersWithUser selects members with their users and roles; callers
+// add the WHERE clause before groupMembersWithUser.
+const selectMembersWithUser = `SELECT m.guild_id, m.user_id, m.nickname, m.joined_at,
+	        COALESCE(array_agg(mr.role_id) FILTER (WHERE mr.role_id IS NOT NULL), '{}'),
+	        u.id, u.username, u.display_name, u.avatar_hash, u.bot, u.created_at
+	 FROM members m
+	 INNER JOIN users u ON u.id = m.user_id
+	 LEFT JOIN member_roles mr ON mr.guild_id = m.guild_id AND mr.user_id = m.user_id`
+
+const groupMembersWithUser = ` GROUP BY m.guild_id, m.user_id, u.id ORDER BY u.username`
+
+// likeEscaper escapes the LIKE wildcards in a literal prefix.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SearchByUsername returns the members of a guild whose username starts
+// with prefix, case-insensitively and ordered by username. A limit of 0
+// returns every match.
+func (r *memberRepo) SearchByUsername(ctx context.Context, guildID int64, prefix string, limit int) ([]models.MemberWithUser, error) {
+	query := selectMembersWithUser + `
+	 WHERE m.guild_id = $1 AND u.username ILIKE $2` + groupMembersWithUser
+	args := []any{guildID, likeEscaper.Replace(prefix) + "%"}
+	if limit > 0 {
+		query += ` LIMIT $3`
+		args = append(args, limit)
+	}
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanMembersWithUser(rows)
+}
+
+// GetByUserIDs returns the members of a guild among the given users.
+func (r *memberRepo) GetByUserIDs(ctx context.Context, guildID int64, userIDs []int64) ([]models.MemberWithUser, error) {
+	rows, err := r.pool.Query(ctx, selectMembersWithUser+`
+	 WHERE m.guild_id = $1 AND m.user_id = ANY($2)`+groupMembersWithUser,
+		guildID, userIDs,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanMembersWithUser(rows)
+}
+
+func scanMembersWithUser(rows pgx.Rows) ([]models.MemberWithUser, error) {
+	defer rows.Close()
+
+	var members []models.MemberWithUser
+	for rows.Next() {
+		var m models.MemberWithUser
+		if err := rows.Scan(
+			&m.GuildID, &m.UserID, &m.Nickname, &m.JoinedAt, &m.Roles,
+			&m.User.ID, &m.User.Username, &m.User.DisplayName, &m.User.AvatarHash, &m.User.Bot, &m.User.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+func scanUserIDs(rows pgx.Rows) ([]int64, error) {
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
 func (r *memberRepo) Update(ctx context.Context, member *models.Member) error {
 	_, err := r.pool.Exec(ctx,
 		`UPDATE members SET nickname = $3
@@ -2,6 +2,7 @@ package database
 
 import (
 	"context"
+	"strings"
 	"testing"
 	"time"
 
@@ -265,6 +266,111 @@ func TestMemberRepo_AddRole_RemoveRole(t *testing.T) {
 	}
 }
 
+func TestMemberRepo_GetUserIDs(t *testing.T) {
+	pool := testPool(t)
+	userRepo := NewUserRepository(pool)
+	guildRepo := NewGuildRepository(pool)
+	roleRepo := NewRoleRepository(pool)
+	memberRepo := NewMemberRepository(pool)
+	ctx := context.Background()
+
+	owner := createTestUserSimple(t, userRepo)
+	other := createTestUserSimple(t, userRepo)
+	guild := createTestGuild(t, guildRepo, owner.ID)
+	_ = createTestMember(t, memberRepo, guild.ID, owner.ID)
+	_ = createTestMember(t, memberRepo, guild.ID, other.ID)
+	role := createTestRole(t, roleRepo, guild.ID)
+
+	if err := memberRepo.AddRole(ctx, guild.ID, other.ID, role.ID); err != nil {
+		t.Fatalf("AddRole: %v", err)
+	}
+
+	all, err := memberRepo.GetUserIDsByGuild(ctx, guild.ID)
+	if err != nil {
+		t.Fatalf("GetUserIDsByGuild: %v", err)
+	}
+	if len(all) != 2 {
+		t.Errorf("GetUserIDsByGuild returned %d IDs, want 2", len(all))
+	}
+
+	withRole, err := memberRepo.GetUserIDsByRoles(ctx, guild.ID, []int64{role.ID})
+	if err != nil {
+		t.Fatalf("GetUserIDsByRoles: %v", err)
+	}
+	if len(withRole) != 1 || withRole[0] != other.ID {
+		t.Errorf("GetUserIDsByRoles = %v, want [%d]", withRole, other.ID)
+	}
+
+	members, err := memberRepo.FilterUserIDs(ctx, guild.ID, []int64{other.ID, nextID()})
+	if err != nil {
+		t.Fatalf("FilterUserIDs: %v", err)
+	}
+	if len(members) != 1 || members[0] != other.ID {
+		t.Errorf("FilterUserIDs = %v, want [%d]", members, other.ID)
+	}
+}
+
+func TestMemberRepo_SearchByUsername_GetByUserIDs(t *testing.T) {
+	pool := testPool(t)
+	userRepo := NewUserRepository(pool)
+	guildRepo := NewGuildRepository(pool)
+	roleRepo := NewRoleRepository(pool)
+	memberRepo := NewMemberRepository(pool)
+	ctx := context.Background()
+
+	owner := createTestUserSimple(t, userRepo)
+	other := createTestUserSimple(t, userRepo)
+	guild := createTestGuild(t, guildRepo, owner.ID)
+	_ = createTestMember(t, memberRepo, guild.ID, owner.ID)
+	_ = createTestMember(t, memberRepo, guild.ID, other.ID)
+	role := createTestRole(t, roleRepo, guild.ID)
+
+	if err := memberRepo.AddRole(ctx, guild.ID, other.ID, role.ID); err != nil {
+		t.Fatalf("AddRole: %v", err)
+	}
+
+	found, err := memberRepo.SearchByUsername(ctx, guild.ID, strings.ToUpper(other.Username), 10)
+	if err != nil {
+		t.Fatalf("SearchByUsername: %v", err)
+	}
+	if len(found) != 1 || found[0].User.ID != other.ID || found[0].User.Username != other.Username {
+		t.Fatalf("SearchByUsername = %+v, want only %s", found, other.Username)
+	}
+	if len(found[0].Roles) != 1 || found[0].Roles[0] != role.ID {
+		t.Errorf("Roles = %v, want [%d]", found[0].Roles, role.ID)
+	}
+
+	// LIKE wildcards in the prefix match literally.
+	found, err = memberRepo.SearchByUsername(ctx, guild.ID, "testuser%", 0)
+	if err != nil {
+		t.Fatalf("SearchByUsername: %v", err)
+	}
+	if len(found) != 0 {
+		t.Errorf("SearchByUsername(%q) returned %d members, want 0", "testuser%", len(found))
+	}
+
+	found, err = memberRepo.SearchByUsername(ctx, guild.ID, "", 1)
+	if err != nil {
+		t.Fatalf("SearchByUsername: %v", err)
+	}
+	if len(found) != 1 {
+		t.Errorf("SearchByUsername with limit 1 returned %d members", len(found))
+	}
+
+	byID, err := memberRepo.GetByUserIDs(ctx, guild.ID, []int64{owner.ID, other.ID, nextID()})
+	if err != nil {
+		t.Fatalf("GetByUserIDs: %v", err)
+	}
+	if len(byID) != 2 {
+		t.Errorf("GetByUserIDs returned %d members, want 2", len(byID))
+	}
+	for _, m := range byID {
+		if m.UserID == owner.ID && len(m.Roles) != 0 {
+			t.Errorf("owner roles = %v, want none", m.Roles)
+		}
+	}
+}
+
 // createTestMember inserts a member and registers cleanup.
 func createTestMember(t *testing.T, repo MemberRepository, guildID, userID int64) *models.Member {
 	t.Helper()
@@ -2,6 +2,7 @@ package database
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/jackc/pgx/v5"
@@ -9,47 +10,144 @@ import (
 	"github.com/victorivanov/retrocast/internal/models"
 )
 
+// ErrPinLimitReached is returned when pinning a message in a channel that
+// already has the maximum number of pinned messages.
+var ErrPinLimitReached = errors.New("pin limit reached")
+
 type messageRepo struct {
 	pool *pgxpool.Pool
 }
 
+// messageSelect selects a message with its author and, for replies, a
+// trimmed copy of the referenced message. Rows are read with scanMessage.
+const messageSelect = `SELECT m.id, m.channel_id, m.author_id, m.content, m.created_at, m.edited_at,
+        m.mentions, m.mention_roles, m.mention_everyone, m.pinned_at IS NOT NULL,
+        u.username, u.display_name, u.avatar_hash,
+        m.reference_message_id, rm.id, rm.author_id, rm.content, rm.created_at,
+        ru.username, ru.display_name
+ FROM messages m
+ INNER JOIN users u ON u.id = m.author_id
+ LEFT JOIN messages rm ON rm.id = m.reference_message_id
+ LEFT JOIN users ru ON ru.id = rm.author_id`
+
+// scanMessage reads a row produced by messageSelect.
+func scanMessage(row pgx.Row) (models.MessageWithAuthor, error) {
+	var m models.MessageWithAuthor
+	var (
+		refID, refFoundID, refAuthorID *int64
+		refContent, refUsername        *string
+		refDisplayName                 *string
+		refCreatedAt                   *time.Time
+	)
+	err := row.Scan(
+		&m.ID, &m.ChannelID, &m.AuthorID, &m.Content, &m.CreatedAt, &m.EditedAt,
+		&m.Mentions, &m.MentionRoles, &m.MentionEveryone, &m.Pinned,
+		&m.AuthorUsername, &m.AuthorDisplayName, &m.AuthorAvatarHash,
+		&refID, &refFoundID, &refAuthorID, &refContent, &refCreatedAt,
+		&refUsername, &refDisplayName,
+	)
+	if err != nil {
+		return m, err
+	}
+
+	if refID != nil {
+		m.MessageReference = &models.MessageReference{ChannelID: m.ChannelID, MessageID: *refID}
+	}
+	if refFoundID != nil {
+		m.ReferencedMessage = &models.ReferencedMessage{
+			ID:        *refFoundID,
+			AuthorID:  *refAuthorID,
+			Content:   *refContent,
+			CreatedAt: *refCreatedAt,
+		}
+		if refUsername != nil {
+			m.ReferencedMessage.AuthorUsername = *refUsername
+		}
+		if refDisplayName != nil {
+			m.ReferencedMessage.AuthorDisplayName = *refDisplayName
+		}
+	}
+	return m, nil
+}
+
+// referenceMessageID returns the ID of the message msg replies to, or nil.
+func referenceMessageID(msg *models.Message) *int64 {
+	if msg.MessageReference == nil {
+		return nil
+	}
+	return &msg.MessageReference.MessageID
+}
+
 func NewMessageRepository(pool *pgxpool.Pool) MessageRepository {
 	return &messageRepo{pool: pool}
 }
 
 func (r *messageRepo) Create(ctx context.Context, msg *models.Message) error {
 	_, err := r.pool.Exec(ctx,
-		`INSERT INTO messages (id, channel_id, author_id, content, created_at, edited_at)
-		 VALUES ($1, $2, $3, $4, $5, $6)`,
+		`INSERT INTO messages (id, channel_id, author_id, content, created_at, edited_at,
+		                       mentions, mention_roles, mention_everyone, reference_message_id)
+		 VALUES ($1, $2, $3, $4, $5, $6, COALESCE($7::BIGINT[], '{}'), COALESCE($8::BIGINT[], '{}'), $9, $10)`,
 		msg.ID, msg.ChannelID, msg.AuthorID, msg.Content, msg.CreatedAt, msg.EditedAt,
+		msg.Mentions, msg.MentionRoles, msg.MentionEveryone, referenceMessageID(msg),
 	)
 	return err
 }
 
+// CreateWithAttachments inserts a message and binds the given unclaimed
+// attachments to it in a single transaction. Attachments must have been
+// uploaded by the message author to the same channel; otherwise nothing is
+// written and ErrAttachmentsUnavailable is returned.
+func (r *messageRepo) CreateWithAttachments(ctx context.Context, msg *models.Message, attachmentIDs []int64) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO messages (id, channel_id, author_id, content, created_at, edited_at,
+		                       mentions, mention_roles, mention_everyone, reference_message_id)
+		 VALUES ($1, $2, $3, $4, $5, $6, COALESCE($7::BIGINT[], '{}'), COALESCE($8::BIGINT[], '{}'), $9, $10)`,
+		msg.ID, msg.ChannelID, msg.AuthorID, msg.Content, msg.CreatedAt, msg.EditedAt,
+		msg.Mentions, msg.MentionRoles, msg.MentionEveryone, referenceMessageID(msg),
+	)
+	if err != nil {
+		return err
+	}
+
+	tag, err := tx.Exec(ctx,
+		`UPDATE attachments SET message_id = $1
+		 WHERE id = ANY($2) AND message_id IS NULL AND NOT pending_deletion
+		   AND uploader_id = $3 AND channel_id = $4`,
+		msg.ID, attachmentIDs, msg.AuthorID, msg.ChannelID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() != int64(len(attachmentIDs)) {
+		return ErrAttachmentsUnavailable
+	}
+
+	return tx.Commit(ctx)
+}
+
 func (r *messageRepo) GetByID(ctx context.Context, id int64) (*models.MessageWithAuthor, error) {
-	m := &models.MessageWithAuthor{}
-	err := r.pool.QueryRow(ctx,
-		`SELECT m.id, m.channel_id, m.author_id, m.content, m.created_at, m.edited_at,
-		        u.username, u.display_name, u.avatar_hash
-		 FROM messages m
-		 INNER JOIN users u ON u.id = m.author_id
+	m, err := scanMessage(r.pool.QueryRow(ctx,
+		messageSelect+`
 		 WHERE m.id = $1`, id,
-	).Scan(
-		&m.ID, &m.ChannelID, &m.AuthorID, &m.Content, &m.CreatedAt, &m.EditedAt,
-		&m.AuthorUsername, &m.AuthorDisplayName, &m.AuthorAvatarHash,
-	)
+	))
 	if err == pgx.ErrNoRows {
 		return nil, nil
 	}
-	return m, err
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
 }
 
 func (r *messageRepo) GetByChannelID(ctx context.Context, channelID int64, before *int64, limit int) ([]models.MessageWithAuthor, error) {
 	rows, err := r.pool.Query(ctx,
-		`SELECT m.id, m.channel_id, m.author_id, m.content, m.created_at, m.edited_at,
-		        u.username, u.display_name, u.avatar_hash
-		 FROM messages m
-		 INNER JOIN users u ON u.id = m.author_id
+		messageSelect+`
 		 WHERE m.channel_id = $1 AND ($2::BIGINT IS NULL OR m.id < $2)
 		 ORDER BY m.id DESC
 		 LIMIT $3`,
@@ -58,27 +156,16 @@ func (r *messageRepo) GetByChannelID(ctx context.Context, channelID int64, befor
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	var messages []models.MessageWithAuthor
-	for rows.Next() {
-		var m models.MessageWithAuthor
-		if err := rows.Scan(
-			&m.ID, &m.ChannelID, &m.AuthorID, &m.Content, &m.CreatedAt, &m.EditedAt,
-			&m.AuthorUsername, &m.AuthorDisplayName, &m.AuthorAvatarHash,
-		); err != nil {
-			return nil, err
-		}
-		messages = append(messages, m)
-	}
-	return messages, rows.Err()
+	return scanMessages(rows)
 }
 
 func (r *messageRepo) Update(ctx context.Context, msg *models.Message) error {
 	_, err := r.pool.Exec(ctx,
-		`UPDATE messages SET content = $2, edited_at = $3
+		`UPDATE messages SET content = $2, edited_at = $3,
+		        mentions = COALESCE($4::BIGINT[], '{}'), mention_roles = COALESCE($5::BIGINT[], '{}'),
+		        mention_everyone = $6
 		 WHERE id = $1`,
-		msg.ID, msg.Content, msg.EditedAt,
+		msg.ID, msg.Content, msg.EditedAt, msg.Mentions, msg.MentionRoles, msg.MentionEveryone,
 	)
 	return err
 }
@@ -88,13 +175,66 @@ func (r *messageRepo) Delete(ctx context.Context, id int64) error {
 	return err
 }
 
+// Pin pins a message in its channel unless the channel already has limit
+// pinned messages, in which case ErrPinLimitReached is returned. Pinning an
+// already pinned message is a no-op.
+func (r *messageRepo) Pin(ctx context.Context, channelID, messageID int64, limit int) error {
+	tag, err := r.pool.Exec(ctx,
+		`UPDATE messages SET pinned_at = NOW()
+		 WHERE id = $1 AND channel_id = $2 AND pinned_at IS NULL
+		   AND (SELECT COUNT(*) FROM messages WHERE channel_id = $2 AND pinned_at IS NOT NULL) < $3`,
+		messageID, channelID, limit,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 1 {
+		return nil
+	}
+
+	var pinned bool
+	err = r.pool.QueryRow(ctx,
+		`SELECT pinned_at IS NOT NULL FROM messages WHERE id = $1`, messageID,
+	).Scan(&pinned)
+	if err == pgx.ErrNoRows || (err == nil && pinned) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return ErrPinLimitReached
+}
+
+// Unpin unpins a message. It reports false if the message was not pinned.
+func (r *messageRepo) Unpin(ctx context.Context, messageID int64) (bool, error) {
+	tag, err := r.pool.Exec(ctx,
+		`UPDATE messages SET pinned_at = NULL WHERE id = $1 AND pinned_at IS NOT NULL`, messageID,
+	)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// GetPinned returns the pinned messages of a channel, most recently pinned
+// first.
+func (r *messageRepo) GetPinned(ctx context.Context, channelID int64) ([]models.MessageWithAuthor, error) {
+	rows, err := r.pool.Query(ctx,
+		messageSelect+`
+		 WHERE m.channel_id = $1 AND m.pinned_at IS NOT NULL
+		 ORDER BY m.pinned_at DESC, m.id DESC`,
+		channelID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanMessages(rows)
+}
+
 func (r *messageRepo) SearchMessages(ctx context.Context, guildID int64, query string, authorID *int64, before *time.Time, after *time.Time, limit int) ([]models.MessageWithAuthor, error) {
 	rows, err := r.pool.Query(ctx,
-		`SELECT m.id, m.channel_id, m.author_id, m.content, m.created_at, m.edited_at,
-		        u.username, u.display_name, u.avatar_hash
-		 FROM messages m
+		messageSelect+`
 		 INNER JOIN channels c ON c.id = m.channel_id
-		 INNER JOIN users u ON u.id = m.author_id
 		 WHERE c.guild_id = $1
 		   AND m.search_vector @@ plainto_tsquery('english', $2)
 		   AND ($3::BIGINT IS NULL OR m.author_id = $3)
@@ -107,15 +247,16 @@ func (r *messageRepo) SearchMessages(ctx context.Context, guildID int64, query s
 	if err != nil {
 		return nil, err
 	}
+	return scanMessages(rows)
+}
+
+func scanMessages(rows pgx.Rows) ([]models.MessageWithAuthor, error) {
 	defer rows.Close()
 
 	var messages []models.MessageWithAuthor
 	for rows.Next() {
-		var m models.MessageWithAuthor
-		if err := rows.Scan(
-			&m.ID, &m.ChannelID, &m.AuthorID, &m.Content, &m.CreatedAt, &m.EditedAt,
-			&m.AuthorUsername, &m.AuthorDisplayName, &m.AuthorAvatarHash,
-		); err != nil {
+		m, err := scanMessage(rows)
+		if err != nil {
 			return nil, err
 		}
 		messages = append(messages, m)
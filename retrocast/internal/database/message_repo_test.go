@@ -2,6 +2,7 @@ package database
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
@@ -47,6 +48,177 @@ func TestMessageRepo_Create(t *testing.T) {
 	}
 }
 
+func TestMessageRepo_Mentions(t *testing.T) {
+	pool := testPool(t)
+	userRepo := NewUserRepository(pool)
+	guildRepo := NewGuildRepository(pool)
+	channelRepo := NewChannelRepository(pool)
+	repo := NewMessageRepository(pool)
+	ctx := context.Background()
+
+	owner := createTestUserSimple(t, userRepo)
+	guild := createTestGuild(t, guildRepo, owner.ID)
+	ch := createTestChannel(t, channelRepo, guild.ID)
+
+	msg := &models.Message{
+		ID:              nextID(),
+		ChannelID:       ch.ID,
+		AuthorID:        owner.ID,
+		Content:         "@everyone <@1> <@&2>",
+		CreatedAt:       time.Now().Truncate(time.Microsecond),
+		Mentions:        []int64{1},
+		MentionRoles:    []int64{2},
+		MentionEveryone: true,
+	}
+	if err := repo.Create(ctx, msg); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	t.Cleanup(func() { _ = repo.Delete(ctx, msg.ID) })
+
+	got, err := repo.GetByID(ctx, msg.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if len(got.Mentions) != 1 || got.Mentions[0] != 1 {
+		t.Errorf("Mentions = %v, want [1]", got.Mentions)
+	}
+	if len(got.MentionRoles) != 1 || got.MentionRoles[0] != 2 {
+		t.Errorf("MentionRoles = %v, want [2]", got.MentionRoles)
+	}
+	if !got.MentionEveryone {
+		t.Error("MentionEveryone = false, want true")
+	}
+
+	// Editing replaces the stored mentions; nil slices are stored as empty.
+	now := time.Now()
+	if err := repo.Update(ctx, &models.Message{ID: msg.ID, Content: "plain", EditedAt: &now}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	got, err = repo.GetByID(ctx, msg.ID)
+	if err != nil {
+		t.Fatalf("GetByID after Update: %v", err)
+	}
+	if got.Mentions == nil || len(got.Mentions) != 0 || len(got.MentionRoles) != 0 || got.MentionEveryone {
+		t.Errorf("mentions after edit = %v %v %v, want empty", got.Mentions, got.MentionRoles, got.MentionEveryone)
+	}
+}
+
+func TestMessageRepo_Reference(t *testing.T) {
+	pool := testPool(t)
+	userRepo := NewUserRepository(pool)
+	guildRepo := NewGuildRepository(pool)
+	channelRepo := NewChannelRepository(pool)
+	repo := NewMessageRepository(pool)
+	ctx := context.Background()
+
+	owner := createTestUserSimple(t, userRepo)
+	guild := createTestGuild(t, guildRepo, owner.ID)
+	ch := createTestChannel(t, channelRepo, guild.ID)
+
+	original := &models.Message{ID: nextID(), ChannelID: ch.ID, AuthorID: owner.ID, Content: "original", CreatedAt: time.Now()}
+	if err := repo.Create(ctx, original); err != nil {
+		t.Fatalf("Create original: %v", err)
+	}
+	t.Cleanup(func() { _ = repo.Delete(ctx, original.ID) })
+
+	reply := &models.Message{
+		ID: nextID(), ChannelID: ch.ID, AuthorID: owner.ID, Content: "reply", CreatedAt: time.Now(),
+		MessageReference: &models.MessageReference{ChannelID: ch.ID, MessageID: original.ID},
+	}
+	if err := repo.Create(ctx, reply); err != nil {
+		t.Fatalf("Create reply: %v", err)
+	}
+	t.Cleanup(func() { _ = repo.Delete(ctx, reply.ID) })
+
+	got, err := repo.GetByID(ctx, reply.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if got.MessageReference == nil || got.MessageReference.MessageID != original.ID || got.MessageReference.ChannelID != ch.ID {
+		t.Fatalf("MessageReference = %+v, want message %d", got.MessageReference, original.ID)
+	}
+	rm := got.ReferencedMessage
+	if rm == nil || rm.ID != original.ID || rm.AuthorID != owner.ID || rm.Content != "original" || rm.AuthorUsername != owner.Username {
+		t.Fatalf("ReferencedMessage = %+v", rm)
+	}
+
+	// Deleting the original keeps the reference but drops the preview.
+	if err := repo.Delete(ctx, original.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	got, err = repo.GetByID(ctx, reply.ID)
+	if err != nil {
+		t.Fatalf("GetByID after delete: %v", err)
+	}
+	if got.MessageReference == nil || got.ReferencedMessage != nil {
+		t.Errorf("after delete: reference = %+v, referenced = %+v", got.MessageReference, got.ReferencedMessage)
+	}
+}
+
+func TestMessageRepo_Pins(t *testing.T) {
+	pool := testPool(t)
+	userRepo := NewUserRepository(pool)
+	guildRepo := NewGuildRepository(pool)
+	channelRepo := NewChannelRepository(pool)
+	repo := NewMessageRepository(pool)
+	ctx := context.Background()
+
+	owner := createTestUserSimple(t, userRepo)
+	guild := createTestGuild(t, guildRepo, owner.ID)
+	ch := createTestChannel(t, channelRepo, guild.ID)
+
+	var ids []int64
+	for i := 0; i < 3; i++ {
+		msg := &models.Message{ID: nextID(), ChannelID: ch.ID, AuthorID: owner.ID, Content: "pin", CreatedAt: time.Now()}
+		if err := repo.Create(ctx, msg); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		t.Cleanup(func() { _ = repo.Delete(ctx, msg.ID) })
+		ids = append(ids, msg.ID)
+	}
+
+	for _, id := range ids[:2] {
+		if err := repo.Pin(ctx, ch.ID, id, 2); err != nil {
+			t.Fatalf("Pin(%d): %v", id, err)
+		}
+	}
+	// Re-pinning at the limit is a no-op; a new pin is rejected.
+	if err := repo.Pin(ctx, ch.ID, ids[0], 2); err != nil {
+		t.Errorf("re-Pin: %v", err)
+	}
+	if err := repo.Pin(ctx, ch.ID, ids[2], 2); !errors.Is(err, ErrPinLimitReached) {
+		t.Errorf("Pin over limit: got %v, want ErrPinLimitReached", err)
+	}
+
+	got, err := repo.GetByID(ctx, ids[0])
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if !got.Pinned {
+		t.Error("expected message to be pinned")
+	}
+
+	pins, err := repo.GetPinned(ctx, ch.ID)
+	if err != nil {
+		t.Fatalf("GetPinned: %v", err)
+	}
+	if len(pins) != 2 || pins[0].ID != ids[1] || pins[1].ID != ids[0] {
+		t.Fatalf("GetPinned returned %d messages, want ids[1], ids[0]", len(pins))
+	}
+
+	unpinned, err := repo.Unpin(ctx, ids[0])
+	if err != nil || !unpinned {
+		t.Fatalf("Unpin = %v, %v", unpinned, err)
+	}
+	unpinned, err = repo.Unpin(ctx, ids[0])
+	if err != nil || unpinned {
+		t.Errorf("second Unpin = %v, %v; want false", unpinned, err)
+	}
+	if err := repo.Pin(ctx, ch.ID, ids[2], 2); err != nil {
+		t.Errorf("Pin after Unpin: %v", err)
+	}
+}
+
 func TestMessageRepo_GetByID_NotFound(t *testing.T) {
 	pool := testPool(t)
 	repo := NewMessageRepository(pool)
@@ -64,11 +64,28 @@ func (r *readStateRepo) GetByUserAndChannel(ctx context.Context, userID, channel
 	return s, err
 }
 
+// IncrementMentionCount bumps a user's unread mention count for a channel,
+// creating the read state if the user has never acknowledged the channel.
 func (r *readStateRepo) IncrementMentionCount(ctx context.Context, userID, channelID int64) error {
 	_, err := r.pool.Exec(ctx,
-		`UPDATE read_states SET mention_count = mention_count + 1, updated_at = NOW()
-		 WHERE user_id = $1 AND channel_id = $2`,
+		`INSERT INTO read_states (user_id, channel_id, last_message_id, mention_count, updated_at)
+		 VALUES ($1, $2, 0, 1, NOW())
+		 ON CONFLICT (user_id, channel_id)
+		 DO UPDATE SET mention_count = read_states.mention_count + 1, updated_at = NOW()`,
 		userID, channelID,
 	)
 	return err
 }
+
+// IncrementMentionCounts bumps the unread mention count of every user in
+// userIDs for a channel in one statement, creating missing read states.
+func (r *readStateRepo) IncrementMentionCounts(ctx context.Context, channelID int64, userIDs []int64) error {
+	_, err := r.pool.Exec(ctx,
+		`INSERT INTO read_states (user_id, channel_id, last_message_id, mention_count, updated_at)
+		 SELECT user_id, $2, 0, 1, NOW() FROM unnest($1::bigint[]) AS user_id
+		 ON CONFLICT (user_id, channel_id)
+		 DO UPDATE SET mention_count = read_states.mention_count + 1, updated_at = NOW()`,
+		userIDs, channelID,
+	)
+	return err
+}
@@ -0,0 +1,39 @@
+package database
+
+import (
+	"context"
+	"testing"
+)
+
+func TestReadStateRepo_IncrementMentionCounts(t *testing.T) {
+	pool := testPool(t)
+	repo := NewReadStateRepository(pool)
+	ctx := context.Background()
+
+	channelID := nextID()
+	acked, fresh := nextID(), nextID()
+	if err := repo.Upsert(ctx, acked, channelID, 5); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	if err := repo.IncrementMentionCount(ctx, acked, channelID); err != nil {
+		t.Fatalf("IncrementMentionCount: %v", err)
+	}
+
+	if err := repo.IncrementMentionCounts(ctx, channelID, []int64{acked, fresh}); err != nil {
+		t.Fatalf("IncrementMentionCounts: %v", err)
+	}
+
+	for userID, want := range map[int64]int{acked: 2, fresh: 1} {
+		state, err := repo.GetByUserAndChannel(ctx, userID, channelID)
+		if err != nil {
+			t.Fatalf("GetByUserAndChannel: %v", err)
+		}
+		if state == nil || state.MentionCount != want {
+			t.Errorf("user %d read state = %+v, want mention count %d", userID, state, want)
+		}
+	}
+	state, _ := repo.GetByUserAndChannel(ctx, acked, channelID)
+	if state != nil && state.LastMessageID != 5 {
+		t.Errorf("last message id = %d, want 5 kept", state.LastMessageID)
+	}
+}
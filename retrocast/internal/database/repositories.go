@@ -27,10 +27,19 @@ type ChannelRepository interface {
 	Create(ctx context.Context, channel *models.Channel) error
 	GetByID(ctx context.Context, id int64) (*models.Channel, error)
 	GetByGuildID(ctx context.Context, guildID int64) ([]models.Channel, error)
+	GetThreadsByParent(ctx context.Context, parentID int64, archived bool) ([]models.Channel, error)
+	GetThreadByStarterMessage(ctx context.Context, messageID int64) (*models.Channel, error)
+	ArchiveInactiveThreads(ctx context.Context, now time.Time) ([]models.Channel, error)
 	Update(ctx context.Context, channel *models.Channel) error
 	Delete(ctx context.Context, id int64) error
 }
 
+type ThreadMemberRepository interface {
+	Add(ctx context.Context, threadID, userID int64) (bool, error)
+	Remove(ctx context.Context, threadID, userID int64) (bool, error)
+	GetByThread(ctx context.Context, threadID int64) ([]models.ThreadMember, error)
+}
+
 type RoleRepository interface {
 	Create(ctx context.Context, role *models.Role) error
 	GetByID(ctx context.Context, id int64) (*models.Role, error)
@@ -38,12 +47,18 @@ type RoleRepository interface {
 	Update(ctx context.Context, role *models.Role) error
 	Delete(ctx context.Context, id int64) error
 	GetByMember(ctx context.Context, guildID, userID int64) ([]models.Role, error)
+	GetByMembers(ctx context.Context, guildID int64, userIDs []int64) (map[int64][]models.Role, error)
 }
 
 type MemberRepository interface {
 	Create(ctx context.Context, member *models.Member) error
 	GetByGuildAndUser(ctx context.Context, guildID, userID int64) (*models.Member, error)
 	GetByGuildID(ctx context.Context, guildID int64, limit, offset int) ([]models.Member, error)
+	GetUserIDsByGuild(ctx context.Context, guildID int64) ([]int64, error)
+	GetUserIDsByRoles(ctx context.Context, guildID int64, roleIDs []int64) ([]int64, error)
+	FilterUserIDs(ctx context.Context, guildID int64, userIDs []int64) ([]int64, error)
+	SearchByUsername(ctx context.Context, guildID int64, prefix string, limit int) ([]models.MemberWithUser, error)
+	GetByUserIDs(ctx context.Context, guildID int64, userIDs []int64) ([]models.MemberWithUser, error)
 	Update(ctx context.Context, member *models.Member) error
 	Delete(ctx context.Context, guildID, userID int64) error
 	AddRole(ctx context.Context, guildID, userID, roleID int64) error
@@ -52,10 +67,14 @@ type MemberRepository interface {
 
 type MessageRepository interface {
 	Create(ctx context.Context, msg *models.Message) error
+	CreateWithAttachments(ctx context.Context, msg *models.Message, attachmentIDs []int64) error
 	GetByID(ctx context.Context, id int64) (*models.MessageWithAuthor, error)
 	GetByChannelID(ctx context.Context, channelID int64, before *int64, limit int) ([]models.MessageWithAuthor, error)
 	Update(ctx context.Context, msg *models.Message) error
 	Delete(ctx context.Context, id int64) error
+	Pin(ctx context.Context, channelID, messageID int64, limit int) error
+	Unpin(ctx context.Context, messageID int64) (bool, error)
+	GetPinned(ctx context.Context, channelID int64) ([]models.MessageWithAuthor, error)
 	SearchMessages(ctx context.Context, guildID int64, query string, authorID *int64, before *time.Time, after *time.Time, limit int) ([]models.MessageWithAuthor, error)
 }
 
@@ -70,13 +89,17 @@ type InviteRepository interface {
 type ChannelOverrideRepository interface {
 	Set(ctx context.Context, override *models.ChannelOverride) error
 	GetByChannel(ctx context.Context, channelID int64) ([]models.ChannelOverride, error)
-	Delete(ctx context.Context, channelID, roleID int64) error
+	GetByChannels(ctx context.Context, channelIDs []int64) ([]models.ChannelOverride, error)
+	Delete(ctx context.Context, channelID, targetID int64) error
 }
 
 type AttachmentRepository interface {
 	Create(ctx context.Context, attachment *models.Attachment) error
 	GetByMessageID(ctx context.Context, messageID int64) ([]models.Attachment, error)
+	GetByMessageIDs(ctx context.Context, messageIDs []int64) ([]models.Attachment, error)
+	GetUnclaimedBefore(ctx context.Context, cutoff time.Time, limit int) ([]models.Attachment, error)
 	Delete(ctx context.Context, id int64) error
+	MarkUnclaimedForDeletion(ctx context.Context, id int64) (bool, error)
 }
 
 type BanRepository interface {
@@ -86,6 +109,11 @@ type BanRepository interface {
 	Delete(ctx context.Context, guildID, userID int64) error
 }
 
+type AuditLogRepository interface {
+	Create(ctx context.Context, entry *models.AuditLogEntry) error
+	GetByGuildID(ctx context.Context, guildID int64, userID *int64, actionType *models.AuditLogAction, before *int64, limit int) ([]models.AuditLogEntry, error)
+}
+
 type DMChannelRepository interface {
 	Create(ctx context.Context, dm *models.DMChannel) error
 	GetByID(ctx context.Context, id int64) (*models.DMChannel, error)
@@ -102,6 +130,7 @@ type ReadStateRepository interface {
 	GetByUser(ctx context.Context, userID int64) ([]models.ReadState, error)
 	GetByUserAndChannel(ctx context.Context, userID, channelID int64) (*models.ReadState, error)
 	IncrementMentionCount(ctx context.Context, userID, channelID int64) error
+	IncrementMentionCounts(ctx context.Context, channelID int64, userIDs []int64) error
 }
 
 type ReactionRepository interface {
@@ -118,4 +147,6 @@ type VoiceStateRepository interface {
 	GetByChannel(ctx context.Context, channelID int64) ([]models.VoiceState, error)
 	GetByGuild(ctx context.Context, guildID int64) ([]models.VoiceState, error)
 	GetByUser(ctx context.Context, guildID, userID int64) (*models.VoiceState, error)
+	GetJoinedBefore(ctx context.Context, before time.Time) ([]models.VoiceState, error)
+	DeleteByChannel(ctx context.Context, channelID int64) ([]models.VoiceState, error)
 }
@@ -96,3 +96,30 @@ func (r *roleRepo) GetByMember(ctx context.Context, guildID, userID int64) ([]mo
 	}
 	return roles, rows.Err()
 }
+
+// GetByMembers returns the roles held by each of the given users in a guild,
+// keyed by user ID. Users without roles are absent from the map.
+func (r *roleRepo) GetByMembers(ctx context.Context, guildID int64, userIDs []int64) (map[int64][]models.Role, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT mr.user_id, r.id, r.guild_id, r.name, r.color, r.permissions, r.position, r.is_default
+		 FROM roles r
+		 INNER JOIN member_roles mr ON mr.role_id = r.id
+		 WHERE mr.guild_id = $1 AND mr.user_id = ANY($2)
+		 ORDER BY r.position`, guildID, userIDs,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := make(map[int64][]models.Role)
+	for rows.Next() {
+		var userID int64
+		var role models.Role
+		if err := rows.Scan(&userID, &role.ID, &role.GuildID, &role.Name, &role.Color, &role.Permissions, &role.Position, &role.IsDefault); err != nil {
+			return nil, err
+		}
+		roles[userID] = append(roles[userID], role)
+	}
+	return roles, rows.Err()
+}
@@ -230,3 +230,34 @@ func TestRoleRepo_GetByMember_NoRoles(t *testing.T) {
 		t.Errorf("expected empty slice, got %d roles", len(roles))
 	}
 }
+
+func TestRoleRepo_GetByMembers(t *testing.T) {
+	pool := testPool(t)
+	userRepo := NewUserRepository(pool)
+	guildRepo := NewGuildRepository(pool)
+	roleRepo := NewRoleRepository(pool)
+	memberRepo := NewMemberRepository(pool)
+	ctx := context.Background()
+
+	owner := createTestUserSimple(t, userRepo)
+	other := createTestUserSimple(t, userRepo)
+	guild := createTestGuild(t, guildRepo, owner.ID)
+	_ = createTestMember(t, memberRepo, guild.ID, owner.ID)
+	_ = createTestMember(t, memberRepo, guild.ID, other.ID)
+	role := createTestRole(t, roleRepo, guild.ID)
+
+	if err := memberRepo.AddRole(ctx, guild.ID, other.ID, role.ID); err != nil {
+		t.Fatalf("AddRole: %v", err)
+	}
+
+	roles, err := roleRepo.GetByMembers(ctx, guild.ID, []int64{owner.ID, other.ID})
+	if err != nil {
+		t.Fatalf("GetByMembers: %v", err)
+	}
+	if len(roles[owner.ID]) != 0 {
+		t.Errorf("owner has %d roles, want 0", len(roles[owner.ID]))
+	}
+	if len(roles[other.ID]) != 1 || roles[other.ID][0].ID != role.ID {
+		t.Errorf("GetByMembers[other] = %v, want [%d]", roles[other.ID], role.ID)
+	}
+}
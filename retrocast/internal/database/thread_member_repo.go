@@ -0,0 +1,65 @@
+package database
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/victorivanov/retrocast/internal/models"
+)
+
+type threadMemberRepo struct {
+	pool *pgxpool.Pool
+}
+
+func NewThreadMemberRepository(pool *pgxpool.Pool) ThreadMemberRepository {
+	return &threadMemberRepo{pool: pool}
+}
+
+// Add joins a user to a thread. It reports false if they already were a
+// member.
+func (r *threadMemberRepo) Add(ctx context.Context, threadID, userID int64) (bool, error) {
+	tag, err := r.pool.Exec(ctx,
+		`INSERT INTO thread_members (thread_id, user_id) VALUES ($1, $2)
+		 ON CONFLICT DO NOTHING`,
+		threadID, userID,
+	)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// Remove removes a user from a thread. It reports false if they were not a
+// member.
+func (r *threadMemberRepo) Remove(ctx context.Context, threadID, userID int64) (bool, error) {
+	tag, err := r.pool.Exec(ctx,
+		`DELETE FROM thread_members WHERE thread_id = $1 AND user_id = $2`,
+		threadID, userID,
+	)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (r *threadMemberRepo) GetByThread(ctx context.Context, threadID int64) ([]models.ThreadMember, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT thread_id, user_id, joined_at
+		 FROM thread_members WHERE thread_id = $1
+		 ORDER BY joined_at, user_id`, threadID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []models.ThreadMember
+	for rows.Next() {
+		var m models.ThreadMember
+		if err := rows.Scan(&m.ThreadID, &m.UserID, &m.JoinedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
@@ -0,0 +1,57 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/victorivanov/retrocast/internal/models"
+)
+
+func TestThreadMemberRepo(t *testing.T) {
+	pool := testPool(t)
+	userRepo := NewUserRepository(pool)
+	guildRepo := NewGuildRepository(pool)
+	channelRepo := NewChannelRepository(pool)
+	repo := NewThreadMemberRepository(pool)
+	ctx := context.Background()
+
+	owner := createTestUserSimple(t, userRepo)
+	other := createTestUserSimple(t, userRepo)
+	guild := createTestGuild(t, guildRepo, owner.ID)
+	parent := createTestChannel(t, channelRepo, guild.ID)
+
+	thread := &models.Channel{
+		ID: nextID(), GuildID: guild.ID, Name: "thread", Type: models.ChannelTypeThread, ParentID: &parent.ID,
+		Thread: &models.ThreadMetadata{OwnerID: owner.ID, AutoArchiveDuration: 1440, ArchiveTimestamp: time.Now()},
+	}
+	if err := channelRepo.Create(ctx, thread); err != nil {
+		t.Fatalf("Create thread: %v", err)
+	}
+	t.Cleanup(func() { _ = channelRepo.Delete(ctx, thread.ID) })
+
+	for _, userID := range []int64{owner.ID, other.ID} {
+		added, err := repo.Add(ctx, thread.ID, userID)
+		if err != nil || !added {
+			t.Fatalf("Add(%d) = %v, %v", userID, added, err)
+		}
+	}
+	if added, err := repo.Add(ctx, thread.ID, owner.ID); err != nil || added {
+		t.Errorf("second Add = %v, %v, want false", added, err)
+	}
+
+	members, err := repo.GetByThread(ctx, thread.ID)
+	if err != nil {
+		t.Fatalf("GetByThread: %v", err)
+	}
+	if len(members) != 2 {
+		t.Fatalf("members = %+v, want 2", members)
+	}
+
+	if removed, err := repo.Remove(ctx, thread.ID, other.ID); err != nil || !removed {
+		t.Fatalf("Remove = %v, %v", removed, err)
+	}
+	if removed, err := repo.Remove(ctx, thread.ID, other.ID); err != nil || removed {
+		t.Errorf("second Remove = %v, %v, want false", removed, err)
+	}
+}
@@ -18,9 +18,9 @@ func NewUserRepository(pool *pgxpool.Pool) UserRepository {
 
 func (r *userRepo) Create(ctx context.Context, user *models.User) error {
 	_, err := r.pool.Exec(ctx,
-		`INSERT INTO users (id, username, display_name, avatar_hash, password_hash, created_at)
-		 VALUES ($1, $2, $3, $4, $5, $6)`,
-		user.ID, user.Username, user.DisplayName, user.AvatarHash, user.PasswordHash, user.CreatedAt,
+		`INSERT INTO users (id, username, display_name, avatar_hash, password_hash, bot, created_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		user.ID, user.Username, user.DisplayName, user.AvatarHash, user.PasswordHash, user.Bot, user.CreatedAt,
 	)
 	return err
 }
@@ -28,9 +28,9 @@ func (r *userRepo) Create(ctx context.Context, user *models.User) error {
 func (r *userRepo) GetByID(ctx context.Context, id int64) (*models.User, error) {
 	u := &models.User{}
 	err := r.pool.QueryRow(ctx,
-		`SELECT id, username, display_name, avatar_hash, password_hash, created_at
+		`SELECT id, username, display_name, avatar_hash, password_hash, bot, created_at
 		 FROM users WHERE id = $1`, id,
-	).Scan(&u.ID, &u.Username, &u.DisplayName, &u.AvatarHash, &u.PasswordHash, &u.CreatedAt)
+	).Scan(&u.ID, &u.Username, &u.DisplayName, &u.AvatarHash, &u.PasswordHash, &u.Bot, &u.CreatedAt)
 	if err == pgx.ErrNoRows {
 		return nil, nil
 	}
@@ -40,9 +40,9 @@ func (r *userRepo) GetByID(ctx context.Context, id int64) (*models.User, error)
 func (r *userRepo) GetByUsername(ctx context.Context, username string) (*models.User, error) {
 	u := &models.User{}
 	err := r.pool.QueryRow(ctx,
-		`SELECT id, username, display_name, avatar_hash, password_hash, created_at
+		`SELECT id, username, display_name, avatar_hash, password_hash, bot, created_at
 		 FROM users WHERE username = $1`, username,
-	).Scan(&u.ID, &u.Username, &u.DisplayName, &u.AvatarHash, &u.PasswordHash, &u.CreatedAt)
+	).Scan(&u.ID, &u.Username, &u.DisplayName, &u.AvatarHash, &u.PasswordHash, &u.Bot, &u.CreatedAt)
 	if err == pgx.ErrNoRows {
 		return nil, nil
 	}
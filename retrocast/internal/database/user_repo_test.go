@@ -40,6 +40,36 @@ func TestUserRepo_Create(t *testing.T) {
 	if got.DisplayName != user.DisplayName {
 		t.Errorf("DisplayName = %q, want %q", got.DisplayName, user.DisplayName)
 	}
+	if got.Bot {
+		t.Error("Bot = true, want false by default")
+	}
+}
+
+func TestUserRepo_Create_Bot(t *testing.T) {
+	pool := testPool(t)
+	repo := NewUserRepository(pool)
+	ctx := context.Background()
+
+	user := &models.User{
+		ID:           nextID(),
+		Username:     "testuser_bot",
+		DisplayName:  "Test Bot",
+		PasswordHash: "$argon2id$v=19$m=65536,t=3,p=2$abc$def",
+		Bot:          true,
+		CreatedAt:    time.Now().Truncate(time.Microsecond),
+	}
+	if err := repo.Create(ctx, user); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	t.Cleanup(func() { _ = repo.Delete(ctx, user.ID) })
+
+	got, err := repo.GetByUsername(ctx, user.Username)
+	if err != nil {
+		t.Fatalf("GetByUsername: %v", err)
+	}
+	if got == nil || !got.Bot {
+		t.Errorf("GetByUsername = %+v, want a bot user", got)
+	}
 }
 
 func TestUserRepo_Create_DuplicateUsername(t *testing.T) {
@@ -2,6 +2,7 @@ package database
 
 import (
 	"context"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -18,11 +19,13 @@ func NewVoiceStateRepository(pool *pgxpool.Pool) VoiceStateRepository {
 
 func (r *voiceStateRepo) Upsert(ctx context.Context, state *models.VoiceState) error {
 	_, err := r.pool.Exec(ctx,
-		`INSERT INTO voice_states (guild_id, channel_id, user_id, session_id, self_mute, self_deaf, joined_at)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7)
+		`INSERT INTO voice_states (guild_id, channel_id, user_id, session_id, self_mute, self_deaf, mute, deaf, suppress, request_to_speak_at, joined_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 		 ON CONFLICT (guild_id, user_id)
-		 DO UPDATE SET channel_id = $2, session_id = $4, self_mute = $5, self_deaf = $6`,
-		state.GuildID, state.ChannelID, state.UserID, state.SessionID, state.SelfMute, state.SelfDeaf, state.JoinedAt,
+		 DO UPDATE SET channel_id = $2, session_id = $4, self_mute = $5, self_deaf = $6, mute = $7, deaf = $8,
+		     suppress = $9, request_to_speak_at = $10, joined_at = $11`,
+		state.GuildID, state.ChannelID, state.UserID, state.SessionID, state.SelfMute, state.SelfDeaf, state.Mute, state.Deaf,
+		state.Suppress, state.RequestToSpeakAt, state.JoinedAt,
 	)
 	return err
 }
@@ -37,7 +40,7 @@ func (r *voiceStateRepo) Delete(ctx context.Context, guildID, userID int64) erro
 
 func (r *voiceStateRepo) GetByChannel(ctx context.Context, channelID int64) ([]models.VoiceState, error) {
 	rows, err := r.pool.Query(ctx,
-		`SELECT guild_id, channel_id, user_id, session_id, self_mute, self_deaf, joined_at
+		`SELECT guild_id, channel_id, user_id, session_id, self_mute, self_deaf, mute, deaf, suppress, request_to_speak_at, joined_at
 		 FROM voice_states
 		 WHERE channel_id = $1
 		 ORDER BY joined_at`,
@@ -51,7 +54,7 @@ func (r *voiceStateRepo) GetByChannel(ctx context.Context, channelID int64) ([]m
 	var states []models.VoiceState
 	for rows.Next() {
 		var s models.VoiceState
-		if err := rows.Scan(&s.GuildID, &s.ChannelID, &s.UserID, &s.SessionID, &s.SelfMute, &s.SelfDeaf, &s.JoinedAt); err != nil {
+		if err := rows.Scan(&s.GuildID, &s.ChannelID, &s.UserID, &s.SessionID, &s.SelfMute, &s.SelfDeaf, &s.Mute, &s.Deaf, &s.Suppress, &s.RequestToSpeakAt, &s.JoinedAt); err != nil {
 			return nil, err
 		}
 		states = append(states, s)
@@ -61,7 +64,7 @@ func (r *voiceStateRepo) GetByChannel(ctx context.Context, channelID int64) ([]m
 
 func (r *voiceStateRepo) GetByGuild(ctx context.Context, guildID int64) ([]models.VoiceState, error) {
 	rows, err := r.pool.Query(ctx,
-		`SELECT guild_id, channel_id, user_id, session_id, self_mute, self_deaf, joined_at
+		`SELECT guild_id, channel_id, user_id, session_id, self_mute, self_deaf, mute, deaf, suppress, request_to_speak_at, joined_at
 		 FROM voice_states
 		 WHERE guild_id = $1
 		 ORDER BY joined_at`,
@@ -75,7 +78,7 @@ func (r *voiceStateRepo) GetByGuild(ctx context.Context, guildID int64) ([]model
 	var states []models.VoiceState
 	for rows.Next() {
 		var s models.VoiceState
-		if err := rows.Scan(&s.GuildID, &s.ChannelID, &s.UserID, &s.SessionID, &s.SelfMute, &s.SelfDeaf, &s.JoinedAt); err != nil {
+		if err := rows.Scan(&s.GuildID, &s.ChannelID, &s.UserID, &s.SessionID, &s.SelfMute, &s.SelfDeaf, &s.Mute, &s.Deaf, &s.Suppress, &s.RequestToSpeakAt, &s.JoinedAt); err != nil {
 			return nil, err
 		}
 		states = append(states, s)
@@ -86,13 +89,60 @@ func (r *voiceStateRepo) GetByGuild(ctx context.Context, guildID int64) ([]model
 func (r *voiceStateRepo) GetByUser(ctx context.Context, guildID, userID int64) (*models.VoiceState, error) {
 	s := &models.VoiceState{}
 	err := r.pool.QueryRow(ctx,
-		`SELECT guild_id, channel_id, user_id, session_id, self_mute, self_deaf, joined_at
+		`SELECT guild_id, channel_id, user_id, session_id, self_mute, self_deaf, mute, deaf, suppress, request_to_speak_at, joined_at
 		 FROM voice_states
 		 WHERE guild_id = $1 AND user_id = $2`,
 		guildID, userID,
-	).Scan(&s.GuildID, &s.ChannelID, &s.UserID, &s.SessionID, &s.SelfMute, &s.SelfDeaf, &s.JoinedAt)
+	).Scan(&s.GuildID, &s.ChannelID, &s.UserID, &s.SessionID, &s.SelfMute, &s.SelfDeaf, &s.Mute, &s.Deaf, &s.Suppress, &s.RequestToSpeakAt, &s.JoinedAt)
 	if err == pgx.ErrNoRows {
 		return nil, nil
 	}
 	return s, err
 }
+
+func (r *voiceStateRepo) GetJoinedBefore(ctx context.Context, before time.Time) ([]models.VoiceState, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT guild_id, channel_id, user_id, session_id, self_mute, self_deaf, mute, deaf, suppress, request_to_speak_at, joined_at
+		 FROM voice_states
+		 WHERE joined_at < $1
+		 ORDER BY joined_at`,
+		before,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var states []models.VoiceState
+	for rows.Next() {
+		var s models.VoiceState
+		if err := rows.Scan(&s.GuildID, &s.ChannelID, &s.UserID, &s.SessionID, &s.SelfMute, &s.SelfDeaf, &s.Mute, &s.Deaf, &s.Suppress, &s.RequestToSpeakAt, &s.JoinedAt); err != nil {
+			return nil, err
+		}
+		states = append(states, s)
+	}
+	return states, rows.Err()
+}
+
+func (r *voiceStateRepo) DeleteByChannel(ctx context.Context, channelID int64) ([]models.VoiceState, error) {
+	rows, err := r.pool.Query(ctx,
+		`DELETE FROM voice_states
+		 WHERE channel_id = $1
+		 RETURNING guild_id, channel_id, user_id, session_id, self_mute, self_deaf, mute, deaf, suppress, request_to_speak_at, joined_at`,
+		channelID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var states []models.VoiceState
+	for rows.Next() {
+		var s models.VoiceState
+		if err := rows.Scan(&s.GuildID, &s.ChannelID, &s.UserID, &s.SessionID, &s.SelfMute, &s.SelfDeaf, &s.Mute, &s.Deaf, &s.Suppress, &s.RequestToSpeakAt, &s.JoinedAt); err != nil {
+			return nil, err
+		}
+		states = append(states, s)
+	}
+	return states, rows.Err()
+}
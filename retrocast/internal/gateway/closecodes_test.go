@@ -0,0 +1,159 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/victorivanov/retrocast/internal/auth"
+	"github.com/victorivanov/retrocast/internal/models"
+)
+
+// identify sends an IDENTIFY on ws and returns the session ID from READY.
+func identify(t *testing.T, ws *websocket.Conn, token string) string {
+	t.Helper()
+	sendPayload(t, ws, OpIdentify, IdentifyData{Token: token})
+	p := readPayload(t, ws)
+	if p.Event == nil || *p.Event != EventReady {
+		t.Fatalf("event = %v, want %q", p.Event, EventReady)
+	}
+	var ready ReadyData
+	decodeData(t, p, &ready)
+	return ready.SessionID
+}
+
+func TestWSLifecycle_CloseCodes(t *testing.T) {
+	tokens := auth.NewTokenService("test-secret")
+	token, err := tokens.GenerateAccessToken(42)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+	m := NewManager(tokens, nil, &mockGuildRepo{}, nil, newTestRedis(t))
+	srv := setupWSServer(t, m)
+
+	tests := []struct {
+		name string
+		send func(t *testing.T, ws *websocket.Conn)
+		want int
+	}{
+		{"undecodable payload", func(t *testing.T, ws *websocket.Conn) {
+			kind := websocket.TextMessage
+			if testEncoding == encodingMsgpack {
+				kind = websocket.BinaryMessage
+			}
+			if err := ws.WriteMessage(kind, []byte("not a payload")); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+		}, CloseDecodeError},
+		{"undecodable identify", func(t *testing.T, ws *websocket.Conn) {
+			sendPayload(t, ws, OpIdentify, "not an identify")
+		}, CloseDecodeError},
+		{"undecodable resume", func(t *testing.T, ws *websocket.Conn) {
+			sendPayload(t, ws, OpResume, "not a resume")
+		}, CloseDecodeError},
+		{"unknown opcode", func(t *testing.T, ws *websocket.Conn) {
+			sendPayload(t, ws, 42, nil)
+		}, CloseUnknownOpcode},
+		{"server-only opcode", func(t *testing.T, ws *websocket.Conn) {
+			sendPayload(t, ws, OpDispatch, nil)
+		}, CloseUnknownOpcode},
+		{"presence before identify", func(t *testing.T, ws *websocket.Conn) {
+			sendPayload(t, ws, OpPresenceUpdate, ClientPresenceUpdate{Status: "idle"})
+		}, CloseNotAuthenticated},
+		{"member request before identify", func(t *testing.T, ws *websocket.Conn) {
+			sendPayload(t, ws, OpRequestGuildMembers, RequestGuildMembersData{GuildID: 1, UserIDs: []int64{1}})
+		}, CloseNotAuthenticated},
+		{"voice state update before identify", func(t *testing.T, ws *websocket.Conn) {
+			sendPayload(t, ws, OpVoiceStateUpdate, ClientVoiceStateUpdate{GuildID: 1})
+		}, CloseNotAuthenticated},
+		{"bad token in identify", func(t *testing.T, ws *websocket.Conn) {
+			sendPayload(t, ws, OpIdentify, IdentifyData{Token: "bogus"})
+		}, CloseAuthenticationFailed},
+		{"bad token in resume", func(t *testing.T, ws *websocket.Conn) {
+			sendPayload(t, ws, OpResume, ResumeData{Token: "bogus", SessionID: "s1", Sequence: 1})
+		}, CloseAuthenticationFailed},
+		{"identify twice", func(t *testing.T, ws *websocket.Conn) {
+			identify(t, ws, token)
+			sendPayload(t, ws, OpIdentify, IdentifyData{Token: token})
+		}, CloseAlreadyAuthenticated},
+		{"resume after identify", func(t *testing.T, ws *websocket.Conn) {
+			sessionID := identify(t, ws, token)
+			sendPayload(t, ws, OpResume, ResumeData{Token: token, SessionID: sessionID, Sequence: 1})
+		}, CloseAlreadyAuthenticated},
+		{"resume from a sequence never sent", func(t *testing.T, ws *websocket.Conn) {
+			other := dialWS(t, srv)
+			readPayload(t, other) // HELLO
+			sessionID := identify(t, other, token)
+			sendPayload(t, ws, OpResume, ResumeData{Token: token, SessionID: sessionID, Sequence: 5})
+		}, CloseInvalidSeq},
+		{"intents with unknown bits", func(t *testing.T, ws *websocket.Conn) {
+			unknown := Intents(1 << 40)
+			sendPayload(t, ws, OpIdentify, IdentifyData{Token: token, Intents: &unknown})
+		}, CloseInvalidIntents},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := dialWS(t, srv)
+			readPayload(t, ws) // HELLO
+			tt.send(t, ws)
+			if code, _ := readCloseCode(t, ws); code != tt.want {
+				t.Errorf("close code = %d, want %d", code, tt.want)
+			}
+		})
+	}
+}
+
+func TestWSLifecycle_IdentifyFailureIsInvalidSession(t *testing.T) {
+	tokens := auth.NewTokenService("test-secret")
+	token, err := tokens.GenerateAccessToken(42)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+	var failing atomic.Bool
+	failing.Store(true)
+	guilds := &mockGuildRepo{GetByUserIDFn: func(context.Context, int64) ([]models.Guild, error) {
+		if failing.Load() {
+			return nil, errors.New("database unavailable")
+		}
+		return nil, nil
+	}}
+	m := NewManager(tokens, nil, guilds, nil, newTestRedis(t))
+	srv := setupWSServer(t, m)
+
+	ws := dialWS(t, srv)
+	readPayload(t, ws) // HELLO
+	sendPayload(t, ws, OpIdentify, IdentifyData{Token: token})
+
+	p := readPayload(t, ws)
+	if p.Op != OpInvalidSession {
+		t.Fatalf("op = %d, want %d (INVALID_SESSION)", p.Op, OpInvalidSession)
+	}
+	var invalid InvalidSessionData
+	decodeData(t, p, &invalid)
+	if invalid.Resumable {
+		t.Error("a session that was never created must not be resumable")
+	}
+
+	// Nothing was registered, so the client may IDENTIFY again.
+	failing.Store(false)
+	identify(t, ws, token)
+}
+
+func TestCheckHeartbeat_ClosesTimedOutSession(t *testing.T) {
+	c, _, client := slowConn(t, 1)
+
+	if !c.checkHeartbeat() {
+		t.Fatal("a fresh connection should not time out")
+	}
+
+	c.lastHeartbeat.Store(time.Now().Add(-heartbeatInterval - heartbeatTimeout - time.Second).UnixMilli())
+	if c.checkHeartbeat() {
+		t.Fatal("a connection that missed its heartbeat should time out")
+	}
+	if code, _ := readCloseCode(t, client); code != CloseSessionTimedOut {
+		t.Errorf("close code = %d, want %d", code, CloseSessionTimedOut)
+	}
+}
@@ -0,0 +1,246 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// clusterChannel is the Redis pub/sub channel every gateway node subscribes
+// to in cluster mode.
+const clusterChannel = "gateway:events"
+
+// Messages from other nodes are delivered by clusterWorkers goroutines, each
+// with a queue of clusterWorkerQueue messages. A message goes to the worker
+// picked by its guild, or its user for direct events, so the messages about
+// one guild are delivered in the order they were published, and a slow
+// permission lookup for a channel only holds up the guilds on its worker.
+const (
+	clusterWorkers     = 16
+	clusterWorkerQueue = 256
+)
+
+// Kinds of cluster messages.
+const (
+	clusterDispatchGuild         = "dispatch_guild"
+	clusterDispatchChannel       = "dispatch_channel"
+	clusterDispatchMembers       = "dispatch_members"
+	clusterDispatchUser          = "dispatch_user"
+	clusterSubscribe             = "subscribe"
+	clusterUnsubscribe           = "unsubscribe"
+	clusterJoinGuild             = "join_guild"
+	clusterInvalidatePermissions = "invalidate_permissions"
+)
+
+// clusterMessage is the envelope published between gateway nodes. Every node
+// receives every message and delivers it to its own local connections.
+type clusterMessage struct {
+	Node         string          `json:"node"`
+	Kind         string          `json:"kind"`
+	GuildID      int64           `json:"guild_id,omitempty"`
+	ChannelID    int64           `json:"channel_id,omitempty"`
+	UserID       int64           `json:"user_id,omitempty"`
+	ExceptUserID int64           `json:"except_user_id,omitempty"`
+	UserIDs      []int64         `json:"user_ids,omitempty"`
+	Event        string          `json:"event,omitempty"`
+	Data         json.RawMessage `json:"data,omitempty"`
+	DataMsgpack  []byte          `json:"data_msgpack,omitempty"`
+}
+
+// StartCluster switches the Manager into cluster mode: dispatches and
+// subscription changes are published through Redis so that several gateway
+// nodes can serve the same users, and messages from other nodes are delivered
+// to local connections. It returns once the subscription is active; delivery
+// stops when ctx is cancelled.
+func (m *Manager) StartCluster(ctx context.Context) error {
+	sub, err := m.redis.Subscribe(ctx, clusterChannel)
+	if err != nil {
+		return err
+	}
+
+	m.nodeID = uuid.NewString()
+	m.clustered.Store(true)
+
+	go func() {
+		<-ctx.Done()
+		_ = sub.Close()
+	}()
+
+	queues := make([]chan clusterMessage, clusterWorkers)
+	for i := range queues {
+		queues[i] = make(chan clusterMessage, clusterWorkerQueue)
+		go func(queue <-chan clusterMessage) {
+			for msg := range queue {
+				m.handleClusterMessage(msg)
+			}
+		}(queues[i])
+	}
+
+	go func() {
+		defer func() {
+			for _, queue := range queues {
+				close(queue)
+			}
+		}()
+		for payload := range sub.Messages() {
+			var msg clusterMessage
+			if err := json.Unmarshal(payload, &msg); err != nil {
+				slog.Error("invalid cluster message", "error", err)
+				continue
+			}
+			if msg.Node == m.nodeID {
+				continue
+			}
+			queues[msg.worker()] <- msg
+		}
+	}()
+
+	slog.Info("gateway cluster mode enabled", "node", m.nodeID)
+	return nil
+}
+
+// handleClusterMessage applies a message published by another node.
+func (m *Manager) handleClusterMessage(msg clusterMessage) {
+	switch msg.Kind {
+	case clusterDispatchGuild:
+		m.deliverToGuild(msg.GuildID, msg.ExceptUserID, Event{Name: msg.Event, Data: msg.eventData()})
+
+	case clusterDispatchChannel:
+		m.deliverToChannel(msg.GuildID, msg.ChannelID, Event{Name: msg.Event, Data: msg.eventData()})
+
+	case clusterDispatchMembers:
+		m.deliverToGuildMembers(msg.GuildID, msg.UserIDs, Event{Name: msg.Event, Data: msg.eventData()})
+
+	case clusterDispatchUser:
+		m.deliverToUser(msg.UserID, Event{Name: msg.Event, Data: msg.eventData()})
+
+	case clusterSubscribe:
+		// Only track users with a session on this node; the node that
+		// hosts the user's other sessions applies the change there.
+		m.mu.RLock()
+		local := len(m.sessionLogs[msg.UserID]) > 0
+		m.mu.RUnlock()
+		if local {
+			m.subscribe(msg.UserID, msg.GuildID)
+		}
+
+	case clusterUnsubscribe:
+		m.unsubscribe(msg.UserID, msg.GuildID)
+
+	case clusterJoinGuild:
+		m.joinGuild(msg.UserID, msg.GuildID)
+
+	case clusterInvalidatePermissions:
+		m.invalidatePermissions(msg.GuildID, msg.UserID)
+	}
+}
+
+// worker picks the delivery worker of a message by its guild, or by its user
+// when it isn't about a guild.
+func (msg clusterMessage) worker() int {
+	key := msg.GuildID
+	if key == 0 {
+		key = msg.UserID
+	}
+	return int(uint64(key) % clusterWorkers)
+}
+
+// eventData returns the dispatch data carried by a message, already encoded
+// in every wire encoding.
+func (msg clusterMessage) eventData() *eventData {
+	return &eventData{json: msg.Data, msgpack: msg.DataMsgpack}
+}
+
+// publishEvent encodes a dispatch payload in every wire encoding and
+// publishes it to the other nodes, which can no longer encode the original
+// value. It is a no-op outside cluster mode.
+func (m *Manager) publishEvent(msg clusterMessage, data any) {
+	if !m.clustered.Load() {
+		return
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		slog.Error("marshal cluster event error", "event", msg.Event, "error", err)
+		return
+	}
+	packed, err := marshalMsgpack(data)
+	if err != nil {
+		slog.Error("marshal cluster event error", "event", msg.Event, "error", err)
+		return
+	}
+	msg.Data = raw
+	msg.DataMsgpack = packed
+	m.publish(msg)
+}
+
+// publish sends a message to the other nodes. It is a no-op outside cluster
+// mode.
+func (m *Manager) publish(msg clusterMessage) {
+	if !m.clustered.Load() {
+		return
+	}
+	msg.Node = m.nodeID
+
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		slog.Error("marshal cluster message error", "kind", msg.Kind, "error", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := m.redis.Publish(ctx, clusterChannel, payload); err != nil {
+		slog.Error("failed to publish cluster message", "kind", msg.Kind, "error", err)
+	}
+}
+
+// defaultSessionTTL is how long a session tracked in Redis counts as live
+// without a heartbeat: two heartbeats, with their grace, may be missed
+// before other nodes stop seeing it.
+const defaultSessionTTL = 2 * (heartbeatInterval + heartbeatTimeout)
+
+// trackSession records a session in Redis, or refreshes it on a heartbeat,
+// so that presence is only cleared once the user's last session on any node
+// has closed. It is a no-op outside cluster mode.
+func (m *Manager) trackSession(userID int64, sessionID string) {
+	if !m.clustered.Load() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := m.redis.AddGatewaySession(ctx, userID, sessionID, m.sessionTTL); err != nil {
+		slog.Error("failed to track gateway session", "userID", userID, "error", err)
+	}
+}
+
+// untrackSession removes a session recorded by trackSession.
+func (m *Manager) untrackSession(userID int64, sessionID string) {
+	if !m.clustered.Load() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := m.redis.RemoveGatewaySession(ctx, userID, sessionID); err != nil {
+		slog.Error("failed to untrack gateway session", "userID", userID, "error", err)
+	}
+}
+
+// hasRemoteSessions reports whether the user still has a live session on any
+// node.
+// Outside cluster mode it always returns false.
+func (m *Manager) hasRemoteSessions(userID int64) bool {
+	if !m.clustered.Load() {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	n, err := m.redis.CountGatewaySessions(ctx, userID, m.sessionTTL)
+	if err != nil {
+		slog.Error("failed to count gateway sessions", "userID", userID, "error", err)
+		return false
+	}
+	return n > 0
+}
@@ -0,0 +1,274 @@
+package gateway
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/victorivanov/retrocast/internal/auth"
+	"github.com/victorivanov/retrocast/internal/permissions"
+	redisclient "github.com/victorivanov/retrocast/internal/redis"
+)
+
+// newClusterPair starts two Managers in cluster mode sharing one Redis.
+func newClusterPair(t *testing.T) (*Manager, *Manager) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	tokens := auth.NewTokenService("test-secret")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	nodes := make([]*Manager, 2)
+	for i := range nodes {
+		rdb, err := redisclient.NewClient("redis://" + mr.Addr())
+		if err != nil {
+			t.Fatalf("creating redis client: %v", err)
+		}
+		t.Cleanup(func() { _ = rdb.Close() })
+
+		nodes[i] = NewManager(tokens, nil, &mockGuildRepo{}, nil, rdb)
+		if err := nodes[i].StartCluster(ctx); err != nil {
+			t.Fatalf("StartCluster: %v", err)
+		}
+	}
+	return nodes[0], nodes[1]
+}
+
+// waitEvents polls a connection's Send channel until n payloads arrive or
+// the timeout elapses.
+func waitEvents(c *Connection, n int, timeout time.Duration) []GatewayPayload {
+	var got []GatewayPayload
+	deadline := time.After(timeout)
+	for len(got) < n {
+		select {
+		case raw := <-c.Send:
+			if p, err := decodeFrame(raw); err == nil {
+				got = append(got, p)
+			}
+		case <-deadline:
+			return got
+		}
+	}
+	return got
+}
+
+func TestCluster_DispatchToGuildReachesOtherNode(t *testing.T) {
+	a, b := newClusterPair(t)
+
+	local := fakeConn(a, 100, "s1")
+	remote := fakeConn(b, 200, "s2")
+	defer func() { _ = local.Conn.Close() }()
+	defer func() { _ = remote.Conn.Close() }()
+	a.subscribe(100, 1)
+	b.subscribe(200, 1)
+
+	a.DispatchToGuild(1, EventMessageCreate, map[string]string{"content": "hello"})
+
+	if got := waitEvents(local, 1, time.Second); len(got) != 1 {
+		t.Fatalf("local subscriber received %d events, want 1", len(got))
+	}
+	got := waitEvents(remote, 1, time.Second)
+	if len(got) != 1 {
+		t.Fatalf("remote subscriber received %d events, want 1", len(got))
+	}
+	if got[0].Event == nil || *got[0].Event != EventMessageCreate {
+		t.Errorf("event = %v, want %q", got[0].Event, EventMessageCreate)
+	}
+	var data map[string]string
+	decodeData(t, got[0], &data)
+	if data["content"] != "hello" {
+		t.Errorf("data = %v, want content=hello", data)
+	}
+
+	// The remote node keeps the event for RESUME as well.
+	if n := len(remote.log.events.since(0)); n != 1 {
+		t.Errorf("remote session log has %d events, want 1", n)
+	}
+
+	// Nodes ignore their own published messages: no duplicate locally.
+	if extra := waitEvents(local, 1, 100*time.Millisecond); len(extra) != 0 {
+		t.Errorf("local subscriber received %d duplicate events", len(extra))
+	}
+}
+
+func TestCluster_DispatchToUserReachesAllNodes(t *testing.T) {
+	a, b := newClusterPair(t)
+
+	phone := fakeConn(a, 100, "phone")
+	web := fakeConn(b, 100, "web")
+	defer func() { _ = phone.Conn.Close() }()
+	defer func() { _ = web.Conn.Close() }()
+
+	a.DispatchToUser(100, EventMessageCreate, "dm")
+
+	if got := waitEvents(phone, 1, time.Second); len(got) != 1 {
+		t.Errorf("session on node A received %d events, want 1", len(got))
+	}
+	if got := waitEvents(web, 1, time.Second); len(got) != 1 {
+		t.Errorf("session on node B received %d events, want 1", len(got))
+	}
+}
+
+func TestCluster_DispatchToGuildExceptHonouredRemotely(t *testing.T) {
+	a, b := newClusterPair(t)
+
+	author := fakeConn(b, 100, "s1")
+	other := fakeConn(b, 200, "s2")
+	defer func() { _ = author.Conn.Close() }()
+	defer func() { _ = other.Conn.Close() }()
+	b.subscribe(100, 1)
+	b.subscribe(200, 1)
+
+	a.DispatchToGuildExcept(1, 100, EventTypingStart, "typing")
+
+	if got := waitEvents(other, 1, time.Second); len(got) != 1 {
+		t.Errorf("other member received %d events, want 1", len(got))
+	}
+	if got := waitEvents(author, 1, 100*time.Millisecond); len(got) != 0 {
+		t.Errorf("excluded member received %d events, want 0", len(got))
+	}
+}
+
+func TestCluster_DispatchToGuildMembersHonouredRemotely(t *testing.T) {
+	a, b := newClusterPair(t)
+
+	viewer := fakeConn(b, 100, "s1")
+	other := fakeConn(b, 200, "s2")
+	defer func() { _ = viewer.Conn.Close() }()
+	defer func() { _ = other.Conn.Close() }()
+	b.subscribe(100, 1)
+	b.subscribe(200, 1)
+
+	a.DispatchToGuildMembers(1, []int64{100}, EventChannelDelete, "channel")
+
+	if got := waitEvents(viewer, 1, time.Second); len(got) != 1 {
+		t.Errorf("listed member received %d events, want 1", len(got))
+	}
+	if got := waitEvents(other, 1, 100*time.Millisecond); len(got) != 0 {
+		t.Errorf("unlisted member received %d events, want 0", len(got))
+	}
+}
+
+// blockingChannelPerms holds every permission lookup until release is
+// closed.
+type blockingChannelPerms struct {
+	mockChannelPerms
+	release chan struct{}
+}
+
+func (b *blockingChannelPerms) FilterChannelPermission(ctx context.Context, guildID, channelID int64, userIDs []int64, perm permissions.Permission) ([]int64, error) {
+	<-b.release
+	return b.mockChannelPerms.FilterChannelPermission(ctx, guildID, channelID, userIDs, perm)
+}
+
+func TestCluster_SlowChannelLookupDoesNotStallOtherGuilds(t *testing.T) {
+	a, b := newClusterPair(t)
+	perms := &blockingChannelPerms{release: make(chan struct{})}
+	b.SetChannelPermissions(perms)
+	t.Cleanup(func() { close(perms.release) })
+
+	slow := fakeConn(b, 100, "s1")
+	other := fakeConn(b, 200, "s2")
+	defer func() { _ = slow.Conn.Close() }()
+	defer func() { _ = other.Conn.Close() }()
+	b.subscribe(100, 1)
+	b.subscribe(200, 2)
+
+	a.DispatchToChannel(1, 10, EventMessageCreate, "stuck")
+	a.DispatchToGuild(2, EventMessageCreate, "hello")
+
+	if got := waitEvents(other, 1, time.Second); len(got) != 1 {
+		t.Errorf("member of another guild received %d events while a lookup was stuck, want 1", len(got))
+	}
+	if got := waitEvents(slow, 1, 100*time.Millisecond); len(got) != 0 {
+		t.Errorf("member waiting on the lookup received %d events, want 0", len(got))
+	}
+}
+
+func TestCluster_SubscribeToGuildAppliesOnOwningNode(t *testing.T) {
+	a, b := newClusterPair(t)
+
+	c := fakeConn(b, 300, "s1")
+	defer func() { _ = c.Conn.Close() }()
+
+	// An HTTP request handled by node A (e.g. accepting an invite) subscribes
+	// a user whose WebSocket lives on node B.
+	a.SubscribeToGuild(300, 7)
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		b.mu.RLock()
+		subscribed := b.subscriptions[7][300]
+		b.mu.RUnlock()
+		if subscribed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("node B did not apply the subscription")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	a.DispatchToGuild(7, EventGuildUpdate, "update")
+	if got := waitEvents(c, 1, time.Second); len(got) != 1 {
+		t.Fatalf("newly subscribed user received %d events, want 1", len(got))
+	}
+
+	a.UnsubscribeFromGuild(300, 7)
+	deadline = time.Now().Add(time.Second)
+	for {
+		b.mu.RLock()
+		subscribed := b.subscriptions[7][300]
+		b.mu.RUnlock()
+		if !subscribed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("node B did not apply the unsubscription")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestCluster_RemoteSessionsKeepUserOnline(t *testing.T) {
+	a, b := newClusterPair(t)
+
+	b.trackSession(100, "web")
+	if !a.hasRemoteSessions(100) {
+		t.Fatal("node A should see the session tracked by node B")
+	}
+
+	b.untrackSession(100, "web")
+	if a.hasRemoteSessions(100) {
+		t.Fatal("session should be gone after untrack")
+	}
+}
+
+func TestCluster_SessionsOfCrashedNodeExpire(t *testing.T) {
+	a, b := newClusterPair(t)
+	a.sessionTTL = 100 * time.Millisecond
+	b.sessionTTL = 100 * time.Millisecond
+
+	// Node B tracks two sessions, then crashes: only "mobile" is refreshed
+	// afterwards, by a heartbeat on the node it reconnected to.
+	b.trackSession(100, "web")
+	b.trackSession(100, "mobile")
+	time.Sleep(60 * time.Millisecond)
+	a.trackSession(100, "mobile")
+	time.Sleep(60 * time.Millisecond)
+
+	n, err := a.redis.CountGatewaySessions(context.Background(), 100, a.sessionTTL)
+	if err != nil {
+		t.Fatalf("CountGatewaySessions: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("live sessions = %d, want 1", n)
+	}
+
+	time.Sleep(120 * time.Millisecond)
+	if a.hasRemoteSessions(100) {
+		t.Fatal("sessions not refreshed within the TTL should not count")
+	}
+}
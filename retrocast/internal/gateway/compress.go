@@ -0,0 +1,41 @@
+package gateway
+
+import (
+	"bytes"
+	"compress/zlib"
+)
+
+// compressZlibStream is the ?compress= value enabling transport compression.
+const compressZlibStream = "zlib-stream"
+
+// zlibSuffix ends every zlib-stream frame. It is the marker of the sync
+// flush after each payload; clients buffer binary frames until they see it
+// and then inflate them with the connection's shared zlib context.
+var zlibSuffix = []byte{0x00, 0x00, 0xff, 0xff}
+
+// zlibStream compresses a connection's outbound payloads into a single zlib
+// stream, so later payloads reuse the dictionary built by earlier ones. It
+// is owned by the connection's write pump.
+type zlibStream struct {
+	buf bytes.Buffer
+	w   *zlib.Writer
+}
+
+func newZlibStream() *zlibStream {
+	z := &zlibStream{}
+	z.w = zlib.NewWriter(&z.buf)
+	return z
+}
+
+// compress deflates one payload and flushes it, returning the frame to send.
+// The frame is only valid until the next call.
+func (z *zlibStream) compress(payload []byte) ([]byte, error) {
+	z.buf.Reset()
+	if _, err := z.w.Write(payload); err != nil {
+		return nil, err
+	}
+	if err := z.w.Flush(); err != nil {
+		return nil, err
+	}
+	return z.buf.Bytes(), nil
+}
@@ -0,0 +1,254 @@
+package gateway
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/victorivanov/retrocast/internal/auth"
+	"github.com/victorivanov/retrocast/internal/models"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// inflateStream decodes every payload of a zlib-stream sent so far in the
+// test encoding. The stream is never closed, so decoding stops at the end
+// of the last flush.
+func inflateStream(t testing.TB, frames [][]byte) []GatewayPayload {
+	t.Helper()
+	zr, err := zlib.NewReader(bytes.NewReader(bytes.Join(frames, nil)))
+	if err != nil {
+		t.Fatalf("zlib reader: %v", err)
+	}
+	raw, _ := io.ReadAll(zr) // ends with io.ErrUnexpectedEOF
+
+	var payloads []GatewayPayload
+	if testEncoding == encodingMsgpack {
+		dec := msgpack.NewDecoder(bytes.NewReader(raw))
+		for {
+			frame, err := dec.DecodeRaw()
+			if err != nil {
+				return payloads
+			}
+			p, err := decodeFrame(frame)
+			if err != nil {
+				t.Fatalf("decode frame: %v", err)
+			}
+			payloads = append(payloads, p)
+		}
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	for {
+		var p GatewayPayload
+		if err := dec.Decode(&p); err != nil {
+			return payloads
+		}
+		payloads = append(payloads, p)
+	}
+}
+
+func TestZlibStream_SharesContextAcrossPayloads(t *testing.T) {
+	z := newZlibStream()
+
+	var frames [][]byte
+	for i := 0; i < 3; i++ {
+		c := &Connection{encoding: testEncoding, Send: make(chan []byte, 1)}
+		c.SendOp(OpHeartbeatAck, nil)
+		frame, err := z.compress(<-c.Send)
+		if err != nil {
+			t.Fatalf("compress: %v", err)
+		}
+		if !bytes.HasSuffix(frame, zlibSuffix) {
+			t.Errorf("frame %d does not end with the zlib-stream suffix", i)
+		}
+		frames = append(frames, bytes.Clone(frame))
+	}
+
+	// Later frames reuse the stream's dictionary instead of starting over.
+	if len(frames[2]) >= len(frames[0]) {
+		t.Errorf("third frame is %d bytes, first %d; want it smaller", len(frames[2]), len(frames[0]))
+	}
+
+	got := inflateStream(t, frames)
+	if len(got) != 3 {
+		t.Fatalf("decoded %d payloads, want 3", len(got))
+	}
+	for i, p := range got {
+		if p.Op != OpHeartbeatAck {
+			t.Errorf("payload %d op = %d, want %d", i, p.Op, OpHeartbeatAck)
+		}
+	}
+}
+
+func TestParseTransportOptions(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    string
+		wantErr bool
+	}{
+		{"", "", false},
+		{"compress=zlib-stream", compressZlibStream, false},
+		{"compress=zlib-stream&encoding=msgpack", compressZlibStream, false},
+		{"compress=gzip", "", true},
+		{"encoding=etf", "", true},
+	}
+	for _, tt := range tests {
+		q, _ := url.ParseQuery(tt.query)
+		opts, err := parseTransportOptions(q)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: err = %v, wantErr %v", tt.query, err, tt.wantErr)
+		}
+		if opts.compress != tt.want {
+			t.Errorf("%q: compress = %q, want %q", tt.query, opts.compress, tt.want)
+		}
+	}
+}
+
+func TestWSLifecycle_ZlibStream(t *testing.T) {
+	tokens := auth.NewTokenService("test-secret")
+	token, err := tokens.GenerateAccessToken(42)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+	m := NewManager(tokens, nil, &mockGuildRepo{}, nil, newTestRedis(t))
+	srv := setupWSServer(t, m)
+
+	ws := dialWS(t, srv, "compress=zlib-stream")
+
+	var frames [][]byte
+	readFrame := func() {
+		t.Helper()
+		_ = ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+		kind, frame, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if kind != websocket.BinaryMessage {
+			t.Fatalf("frame type = %d, want binary", kind)
+		}
+		if !bytes.HasSuffix(frame, zlibSuffix) {
+			t.Fatal("frame does not end with the zlib-stream suffix")
+		}
+		frames = append(frames, frame)
+	}
+
+	readFrame()
+	// Inbound payloads aren't compressed.
+	sendPayload(t, ws, OpIdentify, IdentifyData{Token: token})
+	readFrame()
+
+	got := inflateStream(t, frames)
+	if len(got) != 2 {
+		t.Fatalf("decoded %d payloads, want 2", len(got))
+	}
+	if got[0].Op != OpHello {
+		t.Errorf("first payload op = %d, want HELLO", got[0].Op)
+	}
+	if got[1].Event == nil || *got[1].Event != EventReady {
+		t.Errorf("second payload event = %v, want READY", got[1].Event)
+	}
+}
+
+func TestWSLifecycle_UnsupportedCompressionRejected(t *testing.T) {
+	m := newTestManager(t, &mockGuildRepo{})
+	srv := setupWSServer(t, m)
+
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/gateway?compress=gzip"
+	ws, resp, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err == nil {
+		_ = ws.Close()
+		t.Fatal("expected the upgrade to fail")
+	}
+	if resp == nil || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("response = %v, want 400", resp)
+	}
+}
+
+// eventMix returns the outbound payloads of a busy session: READY for a
+// user in 20 guilds followed by a burst of presence, typing and message
+// traffic.
+func eventMix() [][]byte {
+	var payloads [][]byte
+	seq := int64(0)
+	add := func(name string, data any) {
+		seq++
+		s, n := seq, name
+		raw, _ := json.Marshal(GatewayPayload{Op: OpDispatch, Data: mustMarshal(data), Sequence: &s, Event: &n})
+		payloads = append(payloads, raw)
+	}
+
+	now := time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)
+	ready := ReadyData{SessionID: "6f1c2a9e-4b7d-4c1e-9a51-0d6b8e3f2c47", UserID: 175928847299117056}
+	for i := int64(0); i < 20; i++ {
+		ready.Guilds = append(ready.Guilds, UnavailableGuild{ID: 175928847299117100 + i, Unavailable: true})
+		ready.ReadStates = append(ready.ReadStates, models.ReadState{
+			UserID: ready.UserID, ChannelID: 175928847299118000 + i, LastMessageID: 175928847299119000 + i, UpdatedAt: now,
+		})
+	}
+	add(EventReady, ready)
+
+	statuses := []string{"online", "idle", "dnd", "offline"}
+	for i := int64(0); i < 300; i++ {
+		switch {
+		case i%3 == 0:
+			add(EventPresenceUpdate, PresenceUpdateData{UserID: 175928847299120000 + i, Status: statuses[i%4]})
+		case i%3 == 1:
+			add(EventTypingStart, TypingStartData{
+				ChannelID: 175928847299118000 + i%5, GuildID: 175928847299117100, UserID: 175928847299120000 + i, Timestamp: now.Unix() + i,
+			})
+		default:
+			add(EventMessageCreate, models.MessageWithAuthor{
+				Message: models.Message{
+					ID: 175928847299130000 + i, ChannelID: 175928847299118000 + i%5, AuthorID: 175928847299120000 + i%7,
+					Content:   fmt.Sprintf("message %d: sounds good, see you at the standup tomorrow", i),
+					CreatedAt: now.Add(time.Duration(i) * time.Second), Mentions: []int64{}, MentionRoles: []int64{},
+				},
+				AuthorUsername: fmt.Sprintf("user%d", i%7), AuthorDisplayName: fmt.Sprintf("User %d", i%7),
+				Attachments: []models.Attachment{},
+			})
+		}
+	}
+	return payloads
+}
+
+// BenchmarkWireBytes compares the bytes on the wire for eventMix with and
+// without zlib-stream compression.
+func BenchmarkWireBytes(b *testing.B) {
+	payloads := eventMix()
+
+	b.Run("json", func(b *testing.B) {
+		var wire int
+		for i := 0; i < b.N; i++ {
+			wire = 0
+			for _, p := range payloads {
+				wire += len(p)
+			}
+		}
+		b.ReportMetric(float64(wire), "wire-bytes/op")
+	})
+
+	b.Run("zlib-stream", func(b *testing.B) {
+		var wire, raw int
+		for i := 0; i < b.N; i++ {
+			z := newZlibStream()
+			wire, raw = 0, 0
+			for _, p := range payloads {
+				frame, err := z.compress(p)
+				if err != nil {
+					b.Fatal(err)
+				}
+				wire += len(frame)
+				raw += len(p)
+			}
+		}
+		b.ReportMetric(float64(wire), "wire-bytes/op")
+		b.ReportMetric(float64(raw)/float64(wire), "ratio")
+	})
+}
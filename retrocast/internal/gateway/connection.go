@@ -17,6 +17,10 @@ const (
 	pongWait          = 60 * time.Second
 	maxMessageSize    = 4096
 	sendBufferSize    = 256
+
+	// maxDroppedFrames is how many frames a connection may drop before it
+	// is closed as a slow consumer.
+	maxDroppedFrames = 64
 )
 
 // Connection represents a single WebSocket client connection.
@@ -26,58 +30,154 @@ type Connection struct {
 	Conn      *websocket.Conn
 	Send      chan []byte
 	manager   *Manager
-	sequence  atomic.Int64
+	log       *sessionLog // set once the connection joins a session
+	encoding  string      // encodingJSON or encodingMsgpack
+	zlib      *zlibStream // nil unless the client asked for zlib-stream
+	ip        string      // client address, for the IDENTIFY limits
+	limiter   *inboundLimiter
 
 	closeOnce sync.Once
 	done      chan struct{}
 
 	lastHeartbeat atomic.Int64 // unix millis of last heartbeat ACK from client
+
+	// Backpressure. Once a dispatch has been dropped the connection is
+	// lagging: later dispatches are dropped too, so the client never sees
+	// a gap, and it is closed once the queue drains or maxDroppedFrames is
+	// passed. Frames are dropped under the session log's lock, so passing
+	// maxDroppedFrames only closes slow and leaves the closing to writePump.
+	dropped    atomic.Int64
+	lagging    atomic.Bool
+	slowClosed atomic.Bool
+	slow       chan struct{}
 }
 
-func newConnection(conn *websocket.Conn, manager *Manager) *Connection {
+func newConnection(conn *websocket.Conn, manager *Manager, opts transportOptions) *Connection {
 	c := &Connection{
-		Conn:    conn,
-		Send:    make(chan []byte, sendBufferSize),
-		manager: manager,
-		done:    make(chan struct{}),
+		Conn:     conn,
+		Send:     make(chan []byte, sendBufferSize),
+		manager:  manager,
+		encoding: opts.encoding,
+		limiter:  newInboundLimiter(),
+		done:     make(chan struct{}),
+		slow:     make(chan struct{}),
+	}
+	if opts.compress == compressZlibStream {
+		c.zlib = newZlibStream()
 	}
 	c.lastHeartbeat.Store(time.Now().UnixMilli())
 	return c
 }
 
-// NextSequence increments and returns the next sequence number.
-func (c *Connection) NextSequence() int64 {
-	return c.sequence.Add(1)
+// SendOp encodes and queues a non-dispatch payload; data may be nil.
+func (c *Connection) SendOp(op int, data any) {
+	var raw []byte
+	if data != nil {
+		var err error
+		if raw, err = c.marshal(data); err != nil {
+			slog.Error("marshal error", "userID", c.UserID, "op", op, "error", err)
+			return
+		}
+	}
+	c.sendFrame(op, raw, nil, nil)
 }
 
-// SendPayload marshals and queues a payload to be sent.
-func (c *Connection) SendPayload(p GatewayPayload) {
-	data, err := json.Marshal(p)
+// SendEvent sends a dispatch event through the connection's session log,
+// which assigns its sequence number and keeps it for RESUME.
+func (c *Connection) SendEvent(name string, data any) {
+	ev, err := newEventData(data)
 	if err != nil {
-		slog.Error("marshal error", "userID", c.UserID, "error", err)
+		slog.Error("marshal event error", "event", name, "error", err)
 		return
 	}
-	select {
-	case c.Send <- data:
-	default:
-		slog.Warn("send buffer full, dropping message", "userID", c.UserID)
+	if c.log == nil {
+		slog.Warn("dropping event for connection without a session", "event", name)
+		return
 	}
+	c.log.dispatch(name, ev)
 }
 
-// SendEvent sends a dispatch event with a sequence number.
-func (c *Connection) SendEvent(name string, data any) {
-	raw, err := json.Marshal(data)
+// sendDispatch queues a dispatch payload carrying the given sequence number.
+func (c *Connection) sendDispatch(seq int64, name string, data *eventData) {
+	raw, err := data.encoded(c.encoding)
 	if err != nil {
-		slog.Error("marshal event error", "event", name, "error", err)
+		slog.Error("marshal event error", "event", name, "encoding", c.encoding, "error", err)
 		return
 	}
-	seq := c.NextSequence()
-	c.SendPayload(GatewayPayload{
-		Op:        OpDispatch,
-		Data:      raw,
-		Sequence:  &seq,
-		Event: &name,
-	})
+	c.sendFrame(OpDispatch, raw, &seq, &name)
+}
+
+// sendFrame wraps data, already in the connection's encoding, in a payload
+// envelope and queues it. Frames that don't fit in the queue are dropped.
+func (c *Connection) sendFrame(op int, data []byte, seq *int64, name *string) {
+	dispatch := op == OpDispatch
+	if dispatch && c.lagging.Load() {
+		c.dropFrame()
+		return
+	}
+
+	var frame []byte
+	var err error
+	if c.encoding == encodingMsgpack {
+		frame, err = marshalMsgpack(msgpackPayload{Op: op, Data: data, Sequence: seq, Event: name})
+	} else {
+		frame, err = json.Marshal(GatewayPayload{Op: op, Data: data, Sequence: seq, Event: name})
+	}
+	if err != nil {
+		slog.Error("marshal error", "userID", c.UserID, "op", op, "error", err)
+		return
+	}
+	select {
+	case c.Send <- frame:
+	default:
+		if dispatch {
+			c.lagging.Store(true)
+		}
+		c.dropFrame()
+	}
+}
+
+// dropFrame counts a frame that was not queued, telling writePump to close
+// the connection once it has dropped more than maxDroppedFrames.
+func (c *Connection) dropFrame() {
+	metricDroppedFrames.Inc()
+	if c.dropped.Add(1) > maxDroppedFrames && c.markSlowConsumer() {
+		close(c.slow)
+	}
+}
+
+// markSlowConsumer records that the connection fell behind. It reports
+// whether this call did so, so that the connection is closed once.
+func (c *Connection) markSlowConsumer() bool {
+	if !c.slowClosed.CompareAndSwap(false, true) {
+		return false
+	}
+	metricSlowConsumerCloses.Inc()
+	slog.Warn("closing slow consumer", "userID", c.UserID, "sessionID", c.SessionID, "dropped", c.dropped.Load())
+	return true
+}
+
+// closeWithCode sends a close frame and terminates the connection. It may
+// be called from any goroutine.
+func (c *Connection) closeWithCode(code int, text string) {
+	_ = c.Conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(writeWait))
+	c.Close()
+}
+
+// marshal encodes a value in the connection's encoding.
+func (c *Connection) marshal(v any) ([]byte, error) {
+	if c.encoding == encodingMsgpack {
+		return marshalMsgpack(v)
+	}
+	return json.Marshal(v)
+}
+
+// unmarshal decodes a value sent in the connection's encoding.
+func (c *Connection) unmarshal(data []byte, v any) error {
+	if c.encoding == encodingMsgpack {
+		return unmarshalMsgpack(data, v)
+	}
+	return json.Unmarshal(data, v)
 }
 
 // Close terminates the connection.
@@ -131,20 +231,28 @@ func (c *Connection) writePump() {
 				_ = c.Conn.WriteMessage(websocket.CloseMessage, nil)
 				return
 			}
-			if err := c.Conn.WriteMessage(websocket.TextMessage, message); err != nil {
+			if err := c.writeFrame(message); err != nil {
 				return
 			}
+			// A lagging client has now received everything before its
+			// first dropped event.
+			if c.lagging.Load() && len(c.Send) == 0 {
+				c.markSlowConsumer()
+				c.closeWithCode(CloseSlowConsumer, "slow consumer")
+				return
+			}
+
+		case <-c.slow:
+			c.closeWithCode(CloseSlowConsumer, "slow consumer")
+			return
 
 		case <-heartbeatTicker.C:
-			// Check if client responded to last heartbeat.
-			lastAck := c.lastHeartbeat.Load()
-			if time.Since(time.UnixMilli(lastAck)) > heartbeatInterval+heartbeatTimeout {
-				slog.Warn("heartbeat timeout", "userID", c.UserID)
+			if !c.checkHeartbeat() {
 				return
 			}
 
 			_ = c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
-			c.SendPayload(GatewayPayload{Op: OpHeartbeat})
+			c.SendOp(OpHeartbeat, nil)
 
 		case <-c.done:
 			return
@@ -152,26 +260,120 @@ func (c *Connection) writePump() {
 	}
 }
 
+// checkHeartbeat reports whether the client responded to the last heartbeat
+// in time, closing the connection with CloseSessionTimedOut if not.
+func (c *Connection) checkHeartbeat() bool {
+	lastAck := c.lastHeartbeat.Load()
+	if time.Since(time.UnixMilli(lastAck)) <= heartbeatInterval+heartbeatTimeout {
+		return true
+	}
+	slog.Warn("heartbeat timeout", "userID", c.UserID)
+	c.closeWithCode(CloseSessionTimedOut, "session timed out")
+	return false
+}
+
+// writeFrame writes one payload to the WebSocket. JSON goes out as text
+// frames; MessagePack and zlib-stream frames are binary.
+func (c *Connection) writeFrame(message []byte) error {
+	kind := websocket.TextMessage
+	if c.encoding == encodingMsgpack {
+		kind = websocket.BinaryMessage
+	}
+	if c.zlib == nil {
+		return c.Conn.WriteMessage(kind, message)
+	}
+	frame, err := c.zlib.compress(message)
+	if err != nil {
+		slog.Error("compress error", "userID", c.UserID, "error", err)
+		return err
+	}
+	return c.Conn.WriteMessage(websocket.BinaryMessage, frame)
+}
+
 // handleMessage processes an incoming gateway payload from the client.
 func (c *Connection) handleMessage(data []byte) {
-	var payload GatewayPayload
-	if err := json.Unmarshal(data, &payload); err != nil {
-		slog.Error("invalid payload", "userID", c.UserID, "error", err)
+	payload, err := c.decodePayload(data)
+	if err != nil {
+		slog.Warn("invalid payload", "userID", c.UserID, "error", err)
+		c.closeWithCode(CloseDecodeError, "decode error")
+		return
+	}
+	if c.limiter != nil && !c.limiter.allow(payload.Op) {
+		slog.Warn("inbound rate limit exceeded", "userID", c.UserID, "op", payload.Op)
+		c.closeWithCode(CloseRateLimited, "rate limited")
 		return
 	}
 
 	switch payload.Op {
 	case OpHeartbeat:
 		c.lastHeartbeat.Store(time.Now().UnixMilli())
-		c.SendPayload(GatewayPayload{Op: OpHeartbeatAck})
+		c.SendOp(OpHeartbeatAck, nil)
+		if c.log != nil {
+			c.manager.trackSession(c.UserID, c.SessionID)
+		}
 
 	case OpIdentify:
-		c.manager.handleIdentify(c, payload.Data)
+		if c.requireNoSession() {
+			c.manager.handleIdentify(c, payload.Data)
+		}
 
 	case OpResume:
-		c.manager.handleResume(c, payload.Data)
+		if c.requireNoSession() {
+			c.manager.handleResume(c, payload.Data)
+		}
 
 	case OpPresenceUpdate:
-		c.manager.handlePresenceUpdate(c, payload.Data)
+		if c.requireSession() {
+			c.manager.handlePresenceUpdate(c, payload.Data)
+		}
+
+	case OpVoiceStateUpdate:
+		if c.requireSession() {
+			c.manager.handleVoiceStateUpdate(c, payload.Data)
+		}
+
+	case OpRequestGuildMembers:
+		if c.requireSession() {
+			c.manager.handleRequestGuildMembers(c, payload.Data)
+		}
+
+	default:
+		slog.Warn("unknown opcode", "userID", c.UserID, "op", payload.Op)
+		c.closeWithCode(CloseUnknownOpcode, "unknown opcode")
+	}
+}
+
+// requireSession reports whether the connection has joined a session,
+// closing it with CloseNotAuthenticated if not.
+func (c *Connection) requireSession() bool {
+	if c.log == nil {
+		c.closeWithCode(CloseNotAuthenticated, "not authenticated")
+		return false
+	}
+	return true
+}
+
+// requireNoSession reports whether the connection is yet to join a session,
+// closing it with CloseAlreadyAuthenticated if not.
+func (c *Connection) requireNoSession() bool {
+	if c.log != nil {
+		c.closeWithCode(CloseAlreadyAuthenticated, "already authenticated")
+		return false
+	}
+	return true
+}
+
+// decodePayload decodes an inbound payload envelope. Its Data stays in the
+// connection's encoding, to be decoded with unmarshal.
+func (c *Connection) decodePayload(data []byte) (GatewayPayload, error) {
+	if c.encoding != encodingMsgpack {
+		var payload GatewayPayload
+		err := json.Unmarshal(data, &payload)
+		return payload, err
+	}
+	var payload msgpackPayload
+	if err := unmarshalMsgpack(data, &payload); err != nil {
+		return GatewayPayload{}, err
 	}
+	return GatewayPayload{Op: payload.Op, Data: []byte(payload.Data), Sequence: payload.Sequence, Event: payload.Event}, nil
 }
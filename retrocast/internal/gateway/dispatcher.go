@@ -6,6 +6,11 @@ type Dispatcher interface {
 	DispatchToGuild(guildID int64, event string, data interface{})
 	DispatchToUser(userID int64, event string, data interface{})
 	DispatchToGuildExcept(guildID int64, exceptUserID int64, event string, data interface{})
+	DispatchToChannel(guildID, channelID int64, event string, data interface{})
+	DispatchToGuildMembers(guildID int64, userIDs []int64, event string, data interface{})
+	InvalidateGuildPermissions(guildID int64)
+	InvalidateMemberPermissions(guildID, userID int64)
 	SubscribeToGuild(userID, guildID int64)
 	UnsubscribeFromGuild(userID, guildID int64)
+	JoinGuild(userID, guildID int64)
 }
@@ -0,0 +1,77 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Wire encodings a client picks with ?encoding= on /gateway.
+const (
+	encodingJSON    = "json"
+	encodingMsgpack = "msgpack"
+)
+
+// msgpackPayload is the MessagePack form of GatewayPayload.
+type msgpackPayload struct {
+	Op       int                `msgpack:"op"`
+	Data     msgpack.RawMessage `msgpack:"d,omitempty"`
+	Sequence *int64             `msgpack:"s,omitempty"`
+	Event    *string            `msgpack:"t,omitempty"`
+}
+
+// marshalMsgpack encodes v with MessagePack. Fields are named after their
+// JSON tags, but the ",string" option is ignored so that snowflakes are
+// native integers rather than strings.
+func marshalMsgpack(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// unmarshalMsgpack decodes data encoded by marshalMsgpack.
+func unmarshalMsgpack(data []byte, v any) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
+
+// eventData is the data of a dispatch event. It is encoded at most once
+// per wire encoding, however many sessions receive it.
+type eventData struct {
+	value any
+	json  json.RawMessage
+
+	msgpackOnce sync.Once
+	msgpack     []byte
+	msgpackErr  error
+}
+
+// newEventData encodes an event's data as JSON up front; MessagePack is
+// only encoded once a session using it receives the event.
+func newEventData(value any) (*eventData, error) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return &eventData{value: value, json: raw}, nil
+}
+
+// encoded returns the data in the given wire encoding.
+func (d *eventData) encoded(encoding string) ([]byte, error) {
+	if encoding != encodingMsgpack {
+		return d.json, nil
+	}
+	d.msgpackOnce.Do(func() {
+		if d.msgpack == nil {
+			d.msgpack, d.msgpackErr = marshalMsgpack(d.value)
+		}
+	})
+	return d.msgpack, d.msgpackErr
+}
@@ -0,0 +1,76 @@
+package gateway
+
+import (
+	"testing"
+	"time"
+
+	"github.com/victorivanov/retrocast/internal/models"
+)
+
+func TestMarshalMsgpack_SnowflakesAreIntegers(t *testing.T) {
+	msg := models.MessageWithAuthor{
+		Message: models.Message{
+			ID:        175928847299117056,
+			ChannelID: 2000,
+			AuthorID:  3000,
+			Content:   "hello",
+			CreatedAt: time.Now(),
+		},
+		AuthorUsername: "alice",
+	}
+
+	raw, err := marshalMsgpack(msg)
+	if err != nil {
+		t.Fatalf("marshalMsgpack: %v", err)
+	}
+	var fields map[string]any
+	if err := unmarshalMsgpack(raw, &fields); err != nil {
+		t.Fatalf("unmarshalMsgpack: %v", err)
+	}
+
+	// Embedded structs are inlined and fields keep their JSON names.
+	if got, ok := fields["id"].(int64); !ok || got != 175928847299117056 {
+		t.Errorf("id = %#v, want the integer 175928847299117056", fields["id"])
+	}
+	if got, ok := fields["channel_id"].(int64); !ok || got != 2000 {
+		t.Errorf("channel_id = %#v, want the integer 2000", fields["channel_id"])
+	}
+	if fields["author_username"] != "alice" {
+		t.Errorf("author_username = %#v, want alice", fields["author_username"])
+	}
+	if _, ok := fields["edited_at"]; ok {
+		t.Error("omitempty field edited_at was encoded")
+	}
+
+	var back models.MessageWithAuthor
+	if err := unmarshalMsgpack(raw, &back); err != nil {
+		t.Fatalf("decode into model: %v", err)
+	}
+	if back.ID != msg.ID || back.AuthorID != msg.AuthorID || back.Content != msg.Content {
+		t.Errorf("round trip = %+v, want %+v", back.Message, msg.Message)
+	}
+}
+
+func TestEventData_EncodesEachFormatOnce(t *testing.T) {
+	data, err := newEventData(PresenceUpdateData{UserID: 42, Status: "online"})
+	if err != nil {
+		t.Fatalf("newEventData: %v", err)
+	}
+
+	if got, _ := data.encoded(encodingJSON); string(got) != `{"user_id":"42","status":"online"}` {
+		t.Errorf("json = %s", got)
+	}
+	first, err := data.encoded(encodingMsgpack)
+	if err != nil {
+		t.Fatalf("encoded msgpack: %v", err)
+	}
+	second, _ := data.encoded(encodingMsgpack)
+	if &first[0] != &second[0] {
+		t.Error("msgpack data was encoded twice")
+	}
+
+	var decoded PresenceUpdateData
+	if err := unmarshalMsgpack(first, &decoded); err != nil || decoded.UserID != 42 {
+		t.Errorf("decoded = %+v, %v", decoded, err)
+	}
+}
@@ -8,20 +8,57 @@ import (
 
 // Op codes for gateway payloads.
 const (
-	OpDispatch         = 0
-	OpHeartbeat        = 1
-	OpIdentify         = 2
-	OpPresenceUpdate   = 3
-	OpVoiceStateUpdate = 4
-	OpResume           = 6
-	OpReconnect        = 7
-	OpHello            = 10
-	OpHeartbeatAck     = 11
+	OpDispatch            = 0
+	OpHeartbeat           = 1
+	OpIdentify            = 2
+	OpPresenceUpdate      = 3
+	OpVoiceStateUpdate    = 4
+	OpResume              = 6
+	OpReconnect           = 7
+	OpRequestGuildMembers = 8
+	OpInvalidSession      = 9
+	OpHello               = 10
+	OpHeartbeatAck        = 11
+)
+
+// Close codes the gateway closes client connections with. Apart from
+// CloseAuthenticationFailed and CloseInvalidIntents the client may reconnect
+// and RESUME or IDENTIFY again.
+const (
+	// CloseUnknownError is sent when the server can't tell what went wrong.
+	CloseUnknownError = 4000
+	// CloseUnknownOpcode is sent for a payload with an op code the gateway
+	// doesn't accept from clients.
+	CloseUnknownOpcode = 4001
+	// CloseDecodeError is sent for a payload that can't be decoded.
+	CloseDecodeError = 4002
+	// CloseNotAuthenticated is sent for a payload that needs a session sent
+	// before IDENTIFY or RESUME.
+	CloseNotAuthenticated = 4003
+	// CloseAuthenticationFailed is sent when the token in IDENTIFY or RESUME
+	// is invalid.
+	CloseAuthenticationFailed = 4004
+	// CloseAlreadyAuthenticated is sent for a second IDENTIFY or RESUME.
+	CloseAlreadyAuthenticated = 4005
+	// CloseInvalidSeq is sent for a RESUME with a sequence number the session
+	// never reached.
+	CloseInvalidSeq = 4007
+	// CloseRateLimited is sent when a client sends payloads too quickly.
+	CloseRateLimited = 4008
+	// CloseSessionTimedOut is sent when the client stopped heartbeating.
+	CloseSessionTimedOut = 4009
+	// CloseInvalidIntents is sent for an IDENTIFY with unknown intent bits.
+	CloseInvalidIntents = 4013
+	// CloseSlowConsumer is sent when a connection's send queue overflowed.
+	// The session stays resumable: RESUME replays the events it was not sent
+	// for as long as the session log still holds them.
+	CloseSlowConsumer = 4015
 )
 
 // Event names for DISPATCH payloads.
 const (
 	EventReady              = "READY"
+	EventResumed            = "RESUMED"
 	EventMessageCreate      = "MESSAGE_CREATE"
 	EventMessageUpdate      = "MESSAGE_UPDATE"
 	EventMessageDelete      = "MESSAGE_DELETE"
@@ -31,6 +68,7 @@ const (
 	EventChannelCreate      = "CHANNEL_CREATE"
 	EventChannelUpdate      = "CHANNEL_UPDATE"
 	EventChannelDelete      = "CHANNEL_DELETE"
+	EventChannelPinsUpdate  = "CHANNEL_PINS_UPDATE"
 	EventGuildMemberAdd     = "GUILD_MEMBER_ADD"
 	EventGuildMemberRemove  = "GUILD_MEMBER_REMOVE"
 	EventGuildMemberUpdate  = "GUILD_MEMBER_UPDATE"
@@ -44,6 +82,11 @@ const (
 	EventGuildBanRemove        = "GUILD_BAN_REMOVE"
 	EventMessageReactionAdd    = "MESSAGE_REACTION_ADD"
 	EventMessageReactionRemove = "MESSAGE_REACTION_REMOVE"
+	EventThreadCreate          = "THREAD_CREATE"
+	EventThreadUpdate          = "THREAD_UPDATE"
+	EventThreadMembersUpdate   = "THREAD_MEMBERS_UPDATE"
+	EventGuildMembersChunk     = "GUILD_MEMBERS_CHUNK"
+	EventVoiceServerUpdate     = "VOICE_SERVER_UPDATE"
 )
 
 // GatewayPayload is the envelope for all gateway messages.
@@ -55,8 +98,10 @@ type GatewayPayload struct {
 }
 
 // IdentifyData is sent by the client in an Op 2 IDENTIFY.
+// Intents defaults as described in Manager.sessionIntents when omitted.
 type IdentifyData struct {
-	Token string `json:"token"`
+	Token   string   `json:"token"`
+	Intents *Intents `json:"intents,omitempty"`
 }
 
 // ResumeData is sent by the client in an Op 6 RESUME.
@@ -66,17 +111,44 @@ type ResumeData struct {
 	Sequence  int64  `json:"seq"`
 }
 
+// InvalidSessionData is sent by the server in an Op 9 INVALID_SESSION. The
+// client may RESUME again if Resumable is set and must IDENTIFY otherwise.
+type InvalidSessionData struct {
+	Resumable bool `json:"resumable"`
+}
+
 // HelloData is sent by the server after WebSocket connect.
 type HelloData struct {
 	HeartbeatInterval int `json:"heartbeat_interval"`
 }
 
-// ReadyData is sent by the server after successful IDENTIFY.
+// ReadyData is sent by the server after successful IDENTIFY. Guilds are
+// stubs; each is followed by a GUILD_CREATE carrying its state.
 type ReadyData struct {
-	SessionID  string             `json:"session_id"`
-	UserID     int64              `json:"user_id,string"`
-	Guilds     []int64            `json:"guilds"`
-	ReadStates []models.ReadState `json:"read_states"`
+	SessionID       string             `json:"session_id"`
+	UserID          int64              `json:"user_id,string"`
+	User            *models.User       `json:"user,omitempty"`
+	Guilds          []UnavailableGuild `json:"guilds"`
+	PrivateChannels []models.DMChannel `json:"private_channels"`
+	ReadStates      []models.ReadState `json:"read_states"`
+}
+
+// UnavailableGuild is a guild whose state has not been sent yet.
+type UnavailableGuild struct {
+	ID          int64 `json:"id,string"`
+	Unavailable bool  `json:"unavailable"`
+}
+
+// GuildCreateData is the payload for GUILD_CREATE events: the guild with
+// the channels the user may view, its roles, the user's member, its voice
+// states and the presences of its online members.
+type GuildCreateData struct {
+	models.Guild
+	Channels    []models.Channel     `json:"channels"`
+	Roles       []models.Role        `json:"roles"`
+	Member      *models.Member       `json:"member"`
+	VoiceStates []models.VoiceState  `json:"voice_states"`
+	Presences   []PresenceUpdateData `json:"presences"`
 }
 
 // Event is a dispatch event ready to broadcast.
@@ -93,13 +165,94 @@ type TypingStartData struct {
 	Timestamp int64 `json:"timestamp"`
 }
 
+// ChannelPinsUpdateData is the payload for CHANNEL_PINS_UPDATE events.
+// GuildID is omitted for DM channels.
+type ChannelPinsUpdateData struct {
+	ChannelID int64 `json:"channel_id,string"`
+	GuildID   int64 `json:"guild_id,string,omitempty"`
+}
+
+// ThreadMembersUpdateData is the payload for THREAD_MEMBERS_UPDATE events.
+type ThreadMembersUpdateData struct {
+	ID               int64                 `json:"id,string"`
+	GuildID          int64                 `json:"guild_id,string"`
+	MemberCount      int                   `json:"member_count"`
+	AddedMembers     []models.ThreadMember `json:"added_members,omitempty"`
+	RemovedMemberIDs []int64               `json:"removed_member_ids,omitempty"`
+}
+
 // PresenceUpdateData is the payload for PRESENCE_UPDATE events.
 type PresenceUpdateData struct {
-	UserID int64  `json:"user_id,string"`
-	Status string `json:"status"`
+	UserID       int64                `json:"user_id,string"`
+	Status       string               `json:"status"`
+	CustomStatus *models.CustomStatus `json:"custom_status,omitempty"`
+	Activities   []models.Activity    `json:"activities,omitempty"`
+}
+
+// RequestGuildMembersData is sent by the client in an Op 8
+// REQUEST_GUILD_MEMBERS, with either a username prefix in Query or up to
+// 100 UserIDs. A Limit of 0 returns every member matching Query, all of
+// them for an empty Query, and needs the guild members intent.
+type RequestGuildMembersData struct {
+	GuildID   int64   `json:"guild_id,string"`
+	Query     *string `json:"query,omitempty"`
+	Limit     int     `json:"limit"`
+	UserIDs   []int64 `json:"user_ids,omitempty"`
+	Presences bool    `json:"presences"`
+	Nonce     string  `json:"nonce,omitempty"`
+}
+
+// GuildMembersChunkData is the payload for GUILD_MEMBERS_CHUNK events, sent
+// in reply to REQUEST_GUILD_MEMBERS. NotFound, only set in the first chunk,
+// lists requested user IDs that aren't members; Presences is only set when
+// requested.
+type GuildMembersChunkData struct {
+	GuildID    int64                   `json:"guild_id,string"`
+	Members    []models.MemberWithUser `json:"members"`
+	ChunkIndex int                     `json:"chunk_index"`
+	ChunkCount int                     `json:"chunk_count"`
+	NotFound   []int64                 `json:"not_found,omitempty"`
+	Presences  []PresenceUpdateData    `json:"presences,omitempty"`
+	Nonce      string                  `json:"nonce,omitempty"`
 }
 
 // ClientPresenceUpdate is sent by the client in an Op 3 PRESENCE_UPDATE.
+// It replaces the user's whole presence: leaving out CustomStatus or
+// Activities clears them.
 type ClientPresenceUpdate struct {
-	Status string `json:"status"`
+	Status       string               `json:"status"`
+	CustomStatus *models.CustomStatus `json:"custom_status,omitempty"`
+	Activities   []models.Activity    `json:"activities,omitempty"`
+}
+
+// ClientVoiceStateUpdate is sent by the client in an Op 4
+// VOICE_STATE_UPDATE to join or switch to the voice channel ChannelID in a
+// guild, leave voice there when ChannelID is null, or change its self mute
+// and deafen.
+type ClientVoiceStateUpdate struct {
+	GuildID   int64  `json:"guild_id,string"`
+	ChannelID *int64 `json:"channel_id,string"`
+	SelfMute  bool   `json:"self_mute"`
+	SelfDeaf  bool   `json:"self_deaf"`
+}
+
+// VoiceStateLeaveData is the VOICE_STATE_UPDATE payload of a user who is
+// not in a voice channel of the guild.
+type VoiceStateLeaveData struct {
+	GuildID   int64  `json:"guild_id,string"`
+	ChannelID *int64 `json:"channel_id"`
+	UserID    int64  `json:"user_id,string"`
+}
+
+// VoiceServerUpdateData is the payload for VOICE_SERVER_UPDATE events, sent
+// only to the connection that joined a voice channel, or to every session of
+// a member moved to another one. Endpoint is the LiveKit server to connect
+// to with Token, and Bitrate the channel's audio bitrate in bits per second
+// for the client to encode at.
+type VoiceServerUpdateData struct {
+	GuildID   int64  `json:"guild_id,string"`
+	ChannelID int64  `json:"channel_id,string"`
+	Token     string `json:"token"`
+	Endpoint  string `json:"endpoint"`
+	Bitrate   int    `json:"bitrate"`
 }
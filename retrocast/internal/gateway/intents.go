@@ -0,0 +1,96 @@
+package gateway
+
+// Intents is a bitfield of the event classes a session subscribes to,
+// sent in IDENTIFY. Events outside the session's intents are never
+// dispatched or recorded for it.
+type Intents int64
+
+const (
+	// IntentGuilds covers guild, role, channel, thread, pin and ban events.
+	IntentGuilds Intents = 1 << iota
+	// IntentGuildMembers covers member and thread member updates. Privileged.
+	IntentGuildMembers
+	// IntentGuildMessages covers message creation, edits and deletion.
+	IntentGuildMessages
+	// IntentGuildMessageReactions covers reactions being added and removed.
+	IntentGuildMessageReactions
+	// IntentGuildMessageTyping covers typing indicators.
+	IntentGuildMessageTyping
+	// IntentGuildPresences covers presence updates. Privileged.
+	IntentGuildPresences
+	// IntentGuildVoiceStates covers voice state updates.
+	IntentGuildVoiceStates
+	// IntentDirectMessages covers messages, reactions and typing in DMs.
+	IntentDirectMessages
+)
+
+const (
+	// IntentsAll is every intent.
+	IntentsAll = IntentGuilds | IntentGuildMembers | IntentGuildMessages |
+		IntentGuildMessageReactions | IntentGuildMessageTyping |
+		IntentGuildPresences | IntentGuildVoiceStates | IntentDirectMessages
+
+	// IntentsPrivileged are the intents only bots may request.
+	IntentsPrivileged = IntentGuildMembers | IntentGuildPresences
+
+	// IntentsDefault is what a bot gets when it identifies without intents.
+	IntentsDefault = IntentsAll &^ IntentsPrivileged
+)
+
+// eventIntents maps dispatch events to the intent that gates them. Events
+// not listed, such as READY, are always sent.
+var eventIntents = map[string]Intents{
+	EventGuildCreate:           IntentGuilds,
+	EventGuildUpdate:           IntentGuilds,
+	EventGuildDelete:           IntentGuilds,
+	EventGuildRoleCreate:       IntentGuilds,
+	EventGuildRoleUpdate:       IntentGuilds,
+	EventGuildRoleDelete:       IntentGuilds,
+	EventChannelCreate:         IntentGuilds,
+	EventChannelUpdate:         IntentGuilds,
+	EventChannelDelete:         IntentGuilds,
+	EventChannelPinsUpdate:     IntentGuilds,
+	EventThreadCreate:          IntentGuilds,
+	EventThreadUpdate:          IntentGuilds,
+	EventGuildBanAdd:           IntentGuilds,
+	EventGuildBanRemove:        IntentGuilds,
+	EventGuildMemberAdd:        IntentGuildMembers,
+	EventGuildMemberUpdate:     IntentGuildMembers,
+	EventGuildMemberRemove:     IntentGuildMembers,
+	EventThreadMembersUpdate:   IntentGuildMembers,
+	EventMessageCreate:         IntentGuildMessages,
+	EventMessageUpdate:         IntentGuildMessages,
+	EventMessageDelete:         IntentGuildMessages,
+	EventMessageReactionAdd:    IntentGuildMessageReactions,
+	EventMessageReactionRemove: IntentGuildMessageReactions,
+	EventTypingStart:           IntentGuildMessageTyping,
+	EventPresenceUpdate:        IntentGuildPresences,
+	EventVoiceStateUpdate:      IntentGuildVoiceStates,
+}
+
+// directEventIntents maps the events sent straight to a user, which are
+// about DMs rather than guilds, to the intent that gates them. Events not
+// listed fall back to eventIntents.
+var directEventIntents = map[string]Intents{
+	EventMessageCreate:         IntentDirectMessages,
+	EventMessageUpdate:         IntentDirectMessages,
+	EventMessageDelete:         IntentDirectMessages,
+	EventMessageReactionAdd:    IntentDirectMessages,
+	EventMessageReactionRemove: IntentDirectMessages,
+	EventTypingStart:           IntentDirectMessages,
+}
+
+// allows reports whether a session with these intents receives event.
+func (i Intents) allows(event string) bool {
+	required, ok := eventIntents[event]
+	return !ok || i&required != 0
+}
+
+// allowsDirect reports whether a session with these intents receives event
+// when it is sent straight to the user.
+func (i Intents) allowsDirect(event string) bool {
+	if required, ok := directEventIntents[event]; ok {
+		return i&required != 0
+	}
+	return i.allows(event)
+}
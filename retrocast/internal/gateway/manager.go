@@ -2,117 +2,290 @@ package gateway
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"log/slog"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/victorivanov/retrocast/internal/auth"
 	"github.com/victorivanov/retrocast/internal/database"
 	"github.com/victorivanov/retrocast/internal/models"
+	"github.com/victorivanov/retrocast/internal/permissions"
 	"github.com/victorivanov/retrocast/internal/redis"
 )
 
-const (
-	replayBufferSize = 100
-)
+// ChannelPermissionFilter narrows a set of users down to the guild members
+// holding a permission in a channel. service.PermissionChecker implements it.
+type ChannelPermissionFilter interface {
+	FilterChannelPermission(ctx context.Context, guildID, channelID int64, userIDs []int64, perm permissions.Permission) ([]int64, error)
+	FilterChannels(ctx context.Context, guildID, userID int64, channels []models.Channel, perm permissions.Permission) ([]models.Channel, error)
+}
 
 // Manager manages all active WebSocket connections and event routing.
 type Manager struct {
 	mu            sync.RWMutex
-	connections   map[int64]*Connection            // userID → connection
-	subscriptions map[int64]map[int64]bool          // guildID → set of userIDs
-	sessions      map[string]*Connection            // sessionID → connection
+	connections   map[int64]map[string]*Connection // userID → sessionID → connection
+	subscriptions map[int64]map[int64]bool         // guildID → set of userIDs
+	sessions      map[string]*Connection           // sessionID → connection
 
-	// Ring buffer per guild for session resume replay.
-	replayMu     sync.RWMutex
-	replayBuffer map[int64]*ringBuffer // guildID → ring buffer of events
+	// Outbound event logs, kept after disconnect for resumeWindow so that
+	// RESUME can replay what the client missed.
+	sessionLogs  map[int64]map[string]*sessionLog // userID → sessionID → log
+	resumeWindow time.Duration
 
 	tokens     *auth.TokenService
+	users      database.UserRepository
 	guilds     database.GuildRepository
 	readStates database.ReadStateRepository
 	redis      *redis.Client
+
+	// state loads READY and GUILD_CREATE payloads (see SetStateRepositories).
+	state StateRepositories
+
+	// channelPerms decides who receives DispatchToChannel events. Results
+	// are cached per session; permGen is bumped on every invalidation so
+	// that a lookup racing with one doesn't cache a stale result.
+	channelPerms ChannelPermissionFilter
+	permGen      atomic.Uint64
+
+	// voice handles Op 4 VOICE_STATE_UPDATE (see SetVoiceStates).
+	voice VoiceStateUpdater
+
+	// Client presence updates waiting out presenceWindow (see
+	// queuePresence).
+	presenceMu       sync.Mutex
+	pendingPresences map[int64]models.Presence
+	presenceWindow   time.Duration
+	// Timers clearing custom statuses at their expiry, one per user (see
+	// scheduleCustomStatusExpiry). Guarded by presenceMu.
+	statusExpiries map[int64]*time.Timer
+
+	// Cluster mode (see StartCluster). Sessions tracked in Redis expire
+	// after sessionTTL without a heartbeat.
+	clustered  atomic.Bool
+	nodeID     string
+	sessionTTL time.Duration
 }
 
 // NewManager creates a new gateway Manager.
 func NewManager(
 	tokens *auth.TokenService,
+	users database.UserRepository,
 	guilds database.GuildRepository,
 	readStates database.ReadStateRepository,
 	redisClient *redis.Client,
 ) *Manager {
 	return &Manager{
-		connections:   make(map[int64]*Connection),
+		connections:   make(map[int64]map[string]*Connection),
 		subscriptions: make(map[int64]map[int64]bool),
 		sessions:      make(map[string]*Connection),
-		replayBuffer:  make(map[int64]*ringBuffer),
+		sessionLogs:   make(map[int64]map[string]*sessionLog),
+		resumeWindow:  defaultResumeWindow,
 		tokens:        tokens,
+		users:         users,
 		guilds:        guilds,
 		readStates:    readStates,
 		redis:         redisClient,
+
+		pendingPresences: make(map[int64]models.Presence),
+		statusExpiries:   make(map[int64]*time.Timer),
+		presenceWindow:   defaultPresenceWindow,
+
+		sessionTTL: defaultSessionTTL,
 	}
 }
 
-// register adds a connection to the manager.
-func (m *Manager) register(c *Connection) {
+// SetResumeWindow sets how long a disconnected session can be resumed.
+// A window of zero disables resuming. It must be called before serving
+// connections.
+func (m *Manager) SetResumeWindow(d time.Duration) {
+	m.resumeWindow = d
+}
+
+// SetChannelPermissions sets the filter DispatchToChannel uses to decide
+// which guild subscribers may see a channel. Without one, channel events go
+// to every subscriber of the guild. It must be called before serving
+// connections.
+func (m *Manager) SetChannelPermissions(f ChannelPermissionFilter) {
+	m.channelPerms = f
+}
+
+// register adds a connection to the manager and attaches it to its
+// session's event log, creating the log for a new session with the given
+// intents. A user may hold
+// several concurrent sessions (one per device); only a connection resuming
+// the same session ID displaces an existing one.
+func (m *Manager) register(c *Connection, intents Intents) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	// Disconnect existing connection for this user.
-	if old, ok := m.connections[c.UserID]; ok {
-		old.SendPayload(GatewayPayload{Op: OpReconnect})
+	log := m.sessionLogs[c.UserID][c.SessionID]
+	if log == nil {
+		log = newSessionLog(intents)
+		if m.sessionLogs[c.UserID] == nil {
+			m.sessionLogs[c.UserID] = make(map[string]*sessionLog)
+		}
+		m.sessionLogs[c.UserID][c.SessionID] = log
+	}
+	_ = log.attach(c, log.events.seq)
+	m.addConnectionLocked(c)
+}
+
+// resume attaches a connection to an existing session, replaying the events
+// after afterSeq. It returns errUnknownSession if the session is unknown or
+// has expired, and the error of sessionLog.attach if the log can't bring the
+// client up to date; the connection is then left unregistered.
+func (m *Manager) resume(c *Connection, afterSeq int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	log := m.sessionLogs[c.UserID][c.SessionID]
+	if log == nil {
+		return errUnknownSession
+	}
+	if err := log.attach(c, afterSeq); err != nil {
+		return err
+	}
+	m.addConnectionLocked(c)
+	return nil
+}
+
+// addConnectionLocked indexes a connection, displacing any other connection
+// holding the same session. The caller must hold m.mu.
+func (m *Manager) addConnectionLocked(c *Connection) {
+	if old, ok := m.sessions[c.SessionID]; ok && old != c {
+		old.SendOp(OpReconnect, nil)
 		old.Close()
-		delete(m.sessions, old.SessionID)
+		if userConns, ok := m.connections[old.UserID]; ok {
+			delete(userConns, old.SessionID)
+			if len(userConns) == 0 {
+				delete(m.connections, old.UserID)
+			}
+		}
 	}
 
-	m.connections[c.UserID] = c
+	if m.connections[c.UserID] == nil {
+		m.connections[c.UserID] = make(map[string]*Connection)
+	}
+	m.connections[c.UserID][c.SessionID] = c
 	m.sessions[c.SessionID] = c
 }
 
-// unregister removes a connection from the manager and cleans up subscriptions.
+// unregister removes a connection from the manager. Its session stays
+// resumable for resumeWindow, keeping the user's guild subscriptions so the
+// session's log records what the client misses. Presence is cleared once the
+// user's last connection has closed.
 func (m *Manager) unregister(c *Connection) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if existing, ok := m.connections[c.UserID]; ok && existing == c {
-		delete(m.connections, c.UserID)
+	if existing, ok := m.sessions[c.SessionID]; ok && existing == c {
+		delete(m.sessions, c.SessionID)
+	}
 
-		// Remove from all guild subscriptions.
-		for guildID, members := range m.subscriptions {
-			delete(members, c.UserID)
-			if len(members) == 0 {
-				delete(m.subscriptions, guildID)
-			}
+	userConns, ok := m.connections[c.UserID]
+	if !ok || userConns[c.SessionID] != c {
+		return
+	}
+	delete(userConns, c.SessionID)
+	go m.untrackSession(c.UserID, c.SessionID)
+
+	if log := m.sessionLogs[c.UserID][c.SessionID]; log != nil {
+		log.detach(c)
+		if m.resumeWindow > 0 {
+			userID, sessionID := c.UserID, c.SessionID
+			time.AfterFunc(m.resumeWindow, func() { m.expireSession(userID, sessionID) })
+		}
+	}
+
+	if len(userConns) > 0 {
+		if m.resumeWindow <= 0 {
+			m.expireSessionLocked(c.UserID, c.SessionID)
 		}
+		return
+	}
+	delete(m.connections, c.UserID)
 
-		// Clear presence with grace period.
-		go m.clearPresenceWithGrace(c.UserID)
+	var guildIDs []int64
+	for guildID, members := range m.subscriptions {
+		if members[c.UserID] {
+			guildIDs = append(guildIDs, guildID)
+		}
+	}
+	if m.resumeWindow <= 0 {
+		m.expireSessionLocked(c.UserID, c.SessionID)
 	}
 
-	delete(m.sessions, c.SessionID)
+	// Clear presence with grace period.
+	go m.clearPresenceWithGrace(c.UserID, guildIDs)
+}
+
+// expireSession drops a session's event log once it has been disconnected
+// for the whole resume window.
+func (m *Manager) expireSession(userID int64, sessionID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.expireSessionLocked(userID, sessionID)
+}
+
+// expireSessionLocked drops an expired session log. Once the user has no
+// session left, their guild subscriptions are removed. The caller must hold
+// m.mu.
+func (m *Manager) expireSessionLocked(userID int64, sessionID string) {
+	userLogs := m.sessionLogs[userID]
+	log, ok := userLogs[sessionID]
+	if !ok || !log.expired(m.resumeWindow) {
+		return
+	}
+	delete(userLogs, sessionID)
+	if len(userLogs) > 0 {
+		return
+	}
+	delete(m.sessionLogs, userID)
+
+	for guildID, members := range m.subscriptions {
+		delete(members, userID)
+		if len(members) == 0 {
+			delete(m.subscriptions, guildID)
+		}
+	}
 }
 
 // clearPresenceWithGrace waits before setting offline, allowing reconnection.
-func (m *Manager) clearPresenceWithGrace(userID int64) {
+// guildIDs are the guilds the user was subscribed to when the last session
+// closed.
+func (m *Manager) clearPresenceWithGrace(userID int64, guildIDs []int64) {
 	time.Sleep(10 * time.Second)
 
 	m.mu.RLock()
-	_, stillConnected := m.connections[userID]
+	stillConnected := len(m.connections[userID]) > 0
 	m.mu.RUnlock()
 
-	if stillConnected {
+	if stillConnected || m.hasRemoteSessions(userID) {
 		return
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	if err := m.redis.SetPresence(ctx, userID, "offline"); err != nil {
+	offline := models.Presence{Status: "offline"}
+	if err := storePresence(ctx, m.redis, userID, offline); err != nil {
 		slog.Error("failed to clear presence", "userID", userID, "error", err)
 	}
 
-	m.broadcastPresence(userID, "offline")
+	m.broadcastPresenceToGuilds(userID, offline, guildIDs)
+}
+
+// userSessionLogsLocked appends the event log of every session of a user,
+// connected or awaiting RESUME, to logs. The caller must hold m.mu.
+func (m *Manager) userSessionLogsLocked(logs []*sessionLog, userID int64) []*sessionLog {
+	for _, l := range m.sessionLogs[userID] {
+		logs = append(logs, l)
+	}
+	return logs
 }
 
 // subscribe adds a user to a guild's event subscription.
@@ -124,15 +297,23 @@ func (m *Manager) subscribe(userID, guildID int64) {
 		m.subscriptions[guildID] = make(map[int64]bool)
 	}
 	m.subscriptions[guildID][userID] = true
+	m.forgetChannelViewsLocked(guildID, userID)
 }
 
 // SubscribeToGuild adds a user to a guild's event subscription.
 func (m *Manager) SubscribeToGuild(userID, guildID int64) {
 	m.subscribe(userID, guildID)
+	m.publish(clusterMessage{Kind: clusterSubscribe, UserID: userID, GuildID: guildID})
 }
 
 // UnsubscribeFromGuild removes a user from a guild's event subscription.
 func (m *Manager) UnsubscribeFromGuild(userID, guildID int64) {
+	m.unsubscribe(userID, guildID)
+	m.publish(clusterMessage{Kind: clusterUnsubscribe, UserID: userID, GuildID: guildID})
+}
+
+// unsubscribe removes a user from a guild's event subscription on this node.
+func (m *Manager) unsubscribe(userID, guildID int64) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -142,122 +323,327 @@ func (m *Manager) UnsubscribeFromGuild(userID, guildID int64) {
 			delete(m.subscriptions, guildID)
 		}
 	}
+	m.forgetChannelViewsLocked(guildID, userID)
 }
 
-// DispatchToUser sends a dispatch event to a specific connected user.
+// DispatchToUser sends a dispatch event to every session of a user.
 func (m *Manager) DispatchToUser(userID int64, event string, data interface{}) {
-	m.mu.RLock()
-	c, ok := m.connections[userID]
-	m.mu.RUnlock()
-
-	if ok {
-		c.SendEvent(event, data)
-	}
+	m.deliverToUser(userID, Event{Name: event, Data: data})
+	m.publishEvent(clusterMessage{Kind: clusterDispatchUser, UserID: userID, Event: event}, data)
 }
 
 // DispatchToGuild sends a dispatch event to all users subscribed to a guild.
 func (m *Manager) DispatchToGuild(guildID int64, event string, data interface{}) {
+	m.deliverToGuild(guildID, 0, Event{Name: event, Data: data})
+	m.publishEvent(clusterMessage{Kind: clusterDispatchGuild, GuildID: guildID, Event: event}, data)
+}
+
+// DispatchToGuildExcept sends a dispatch event to all guild subscribers except one user.
+func (m *Manager) DispatchToGuildExcept(guildID int64, exceptUserID int64, event string, data interface{}) {
+	m.deliverToGuild(guildID, exceptUserID, Event{Name: event, Data: data})
+	m.publishEvent(clusterMessage{Kind: clusterDispatchGuild, GuildID: guildID, ExceptUserID: exceptUserID, Event: event}, data)
+}
+
+// DispatchToChannel sends a dispatch event about a guild channel to the guild
+// subscribers allowed to view that channel, resolving VIEW_CHANNEL the way
+// PermissionChecker.RequireChannelPermission does.
+func (m *Manager) DispatchToChannel(guildID, channelID int64, event string, data interface{}) {
+	m.deliverToChannel(guildID, channelID, Event{Name: event, Data: data})
+	m.publishEvent(clusterMessage{Kind: clusterDispatchChannel, GuildID: guildID, ChannelID: channelID, Event: event}, data)
+}
+
+// DispatchToGuildMembers sends a dispatch event about a guild to the listed
+// users among its subscribers. It is for events whose recipients the caller
+// resolved itself, such as CHANNEL_DELETE, whose viewers can't be worked out
+// once the channel's overrides are gone.
+func (m *Manager) DispatchToGuildMembers(guildID int64, userIDs []int64, event string, data interface{}) {
+	m.deliverToGuildMembers(guildID, userIDs, Event{Name: event, Data: data})
+	m.publishEvent(clusterMessage{Kind: clusterDispatchMembers, GuildID: guildID, UserIDs: userIDs, Event: event}, data)
+}
+
+// InvalidateGuildPermissions drops every cached channel permission in a
+// guild. Call it after roles or channel overrides change.
+func (m *Manager) InvalidateGuildPermissions(guildID int64) {
+	m.invalidatePermissions(guildID, 0)
+	m.publish(clusterMessage{Kind: clusterInvalidatePermissions, GuildID: guildID})
+}
+
+// InvalidateMemberPermissions drops a user's cached channel permissions in a
+// guild. Call it after the user's roles or membership change.
+func (m *Manager) InvalidateMemberPermissions(guildID, userID int64) {
+	m.invalidatePermissions(guildID, userID)
+	m.publish(clusterMessage{Kind: clusterInvalidatePermissions, GuildID: guildID, UserID: userID})
+}
+
+// HasSession reports whether the user has a gateway session on this node,
+// connected or waiting to be resumed, or, in cluster mode, a connected
+// session on any node.
+func (m *Manager) HasSession(userID int64) bool {
 	m.mu.RLock()
-	members := m.subscriptions[guildID]
-	conns := make([]*Connection, 0, len(members))
-	for userID := range members {
-		if c, ok := m.connections[userID]; ok {
-			conns = append(conns, c)
+	local := len(m.sessionLogs[userID]) > 0
+	m.mu.RUnlock()
+	return local || m.hasRemoteSessions(userID)
+}
+
+// invalidatePermissions drops the cached channel permissions in a guild of
+// userID's sessions on this node, or of every session when userID is 0.
+func (m *Manager) invalidatePermissions(guildID, userID int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if userID != 0 {
+		m.forgetChannelViewsLocked(guildID, userID)
+		return
+	}
+	m.permGen.Add(1)
+	for _, userLogs := range m.sessionLogs {
+		for _, l := range userLogs {
+			l.forgetChannelViews(guildID)
 		}
 	}
-	m.mu.RUnlock()
+}
 
-	for _, c := range conns {
-		c.SendEvent(event, data)
+// forgetChannelViewsLocked drops a user's cached channel permissions in a
+// guild. The caller must hold m.mu for writing.
+func (m *Manager) forgetChannelViewsLocked(guildID, userID int64) {
+	m.permGen.Add(1)
+	for _, l := range m.sessionLogs[userID] {
+		l.forgetChannelViews(guildID)
 	}
+}
+
+// deliverToUser sends an event to the user's sessions on this node. Such
+// events concern DMs, so they are gated by Intents.allowsDirect.
+func (m *Manager) deliverToUser(userID int64, event Event) {
+	m.mu.RLock()
+	logs := m.userSessionLogsLocked(nil, userID)
+	m.mu.RUnlock()
 
-	// Store in replay buffer.
-	m.storeReplayEvent(guildID, Event{Name: event, Data: data})
+	if len(logs) == 0 {
+		return
+	}
+	data, ok := encodeEvent(event)
+	if !ok {
+		return
+	}
+	for _, l := range logs {
+		l.dispatchDirect(event.Name, data)
+	}
 }
 
-// DispatchToGuildExcept sends a dispatch event to all guild subscribers except one user.
-func (m *Manager) DispatchToGuildExcept(guildID int64, exceptUserID int64, event string, data interface{}) {
+// deliverToGuild sends an event to the sessions of the guild subscribers on
+// this node, skipping exceptUserID (0 skips nobody).
+func (m *Manager) deliverToGuild(guildID, exceptUserID int64, event Event) {
 	m.mu.RLock()
 	members := m.subscriptions[guildID]
-	conns := make([]*Connection, 0, len(members))
+	logs := make([]*sessionLog, 0, len(members))
 	for userID := range members {
 		if userID == exceptUserID {
 			continue
 		}
-		if c, ok := m.connections[userID]; ok {
-			conns = append(conns, c)
-		}
+		logs = m.userSessionLogsLocked(logs, userID)
 	}
 	m.mu.RUnlock()
 
-	for _, c := range conns {
-		c.SendEvent(event, data)
+	deliver(logs, event)
+}
+
+// deliverToGuildMembers sends an event to the sessions on this node of the
+// users in userIDs who are subscribed to the guild.
+func (m *Manager) deliverToGuildMembers(guildID int64, userIDs []int64, event Event) {
+	m.mu.RLock()
+	members := m.subscriptions[guildID]
+	var logs []*sessionLog
+	for _, userID := range userIDs {
+		if members[userID] {
+			logs = m.userSessionLogsLocked(logs, userID)
+		}
 	}
+	m.mu.RUnlock()
 
-	// Store in replay buffer.
-	m.storeReplayEvent(guildID, Event{Name: event, Data: data})
+	deliver(logs, event)
 }
 
-// sendToGuildInternal sends an Event to all guild subscribers (internal use).
-func (m *Manager) sendToGuildInternal(guildID int64, event Event) {
+// deliverToChannel sends an event to the sessions on this node of the guild
+// subscribers that may view channelID. Permissions missing from the session
+// caches are resolved in one batch; if that fails, those users are skipped.
+func (m *Manager) deliverToChannel(guildID, channelID int64, event Event) {
+	if m.channelPerms == nil {
+		m.deliverToGuild(guildID, 0, event)
+		return
+	}
+
+	gen := m.permGen.Load()
+
 	m.mu.RLock()
 	members := m.subscriptions[guildID]
-	conns := make([]*Connection, 0, len(members))
+	userLogs := make(map[int64][]*sessionLog, len(members))
 	for userID := range members {
-		if c, ok := m.connections[userID]; ok {
-			conns = append(conns, c)
+		if logs := m.userSessionLogsLocked(nil, userID); len(logs) > 0 {
+			userLogs[userID] = logs
 		}
 	}
 	m.mu.RUnlock()
 
-	for _, c := range conns {
-		c.SendEvent(event.Name, event.Data)
+	var logs []*sessionLog
+	var unresolved []int64
+	for userID, ul := range userLogs {
+		canView, ok := cachedChannelView(ul, guildID, channelID)
+		switch {
+		case !ok:
+			unresolved = append(unresolved, userID)
+		case canView:
+			logs = append(logs, ul...)
+		}
 	}
 
-	m.storeReplayEvent(guildID, event)
+	if len(unresolved) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		allowed, err := m.channelPerms.FilterChannelPermission(ctx, guildID, channelID, unresolved, permissions.PermViewChannel)
+		cancel()
+		if err != nil {
+			slog.Error("failed to resolve channel permissions", "guildID", guildID, "channelID", channelID, "error", err)
+			unresolved = nil
+		}
+
+		canView := make(map[int64]bool, len(allowed))
+		for _, userID := range allowed {
+			canView[userID] = true
+			logs = append(logs, userLogs[userID]...)
+		}
+
+		// Holding m.mu keeps invalidations out until the results are
+		// cached; if one happened during the lookup, they may be stale.
+		m.mu.RLock()
+		if m.permGen.Load() == gen {
+			for _, userID := range unresolved {
+				for _, l := range userLogs[userID] {
+					l.cacheChannelView(guildID, channelID, canView[userID])
+				}
+			}
+		}
+		m.mu.RUnlock()
+	}
+
+	deliver(logs, event)
+}
+
+// cachedChannelView returns a user's cached VIEW_CHANNEL permission in a
+// channel. ok is false unless every one of the user's sessions has it cached.
+func cachedChannelView(logs []*sessionLog, guildID, channelID int64) (canView, ok bool) {
+	for _, l := range logs {
+		canView, ok = l.channelView(guildID, channelID)
+		if !ok {
+			return false, false
+		}
+	}
+	return canView, ok
+}
+
+// deliver encodes an event once and dispatches it to each session log.
+// Event data may already be encoded as *eventData.
+func deliver(logs []*sessionLog, event Event) {
+	if len(logs) == 0 {
+		return
+	}
+	data, ok := encodeEvent(event)
+	if !ok {
+		return
+	}
+	for _, l := range logs {
+		l.dispatch(event.Name, data)
+	}
+}
+
+// encodeEvent returns the event's data as *eventData, encoding it unless it
+// already is. ok is false if the data can't be marshalled.
+func encodeEvent(event Event) (data *eventData, ok bool) {
+	if data, ok := event.Data.(*eventData); ok {
+		return data, true
+	}
+	data, err := newEventData(event.Data)
+	if err != nil {
+		slog.Error("marshal event error", "event", event.Name, "error", err)
+		return nil, false
+	}
+	return data, true
 }
 
 // handleIdentify processes an IDENTIFY payload from a client.
-func (m *Manager) handleIdentify(c *Connection, data json.RawMessage) {
+func (m *Manager) handleIdentify(c *Connection, data []byte) {
 	var identify IdentifyData
-	if err := json.Unmarshal(data, &identify); err != nil {
-		slog.Error("invalid identify data", "error", err)
-		c.Close()
+	if err := c.unmarshal(data, &identify); err != nil {
+		slog.Warn("invalid identify data", "error", err)
+		c.closeWithCode(CloseDecodeError, "decode error")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if c.ip != "" && !m.identifyAllowed(ctx, identifyIPKey(c.ip), identifyIPLimit) {
+		slog.Warn("identify rate limited", "ip", c.ip)
+		m.invalidSession(c, false)
 		return
 	}
 
 	claims, err := m.tokens.ValidateAccessToken(identify.Token)
 	if err != nil {
 		slog.Warn("invalid token in identify", "error", err)
-		c.Close()
+		c.closeWithCode(CloseAuthenticationFailed, "authentication failed")
+		return
+	}
+
+	if !m.identifyAllowed(ctx, identifyUserKey(claims.UserID), identifyUserLimit) {
+		slog.Warn("identify rate limited", "userID", claims.UserID)
+		m.invalidSession(c, false)
 		return
 	}
 
 	c.UserID = claims.UserID
 	c.SessionID = uuid.NewString()
 
+	intents, err := m.sessionIntents(ctx, c.UserID, identify.Intents)
+	switch {
+	case errors.Is(err, errInvalidIntents):
+		slog.Warn("rejected identify intents", "userID", c.UserID, "error", err)
+		c.closeWithCode(CloseInvalidIntents, "invalid intents")
+		return
+	case err != nil:
+		slog.Error("failed to get user for identify", "userID", c.UserID, "error", err)
+		m.invalidSession(c, false)
+		return
+	}
+
 	// Get user's guilds and subscribe.
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
 
 	guilds, err := m.guilds.GetByUserID(ctx, c.UserID)
 	if err != nil {
 		slog.Error("failed to get guilds for user", "userID", c.UserID, "error", err)
-		c.Close()
+		m.invalidSession(c, false)
 		return
 	}
 
-	m.register(c)
+	// Only the first session brings the user online; additional devices keep
+	// whatever status the user already has.
+	m.mu.RLock()
+	firstSession := len(m.connections[c.UserID]) == 0
+	m.mu.RUnlock()
+	firstSession = firstSession && !m.hasRemoteSessions(c.UserID)
+
+	m.register(c, intents)
+	m.trackSession(c.UserID, c.SessionID)
 
-	guildIDs := make([]int64, len(guilds))
+	stubs := make([]UnavailableGuild, len(guilds))
 	for i, g := range guilds {
-		guildIDs[i] = g.ID
+		stubs[i] = UnavailableGuild{ID: g.ID, Unavailable: true}
 		m.subscribe(c.UserID, g.ID)
 	}
 
-	// Set presence to online.
-	if err := m.redis.SetPresence(ctx, c.UserID, "online"); err != nil {
-		slog.Error("failed to set presence", "userID", c.UserID, "error", err)
+	if firstSession {
+		if err := m.redis.SetPresence(ctx, c.UserID, "online"); err != nil {
+			slog.Error("failed to set presence", "userID", c.UserID, "error", err)
+		}
 	}
 
 	// Fetch read states for READY payload.
@@ -271,112 +657,138 @@ func (m *Manager) handleIdentify(c *Connection, data json.RawMessage) {
 		}
 	}
 
-	// Send READY.
+	var user *models.User
+	if m.users != nil {
+		if user, err = m.users.GetByID(ctx, c.UserID); err != nil {
+			slog.Error("failed to get user", "userID", c.UserID, "error", err)
+		}
+	}
+
+	privateChannels := []models.DMChannel{}
+	if m.state.DMChannels != nil {
+		dms, err := m.state.DMChannels.GetByUserID(ctx, c.UserID)
+		if err != nil {
+			slog.Error("failed to get dm channels", "userID", c.UserID, "error", err)
+		} else if dms != nil {
+			privateChannels = dms
+		}
+	}
+
+	// Send READY, then stream the state of each guild.
 	c.SendEvent(EventReady, ReadyData{
-		SessionID:  c.SessionID,
-		UserID:     c.UserID,
-		Guilds:     guildIDs,
-		ReadStates: readStates,
+		SessionID:       c.SessionID,
+		UserID:          c.UserID,
+		User:            user,
+		Guilds:          stubs,
+		PrivateChannels: privateChannels,
+		ReadStates:      readStates,
 	})
+	for _, g := range guilds {
+		m.sendGuildCreate(c, g, intents)
+	}
 
 	// Broadcast presence online to guild members.
-	m.broadcastPresence(c.UserID, "online")
+	if firstSession {
+		m.broadcastPresence(c.UserID, models.Presence{Status: "online"})
+	}
 }
 
-// handleResume processes a RESUME payload to replay missed events.
-func (m *Manager) handleResume(c *Connection, data json.RawMessage) {
+// errInvalidIntents rejects an IDENTIFY with unknown intent bits.
+var errInvalidIntents = errors.New("invalid intents")
+
+// sessionIntents works out the intents of a new session. A user who
+// identifies without intents gets IntentsAll, since their client shows
+// member lists and presences; a bot gets IntentsDefault and must opt into
+// privileged intents. Only bots may request privileged intents, which are
+// masked out of a user's explicit request.
+func (m *Manager) sessionIntents(ctx context.Context, userID int64, requested *Intents) (Intents, error) {
+	bot := false
+	if m.users != nil {
+		user, err := m.users.GetByID(ctx, userID)
+		if err != nil {
+			return 0, err
+		}
+		bot = user != nil && user.Bot
+	}
+
+	if requested == nil {
+		if bot {
+			return IntentsDefault, nil
+		}
+		return IntentsAll, nil
+	}
+
+	intents := *requested
+	if intents&^IntentsAll != 0 {
+		return 0, errInvalidIntents
+	}
+	if !bot {
+		intents &^= IntentsPrivileged
+	}
+	return intents, nil
+}
+
+// handleResume processes a RESUME payload, reattaching the connection to its
+// session and replaying the events sent after the client's last sequence
+// number. If the session can't be resumed the client is told to IDENTIFY
+// again with INVALID_SESSION.
+func (m *Manager) handleResume(c *Connection, data []byte) {
 	var resume ResumeData
-	if err := json.Unmarshal(data, &resume); err != nil {
-		slog.Error("invalid resume data", "error", err)
-		c.SendPayload(GatewayPayload{Op: OpReconnect})
-		c.Close()
+	if err := c.unmarshal(data, &resume); err != nil {
+		slog.Warn("invalid resume data", "error", err)
+		c.closeWithCode(CloseDecodeError, "decode error")
 		return
 	}
 
 	claims, err := m.tokens.ValidateAccessToken(resume.Token)
 	if err != nil {
 		slog.Warn("invalid token in resume", "error", err)
-		c.Close()
+		c.closeWithCode(CloseAuthenticationFailed, "authentication failed")
 		return
 	}
 
 	c.UserID = claims.UserID
 	c.SessionID = resume.SessionID
 
-	// Get user's guilds.
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	guilds, err := m.guilds.GetByUserID(ctx, c.UserID)
-	if err != nil {
-		slog.Error("failed to get guilds on resume", "userID", c.UserID, "error", err)
-		c.SendPayload(GatewayPayload{Op: OpReconnect})
-		c.Close()
+	if err := m.resume(c, resume.Sequence); err != nil {
+		slog.Info("session not resumable", "userID", c.UserID, "sessionID", c.SessionID, "seq", resume.Sequence, "error", err)
+		if errors.Is(err, errInvalidSeq) {
+			c.closeWithCode(CloseInvalidSeq, "invalid seq")
+			return
+		}
+		m.invalidSession(c, false)
 		return
 	}
+	m.trackSession(c.UserID, c.SessionID)
 
-	m.register(c)
-
-	for _, g := range guilds {
-		m.subscribe(c.UserID, g.ID)
-
-		// Replay missed events from ring buffer.
-		m.replayMu.RLock()
-		rb, ok := m.replayBuffer[g.ID]
-		m.replayMu.RUnlock()
+	c.SendEvent(EventResumed, nil)
+}
 
-		if ok {
-			events := rb.since(resume.Sequence)
-			for _, ev := range events {
-				c.SendEvent(ev.Name, ev.Data)
-			}
-		}
-	}
+// invalidSession forgets the identity a connection was being given and
+// sends it an INVALID_SESSION. The connection stays open for the client to
+// RESUME, if resumable, or IDENTIFY again.
+func (m *Manager) invalidSession(c *Connection, resumable bool) {
+	c.UserID = 0
+	c.SessionID = ""
+	c.SendOp(OpInvalidSession, InvalidSessionData{Resumable: resumable})
 }
 
 // handlePresenceUpdate processes a client presence update.
-func (m *Manager) handlePresenceUpdate(c *Connection, data json.RawMessage) {
+func (m *Manager) handlePresenceUpdate(c *Connection, data []byte) {
 	var update ClientPresenceUpdate
-	if err := json.Unmarshal(data, &update); err != nil {
+	if err := c.unmarshal(data, &update); err != nil {
 		return
 	}
 
-	switch update.Status {
-	case "online", "idle", "dnd", "invisible":
-		// valid
-	default:
-		return
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	redisStatus := update.Status
-	if redisStatus == "invisible" {
-		redisStatus = "offline"
-	}
-	if err := m.redis.SetPresence(ctx, c.UserID, redisStatus); err != nil {
-		slog.Error("failed to update presence", "userID", c.UserID, "error", err)
+	presence, ok := clientPresence(update, time.Now())
+	if !ok {
 		return
 	}
-
-	broadcastStatus := update.Status
-	if broadcastStatus == "invisible" {
-		broadcastStatus = "offline"
-	}
-	m.broadcastPresence(c.UserID, broadcastStatus)
+	m.queuePresence(c.UserID, presence)
 }
 
 // broadcastPresence sends a PRESENCE_UPDATE event to all guilds the user is in.
-func (m *Manager) broadcastPresence(userID int64, status string) {
-	event := Event{
-		Name: EventPresenceUpdate,
-		Data: PresenceUpdateData{
-			UserID: userID,
-			Status: status,
-		},
-	}
-
+func (m *Manager) broadcastPresence(userID int64, presence models.Presence) {
 	m.mu.RLock()
 	var guildIDs []int64
 	for guildID, members := range m.subscriptions {
@@ -386,73 +798,13 @@ func (m *Manager) broadcastPresence(userID int64, status string) {
 	}
 	m.mu.RUnlock()
 
-	for _, guildID := range guildIDs {
-		m.sendToGuildInternal(guildID, event)
-	}
-}
-
-// storeReplayEvent adds an event to the guild's replay ring buffer.
-func (m *Manager) storeReplayEvent(guildID int64, event Event) {
-	m.replayMu.Lock()
-	defer m.replayMu.Unlock()
-
-	rb, ok := m.replayBuffer[guildID]
-	if !ok {
-		rb = newRingBuffer(replayBufferSize)
-		m.replayBuffer[guildID] = rb
-	}
-	rb.add(event)
-}
-
-// sequencedEvent pairs an event with its sequence number for replay.
-type sequencedEvent struct {
-	Sequence int64
-	Event
+	m.broadcastPresenceToGuilds(userID, presence, guildIDs)
 }
 
-// ringBuffer is a fixed-size circular buffer for replay events.
-type ringBuffer struct {
-	events []sequencedEvent
-	size   int
-	pos    int
-	seq    int64
-	full   bool
-}
-
-func newRingBuffer(size int) *ringBuffer {
-	return &ringBuffer{
-		events: make([]sequencedEvent, size),
-		size:   size,
-	}
-}
-
-func (rb *ringBuffer) add(event Event) {
-	rb.seq++
-	rb.events[rb.pos] = sequencedEvent{Sequence: rb.seq, Event: event}
-	rb.pos = (rb.pos + 1) % rb.size
-	if rb.pos == 0 {
-		rb.full = true
-	}
-}
-
-// since returns all events with sequence > afterSeq.
-func (rb *ringBuffer) since(afterSeq int64) []Event {
-	var result []Event
-	count := rb.size
-	if !rb.full {
-		count = rb.pos
-	}
-
-	start := 0
-	if rb.full {
-		start = rb.pos
-	}
-
-	for i := 0; i < count; i++ {
-		idx := (start + i) % rb.size
-		if rb.events[idx].Sequence > afterSeq {
-			result = append(result, rb.events[idx].Event)
-		}
+// broadcastPresenceToGuilds sends a PRESENCE_UPDATE event to the given guilds.
+func (m *Manager) broadcastPresenceToGuilds(userID int64, presence models.Presence, guildIDs []int64) {
+	data := presenceUpdate(userID, presence)
+	for _, guildID := range guildIDs {
+		m.DispatchToGuild(guildID, EventPresenceUpdate, data)
 	}
-	return result
 }
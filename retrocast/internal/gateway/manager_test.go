@@ -3,8 +3,11 @@ package gateway
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"strings"
 	"sync"
 	"testing"
@@ -14,6 +17,7 @@ import (
 	"github.com/gorilla/websocket"
 	"github.com/victorivanov/retrocast/internal/auth"
 	"github.com/victorivanov/retrocast/internal/models"
+	"github.com/victorivanov/retrocast/internal/permissions"
 	redisclient "github.com/victorivanov/retrocast/internal/redis"
 )
 
@@ -21,6 +25,20 @@ import (
 // Helpers
 // ---------------------------------------------------------------------------
 
+// testEncoding is the wire encoding of the connections tests create. Every
+// test runs once per encoding.
+var testEncoding = encodingJSON
+
+func TestMain(m *testing.M) {
+	for _, encoding := range []string{encodingJSON, encodingMsgpack} {
+		testEncoding = encoding
+		if code := m.Run(); code != 0 {
+			os.Exit(code)
+		}
+	}
+	os.Exit(0)
+}
+
 func newTestRedis(t *testing.T) *redisclient.Client {
 	t.Helper()
 	mr := miniredis.RunT(t)
@@ -36,7 +54,7 @@ func newTestManager(t *testing.T, guilds *mockGuildRepo) *Manager {
 	t.Helper()
 	tokens := auth.NewTokenService("test-secret")
 	rdb := newTestRedis(t)
-	return NewManager(tokens, guilds, nil, rdb)
+	return NewManager(tokens, nil, guilds, nil, rdb)
 }
 
 // fakeConn creates a Connection wired into the Manager with a buffered Send
@@ -44,7 +62,7 @@ func newTestManager(t *testing.T, guilds *mockGuildRepo) *Manager {
 // It uses a minimal websocket.Conn that is never written to; the Send channel
 // is what we inspect.
 func fakeConn(m *Manager, userID int64, sessionID string) *Connection {
-	// We need a real *websocket.Conn to avoid nil panics in SendPayload.
+	// We need a real *websocket.Conn to avoid nil panics in SendOp.
 	// Use a throw-away test server pair; we won't actually read/write the ws.
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		up := websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }}
@@ -74,16 +92,14 @@ func fakeConn(m *Manager, userID int64, sessionID string) *Connection {
 		SessionID: sessionID,
 		Conn:      ws,
 		Send:      make(chan []byte, sendBufferSize),
+		encoding:  testEncoding,
 		manager:   m,
 		done:      make(chan struct{}),
 	}
 	c.lastHeartbeat.Store(time.Now().UnixMilli())
 
 	// Register the connection in the manager.
-	m.mu.Lock()
-	m.connections[userID] = c
-	m.sessions[sessionID] = c
-	m.mu.Unlock()
+	m.register(c, IntentsAll)
 
 	return c
 }
@@ -95,8 +111,7 @@ func drainEvents(c *Connection) []GatewayPayload {
 	for {
 		select {
 		case raw := <-c.Send:
-			var p GatewayPayload
-			if err := json.Unmarshal(raw, &p); err == nil {
+			if p, err := decodeFrame(raw); err == nil {
 				payloads = append(payloads, p)
 			}
 		default:
@@ -105,15 +120,43 @@ func drainEvents(c *Connection) []GatewayPayload {
 	}
 }
 
+// decodeFrame decodes a payload sent in the test encoding. Its Data stays
+// encoded; see decodeData.
+func decodeFrame(raw []byte) (GatewayPayload, error) {
+	return (&Connection{encoding: testEncoding}).decodePayload(raw)
+}
+
+// decodeData decodes the data of a payload sent in the test encoding.
+func decodeData(t testing.TB, p GatewayPayload, v any) {
+	t.Helper()
+	if err := (&Connection{encoding: testEncoding}).unmarshal(p.Data, v); err != nil {
+		t.Fatalf("decode %s data: %v", testEncoding, err)
+	}
+}
+
+// dataString decodes the data of a payload that carries a string.
+func dataString(t testing.TB, p GatewayPayload) string {
+	t.Helper()
+	var s string
+	decodeData(t, p, &s)
+	return s
+}
+
 // mockGuildRepo implements database.GuildRepository for testing.
 type mockGuildRepo struct {
+	GetByIDFn     func(ctx context.Context, id int64) (*models.Guild, error)
 	GetByUserIDFn func(ctx context.Context, userID int64) ([]models.Guild, error)
 }
 
 func (m *mockGuildRepo) Create(context.Context, *models.Guild) error          { return nil }
-func (m *mockGuildRepo) GetByID(context.Context, int64) (*models.Guild, error) { return nil, nil }
 func (m *mockGuildRepo) Update(context.Context, *models.Guild) error          { return nil }
 func (m *mockGuildRepo) Delete(context.Context, int64) error                  { return nil }
+func (m *mockGuildRepo) GetByID(ctx context.Context, id int64) (*models.Guild, error) {
+	if m.GetByIDFn != nil {
+		return m.GetByIDFn(ctx, id)
+	}
+	return nil, nil
+}
 func (m *mockGuildRepo) GetByUserID(ctx context.Context, userID int64) ([]models.Guild, error) {
 	if m.GetByUserIDFn != nil {
 		return m.GetByUserIDFn(ctx, userID)
@@ -121,6 +164,19 @@ func (m *mockGuildRepo) GetByUserID(ctx context.Context, userID int64) ([]models
 	return nil, nil
 }
 
+// mockUserRepo implements database.UserRepository for testing.
+type mockUserRepo struct {
+	users map[int64]*models.User
+}
+
+func (m *mockUserRepo) Create(context.Context, *models.User) error { return nil }
+func (m *mockUserRepo) GetByID(_ context.Context, id int64) (*models.User, error) {
+	return m.users[id], nil
+}
+func (m *mockUserRepo) GetByUsername(context.Context, string) (*models.User, error) { return nil, nil }
+func (m *mockUserRepo) Update(context.Context, *models.User) error                  { return nil }
+func (m *mockUserRepo) Delete(context.Context, int64) error                         { return nil }
+
 // ---------------------------------------------------------------------------
 // Ring Buffer Tests
 // ---------------------------------------------------------------------------
@@ -240,6 +296,32 @@ func TestRingBuffer_Empty(t *testing.T) {
 	}
 }
 
+func TestRingBuffer_Covers(t *testing.T) {
+	rb := newRingBuffer(10)
+	if !rb.covers(0) {
+		t.Error("empty buffer should cover seq 0")
+	}
+	if rb.covers(1) {
+		t.Error("buffer should not cover a sequence it never issued")
+	}
+
+	for i := 1; i <= 25; i++ {
+		rb.add(Event{Name: "E", Data: i})
+	}
+
+	// Events 16-25 are buffered: a client at 15 or later can catch up.
+	for _, seq := range []int64{15, 20, 25} {
+		if !rb.covers(seq) {
+			t.Errorf("covers(%d) = false, want true", seq)
+		}
+	}
+	for _, seq := range []int64{-1, 0, 14, 26} {
+		if rb.covers(seq) {
+			t.Errorf("covers(%d) = true, want false", seq)
+		}
+	}
+}
+
 func TestRingBuffer_ExactlyFull(t *testing.T) {
 	rb := newRingBuffer(5)
 
@@ -408,7 +490,7 @@ func TestDispatchToGuild_SendsToAllSubscribed(t *testing.T) {
 	}
 }
 
-func TestDispatchToGuild_StoresInReplayBuffer(t *testing.T) {
+func TestDispatchToGuild_RecordsInSessionLog(t *testing.T) {
 	m := newTestManager(t, &mockGuildRepo{})
 
 	c1 := fakeConn(m, 100, "s1")
@@ -418,17 +500,41 @@ func TestDispatchToGuild_StoresInReplayBuffer(t *testing.T) {
 	m.DispatchToGuild(1, EventMessageCreate, "msg1")
 	m.DispatchToGuild(1, EventMessageCreate, "msg2")
 
-	m.replayMu.RLock()
-	rb, ok := m.replayBuffer[1]
-	m.replayMu.RUnlock()
+	events := c1.log.events.since(0)
+	if len(events) != 2 {
+		t.Fatalf("session log has %d events, want 2", len(events))
+	}
 
-	if !ok {
-		t.Fatal("replay buffer not created for guild 1")
+	// Sequence numbers on the wire match the log.
+	payloads := drainEvents(c1)
+	for i, p := range payloads {
+		if p.Sequence == nil || *p.Sequence != int64(i+1) {
+			t.Errorf("payload %d sequence = %v, want %d", i, p.Sequence, i+1)
+		}
 	}
+}
 
-	events := rb.since(0)
-	if len(events) != 2 {
-		t.Fatalf("replay buffer has %d events, want 2", len(events))
+func TestDispatch_SequenceIsPerSession(t *testing.T) {
+	m := newTestManager(t, &mockGuildRepo{})
+
+	c1 := fakeConn(m, 100, "s1")
+	c2 := fakeConn(m, 200, "s2")
+	defer func() { _ = c1.Conn.Close() }()
+	defer func() { _ = c2.Conn.Close() }()
+	m.SubscribeToGuild(100, 1)
+	m.SubscribeToGuild(200, 2)
+
+	m.DispatchToGuild(1, EventMessageCreate, "guild 1")
+	m.DispatchToUser(100, EventMessageCreate, "dm")
+	m.DispatchToGuild(2, EventMessageCreate, "guild 2")
+
+	p1 := drainEvents(c1)
+	if len(p1) != 2 || *p1[0].Sequence != 1 || *p1[1].Sequence != 2 {
+		t.Fatalf("user 100 sequences not contiguous: %+v", p1)
+	}
+	p2 := drainEvents(c2)
+	if len(p2) != 1 || *p2[0].Sequence != 1 {
+		t.Fatalf("user 200 should start at sequence 1: %+v", p2)
 	}
 }
 
@@ -495,7 +601,7 @@ func TestDispatchToGuildExcept_ExcludesSpecifiedUser(t *testing.T) {
 	}
 }
 
-func TestDispatchToGuildExcept_StoresInReplayBuffer(t *testing.T) {
+func TestDispatchToGuildExcept_SkipsExcludedSessionLog(t *testing.T) {
 	m := newTestManager(t, &mockGuildRepo{})
 
 	c1 := fakeConn(m, 100, "s1")
@@ -504,17 +610,8 @@ func TestDispatchToGuildExcept_StoresInReplayBuffer(t *testing.T) {
 
 	m.DispatchToGuildExcept(1, 100, EventMessageCreate, "msg")
 
-	m.replayMu.RLock()
-	rb, ok := m.replayBuffer[1]
-	m.replayMu.RUnlock()
-
-	if !ok {
-		t.Fatal("replay buffer not created for guild 1")
-	}
-
-	events := rb.since(0)
-	if len(events) != 1 {
-		t.Fatalf("replay buffer has %d events, want 1", len(events))
+	if events := c1.log.events.since(0); len(events) != 0 {
+		t.Fatalf("excluded session log has %d events, want 0", len(events))
 	}
 }
 
@@ -532,45 +629,591 @@ func TestDispatchToGuildExcept_NonExistentGuildIsNoop(t *testing.T) {
 	m.DispatchToGuildExcept(999, 100, EventMessageCreate, "data")
 }
 
+// ---------------------------------------------------------------------------
+// Channel Dispatch Tests
+// ---------------------------------------------------------------------------
+
+// mockChannelPerms implements ChannelPermissionFilter with a fixed set of
+// users denied VIEW_CHANNEL, counting the lookups it serves.
+type mockChannelPerms struct {
+	mu     sync.Mutex
+	denied map[int64]bool
+	err    error
+	calls  int
+}
+
+func (f *mockChannelPerms) FilterChannelPermission(_ context.Context, _, _ int64, userIDs []int64, perm permissions.Permission) ([]int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	if perm != permissions.PermViewChannel {
+		return nil, nil
+	}
+	var allowed []int64
+	for _, id := range userIDs {
+		if !f.denied[id] {
+			allowed = append(allowed, id)
+		}
+	}
+	return allowed, nil
+}
+
+func (f *mockChannelPerms) FilterChannels(_ context.Context, _, userID int64, channels []models.Channel, perm permissions.Permission) ([]models.Channel, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.err != nil {
+		return nil, f.err
+	}
+	if perm != permissions.PermViewChannel || f.denied[userID] {
+		return nil, nil
+	}
+	return channels, nil
+}
+
+func (f *mockChannelPerms) deny(userID int64, denied bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.denied[userID] = denied
+}
+
+func (f *mockChannelPerms) lookups() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+func TestDispatchToChannel_DeniedMemberReceivesNothing(t *testing.T) {
+	m := newTestManager(t, &mockGuildRepo{})
+	perms := &mockChannelPerms{denied: map[int64]bool{200: true}}
+	m.SetChannelPermissions(perms)
+
+	c1 := fakeConn(m, 100, "s1")
+	c2 := fakeConn(m, 200, "s2")
+	c2b := fakeConn(m, 200, "s2b")
+	defer func() { _ = c1.Conn.Close() }()
+	defer func() { _ = c2.Conn.Close() }()
+	defer func() { _ = c2b.Conn.Close() }()
+	m.SubscribeToGuild(100, 1)
+	m.SubscribeToGuild(200, 1)
+
+	for _, event := range []string{EventMessageCreate, EventMessageUpdate, EventTypingStart, EventMessageReactionAdd} {
+		m.DispatchToChannel(1, 10, event, "data")
+	}
+
+	if got := drainEvents(c1); len(got) != 4 {
+		t.Errorf("allowed member received %d events, want 4", len(got))
+	}
+	for _, c := range []*Connection{c2, c2b} {
+		if got := drainEvents(c); len(got) != 0 {
+			t.Errorf("denied session %s received %d events, want 0", c.SessionID, len(got))
+		}
+		if logged := c.log.events.since(0); len(logged) != 0 {
+			t.Errorf("denied session %s logged %d events for RESUME, want 0", c.SessionID, len(logged))
+		}
+	}
+}
+
+func TestDispatchToGuildMembers_OnlyListedSubscribers(t *testing.T) {
+	m := newTestManager(t, &mockGuildRepo{})
+
+	listed := fakeConn(m, 100, "s1")
+	unlisted := fakeConn(m, 200, "s2")
+	elsewhere := fakeConn(m, 300, "s3")
+	defer func() { _ = listed.Conn.Close() }()
+	defer func() { _ = unlisted.Conn.Close() }()
+	defer func() { _ = elsewhere.Conn.Close() }()
+	m.SubscribeToGuild(100, 1)
+	m.SubscribeToGuild(200, 1)
+	m.SubscribeToGuild(300, 2)
+
+	m.DispatchToGuildMembers(1, []int64{100, 300}, EventChannelDelete, "data")
+
+	if got := drainEvents(listed); len(got) != 1 || got[0].Event == nil || *got[0].Event != EventChannelDelete {
+		t.Errorf("listed subscriber received %d events, want one CHANNEL_DELETE", len(got))
+	}
+	if got := drainEvents(unlisted); len(got) != 0 {
+		t.Errorf("unlisted subscriber received %d events, want 0", len(got))
+	}
+	// A listed user who isn't subscribed to the guild gets nothing.
+	if got := drainEvents(elsewhere); len(got) != 0 {
+		t.Errorf("user outside the guild received %d events, want 0", len(got))
+	}
+}
+
+func TestDispatchToChannel_CachesPermissions(t *testing.T) {
+	m := newTestManager(t, &mockGuildRepo{})
+	perms := &mockChannelPerms{denied: map[int64]bool{}}
+	m.SetChannelPermissions(perms)
+
+	c1 := fakeConn(m, 100, "s1")
+	defer func() { _ = c1.Conn.Close() }()
+	m.SubscribeToGuild(100, 1)
+
+	m.DispatchToChannel(1, 10, EventMessageCreate, "a")
+	m.DispatchToChannel(1, 10, EventMessageCreate, "b")
+	if n := perms.lookups(); n != 1 {
+		t.Errorf("same channel looked up %d times, want 1", n)
+	}
+
+	m.DispatchToChannel(1, 11, EventMessageCreate, "c")
+	if n := perms.lookups(); n != 2 {
+		t.Errorf("lookups after second channel = %d, want 2", n)
+	}
+	if got := drainEvents(c1); len(got) != 3 {
+		t.Errorf("received %d events, want 3", len(got))
+	}
+}
+
+func TestDispatchToChannel_InvalidationRefreshesPermissions(t *testing.T) {
+	tests := []struct {
+		name       string
+		invalidate func(m *Manager)
+	}{
+		{"member update", func(m *Manager) { m.InvalidateMemberPermissions(1, 200) }},
+		{"role or override update", func(m *Manager) { m.InvalidateGuildPermissions(1) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestManager(t, &mockGuildRepo{})
+			perms := &mockChannelPerms{denied: map[int64]bool{}}
+			m.SetChannelPermissions(perms)
+
+			c := fakeConn(m, 200, "s1")
+			defer func() { _ = c.Conn.Close() }()
+			m.SubscribeToGuild(200, 1)
+
+			m.DispatchToChannel(1, 10, EventMessageCreate, "before")
+			if got := drainEvents(c); len(got) != 1 {
+				t.Fatalf("received %d events before the deny, want 1", len(got))
+			}
+
+			// Without invalidation the cached permission still applies.
+			perms.deny(200, true)
+			m.DispatchToChannel(1, 10, EventMessageCreate, "cached")
+			if got := drainEvents(c); len(got) != 1 {
+				t.Fatalf("received %d events from cache, want 1", len(got))
+			}
+
+			tt.invalidate(m)
+			m.DispatchToChannel(1, 10, EventMessageCreate, "after")
+			if got := drainEvents(c); len(got) != 0 {
+				t.Errorf("denied member received %d events after invalidation, want 0", len(got))
+			}
+
+			perms.deny(200, false)
+			tt.invalidate(m)
+			m.DispatchToChannel(1, 10, EventMessageCreate, "restored")
+			if got := drainEvents(c); len(got) != 1 {
+				t.Errorf("received %d events after access was restored, want 1", len(got))
+			}
+		})
+	}
+}
+
+func TestDispatchToChannel_LookupErrorDeliversNothing(t *testing.T) {
+	m := newTestManager(t, &mockGuildRepo{})
+	perms := &mockChannelPerms{denied: map[int64]bool{}, err: errors.New("db down")}
+	m.SetChannelPermissions(perms)
+
+	c := fakeConn(m, 100, "s1")
+	defer func() { _ = c.Conn.Close() }()
+	m.SubscribeToGuild(100, 1)
+
+	m.DispatchToChannel(1, 10, EventMessageCreate, "data")
+	if got := drainEvents(c); len(got) != 0 {
+		t.Errorf("received %d events despite failed lookup, want 0", len(got))
+	}
+
+	// Failures aren't cached.
+	perms.mu.Lock()
+	perms.err = nil
+	perms.mu.Unlock()
+	m.DispatchToChannel(1, 10, EventMessageCreate, "data")
+	if got := drainEvents(c); len(got) != 1 {
+		t.Errorf("received %d events after recovery, want 1", len(got))
+	}
+}
+
+func TestDispatchToChannel_WithoutFilterSendsToGuild(t *testing.T) {
+	m := newTestManager(t, &mockGuildRepo{})
+
+	c := fakeConn(m, 100, "s1")
+	defer func() { _ = c.Conn.Close() }()
+	m.SubscribeToGuild(100, 1)
+
+	m.DispatchToChannel(1, 10, EventMessageCreate, "data")
+	if got := drainEvents(c); len(got) != 1 {
+		t.Errorf("received %d events, want 1", len(got))
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Intent Tests
+// ---------------------------------------------------------------------------
+
+func TestDispatch_DropsEventsOutsideIntents(t *testing.T) {
+	m := newTestManager(t, &mockGuildRepo{})
+
+	c := fakeConn(m, 100, "s1")
+	defer func() { _ = c.Conn.Close() }()
+	m.unregister(c)
+	quiet := &Connection{
+		UserID:    100,
+		SessionID: "quiet",
+		Conn:      c.Conn,
+		Send:      make(chan []byte, sendBufferSize),
+		encoding:  testEncoding,
+		manager:   m,
+		done:      make(chan struct{}),
+	}
+	m.register(quiet, IntentGuilds|IntentGuildMessages)
+	m.SubscribeToGuild(100, 1)
+
+	m.DispatchToGuild(1, EventTypingStart, "typing")
+	m.DispatchToGuild(1, EventPresenceUpdate, "presence")
+	m.DispatchToGuild(1, EventMessageCreate, "message")
+	m.DispatchToGuild(1, EventVoiceStateUpdate, "voice")
+	m.DispatchToUser(100, EventGuildCreate, "guild")
+
+	got := drainEvents(quiet)
+	want := []string{EventMessageCreate, EventGuildCreate}
+	if len(got) != len(want) {
+		t.Fatalf("received %d events, want %d", len(got), len(want))
+	}
+	for i, p := range got {
+		if p.Event == nil || *p.Event != want[i] {
+			t.Errorf("event %d = %v, want %s", i, p.Event, want[i])
+		}
+		// Dropped events don't consume sequence numbers.
+		if p.Sequence == nil || *p.Sequence != int64(i+1) {
+			t.Errorf("event %d sequence = %v, want %d", i, p.Sequence, i+1)
+		}
+	}
+}
+
+func TestDispatchToUser_GatesDMEventsByDirectIntent(t *testing.T) {
+	m := newTestManager(t, &mockGuildRepo{})
+
+	c := fakeConn(m, 100, "s1")
+	defer func() { _ = c.Conn.Close() }()
+	m.unregister(c)
+	guildOnly := &Connection{
+		UserID:    100,
+		SessionID: "guild-only",
+		Conn:      c.Conn,
+		Send:      make(chan []byte, sendBufferSize),
+		encoding:  testEncoding,
+		manager:   m,
+		done:      make(chan struct{}),
+	}
+	m.register(guildOnly, IntentGuilds|IntentGuildMessages)
+	m.SubscribeToGuild(100, 1)
+
+	m.DispatchToUser(100, EventMessageCreate, "dm")
+	m.DispatchToUser(100, EventTypingStart, "dm typing")
+	m.DispatchToGuild(1, EventMessageCreate, "guild message")
+	m.DispatchToUser(100, EventChannelCreate, "dm channel")
+
+	got := drainEvents(guildOnly)
+	want := []string{EventMessageCreate, EventChannelCreate}
+	if len(got) != len(want) {
+		t.Fatalf("received %d events, want %d", len(got), len(want))
+	}
+	for i, p := range got {
+		if p.Event == nil || *p.Event != want[i] {
+			t.Errorf("event %d = %v, want %s", i, p.Event, want[i])
+		}
+	}
+
+	m.unregister(guildOnly)
+	dmOnly := &Connection{
+		UserID:    100,
+		SessionID: "dm-only",
+		Conn:      c.Conn,
+		Send:      make(chan []byte, sendBufferSize),
+		encoding:  testEncoding,
+		manager:   m,
+		done:      make(chan struct{}),
+	}
+	m.register(dmOnly, IntentDirectMessages)
+
+	m.DispatchToUser(100, EventMessageCreate, "dm")
+	m.DispatchToGuild(1, EventMessageCreate, "guild message")
+
+	got = drainEvents(dmOnly)
+	if len(got) != 1 || got[0].Event == nil || *got[0].Event != EventMessageCreate {
+		t.Fatalf("expected only the DM MESSAGE_CREATE, got %d events", len(got))
+	}
+}
+
+func TestSessionIntents(t *testing.T) {
+	users := &mockUserRepo{users: map[int64]*models.User{
+		1: {ID: 1},
+		2: {ID: 2, Bot: true},
+	}}
+	m := NewManager(auth.NewTokenService("test-secret"), users, &mockGuildRepo{}, nil, newTestRedis(t))
+
+	intents := func(i Intents) *Intents { return &i }
+	tests := []struct {
+		name      string
+		userID    int64
+		requested *Intents
+		want      Intents
+		wantErr   error
+	}{
+		{"user without intents gets everything", 1, nil, IntentsAll, nil},
+		{"bot without intents gets defaults", 2, nil, IntentsDefault, nil},
+		{"user opts out of typing", 1, intents(IntentsDefault &^ IntentGuildMessageTyping), IntentsDefault &^ IntentGuildMessageTyping, nil},
+		{"user asks for presences", 1, intents(IntentGuilds | IntentGuildPresences), IntentGuilds, nil},
+		{"user asks for members", 1, intents(IntentGuildMembers), 0, nil},
+		{"bot asks for privileged intents", 2, intents(IntentGuilds | IntentsPrivileged), IntentGuilds | IntentsPrivileged, nil},
+		{"unknown bits", 2, intents(1 << 40), 0, errInvalidIntents},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := m.sessionIntents(context.Background(), tt.userID, tt.requested)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("intents = %b, want %b", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWSLifecycle_PrivilegedIntentsRequireBot(t *testing.T) {
+	tokens := auth.NewTokenService("test-secret")
+	token, err := tokens.GenerateAccessToken(42)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+	users := &mockUserRepo{users: map[int64]*models.User{42: {ID: 42}}}
+	m := NewManager(tokens, users, &mockGuildRepo{}, nil, newTestRedis(t))
+	srv := setupWSServer(t, m)
+	ws := dialWS(t, srv)
+
+	readPayload(t, ws)
+
+	presences := IntentGuilds | IntentGuildPresences
+	sendPayload(t, ws, OpIdentify, IdentifyData{Token: token, Intents: &presences})
+
+	ready := readPayload(t, ws)
+	if ready.Event == nil || *ready.Event != EventReady {
+		t.Fatalf("expected READY, got %+v", ready)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, l := range m.sessionLogs[42] {
+		if l.intents != IntentGuilds {
+			t.Errorf("session intents = %b, want %b with presences masked out", l.intents, IntentGuilds)
+		}
+	}
+}
+
+func TestWSLifecycle_UserWithoutIntentsGetsMembersAndPresences(t *testing.T) {
+	tokens := auth.NewTokenService("test-secret")
+	token, err := tokens.GenerateAccessToken(42)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+	users := &mockUserRepo{users: map[int64]*models.User{42: {ID: 42}}}
+	guilds := &mockGuildRepo{
+		GetByUserIDFn: func(context.Context, int64) ([]models.Guild, error) {
+			return []models.Guild{{ID: 1, Name: "Guild A"}}, nil
+		},
+	}
+	m := NewManager(tokens, users, guilds, nil, newTestRedis(t))
+	srv := setupWSServer(t, m)
+	ws := dialWS(t, srv)
+
+	readPayload(t, ws)
+	sendPayload(t, ws, OpIdentify, IdentifyData{Token: token})
+
+	ready := readPayload(t, ws)
+	if ready.Event == nil || *ready.Event != EventReady {
+		t.Fatalf("expected READY, got %+v", ready)
+	}
+
+	m.DispatchToGuild(1, EventPresenceUpdate, PresenceUpdateData{UserID: 43, Status: "online"})
+	m.DispatchToGuild(1, EventGuildMemberAdd, "member")
+
+	want := map[string]bool{EventPresenceUpdate: true, EventGuildMemberAdd: true}
+	for len(want) > 0 {
+		p := readPayload(t, ws)
+		if p.Event != nil {
+			delete(want, *p.Event)
+		}
+	}
+}
+
 // ---------------------------------------------------------------------------
 // Register / Unregister Tests
 // ---------------------------------------------------------------------------
 
-func TestRegister_DisplacesExistingConnection(t *testing.T) {
+func TestRegister_KeepsConcurrentSessions(t *testing.T) {
 	m := newTestManager(t, &mockGuildRepo{})
 
 	c1 := fakeConn(m, 100, "s1")
 	defer func() { _ = c1.Conn.Close() }()
 
-	// Register a second connection for the same user.
+	// Register a second connection for the same user (another device).
 	c2 := &Connection{
 		UserID:    100,
 		SessionID: "s2",
 		Conn:      c1.Conn, // reuse for simplicity
 		Send:      make(chan []byte, sendBufferSize),
+		encoding:  testEncoding,
 		manager:   m,
 		done:      make(chan struct{}),
 	}
 	c2.lastHeartbeat.Store(time.Now().UnixMilli())
 
-	m.register(c2)
+	m.register(c2, IntentsAll)
 
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	if m.connections[100] != c2 {
-		t.Error("new connection should replace old one")
+	if m.connections[100]["s1"] != c1 {
+		t.Error("existing session should be kept")
 	}
-	if _, ok := m.sessions["s1"]; ok {
-		t.Error("old session should be removed")
+	if m.connections[100]["s2"] != c2 {
+		t.Error("new session should be registered alongside the old one")
+	}
+	if m.sessions["s1"] != c1 || m.sessions["s2"] != c2 {
+		t.Error("both sessions should be indexed by session ID")
+	}
+	if len(drainEvents(c1)) != 0 {
+		t.Error("existing session should not receive RECONNECT")
+	}
+}
+
+func TestRegister_SameSessionDisplacesOldConnection(t *testing.T) {
+	m := newTestManager(t, &mockGuildRepo{})
+
+	c1 := fakeConn(m, 100, "s1")
+	defer func() { _ = c1.Conn.Close() }()
+
+	// A resumed connection reuses the session ID of the old one.
+	c2 := &Connection{
+		UserID:    100,
+		SessionID: "s1",
+		Conn:      c1.Conn,
+		Send:      make(chan []byte, sendBufferSize),
+		encoding:  testEncoding,
+		manager:   m,
+		done:      make(chan struct{}),
+	}
+	c2.lastHeartbeat.Store(time.Now().UnixMilli())
+
+	m.register(c2, IntentsAll)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.connections[100]["s1"] != c2 {
+		t.Error("resumed connection should replace the old one")
+	}
+	if len(m.connections[100]) != 1 {
+		t.Errorf("user has %d sessions, want 1", len(m.connections[100]))
+	}
+	if m.sessions["s1"] != c2 {
+		t.Error("session index should point at the resumed connection")
+	}
+
+	p := drainEvents(c1)
+	if len(p) != 1 || p[0].Op != OpReconnect {
+		t.Errorf("displaced connection should receive RECONNECT, got %+v", p)
+	}
+}
+
+func TestDispatchToUser_FansOutToAllSessions(t *testing.T) {
+	m := newTestManager(t, &mockGuildRepo{})
+
+	phone := fakeConn(m, 100, "phone")
+	web := fakeConn(m, 100, "web")
+	other := fakeConn(m, 200, "other")
+	defer func() { _ = phone.Conn.Close() }()
+	defer func() { _ = web.Conn.Close() }()
+	defer func() { _ = other.Conn.Close() }()
+
+	m.DispatchToUser(100, EventMessageCreate, "dm")
+
+	if n := len(drainEvents(phone)); n != 1 {
+		t.Errorf("phone session received %d events, want 1", n)
+	}
+	if n := len(drainEvents(web)); n != 1 {
+		t.Errorf("web session received %d events, want 1", n)
+	}
+	if n := len(drainEvents(other)); n != 0 {
+		t.Errorf("other user received %d events, want 0", n)
+	}
+}
+
+func TestDispatchToGuild_FansOutToAllSessions(t *testing.T) {
+	m := newTestManager(t, &mockGuildRepo{})
+
+	phone := fakeConn(m, 100, "phone")
+	web := fakeConn(m, 100, "web")
+	defer func() { _ = phone.Conn.Close() }()
+	defer func() { _ = web.Conn.Close() }()
+	m.SubscribeToGuild(100, 1)
+
+	m.DispatchToGuild(1, EventMessageCreate, "hello")
+
+	if n := len(drainEvents(phone)); n != 1 {
+		t.Errorf("phone session received %d events, want 1", n)
+	}
+	if n := len(drainEvents(web)); n != 1 {
+		t.Errorf("web session received %d events, want 1", n)
+	}
+}
+
+func TestUnregister_KeepsSubscriptionsWhileOtherSessionsRemain(t *testing.T) {
+	m := newTestManager(t, &mockGuildRepo{})
+	m.SetResumeWindow(0)
+
+	phone := fakeConn(m, 100, "phone")
+	web := fakeConn(m, 100, "web")
+	defer func() { _ = phone.Conn.Close() }()
+	defer func() { _ = web.Conn.Close() }()
+	m.SubscribeToGuild(100, 1)
+
+	m.unregister(web)
+
+	m.mu.RLock()
+	if !m.subscriptions[1][100] {
+		t.Error("user should stay subscribed while a session remains")
+	}
+	if _, ok := m.connections[100]["web"]; ok {
+		t.Error("closed session should be removed")
+	}
+	if m.connections[100]["phone"] != phone {
+		t.Error("remaining session should be kept")
+	}
+	m.mu.RUnlock()
+
+	m.unregister(phone)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if _, ok := m.connections[100]; ok {
+		t.Error("user should be removed once the last session closes")
 	}
-	if m.sessions["s2"] != c2 {
-		t.Error("new session should be registered")
+	if m.subscriptions[1][100] {
+		t.Error("subscriptions should be cleared once the last session closes")
 	}
 }
 
 func TestUnregister_RemovesFromAllGuildSubscriptions(t *testing.T) {
 	m := newTestManager(t, &mockGuildRepo{})
+	m.SetResumeWindow(0)
 
 	c := fakeConn(m, 100, "s1")
 	defer func() { _ = c.Conn.Close() }()
@@ -608,6 +1251,7 @@ func TestUnregister_IgnoresMismatchedConnection(t *testing.T) {
 		SessionID: "s2",
 		Conn:      c1.Conn,
 		Send:      make(chan []byte, sendBufferSize),
+		encoding:  testEncoding,
 		manager:   m,
 		done:      make(chan struct{}),
 	}
@@ -619,34 +1263,126 @@ func TestUnregister_IgnoresMismatchedConnection(t *testing.T) {
 	defer m.mu.RUnlock()
 
 	// c1 should still be registered.
-	if m.connections[100] != c1 {
+	if m.connections[100]["s1"] != c1 {
 		t.Error("original connection should not be removed by mismatched unregister")
 	}
 }
 
 // ---------------------------------------------------------------------------
-// Store Replay Event Tests
+// Session Log Tests
 // ---------------------------------------------------------------------------
 
-func TestStoreReplayEvent_CreatesBufferOnDemand(t *testing.T) {
+func TestUnregister_SessionKeepsRecordingUntilExpiry(t *testing.T) {
 	m := newTestManager(t, &mockGuildRepo{})
+	m.SetResumeWindow(50 * time.Millisecond)
+
+	c := fakeConn(m, 100, "s1")
+	defer func() { _ = c.Conn.Close() }()
+	m.SubscribeToGuild(100, 1)
 
-	m.storeReplayEvent(42, Event{Name: "TEST", Data: "data"})
+	m.unregister(c)
 
-	m.replayMu.RLock()
-	defer m.replayMu.RUnlock()
+	// Guild and DM events keep being recorded while the session is resumable.
+	m.DispatchToGuild(1, EventMessageCreate, "missed")
+	m.DispatchToUser(100, EventMessageCreate, "missed dm")
 
-	rb, ok := m.replayBuffer[42]
-	if !ok {
-		t.Fatal("replay buffer not created for guild 42")
+	m.mu.RLock()
+	log := m.sessionLogs[100]["s1"]
+	subscribed := m.subscriptions[1][100]
+	m.mu.RUnlock()
+	if log == nil {
+		t.Fatal("session log should survive disconnect")
+	}
+	if !subscribed {
+		t.Error("subscriptions should be kept while the session is resumable")
+	}
+	if n := len(log.events.since(0)); n != 2 {
+		t.Errorf("session log has %d events, want 2", n)
+	}
+	if n := len(drainEvents(c)); n != 0 {
+		t.Errorf("detached connection received %d events, want 0", n)
 	}
 
-	events := rb.since(0)
-	if len(events) != 1 {
-		t.Fatalf("replay buffer has %d events, want 1", len(events))
+	deadline := time.Now().Add(time.Second)
+	for {
+		m.mu.RLock()
+		_, ok := m.sessionLogs[100]
+		subscribed := m.subscriptions[1][100]
+		m.mu.RUnlock()
+		if !ok && !subscribed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("session should expire after the resume window")
+		}
+		time.Sleep(5 * time.Millisecond)
 	}
-	if events[0].Name != "TEST" {
-		t.Errorf("event name = %q, want %q", events[0].Name, "TEST")
+}
+
+func TestResume_ReplaysMissedEventsInOrder(t *testing.T) {
+	m := newTestManager(t, &mockGuildRepo{})
+
+	c := fakeConn(m, 100, "s1")
+	defer func() { _ = c.Conn.Close() }()
+	m.SubscribeToGuild(100, 1)
+
+	m.DispatchToGuild(1, EventMessageCreate, "seen")
+	drainEvents(c)
+	m.unregister(c)
+
+	m.DispatchToGuild(1, EventMessageCreate, "missed 1")
+	m.DispatchToUser(100, EventMessageCreate, "missed 2")
+
+	resumed := &Connection{
+		UserID:    100,
+		SessionID: "s1",
+		Conn:      c.Conn,
+		Send:      make(chan []byte, sendBufferSize),
+		encoding:  testEncoding,
+		manager:   m,
+		done:      make(chan struct{}),
+	}
+	if err := m.resume(resumed, 1); err != nil {
+		t.Fatalf("resume should succeed within the window: %v", err)
+	}
+	m.DispatchToGuild(1, EventMessageCreate, "live")
+
+	got := drainEvents(resumed)
+	want := []string{"missed 1", "missed 2", "live"}
+	if len(got) != len(want) {
+		t.Fatalf("resumed connection received %d events, want %d", len(got), len(want))
+	}
+	for i, p := range got {
+		if p.Sequence == nil || *p.Sequence != int64(i+2) {
+			t.Errorf("event %d sequence = %v, want %d", i, p.Sequence, i+2)
+		}
+		if got := dataString(t, p); got != want[i] {
+			t.Errorf("event %d data = %q, want %q", i, got, want[i])
+		}
+	}
+}
+
+func TestResume_RejectsUnfillableGap(t *testing.T) {
+	m := newTestManager(t, &mockGuildRepo{})
+
+	c := fakeConn(m, 100, "s1")
+	defer func() { _ = c.Conn.Close() }()
+	m.unregister(c)
+
+	for i := 0; i < sessionLogSize+1; i++ {
+		m.DispatchToUser(100, EventMessageCreate, i)
+	}
+
+	for seq, want := range map[int64]error{0: errSessionGap, -1: errInvalidSeq, sessionLogSize + 2: errInvalidSeq} {
+		resumed := &Connection{UserID: 100, SessionID: "s1", Conn: c.Conn, Send: make(chan []byte, sendBufferSize), manager: m, done: make(chan struct{})}
+		if err := m.resume(resumed, seq); !errors.Is(err, want) {
+			t.Errorf("resume from seq %d: err = %v, want %v", seq, err, want)
+		}
+	}
+
+	other := &Connection{UserID: 200, SessionID: "s1", Conn: c.Conn, Send: make(chan []byte, sendBufferSize), manager: m, done: make(chan struct{})}
+	if err := m.resume(other, 1); !errors.Is(err, errUnknownSession) {
+		t.Errorf("another user resuming the session: err = %v, want %v", err, errUnknownSession)
 	}
 }
 
@@ -658,6 +1394,12 @@ func setupWSServer(t *testing.T, m *Manager) *httptest.Server {
 	t.Helper()
 	mux := http.NewServeMux()
 	mux.HandleFunc("/gateway", func(w http.ResponseWriter, r *http.Request) {
+		opts, err := parseTransportOptions(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		up := websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }}
 		ws, err := up.Upgrade(w, r, nil)
 		if err != nil {
@@ -665,11 +1407,9 @@ func setupWSServer(t *testing.T, m *Manager) *httptest.Server {
 			return
 		}
 
-		conn := newConnection(ws, m)
-		conn.SendPayload(GatewayPayload{
-			Op:   OpHello,
-			Data: mustMarshal(HelloData{HeartbeatInterval: int(heartbeatInterval.Milliseconds())}),
-		})
+		conn := newConnection(ws, m, opts)
+		conn.ip, _, _ = net.SplitHostPort(r.RemoteAddr)
+		conn.SendOp(OpHello, HelloData{HeartbeatInterval: int(heartbeatInterval.Milliseconds())})
 
 		go conn.writePump()
 		go conn.readPump()
@@ -680,9 +1420,12 @@ func setupWSServer(t *testing.T, m *Manager) *httptest.Server {
 	return srv
 }
 
-func dialWS(t *testing.T, srv *httptest.Server) *websocket.Conn {
+// dialWS connects to the test gateway with the test encoding and any extra
+// query parameters.
+func dialWS(t *testing.T, srv *httptest.Server, query ...string) *websocket.Conn {
 	t.Helper()
-	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/gateway"
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/gateway?" +
+		strings.Join(append([]string{"encoding=" + testEncoding}, query...), "&")
 	ws, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
 	if err != nil {
 		t.Fatalf("dial: %v", err)
@@ -698,20 +1441,37 @@ func readPayload(t *testing.T, ws *websocket.Conn) GatewayPayload {
 	if err != nil {
 		t.Fatalf("read: %v", err)
 	}
-	var p GatewayPayload
-	if err := json.Unmarshal(msg, &p); err != nil {
+	p, err := decodeFrame(msg)
+	if err != nil {
 		t.Fatalf("unmarshal: %v", err)
 	}
 	return p
 }
 
-func sendPayload(t *testing.T, ws *websocket.Conn, p GatewayPayload) {
+// sendPayload sends a client payload in the test encoding; data may be nil.
+func sendPayload(t *testing.T, ws *websocket.Conn, op int, data any) {
 	t.Helper()
-	data, err := json.Marshal(p)
+	kind := websocket.TextMessage
+	c := &Connection{encoding: testEncoding}
+	var raw []byte
+	if data != nil {
+		var err error
+		if raw, err = c.marshal(data); err != nil {
+			t.Fatalf("marshal: %v", err)
+		}
+	}
+	var frame []byte
+	var err error
+	if testEncoding == encodingMsgpack {
+		kind = websocket.BinaryMessage
+		frame, err = marshalMsgpack(msgpackPayload{Op: op, Data: raw})
+	} else {
+		frame, err = json.Marshal(GatewayPayload{Op: op, Data: raw})
+	}
 	if err != nil {
 		t.Fatalf("marshal: %v", err)
 	}
-	if err := ws.WriteMessage(websocket.TextMessage, data); err != nil {
+	if err := ws.WriteMessage(kind, frame); err != nil {
 		t.Fatalf("write: %v", err)
 	}
 }
@@ -727,9 +1487,7 @@ func TestWSLifecycle_HelloOnConnect(t *testing.T) {
 	}
 
 	var hello HelloData
-	if err := json.Unmarshal(p.Data, &hello); err != nil {
-		t.Fatalf("unmarshal hello data: %v", err)
-	}
+	decodeData(t, p, &hello)
 	if hello.HeartbeatInterval != int(heartbeatInterval.Milliseconds()) {
 		t.Errorf("heartbeat_interval = %d, want %d", hello.HeartbeatInterval, int(heartbeatInterval.Milliseconds()))
 	}
@@ -752,7 +1510,7 @@ func TestWSLifecycle_IdentifyAndReady(t *testing.T) {
 	}
 
 	rdb := newTestRedis(t)
-	m := NewManager(tokens, guilds, nil, rdb)
+	m := NewManager(tokens, nil, guilds, nil, rdb)
 	srv := setupWSServer(t, m)
 	ws := dialWS(t, srv)
 
@@ -760,8 +1518,7 @@ func TestWSLifecycle_IdentifyAndReady(t *testing.T) {
 	readPayload(t, ws)
 
 	// Send IDENTIFY.
-	identifyData := mustMarshal(IdentifyData{Token: token})
-	sendPayload(t, ws, GatewayPayload{Op: OpIdentify, Data: identifyData})
+	sendPayload(t, ws, OpIdentify, IdentifyData{Token: token})
 
 	// Read READY.
 	p := readPayload(t, ws)
@@ -773,9 +1530,7 @@ func TestWSLifecycle_IdentifyAndReady(t *testing.T) {
 	}
 
 	var ready ReadyData
-	if err := json.Unmarshal(p.Data, &ready); err != nil {
-		t.Fatalf("unmarshal ready data: %v", err)
-	}
+	decodeData(t, p, &ready)
 	if ready.UserID != 42 {
 		t.Errorf("ready user_id = %d, want 42", ready.UserID)
 	}
@@ -796,6 +1551,59 @@ func TestWSLifecycle_IdentifyAndReady(t *testing.T) {
 	}
 }
 
+func TestWSLifecycle_MultipleDevicesStayConnected(t *testing.T) {
+	tokens := auth.NewTokenService("test-secret")
+	token, err := tokens.GenerateAccessToken(42)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+
+	guilds := &mockGuildRepo{
+		GetByUserIDFn: func(ctx context.Context, userID int64) ([]models.Guild, error) {
+			return []models.Guild{{ID: 1, Name: "Guild A"}}, nil
+		},
+	}
+
+	m := NewManager(tokens, nil, guilds, nil, newTestRedis(t))
+	srv := setupWSServer(t, m)
+
+	identify := func(ws *websocket.Conn) ReadyData {
+		readPayload(t, ws) // HELLO
+		sendPayload(t, ws, OpIdentify, IdentifyData{Token: token})
+		for {
+			p := readPayload(t, ws)
+			if p.Event != nil && *p.Event == EventReady {
+				var ready ReadyData
+				decodeData(t, p, &ready)
+				return ready
+			}
+		}
+	}
+
+	phone := dialWS(t, srv)
+	web := dialWS(t, srv)
+	phoneReady := identify(phone)
+	webReady := identify(web)
+
+	if phoneReady.SessionID == webReady.SessionID {
+		t.Fatal("each device should get its own session ID")
+	}
+
+	m.DispatchToUser(42, EventMessageCreate, "dm")
+
+	for name, ws := range map[string]*websocket.Conn{"phone": phone, "web": web} {
+		for {
+			p := readPayload(t, ws)
+			if p.Op == OpReconnect {
+				t.Fatalf("%s session was sent RECONNECT", name)
+			}
+			if p.Event != nil && *p.Event == EventMessageCreate {
+				break
+			}
+		}
+	}
+}
+
 func TestWSLifecycle_InvalidTokenClosesConnection(t *testing.T) {
 	m := newTestManager(t, &mockGuildRepo{})
 	srv := setupWSServer(t, m)
@@ -803,8 +1611,7 @@ func TestWSLifecycle_InvalidTokenClosesConnection(t *testing.T) {
 
 	readPayload(t, ws)
 
-	identifyData := mustMarshal(IdentifyData{Token: "invalid-token"})
-	sendPayload(t, ws, GatewayPayload{Op: OpIdentify, Data: identifyData})
+	sendPayload(t, ws, OpIdentify, IdentifyData{Token: "invalid-token"})
 
 	// The server should close the connection. The next read should fail.
 	_ = ws.SetReadDeadline(time.Now().Add(2 * time.Second))
@@ -822,7 +1629,7 @@ func TestWSLifecycle_HeartbeatExchange(t *testing.T) {
 	readPayload(t, ws)
 
 	// Send a heartbeat.
-	sendPayload(t, ws, GatewayPayload{Op: OpHeartbeat})
+	sendPayload(t, ws, OpHeartbeat, nil)
 
 	// Should receive heartbeat ACK.
 	p := readPayload(t, ws)
@@ -841,49 +1648,120 @@ func TestWSLifecycle_ResumeReplaysEvents(t *testing.T) {
 	}
 
 	rdb := newTestRedis(t)
-	m := NewManager(tokens, guilds, nil, rdb)
+	m := NewManager(tokens, nil, guilds, nil, rdb)
+	srv := setupWSServer(t, m)
 
-	// Pre-populate the replay buffer for guild 1 with 3 events.
-	m.storeReplayEvent(1, Event{Name: EventMessageCreate, Data: "msg1"})
-	m.storeReplayEvent(1, Event{Name: EventMessageCreate, Data: "msg2"})
-	m.storeReplayEvent(1, Event{Name: EventMessageCreate, Data: "msg3"})
+	token, err := tokens.GenerateAccessToken(42)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
 
-	srv := setupWSServer(t, m)
+	// IDENTIFY and read everything up to a known event.
 	ws := dialWS(t, srv)
-
 	readPayload(t, ws) // HELLO
+	sendPayload(t, ws, OpIdentify, IdentifyData{Token: token})
+	p := readPayload(t, ws)
+	var ready ReadyData
+	decodeData(t, p, &ready)
+	m.DispatchToGuild(1, EventMessageCreate, "msg1")
+	lastSeq := *p.Sequence
+	for {
+		p := readPayload(t, ws)
+		if p.Sequence == nil || *p.Sequence != lastSeq+1 {
+			t.Fatalf("sequence = %v after %d, want contiguous", p.Sequence, lastSeq)
+		}
+		lastSeq = *p.Sequence
+		if p.Event != nil && *p.Event == EventMessageCreate && dataString(t, p) == "msg1" {
+			break
+		}
+	}
+
+	// Drop the connection and wait for the server to notice.
+	_ = ws.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		m.mu.RLock()
+		connected := len(m.connections[42]) > 0
+		m.mu.RUnlock()
+		if !connected {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("server did not unregister the closed connection")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// Events sent while disconnected, including DMs, are kept.
+	m.DispatchToGuild(1, EventMessageCreate, "msg2")
+	m.DispatchToUser(42, EventMessageCreate, "dm")
+
+	ws2 := dialWS(t, srv)
+	readPayload(t, ws2) // HELLO
+	sendPayload(t, ws2, OpResume, ResumeData{
+		Token:     token,
+		SessionID: ready.SessionID,
+		Sequence:  lastSeq,
+	})
+
+	want := []struct {
+		seq   int64
+		event string
+	}{
+		{lastSeq + 1, EventMessageCreate},
+		{lastSeq + 2, EventMessageCreate},
+		{lastSeq + 3, EventResumed},
+	}
+	for _, w := range want {
+		p := readPayload(t, ws2)
+		if p.Op != OpDispatch {
+			t.Fatalf("replayed op = %d, want %d", p.Op, OpDispatch)
+		}
+		if p.Sequence == nil || *p.Sequence != w.seq {
+			t.Errorf("replayed sequence = %v, want %d", p.Sequence, w.seq)
+		}
+		if p.Event == nil || *p.Event != w.event {
+			t.Errorf("replayed event = %v, want %q", p.Event, w.event)
+		}
+	}
+}
+
+func TestWSLifecycle_ResumeUnknownSessionIsInvalid(t *testing.T) {
+	tokens := auth.NewTokenService("test-secret")
+	m := NewManager(tokens, nil, &mockGuildRepo{}, nil, newTestRedis(t))
+	srv := setupWSServer(t, m)
 
 	token, err := tokens.GenerateAccessToken(42)
 	if err != nil {
 		t.Fatalf("generate token: %v", err)
 	}
 
-	// Send RESUME with sequence 1 → should replay events with seq > 1 (events 2 and 3).
-	resumeData := mustMarshal(ResumeData{
+	ws := dialWS(t, srv)
+	readPayload(t, ws) // HELLO
+	sendPayload(t, ws, OpResume, ResumeData{
 		Token:     token,
-		SessionID: "old-session",
+		SessionID: "unknown-session",
 		Sequence:  1,
 	})
-	sendPayload(t, ws, GatewayPayload{Op: OpResume, Data: resumeData})
 
-	// Read replayed events.
-	var replayed []GatewayPayload
-	for i := 0; i < 2; i++ {
-		p := readPayload(t, ws)
-		replayed = append(replayed, p)
+	p := readPayload(t, ws)
+	if p.Op != OpInvalidSession {
+		t.Fatalf("op = %d, want %d (INVALID_SESSION)", p.Op, OpInvalidSession)
 	}
-
-	if len(replayed) != 2 {
-		t.Fatalf("replayed %d events, want 2", len(replayed))
+	var invalid InvalidSessionData
+	decodeData(t, p, &invalid)
+	if invalid.Resumable {
+		t.Error("an unknown session must not be resumable")
 	}
 
-	for _, p := range replayed {
-		if p.Op != OpDispatch {
-			t.Errorf("replayed event op = %d, want %d", p.Op, OpDispatch)
-		}
-		if p.Event == nil || *p.Event != EventMessageCreate {
-			t.Errorf("replayed event name = %v, want %q", p.Event, EventMessageCreate)
-		}
+	// The client can IDENTIFY on the same connection afterwards.
+	sendPayload(t, ws, OpIdentify, IdentifyData{Token: token})
+	p = readPayload(t, ws)
+	if p.Event == nil || *p.Event != EventReady {
+		t.Fatalf("event = %v, want %q", p.Event, EventReady)
+	}
+	if p.Sequence == nil || *p.Sequence != 1 {
+		t.Errorf("READY sequence = %v, want 1", p.Sequence)
 	}
 }
 
@@ -0,0 +1,121 @@
+package gateway
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/victorivanov/retrocast/internal/models"
+)
+
+const (
+	// memberChunkSize is the most members sent in one GUILD_MEMBERS_CHUNK.
+	memberChunkSize = 1000
+	// maxMemberRequest bounds both the limit of a query and the number of
+	// user IDs in one REQUEST_GUILD_MEMBERS.
+	maxMemberRequest = 100
+	// maxNonceLength bounds the nonce echoed back in every chunk.
+	maxNonceLength = 32
+)
+
+// handleRequestGuildMembers answers a REQUEST_GUILD_MEMBERS with one or more
+// GUILD_MEMBERS_CHUNK dispatches. Requests for guilds the user isn't in or
+// outside the limits are ignored.
+func (m *Manager) handleRequestGuildMembers(c *Connection, data []byte) {
+	if m.state.Members == nil {
+		return
+	}
+
+	var req RequestGuildMembersData
+	if err := c.unmarshal(data, &req); err != nil {
+		return
+	}
+	if len(req.Nonce) > maxNonceLength || len(req.UserIDs) > maxMemberRequest ||
+		req.Limit < 0 || req.Limit > maxMemberRequest {
+		return
+	}
+	if (req.Query == nil) == (len(req.UserIDs) == 0) {
+		return // exactly one of query and user_ids
+	}
+
+	// An unbounded query takes the members intent; presences are left out
+	// without the presences intent.
+	intents := c.log.intents
+	if req.Query != nil && req.Limit == 0 && !intents.allows(EventGuildMemberAdd) {
+		return
+	}
+	withPresences := req.Presences && intents.allows(EventPresenceUpdate)
+
+	m.mu.RLock()
+	member := m.subscriptions[req.GuildID][c.UserID]
+	m.mu.RUnlock()
+	if !member {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var members []models.MemberWithUser
+	var err error
+	if req.Query != nil {
+		members, err = m.state.Members.SearchByUsername(ctx, req.GuildID, *req.Query, req.Limit)
+	} else {
+		members, err = m.state.Members.GetByUserIDs(ctx, req.GuildID, req.UserIDs)
+	}
+	if err != nil {
+		slog.Error("failed to get guild members", "guildID", req.GuildID, "userID", c.UserID, "error", err)
+		return
+	}
+
+	var notFound []int64
+	if len(req.UserIDs) > 0 {
+		found := make(map[int64]bool, len(members))
+		for _, mem := range members {
+			found[mem.UserID] = true
+		}
+		for _, id := range req.UserIDs {
+			if !found[id] {
+				notFound = append(notFound, id)
+			}
+		}
+	}
+
+	var presences map[int64]models.Presence
+	if withPresences && len(members) > 0 {
+		userIDs := make([]int64, len(members))
+		for i, mem := range members {
+			userIDs[i] = mem.UserID
+		}
+		if presences, err = loadPresences(ctx, m.redis, userIDs); err != nil {
+			slog.Error("failed to get presences", "guildID", req.GuildID, "error", err)
+			withPresences = false
+		}
+	}
+
+	chunkCount := max(1, (len(members)+memberChunkSize-1)/memberChunkSize)
+	for i := 0; i < chunkCount; i++ {
+		chunk := GuildMembersChunkData{
+			GuildID:    req.GuildID,
+			Members:    members[min(i*memberChunkSize, len(members)):min((i+1)*memberChunkSize, len(members))],
+			ChunkIndex: i,
+			ChunkCount: chunkCount,
+			Nonce:      req.Nonce,
+		}
+		if chunk.Members == nil {
+			chunk.Members = []models.MemberWithUser{}
+		}
+		if i == 0 {
+			chunk.NotFound = notFound
+		}
+		if withPresences {
+			chunk.Presences = []PresenceUpdateData{}
+			for _, mem := range chunk.Members {
+				if p, ok := presences[mem.UserID]; ok {
+					chunk.Presences = append(chunk.Presences, presenceUpdate(mem.UserID, p))
+				}
+			}
+		}
+		c.SendEvent(EventGuildMembersChunk, chunk)
+	}
+}
@@ -0,0 +1,188 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/victorivanov/retrocast/internal/database"
+	"github.com/victorivanov/retrocast/internal/models"
+)
+
+// mockMemberSearch serves REQUEST_GUILD_MEMBERS from a fixed member list.
+type mockMemberSearch struct {
+	database.MemberRepository
+	members []models.MemberWithUser
+
+	prefix string
+	limit  int
+}
+
+func (f *mockMemberSearch) SearchByUsername(_ context.Context, _ int64, prefix string, limit int) ([]models.MemberWithUser, error) {
+	f.prefix, f.limit = prefix, limit
+	if limit > 0 && limit < len(f.members) {
+		return f.members[:limit], nil
+	}
+	return f.members, nil
+}
+
+func (f *mockMemberSearch) GetByUserIDs(_ context.Context, _ int64, userIDs []int64) ([]models.MemberWithUser, error) {
+	var found []models.MemberWithUser
+	for _, mem := range f.members {
+		for _, id := range userIDs {
+			if mem.UserID == id {
+				found = append(found, mem)
+			}
+		}
+	}
+	return found, nil
+}
+
+func newMemberSearch(n int) *mockMemberSearch {
+	f := &mockMemberSearch{}
+	for i := 1; i <= n; i++ {
+		id := int64(i)
+		f.members = append(f.members, models.MemberWithUser{
+			Member: models.Member{GuildID: 1, UserID: id},
+			User:   models.User{ID: id, Username: fmt.Sprintf("user%d", id)},
+		})
+	}
+	return f
+}
+
+// requestMembers sends a REQUEST_GUILD_MEMBERS on c and returns the chunks
+// it was answered with.
+func requestMembers(t *testing.T, m *Manager, c *Connection, req RequestGuildMembersData) []GuildMembersChunkData {
+	t.Helper()
+	raw, err := c.marshal(req)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	m.handleRequestGuildMembers(c, raw)
+
+	var chunks []GuildMembersChunkData
+	for _, p := range drainEvents(c) {
+		if p.Event == nil || *p.Event != EventGuildMembersChunk {
+			t.Fatalf("event = %v, want %q", p.Event, EventGuildMembersChunk)
+		}
+		var chunk GuildMembersChunkData
+		decodeData(t, p, &chunk)
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+func TestRequestGuildMembers_ChunksUnboundedQuery(t *testing.T) {
+	m := newTestManager(t, &mockGuildRepo{})
+	search := newMemberSearch(2500)
+	m.SetStateRepositories(StateRepositories{Members: search})
+
+	c := fakeConn(m, 1, "s1")
+	defer func() { _ = c.Conn.Close() }()
+	m.subscribe(1, 1)
+
+	query := ""
+	chunks := requestMembers(t, m, c, RequestGuildMembersData{GuildID: 1, Query: &query, Nonce: "abc"})
+
+	if len(chunks) != 3 {
+		t.Fatalf("received %d chunks, want 3", len(chunks))
+	}
+	for i, chunk := range chunks {
+		want := memberChunkSize
+		if i == 2 {
+			want = 500
+		}
+		if len(chunk.Members) != want {
+			t.Errorf("chunk %d has %d members, want %d", i, len(chunk.Members), want)
+		}
+		if chunk.ChunkIndex != i || chunk.ChunkCount != 3 || chunk.Nonce != "abc" || chunk.GuildID != 1 {
+			t.Errorf("chunk %d = index %d of %d, nonce %q, guild %d", i, chunk.ChunkIndex, chunk.ChunkCount, chunk.Nonce, chunk.GuildID)
+		}
+		if chunk.Presences != nil {
+			t.Errorf("chunk %d has presences without asking for them", i)
+		}
+	}
+	if got := chunks[2].Members[499].User.Username; got != "user2500" {
+		t.Errorf("last member = %q, want user2500", got)
+	}
+}
+
+func TestRequestGuildMembers_ByUserIDsWithPresences(t *testing.T) {
+	m := newTestManager(t, &mockGuildRepo{})
+	m.SetStateRepositories(StateRepositories{Members: newMemberSearch(3)})
+	if err := m.redis.SetPresence(context.Background(), 2, "dnd"); err != nil {
+		t.Fatalf("set presence: %v", err)
+	}
+
+	c := fakeConn(m, 1, "s1")
+	defer func() { _ = c.Conn.Close() }()
+	m.subscribe(1, 1)
+
+	chunks := requestMembers(t, m, c, RequestGuildMembersData{GuildID: 1, UserIDs: []int64{2, 3, 99}, Presences: true})
+
+	if len(chunks) != 1 {
+		t.Fatalf("received %d chunks, want 1", len(chunks))
+	}
+	chunk := chunks[0]
+	if len(chunk.Members) != 2 {
+		t.Errorf("members = %d, want 2", len(chunk.Members))
+	}
+	if len(chunk.NotFound) != 1 || chunk.NotFound[0] != 99 {
+		t.Errorf("not_found = %v, want [99]", chunk.NotFound)
+	}
+	if len(chunk.Presences) != 1 || chunk.Presences[0].UserID != 2 || chunk.Presences[0].Status != "dnd" {
+		t.Errorf("presences = %+v, want user 2 dnd", chunk.Presences)
+	}
+}
+
+func TestRequestGuildMembers_EmptyResultIsOneChunk(t *testing.T) {
+	m := newTestManager(t, &mockGuildRepo{})
+	search := newMemberSearch(0)
+	m.SetStateRepositories(StateRepositories{Members: search})
+
+	c := fakeConn(m, 1, "s1")
+	defer func() { _ = c.Conn.Close() }()
+	m.subscribe(1, 1)
+
+	query := "zed"
+	chunks := requestMembers(t, m, c, RequestGuildMembersData{GuildID: 1, Query: &query, Limit: 10})
+
+	if len(chunks) != 1 || chunks[0].ChunkCount != 1 || chunks[0].Members == nil {
+		t.Fatalf("chunks = %+v, want one empty chunk", chunks)
+	}
+	if search.prefix != "zed" || search.limit != 10 {
+		t.Errorf("searched %q with limit %d, want %q with limit 10", search.prefix, search.limit, "zed")
+	}
+}
+
+func TestRequestGuildMembers_IgnoredRequests(t *testing.T) {
+	m := newTestManager(t, &mockGuildRepo{})
+	m.SetStateRepositories(StateRepositories{Members: newMemberSearch(3)})
+
+	c := fakeConn(m, 1, "s1")
+	defer func() { _ = c.Conn.Close() }()
+	m.subscribe(1, 1)
+
+	bot := &Connection{UserID: 1, SessionID: "bot", encoding: testEncoding, Send: make(chan []byte, 16)}
+	m.register(bot, IntentsDefault)
+
+	query := ""
+	tooMany := make([]int64, maxMemberRequest+1)
+	tests := []struct {
+		name string
+		conn *Connection
+		req  RequestGuildMembersData
+	}{
+		{"guild the user isn't in", c, RequestGuildMembersData{GuildID: 2, Query: &query, Limit: 10}},
+		{"neither query nor user_ids", c, RequestGuildMembersData{GuildID: 1, Limit: 10}},
+		{"both query and user_ids", c, RequestGuildMembersData{GuildID: 1, Query: &query, UserIDs: []int64{2}}},
+		{"limit too large", c, RequestGuildMembersData{GuildID: 1, Query: &query, Limit: maxMemberRequest + 1}},
+		{"too many user_ids", c, RequestGuildMembersData{GuildID: 1, UserIDs: tooMany}},
+		{"unbounded without members intent", bot, RequestGuildMembersData{GuildID: 1, Query: &query}},
+	}
+	for _, tt := range tests {
+		if chunks := requestMembers(t, m, tt.conn, tt.req); len(chunks) != 0 {
+			t.Errorf("%s: received %d chunks, want none", tt.name, len(chunks))
+		}
+	}
+}
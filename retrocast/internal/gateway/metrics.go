@@ -0,0 +1,87 @@
+package gateway
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	metricDroppedFrames = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "retrocast",
+		Subsystem: "gateway",
+		Name:      "dropped_frames_total",
+		Help:      "Outbound frames dropped because a connection's send queue was full or it was falling behind.",
+	})
+	metricSlowConsumerCloses = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "retrocast",
+		Subsystem: "gateway",
+		Name:      "slow_consumer_closes_total",
+		Help:      "Connections closed with CloseSlowConsumer.",
+	})
+)
+
+// frameBuckets are the upper bounds, in frames, of the per-connection
+// histograms. A connection never has more than sendBufferSize queued.
+var frameBuckets = []float64{0, 1, 4, 16, 64, 128, 192, sendBufferSize}
+
+// Collector reports the state of the Manager's live connections at scrape
+// time: how many there are, and histograms of their send queue depths and
+// of the frames each has dropped. Register it once per Manager.
+type Collector struct {
+	m *Manager
+
+	connections *prometheus.Desc
+	queueDepth  *prometheus.Desc
+	dropped     *prometheus.Desc
+}
+
+// NewCollector creates a Collector for m.
+func NewCollector(m *Manager) *Collector {
+	return &Collector{
+		m: m,
+		connections: prometheus.NewDesc("retrocast_gateway_connections",
+			"Open gateway connections on this node.", nil, nil),
+		queueDepth: prometheus.NewDesc("retrocast_gateway_send_queue_depth",
+			"Frames waiting in each connection's send queue.", nil, nil),
+		dropped: prometheus.NewDesc("retrocast_gateway_connection_dropped_frames",
+			"Frames dropped by each open connection so far.", nil, nil),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (col *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- col.connections
+	ch <- col.queueDepth
+	ch <- col.dropped
+}
+
+// Collect implements prometheus.Collector.
+func (col *Collector) Collect(ch chan<- prometheus.Metric) {
+	col.m.mu.RLock()
+	depths := make([]float64, 0, len(col.m.sessions))
+	dropped := make([]float64, 0, len(col.m.sessions))
+	for _, c := range col.m.sessions {
+		depths = append(depths, float64(len(c.Send)))
+		dropped = append(dropped, float64(c.dropped.Load()))
+	}
+	col.m.mu.RUnlock()
+
+	ch <- prometheus.MustNewConstMetric(col.connections, prometheus.GaugeValue, float64(len(depths)))
+	ch <- constHistogram(col.queueDepth, depths)
+	ch <- constHistogram(col.dropped, dropped)
+}
+
+// constHistogram buckets observations into a histogram over frameBuckets.
+func constHistogram(desc *prometheus.Desc, observations []float64) prometheus.Metric {
+	buckets := make(map[float64]uint64, len(frameBuckets))
+	var sum float64
+	for _, v := range observations {
+		sum += v
+		for _, bound := range frameBuckets {
+			if v <= bound {
+				buckets[bound]++
+			}
+		}
+	}
+	return prometheus.MustNewConstHistogram(desc, uint64(len(observations)), sum, buckets)
+}
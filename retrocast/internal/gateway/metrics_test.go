@@ -0,0 +1,188 @@
+package gateway
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// wsPair returns both ends of a WebSocket connection.
+func wsPair(t *testing.T) (server, client *websocket.Conn) {
+	t.Helper()
+	conns := make(chan *websocket.Conn, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		up := websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }}
+		ws, err := up.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		conns <- ws
+	}))
+	t.Cleanup(srv.Close)
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	server = <-conns
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = server.Close()
+	})
+	return server, client
+}
+
+// slowConn returns a connection with a send queue of the given size attached
+// to a fresh session, and the client end of its WebSocket.
+func slowConn(t *testing.T, queue int) (*Connection, *sessionLog, *websocket.Conn) {
+	t.Helper()
+	server, client := wsPair(t)
+	c := &Connection{
+		UserID:    1,
+		SessionID: "slow",
+		Conn:      server,
+		Send:      make(chan []byte, queue),
+		encoding:  testEncoding,
+		done:      make(chan struct{}),
+		slow:      make(chan struct{}),
+	}
+	c.lastHeartbeat.Store(time.Now().UnixMilli())
+	log := newSessionLog(IntentsAll)
+	log.attach(c, 0)
+	return c, log, client
+}
+
+// readCloseCode reads from ws until the server closes it and returns the
+// close code, counting the dispatches received before.
+func readCloseCode(t *testing.T, ws *websocket.Conn) (code int, dispatches int) {
+	t.Helper()
+	for {
+		_ = ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, msg, err := ws.ReadMessage()
+		if err != nil {
+			var closeErr *websocket.CloseError
+			if !errors.As(err, &closeErr) {
+				t.Fatalf("read: %v", err)
+			}
+			return closeErr.Code, dispatches
+		}
+		if p, err := decodeFrame(msg); err == nil && p.Op == OpDispatch {
+			dispatches++
+		}
+	}
+}
+
+func TestBackpressure_LaggingConnectionClosesOnceDrained(t *testing.T) {
+	c, log, client := slowConn(t, 4)
+	dropsBefore := testutil.ToFloat64(metricDroppedFrames)
+	closesBefore := testutil.ToFloat64(metricSlowConsumerCloses)
+
+	ev, _ := newEventData("msg")
+	for i := 0; i < 6; i++ {
+		log.dispatch(EventMessageCreate, ev)
+	}
+	if !c.lagging.Load() || c.dropped.Load() != 2 {
+		t.Fatalf("lagging = %v, dropped = %d; want lagging with 2 dropped", c.lagging.Load(), c.dropped.Load())
+	}
+
+	// Heartbeat ACKs still go out while the queue has room; dispatches don't.
+	<-c.Send
+	c.SendOp(OpHeartbeatAck, nil)
+	log.dispatch(EventMessageCreate, ev)
+	if got := c.dropped.Load(); got != 3 {
+		t.Errorf("dropped = %d after another dispatch, want 3", got)
+	}
+
+	go c.writePump()
+
+	code, dispatches := readCloseCode(t, client)
+	if code != CloseSlowConsumer {
+		t.Errorf("close code = %d, want %d", code, CloseSlowConsumer)
+	}
+	if dispatches != 3 {
+		t.Errorf("received %d dispatches before closing, want the 3 still queued", dispatches)
+	}
+	if got := testutil.ToFloat64(metricDroppedFrames) - dropsBefore; got != 3 {
+		t.Errorf("dropped frames metric grew by %v, want 3", got)
+	}
+	if got := testutil.ToFloat64(metricSlowConsumerCloses) - closesBefore; got != 1 {
+		t.Errorf("slow consumer closes metric grew by %v, want 1", got)
+	}
+
+	// Everything is still in the session log for RESUME.
+	if got := len(log.events.since(0)); got != 7 {
+		t.Errorf("session log holds %d events, want 7", got)
+	}
+}
+
+func TestBackpressure_ClosesAfterMaxDroppedFrames(t *testing.T) {
+	c, log, client := slowConn(t, 1)
+
+	ev, _ := newEventData("msg")
+	for i := 0; i < maxDroppedFrames+2; i++ {
+		log.dispatch(EventMessageCreate, ev)
+	}
+
+	if got := c.dropped.Load(); got != maxDroppedFrames+1 {
+		t.Errorf("dropped = %d, want %d", got, maxDroppedFrames+1)
+	}
+
+	// Dispatching only marks the connection; its writes are left to
+	// writePump, outside the session log's lock.
+	select {
+	case <-c.done:
+		t.Fatal("connection closed from the dispatching goroutine")
+	default:
+	}
+
+	go c.writePump()
+	code, _ := readCloseCode(t, client)
+	if code != CloseSlowConsumer {
+		t.Errorf("close code = %d, want %d", code, CloseSlowConsumer)
+	}
+}
+
+func TestCollector_ReportsConnections(t *testing.T) {
+	m := newTestManager(t, &mockGuildRepo{})
+	c1 := fakeConn(m, 1, "s1")
+	c2 := fakeConn(m, 2, "s2")
+	defer func() { _ = c1.Conn.Close() }()
+	defer func() { _ = c2.Conn.Close() }()
+
+	for i := 0; i < 3; i++ {
+		c1.SendOp(OpHeartbeatAck, nil)
+	}
+	c2.dropped.Store(5)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(NewCollector(m))
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+
+	got := make(map[string]*dto.Metric)
+	for _, f := range families {
+		got[f.GetName()] = f.GetMetric()[0]
+	}
+	if v := got["retrocast_gateway_connections"].GetGauge().GetValue(); v != 2 {
+		t.Errorf("connections = %v, want 2", v)
+	}
+	for name, want := range map[string]float64{
+		"retrocast_gateway_send_queue_depth":          3,
+		"retrocast_gateway_connection_dropped_frames": 5,
+	} {
+		h := got[name].GetHistogram()
+		if h.GetSampleCount() != 2 || h.GetSampleSum() != want {
+			t.Errorf("%s: count = %d, sum = %v; want 2 and %v", name, h.GetSampleCount(), h.GetSampleSum(), want)
+		}
+	}
+}
@@ -2,8 +2,11 @@ package gateway
 
 import (
 	"context"
+	"encoding/json"
+	"log/slog"
 	"time"
 
+	"github.com/victorivanov/retrocast/internal/models"
 	"github.com/victorivanov/retrocast/internal/redis"
 )
 
@@ -29,6 +32,12 @@ func (ps *PresenceService) GetStatus(userID int64) string {
 	return status
 }
 
+// GetStatuses returns the current status of each of the given users that has
+// one, in a single Redis round trip.
+func (ps *PresenceService) GetStatuses(ctx context.Context, userIDs []int64) (map[int64]string, error) {
+	return ps.redis.GetPresences(ctx, userIDs)
+}
+
 // SetOnline marks a user as online.
 func (ps *PresenceService) SetOnline(userID int64) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
@@ -42,3 +51,194 @@ func (ps *PresenceService) SetOffline(userID int64) error {
 	defer cancel()
 	return ps.redis.DeletePresence(ctx, userID)
 }
+
+// GetPresences returns the presence of each of the given users that has
+// one.
+func (ps *PresenceService) GetPresences(ctx context.Context, userIDs []int64) (map[int64]models.Presence, error) {
+	return loadPresences(ctx, ps.redis, userIDs)
+}
+
+// Limits of the custom status and activities of a presence update.
+const (
+	maxActivities              = 5
+	maxActivityNameLength      = 128
+	maxCustomStatusLength      = 128
+	maxCustomStatusEmojiLength = 64
+)
+
+// presenceDetails is what a presence carries besides its status, stored as
+// JSON next to the status in Redis.
+type presenceDetails struct {
+	CustomStatus *models.CustomStatus `json:"custom_status,omitempty"`
+	Activities   []models.Activity    `json:"activities,omitempty"`
+}
+
+// clientPresence validates a client presence update and returns the
+// presence it sets. Invisible users are stored and broadcast as offline,
+// without a custom status or activities.
+func clientPresence(update ClientPresenceUpdate, now time.Time) (models.Presence, bool) {
+	switch update.Status {
+	case "online", "idle", "dnd":
+	case "invisible":
+		return models.Presence{Status: "offline"}, true
+	default:
+		return models.Presence{}, false
+	}
+
+	if cs := update.CustomStatus; cs != nil {
+		if cs.Text == "" && cs.Emoji == nil {
+			return models.Presence{}, false
+		}
+		if len(cs.Text) > maxCustomStatusLength || cs.Expired(now) {
+			return models.Presence{}, false
+		}
+		if cs.Emoji != nil && (*cs.Emoji == "" || len(*cs.Emoji) > maxCustomStatusEmojiLength) {
+			return models.Presence{}, false
+		}
+	}
+	if len(update.Activities) > maxActivities {
+		return models.Presence{}, false
+	}
+	for _, a := range update.Activities {
+		switch a.Type {
+		case models.ActivityPlaying, models.ActivityListening, models.ActivityWatching, models.ActivityCustom:
+		default:
+			return models.Presence{}, false
+		}
+		if a.Name == "" || len(a.Name) > maxActivityNameLength {
+			return models.Presence{}, false
+		}
+	}
+
+	return models.Presence{
+		Status:       update.Status,
+		CustomStatus: update.CustomStatus,
+		Activities:   update.Activities,
+	}, true
+}
+
+// storePresence saves a presence's status and details.
+func storePresence(ctx context.Context, rdb *redis.Client, userID int64, p models.Presence) error {
+	if err := rdb.SetPresence(ctx, userID, p.Status); err != nil {
+		return err
+	}
+	var details []byte
+	if p.CustomStatus != nil || len(p.Activities) > 0 {
+		var err error
+		if details, err = json.Marshal(presenceDetails{CustomStatus: p.CustomStatus, Activities: p.Activities}); err != nil {
+			return err
+		}
+	}
+	return rdb.SetPresenceDetails(ctx, userID, details)
+}
+
+// loadPresences returns the presence of each of the given users that has a
+// status. Custom statuses past their expiry are left out.
+func loadPresences(ctx context.Context, rdb *redis.Client, userIDs []int64) (map[int64]models.Presence, error) {
+	statuses, err := rdb.GetPresences(ctx, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	withStatus := make([]int64, 0, len(statuses))
+	for _, id := range userIDs {
+		if _, ok := statuses[id]; ok {
+			withStatus = append(withStatus, id)
+		}
+	}
+	details, err := rdb.GetPresenceDetails(ctx, withStatus)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	presences := make(map[int64]models.Presence, len(statuses))
+	for id, status := range statuses {
+		p := models.Presence{Status: status}
+		if raw, ok := details[id]; ok && status != "offline" {
+			var d presenceDetails
+			if err := json.Unmarshal(raw, &d); err != nil {
+				return nil, err
+			}
+			if d.CustomStatus != nil && !d.CustomStatus.Expired(now) {
+				p.CustomStatus = d.CustomStatus
+			}
+			p.Activities = d.Activities
+		}
+		presences[id] = p
+	}
+	return presences, nil
+}
+
+// scheduleCustomStatusExpiry arranges for a user's just-stored custom status
+// to be cleared once it expires. The timer of the status it replaced, if
+// any, is stopped: each user has at most one pending expiry.
+func (m *Manager) scheduleCustomStatusExpiry(userID int64, cs *models.CustomStatus) {
+	m.presenceMu.Lock()
+	defer m.presenceMu.Unlock()
+
+	if t, ok := m.statusExpiries[userID]; ok {
+		t.Stop()
+		delete(m.statusExpiries, userID)
+	}
+	if cs == nil || cs.ExpiresAt == nil {
+		return
+	}
+
+	expiresAt := *cs.ExpiresAt
+	var t *time.Timer
+	t = time.AfterFunc(time.Until(expiresAt), func() {
+		m.presenceMu.Lock()
+		current := m.statusExpiries[userID] == t
+		if current {
+			delete(m.statusExpiries, userID)
+		}
+		m.presenceMu.Unlock()
+		if current {
+			m.expireCustomStatus(userID, expiresAt)
+		}
+	})
+	m.statusExpiries[userID] = t
+}
+
+// expireCustomStatus clears a user's custom status if it is still the one
+// expiring at expiresAt and no newer update is waiting to be stored.
+func (m *Manager) expireCustomStatus(userID int64, expiresAt time.Time) {
+	m.presenceMu.Lock()
+	_, pending := m.pendingPresences[userID]
+	m.presenceMu.Unlock()
+	if pending {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	status, err := m.redis.GetPresence(ctx, userID)
+	if err != nil {
+		slog.Error("failed to get presence", "userID", userID, "error", err)
+		return
+	}
+	details, err := m.redis.GetPresenceDetails(ctx, []int64{userID})
+	if err != nil {
+		slog.Error("failed to get presence details", "userID", userID, "error", err)
+		return
+	}
+	var d presenceDetails
+	if status == "" || json.Unmarshal(details[userID], &d) != nil {
+		return
+	}
+	if d.CustomStatus == nil || d.CustomStatus.ExpiresAt == nil || !d.CustomStatus.ExpiresAt.Equal(expiresAt) {
+		return // replaced or cleared since
+	}
+	m.queuePresence(userID, models.Presence{Status: status, Activities: d.Activities})
+}
+
+// presenceUpdate builds the PRESENCE_UPDATE payload of a user's presence.
+func presenceUpdate(userID int64, p models.Presence) PresenceUpdateData {
+	return PresenceUpdateData{
+		UserID:       userID,
+		Status:       p.Status,
+		CustomStatus: p.CustomStatus,
+		Activities:   p.Activities,
+	}
+}
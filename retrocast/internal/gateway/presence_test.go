@@ -0,0 +1,167 @@
+package gateway
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/victorivanov/retrocast/internal/models"
+)
+
+func TestClientPresence(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Hour)
+	emoji, empty := "🎮", ""
+	long := strings.Repeat("x", maxCustomStatusLength+1)
+
+	tests := []struct {
+		name   string
+		update ClientPresenceUpdate
+		valid  bool
+	}{
+		{"plain status", ClientPresenceUpdate{Status: "idle"}, true},
+		{"unknown status", ClientPresenceUpdate{Status: "away"}, false},
+		{"custom status", ClientPresenceUpdate{Status: "online", CustomStatus: &models.CustomStatus{Text: "hi", Emoji: &emoji, ExpiresAt: &future}}, true},
+		{"emoji only", ClientPresenceUpdate{Status: "online", CustomStatus: &models.CustomStatus{Emoji: &emoji}}, true},
+		{"empty custom status", ClientPresenceUpdate{Status: "online", CustomStatus: &models.CustomStatus{}}, false},
+		{"empty emoji", ClientPresenceUpdate{Status: "online", CustomStatus: &models.CustomStatus{Text: "hi", Emoji: &empty}}, false},
+		{"custom status too long", ClientPresenceUpdate{Status: "online", CustomStatus: &models.CustomStatus{Text: long}}, false},
+		{"already expired", ClientPresenceUpdate{Status: "online", CustomStatus: &models.CustomStatus{Text: "hi", ExpiresAt: &past}}, false},
+		{"activities", ClientPresenceUpdate{Status: "dnd", Activities: []models.Activity{{Type: models.ActivityPlaying, Name: "chess"}, {Type: models.ActivityWatching, Name: "tv"}}}, true},
+		{"unknown activity type", ClientPresenceUpdate{Status: "dnd", Activities: []models.Activity{{Type: 1, Name: "stream"}}}, false},
+		{"unnamed activity", ClientPresenceUpdate{Status: "dnd", Activities: []models.Activity{{Type: models.ActivityCustom}}}, false},
+		{"too many activities", ClientPresenceUpdate{Status: "dnd", Activities: make([]models.Activity, maxActivities+1)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := clientPresence(tt.update, now); ok != tt.valid {
+				t.Errorf("valid = %v, want %v", ok, tt.valid)
+			}
+		})
+	}
+
+	// Invisible users show nothing but offline.
+	p, ok := clientPresence(ClientPresenceUpdate{
+		Status:       "invisible",
+		CustomStatus: &models.CustomStatus{Text: "hidden"},
+		Activities:   []models.Activity{{Type: models.ActivityPlaying, Name: "chess"}},
+	}, now)
+	if !ok || p.Status != "offline" || p.CustomStatus != nil || p.Activities != nil {
+		t.Errorf("invisible presence = %+v, want a bare offline", p)
+	}
+}
+
+func TestLoadPresences_LeavesOutExpiredAndOfflineDetails(t *testing.T) {
+	m := newTestManager(t, &mockGuildRepo{})
+	ctx := context.Background()
+	past := time.Now().Add(-time.Minute)
+	playing := []models.Activity{{Type: models.ActivityPlaying, Name: "chess"}}
+
+	for id, p := range map[int64]models.Presence{
+		1: {Status: "online", CustomStatus: &models.CustomStatus{Text: "stale", ExpiresAt: &past}, Activities: playing},
+		2: {Status: "offline", CustomStatus: &models.CustomStatus{Text: "hidden"}},
+	} {
+		if err := storePresence(ctx, m.redis, id, p); err != nil {
+			t.Fatalf("store presence: %v", err)
+		}
+	}
+
+	presences, err := loadPresences(ctx, m.redis, []int64{1, 2, 3})
+	if err != nil {
+		t.Fatalf("load presences: %v", err)
+	}
+	if len(presences) != 2 {
+		t.Fatalf("loaded %d presences, want 2", len(presences))
+	}
+	if p := presences[1]; p.CustomStatus != nil || len(p.Activities) != 1 {
+		t.Errorf("user 1 presence = %+v, want the activity without the expired custom status", p)
+	}
+	if p := presences[2]; p.Status != "offline" || p.CustomStatus != nil {
+		t.Errorf("user 2 presence = %+v, want a bare offline", p)
+	}
+}
+
+func TestPresenceUpdate_CustomStatusIsClearedOnExpiry(t *testing.T) {
+	m := newTestManager(t, &mockGuildRepo{})
+	m.presenceWindow = 10 * time.Millisecond
+
+	c := fakeConn(m, 1, "s1")
+	observer := fakeConn(m, 2, "s2")
+	defer func() { _ = c.Conn.Close() }()
+	defer func() { _ = observer.Conn.Close() }()
+	m.subscribe(1, 1)
+	m.subscribe(2, 1)
+
+	expiresAt := time.Now().Add(300 * time.Millisecond)
+	raw, err := c.marshal(ClientPresenceUpdate{
+		Status:       "online",
+		CustomStatus: &models.CustomStatus{Text: "back soon", ExpiresAt: &expiresAt},
+		Activities:   []models.Activity{{Type: models.ActivityListening, Name: "podcast"}},
+	})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	m.handlePresenceUpdate(c, raw)
+
+	var got []PresenceUpdateData
+	deadline := time.Now().Add(2 * time.Second)
+	for len(got) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		for _, p := range drainEvents(observer) {
+			var presence PresenceUpdateData
+			decodeData(t, p, &presence)
+			got = append(got, presence)
+		}
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("received %d presence updates, want 2", len(got))
+	}
+	if got[0].CustomStatus == nil || got[0].CustomStatus.Text != "back soon" || len(got[0].Activities) != 1 {
+		t.Errorf("first update = %+v, want the custom status and activity", got[0])
+	}
+	if got[1].CustomStatus != nil || got[1].Status != "online" || len(got[1].Activities) != 1 {
+		t.Errorf("update on expiry = %+v, want online with the activity only", got[1])
+	}
+
+	details, err := m.redis.GetPresenceDetails(context.Background(), []int64{1})
+	if err != nil {
+		t.Fatalf("get presence details: %v", err)
+	}
+	if strings.Contains(string(details[1]), "back soon") {
+		t.Errorf("stored details %s still hold the expired custom status", details[1])
+	}
+}
+
+func TestScheduleCustomStatusExpiry_KeepsOneTimerPerUser(t *testing.T) {
+	m := newTestManager(t, &mockGuildRepo{})
+
+	first := time.Now().Add(time.Hour)
+	m.scheduleCustomStatusExpiry(1, &models.CustomStatus{Text: "first", ExpiresAt: &first})
+	m.presenceMu.Lock()
+	replaced := m.statusExpiries[1]
+	m.presenceMu.Unlock()
+
+	second := time.Now().Add(2 * time.Hour)
+	m.scheduleCustomStatusExpiry(1, &models.CustomStatus{Text: "second", ExpiresAt: &second})
+	if replaced.Stop() {
+		t.Error("timer of the replaced custom status was still running")
+	}
+
+	m.presenceMu.Lock()
+	n := len(m.statusExpiries)
+	m.presenceMu.Unlock()
+	if n != 1 {
+		t.Errorf("%d expiry timers, want 1", n)
+	}
+
+	// A status without an expiry cancels the pending one.
+	m.scheduleCustomStatusExpiry(1, &models.CustomStatus{Text: "forever"})
+	m.presenceMu.Lock()
+	_, pending := m.statusExpiries[1]
+	m.presenceMu.Unlock()
+	if pending {
+		t.Error("expiry timer left running after the custom status lost its expiry")
+	}
+}
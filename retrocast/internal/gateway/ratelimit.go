@@ -0,0 +1,122 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/victorivanov/retrocast/internal/models"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// inboundBurst payloads may be sent on a connection at once, refilled
+	// at one per inboundInterval: 120 a minute.
+	inboundBurst    = 120
+	inboundInterval = 500 * time.Millisecond
+
+	// IDENTIFYs allowed per identifyWindow, across the cluster, for one user
+	// and for one IP address.
+	identifyUserLimit = 10
+	identifyIPLimit   = 30
+	identifyWindow    = time.Minute
+
+	// defaultPresenceWindow is how long client presence updates are
+	// coalesced before the latest one is stored and broadcast.
+	defaultPresenceWindow = 500 * time.Millisecond
+)
+
+// opLimits are the token buckets of op codes that cost more to serve than
+// the connection-wide bucket allows for.
+var opLimits = map[int]struct {
+	burst    int
+	interval time.Duration
+}{
+	OpPresenceUpdate:      {burst: 10, interval: 2 * time.Second},
+	OpVoiceStateUpdate:    {burst: 10, interval: 2 * time.Second},
+	OpRequestGuildMembers: {burst: 10, interval: 6 * time.Second},
+}
+
+// inboundLimiter holds a connection's token buckets for client payloads.
+// It is only used from the connection's read pump.
+type inboundLimiter struct {
+	all *rate.Limiter
+	ops map[int]*rate.Limiter
+}
+
+func newInboundLimiter() *inboundLimiter {
+	l := &inboundLimiter{
+		all: rate.NewLimiter(rate.Every(inboundInterval), inboundBurst),
+		ops: make(map[int]*rate.Limiter, len(opLimits)),
+	}
+	for op, limit := range opLimits {
+		l.ops[op] = rate.NewLimiter(rate.Every(limit.interval), limit.burst)
+	}
+	return l
+}
+
+// allow takes a token for a payload with the given op code from the
+// connection-wide bucket and from the op's own bucket, if it has one.
+func (l *inboundLimiter) allow(op int) bool {
+	if !l.all.Allow() {
+		return false
+	}
+	if b, ok := l.ops[op]; ok {
+		return b.Allow()
+	}
+	return true
+}
+
+// identifyAllowed checks one of the IDENTIFY limits. They are kept in Redis
+// so they hold across the cluster; if Redis is unavailable the IDENTIFY is
+// allowed.
+func (m *Manager) identifyAllowed(ctx context.Context, key string, limit int) bool {
+	allowed, _, _, err := m.redis.CheckRateLimit(ctx, key, limit, identifyWindow)
+	if err != nil {
+		slog.Error("failed to check identify rate limit", "key", key, "error", err)
+		return true
+	}
+	return allowed
+}
+
+// identifyIPKey and identifyUserKey are the Redis keys of the IDENTIFY
+// limits.
+func identifyIPKey(ip string) string      { return "rl:gateway:identify:ip:" + ip }
+func identifyUserKey(userID int64) string { return fmt.Sprintf("rl:gateway:identify:user:%d", userID) }
+
+// queuePresence records a client presence update. Updates from the same
+// user within presenceWindow are coalesced: only the latest is stored and
+// broadcast, once the window ends.
+func (m *Manager) queuePresence(userID int64, presence models.Presence) {
+	m.presenceMu.Lock()
+	_, scheduled := m.pendingPresences[userID]
+	m.pendingPresences[userID] = presence
+	m.presenceMu.Unlock()
+
+	if !scheduled {
+		time.AfterFunc(m.presenceWindow, func() { m.flushPresence(userID) })
+	}
+}
+
+// flushPresence stores and broadcasts a user's latest queued presence and
+// reschedules the expiry of their custom status.
+func (m *Manager) flushPresence(userID int64) {
+	m.presenceMu.Lock()
+	presence, ok := m.pendingPresences[userID]
+	delete(m.pendingPresences, userID)
+	m.presenceMu.Unlock()
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := storePresence(ctx, m.redis, userID, presence); err != nil {
+		slog.Error("failed to update presence", "userID", userID, "error", err)
+		return
+	}
+	m.broadcastPresence(userID, presence)
+	m.scheduleCustomStatusExpiry(userID, presence.CustomStatus)
+}
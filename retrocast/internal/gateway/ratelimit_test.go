@@ -0,0 +1,128 @@
+package gateway
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/victorivanov/retrocast/internal/auth"
+)
+
+func TestInboundLimits_CloseFloodingConnection(t *testing.T) {
+	tokens := auth.NewTokenService("test-secret")
+	token, err := tokens.GenerateAccessToken(42)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+	m := NewManager(tokens, nil, &mockGuildRepo{}, nil, newTestRedis(t))
+	srv := setupWSServer(t, m)
+
+	tests := []struct {
+		name     string
+		identify bool
+		op       int
+		data     any
+		count    int
+	}{
+		{"heartbeats", false, OpHeartbeat, nil, inboundBurst + 1},
+		{"presence updates", true, OpPresenceUpdate, ClientPresenceUpdate{Status: "idle"}, opLimits[OpPresenceUpdate].burst + 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := dialWS(t, srv)
+			readPayload(t, ws) // HELLO
+			if tt.identify {
+				identify(t, ws, token)
+			}
+			for i := 0; i < tt.count; i++ {
+				sendPayload(t, ws, tt.op, tt.data)
+			}
+			if code, _ := readCloseCode(t, ws); code != CloseRateLimited {
+				t.Errorf("close code = %d, want %d", code, CloseRateLimited)
+			}
+		})
+	}
+}
+
+func TestIdentifyLimits(t *testing.T) {
+	tokens := auth.NewTokenService("test-secret")
+
+	tests := []struct {
+		name    string
+		allowed int
+		userID  func(i int) int64
+	}{
+		{"per user", identifyUserLimit, func(int) int64 { return 42 }},
+		{"per IP", identifyIPLimit, func(i int) int64 { return int64(i + 1) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewManager(tokens, nil, &mockGuildRepo{}, nil, newTestRedis(t))
+			srv := setupWSServer(t, m)
+
+			for i := 0; i <= tt.allowed; i++ {
+				token, err := tokens.GenerateAccessToken(tt.userID(i))
+				if err != nil {
+					t.Fatalf("generate token: %v", err)
+				}
+				ws := dialWS(t, srv)
+				readPayload(t, ws) // HELLO
+				if i < tt.allowed {
+					identify(t, ws, token)
+					continue
+				}
+
+				sendPayload(t, ws, OpIdentify, IdentifyData{Token: token})
+				p := readPayload(t, ws)
+				if p.Op != OpInvalidSession {
+					t.Fatalf("identify %d: op = %d, want %d (INVALID_SESSION)", i+1, p.Op, OpInvalidSession)
+				}
+			}
+		})
+	}
+}
+
+func TestPresenceUpdates_AreCoalesced(t *testing.T) {
+	m := newTestManager(t, &mockGuildRepo{})
+	m.presenceWindow = 20 * time.Millisecond
+
+	c := fakeConn(m, 1, "s1")
+	observer := fakeConn(m, 2, "s2")
+	defer func() { _ = c.Conn.Close() }()
+	defer func() { _ = observer.Conn.Close() }()
+	m.subscribe(1, 1)
+	m.subscribe(2, 1)
+
+	for _, status := range []string{"idle", "bogus", "dnd", "invisible"} {
+		raw, err := c.marshal(ClientPresenceUpdate{Status: status})
+		if err != nil {
+			t.Fatalf("marshal: %v", err)
+		}
+		m.handlePresenceUpdate(c, raw)
+	}
+
+	var got []PresenceUpdateData
+	deadline := time.Now().Add(2 * time.Second)
+	for len(got) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		for _, p := range drainEvents(observer) {
+			var presence PresenceUpdateData
+			decodeData(t, p, &presence)
+			got = append(got, presence)
+		}
+	}
+	// Nothing else may follow the coalesced update.
+	time.Sleep(4 * m.presenceWindow)
+	got = append(got, make([]PresenceUpdateData, len(drainEvents(observer)))...)
+
+	if len(got) != 1 || got[0].UserID != 1 || got[0].Status != "offline" {
+		t.Fatalf("presence updates = %+v, want one update to offline", got)
+	}
+	status, err := m.redis.GetPresence(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("get presence: %v", err)
+	}
+	if status != "offline" {
+		t.Errorf("stored presence = %q, want offline", status)
+	}
+}
@@ -17,21 +17,26 @@ var upgrader = websocket.Upgrader{
 }
 
 // HandleWebSocket handles GET /gateway by upgrading to WebSocket.
+// ?compress=zlib-stream compresses outbound payloads and ?encoding=msgpack
+// switches both directions from JSON to MessagePack.
 func (m *Manager) HandleWebSocket(c echo.Context) error {
+	opts, err := parseTransportOptions(c.QueryParams())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
 	ws, err := upgrader.Upgrade(c.Response(), c.Request(), nil)
 	if err != nil {
 		slog.Error("websocket upgrade error", "error", err)
 		return nil
 	}
 
-	conn := newConnection(ws, m)
+	conn := newConnection(ws, m, opts)
+	conn.ip = c.RealIP()
 
 	// Send HELLO with heartbeat interval.
-	conn.SendPayload(GatewayPayload{
-		Op: OpHello,
-		Data: mustMarshal(HelloData{
-			HeartbeatInterval: int(heartbeatInterval.Milliseconds()),
-		}),
+	conn.SendOp(OpHello, HelloData{
+		HeartbeatInterval: int(heartbeatInterval.Milliseconds()),
 	})
 
 	go conn.writePump()
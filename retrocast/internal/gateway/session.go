@@ -0,0 +1,225 @@
+package gateway
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// sessionLogSize is the number of outbound events kept per session for
+	// RESUME. It stays below sendBufferSize so a full replay fits into a
+	// fresh connection's send buffer.
+	sessionLogSize = 200
+
+	// defaultResumeWindow is how long a disconnected session stays
+	// resumable unless overridden with SetResumeWindow.
+	defaultResumeWindow = 2 * time.Minute
+)
+
+// Reasons a session can't be resumed.
+var (
+	errUnknownSession = errors.New("unknown session")
+	errInvalidSeq     = errors.New("invalid sequence number")
+	errSessionGap     = errors.New("events no longer buffered")
+)
+
+// sessionLog is the outbound event log of one gateway session. It owns the
+// session's sequence numbers, keeps recording events while the client is
+// disconnected and forwards them to the connection currently attached to the
+// session.
+type sessionLog struct {
+	mu         sync.Mutex
+	events     *ringBuffer
+	conn       *Connection // nil while no client is attached
+	detachedAt time.Time
+	intents    Intents // fixed at IDENTIFY
+
+	// channelViews caches whether the session's user may view a channel,
+	// as guildID → channelID → VIEW_CHANNEL, for DispatchToChannel.
+	channelViews map[int64]map[int64]bool
+}
+
+func newSessionLog(intents Intents) *sessionLog {
+	return &sessionLog{events: newRingBuffer(sessionLogSize), intents: intents}
+}
+
+// dispatch assigns the next sequence number to an event, records it and
+// sends it to the attached connection, if any. Events outside the session's
+// intents are dropped.
+func (l *sessionLog) dispatch(name string, data *eventData) {
+	if !l.intents.allows(name) {
+		return
+	}
+	l.record(name, data)
+}
+
+// dispatchDirect is dispatch for an event sent straight to the user, gated
+// by Intents.allowsDirect.
+func (l *sessionLog) dispatchDirect(name string, data *eventData) {
+	if !l.intents.allowsDirect(name) {
+		return
+	}
+	l.record(name, data)
+}
+
+// record assigns the next sequence number to an event, keeps it and sends it
+// to the attached connection, if any.
+func (l *sessionLog) record(name string, data *eventData) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	seq := l.events.add(Event{Name: name, Data: data})
+	if l.conn != nil {
+		l.conn.sendDispatch(seq, name, data)
+	}
+}
+
+// attach makes c the session's connection after replaying every event with
+// a sequence number greater than afterSeq. It attaches nothing and returns
+// errInvalidSeq if the session never reached afterSeq, or errSessionGap if
+// the events after it are no longer in the log.
+func (l *sessionLog) attach(c *Connection, afterSeq int64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if afterSeq < 0 || afterSeq > l.events.seq {
+		return errInvalidSeq
+	}
+	if !l.events.covers(afterSeq) {
+		return errSessionGap
+	}
+	for i, ev := range l.events.since(afterSeq) {
+		l.replay(c, afterSeq+int64(i)+1, ev)
+	}
+	l.conn = c
+	c.log = l
+	return nil
+}
+
+// replay re-sends a recorded event with its original sequence number.
+func (l *sessionLog) replay(c *Connection, seq int64, ev Event) {
+	data, _ := ev.Data.(*eventData)
+	c.sendDispatch(seq, ev.Name, data)
+}
+
+// detach marks the session as disconnected if c is still its connection.
+func (l *sessionLog) detach(c *Connection) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conn == c {
+		l.conn = nil
+		l.detachedAt = time.Now()
+	}
+}
+
+// expired reports whether the session has been disconnected for at least
+// window.
+func (l *sessionLog) expired(window time.Duration) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.conn == nil && !time.Now().Before(l.detachedAt.Add(window))
+}
+
+// channelView returns the cached VIEW_CHANNEL permission of the session's
+// user in a channel; ok is false if it isn't cached.
+func (l *sessionLog) channelView(guildID, channelID int64) (canView, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	canView, ok = l.channelViews[guildID][channelID]
+	return canView, ok
+}
+
+// cacheChannelView records the VIEW_CHANNEL permission of the session's user
+// in a channel.
+func (l *sessionLog) cacheChannelView(guildID, channelID int64, canView bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.channelViews == nil {
+		l.channelViews = make(map[int64]map[int64]bool)
+	}
+	if l.channelViews[guildID] == nil {
+		l.channelViews[guildID] = make(map[int64]bool)
+	}
+	l.channelViews[guildID][channelID] = canView
+}
+
+// forgetChannelViews drops the cached channel permissions for a guild.
+func (l *sessionLog) forgetChannelViews(guildID int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.channelViews, guildID)
+}
+
+// sequencedEvent pairs an event with its sequence number for replay.
+type sequencedEvent struct {
+	Sequence int64
+	Event
+}
+
+// ringBuffer is a fixed-size circular buffer for replay events.
+type ringBuffer struct {
+	events []sequencedEvent
+	size   int
+	pos    int
+	seq    int64
+	full   bool
+}
+
+func newRingBuffer(size int) *ringBuffer {
+	return &ringBuffer{
+		events: make([]sequencedEvent, size),
+		size:   size,
+	}
+}
+
+// add appends an event and returns the sequence number assigned to it.
+func (rb *ringBuffer) add(event Event) int64 {
+	rb.seq++
+	rb.events[rb.pos] = sequencedEvent{Sequence: rb.seq, Event: event}
+	rb.pos = (rb.pos + 1) % rb.size
+	if rb.pos == 0 {
+		rb.full = true
+	}
+	return rb.seq
+}
+
+// covers reports whether every event after afterSeq is still buffered, so
+// that a client which last saw afterSeq can be brought up to date.
+func (rb *ringBuffer) covers(afterSeq int64) bool {
+	if afterSeq < 0 || afterSeq > rb.seq {
+		return false
+	}
+	oldest := int64(1)
+	if rb.full {
+		oldest = rb.seq - int64(rb.size) + 1
+	}
+	return afterSeq >= oldest-1
+}
+
+// since returns all events with sequence > afterSeq.
+func (rb *ringBuffer) since(afterSeq int64) []Event {
+	var result []Event
+	count := rb.size
+	if !rb.full {
+		count = rb.pos
+	}
+
+	start := 0
+	if rb.full {
+		start = rb.pos
+	}
+
+	for i := 0; i < count; i++ {
+		idx := (start + i) % rb.size
+		if rb.events[idx].Sequence > afterSeq {
+			result = append(result, rb.events[idx].Event)
+		}
+	}
+	return result
+}
@@ -0,0 +1,171 @@
+package gateway
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/victorivanov/retrocast/internal/database"
+	"github.com/victorivanov/retrocast/internal/models"
+	"github.com/victorivanov/retrocast/internal/permissions"
+)
+
+// StateRepositories are what READY, GUILD_CREATE and GUILD_MEMBERS_CHUNK
+// payloads are built from. A nil repository leaves its part of the payloads
+// empty; without Members, REQUEST_GUILD_MEMBERS is ignored.
+type StateRepositories struct {
+	Channels    database.ChannelRepository
+	Roles       database.RoleRepository
+	Members     database.MemberRepository
+	VoiceStates database.VoiceStateRepository
+	DMChannels  database.DMChannelRepository
+}
+
+// SetStateRepositories sets the repositories used to load the state sent
+// in READY and GUILD_CREATE and to answer REQUEST_GUILD_MEMBERS. It must
+// be called before serving connections.
+func (m *Manager) SetStateRepositories(r StateRepositories) {
+	m.state = r
+}
+
+// JoinGuild subscribes a user who just joined a guild and sends each of
+// their sessions a GUILD_CREATE with the guild's state.
+func (m *Manager) JoinGuild(userID, guildID int64) {
+	m.joinGuild(userID, guildID)
+	m.publish(clusterMessage{Kind: clusterJoinGuild, UserID: userID, GuildID: guildID})
+}
+
+// joinGuild applies JoinGuild to the user's sessions on this node.
+func (m *Manager) joinGuild(userID, guildID int64) {
+	m.mu.RLock()
+	logs := m.userSessionLogsLocked(nil, userID)
+	m.mu.RUnlock()
+	if len(logs) == 0 {
+		return
+	}
+	m.subscribe(userID, guildID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	guild, err := m.guilds.GetByID(ctx, guildID)
+	if err != nil || guild == nil {
+		slog.Error("failed to get joined guild", "guildID", guildID, "error", err)
+		return
+	}
+
+	// Sessions without the presences intent get the state without them.
+	states := make(map[bool]*eventData, 2)
+	for _, l := range logs {
+		if !l.intents.allows(EventGuildCreate) {
+			continue
+		}
+		presences := l.intents.allows(EventPresenceUpdate)
+		data, ok := states[presences]
+		if !ok {
+			state, err := m.guildState(ctx, *guild, userID, presences)
+			if err != nil {
+				slog.Error("failed to load guild state", "guildID", guildID, "userID", userID, "error", err)
+				return
+			}
+			if data, err = newEventData(state); err != nil {
+				slog.Error("marshal event error", "event", EventGuildCreate, "error", err)
+				return
+			}
+			states[presences] = data
+		}
+		l.dispatch(EventGuildCreate, data)
+	}
+}
+
+// sendGuildCreate loads a guild's state and sends it to a newly identified
+// connection.
+func (m *Manager) sendGuildCreate(c *Connection, guild models.Guild, intents Intents) {
+	if !intents.allows(EventGuildCreate) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	state, err := m.guildState(ctx, guild, c.UserID, intents.allows(EventPresenceUpdate))
+	if err != nil {
+		// The client keeps the unavailable stub from READY.
+		slog.Error("failed to load guild state", "guildID", guild.ID, "userID", c.UserID, "error", err)
+		return
+	}
+	c.SendEvent(EventGuildCreate, state)
+}
+
+// guildState loads the GUILD_CREATE payload of a guild as seen by userID:
+// only the channels they may view, and the presences of online members
+// when withPresences is set.
+func (m *Manager) guildState(ctx context.Context, guild models.Guild, userID int64, withPresences bool) (*GuildCreateData, error) {
+	state := &GuildCreateData{
+		Guild:       guild,
+		Channels:    []models.Channel{},
+		Roles:       []models.Role{},
+		VoiceStates: []models.VoiceState{},
+		Presences:   []PresenceUpdateData{},
+	}
+
+	if m.state.Channels != nil {
+		channels, err := m.state.Channels.GetByGuildID(ctx, guild.ID)
+		if err != nil {
+			return nil, err
+		}
+		if m.channelPerms != nil {
+			channels, err = m.channelPerms.FilterChannels(ctx, guild.ID, userID, channels, permissions.PermViewChannel)
+			if err != nil {
+				return nil, err
+			}
+		}
+		state.Channels = append(state.Channels, channels...)
+	}
+
+	if m.state.Roles != nil {
+		roles, err := m.state.Roles.GetByGuildID(ctx, guild.ID)
+		if err != nil {
+			return nil, err
+		}
+		if roles != nil {
+			state.Roles = roles
+		}
+	}
+
+	if m.state.Members != nil {
+		member, err := m.state.Members.GetByGuildAndUser(ctx, guild.ID, userID)
+		if err != nil {
+			return nil, err
+		}
+		state.Member = member
+
+		if withPresences {
+			userIDs, err := m.state.Members.GetUserIDsByGuild(ctx, guild.ID)
+			if err != nil {
+				return nil, err
+			}
+			presences, err := loadPresences(ctx, m.redis, userIDs)
+			if err != nil {
+				return nil, err
+			}
+			for _, id := range userIDs {
+				if p, ok := presences[id]; ok && p.Status != "offline" {
+					state.Presences = append(state.Presences, presenceUpdate(id, p))
+				}
+			}
+		}
+	}
+
+	if m.state.VoiceStates != nil {
+		voiceStates, err := m.state.VoiceStates.GetByGuild(ctx, guild.ID)
+		if err != nil {
+			return nil, err
+		}
+		if voiceStates != nil {
+			state.VoiceStates = voiceStates
+		}
+	}
+
+	return state, nil
+}
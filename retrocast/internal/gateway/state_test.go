@@ -0,0 +1,210 @@
+package gateway
+
+import (
+	"context"
+	"testing"
+
+	"github.com/victorivanov/retrocast/internal/auth"
+	"github.com/victorivanov/retrocast/internal/database"
+	"github.com/victorivanov/retrocast/internal/models"
+	"github.com/victorivanov/retrocast/internal/permissions"
+)
+
+// The state mocks embed their repository interface; only the methods READY
+// and GUILD_CREATE use are implemented.
+
+type mockStateChannels struct{ database.ChannelRepository }
+
+func (mockStateChannels) GetByGuildID(_ context.Context, guildID int64) ([]models.Channel, error) {
+	return []models.Channel{
+		{ID: guildID*10 + 1, GuildID: guildID, Name: "general"},
+		{ID: guildID*10 + 2, GuildID: guildID, Name: "staff"},
+	}, nil
+}
+
+type mockStateRoles struct{ database.RoleRepository }
+
+func (mockStateRoles) GetByGuildID(_ context.Context, guildID int64) ([]models.Role, error) {
+	return []models.Role{{ID: guildID * 100, GuildID: guildID, Name: "@everyone", IsDefault: true}}, nil
+}
+
+type mockStateMembers struct{ database.MemberRepository }
+
+func (mockStateMembers) GetByGuildAndUser(_ context.Context, guildID, userID int64) (*models.Member, error) {
+	return &models.Member{GuildID: guildID, UserID: userID, Roles: []int64{guildID * 100}}, nil
+}
+
+func (mockStateMembers) GetUserIDsByGuild(context.Context, int64) ([]int64, error) {
+	return []int64{42, 43, 44, 45}, nil
+}
+
+type mockStateVoiceStates struct{ database.VoiceStateRepository }
+
+func (mockStateVoiceStates) GetByGuild(_ context.Context, guildID int64) ([]models.VoiceState, error) {
+	return []models.VoiceState{{GuildID: guildID, ChannelID: guildID*10 + 1, UserID: 43}}, nil
+}
+
+type mockStateDMChannels struct{ database.DMChannelRepository }
+
+func (mockStateDMChannels) GetByUserID(_ context.Context, userID int64) ([]models.DMChannel, error) {
+	return []models.DMChannel{{ID: 900, Type: models.DMTypeDM, Recipients: []models.User{{ID: userID}, {ID: 43}}}}, nil
+}
+
+// hiddenChannels implements ChannelPermissionFilter, denying VIEW_CHANNEL
+// in a fixed set of channels to everyone.
+type hiddenChannels map[int64]bool
+
+func (h hiddenChannels) FilterChannelPermission(_ context.Context, _, channelID int64, userIDs []int64, _ permissions.Permission) ([]int64, error) {
+	if h[channelID] {
+		return nil, nil
+	}
+	return userIDs, nil
+}
+
+func (h hiddenChannels) FilterChannels(_ context.Context, _, _ int64, channels []models.Channel, _ permissions.Permission) ([]models.Channel, error) {
+	var visible []models.Channel
+	for _, ch := range channels {
+		if !h[ch.ID] {
+			visible = append(visible, ch)
+		}
+	}
+	return visible, nil
+}
+
+func newStateManager(t *testing.T, guilds *mockGuildRepo) *Manager {
+	t.Helper()
+	users := &mockUserRepo{users: map[int64]*models.User{42: {ID: 42, Username: "alice"}}}
+	m := NewManager(auth.NewTokenService("test-secret"), users, guilds, nil, newTestRedis(t))
+	m.SetChannelPermissions(hiddenChannels{12: true})
+	m.SetStateRepositories(StateRepositories{
+		Channels:    mockStateChannels{},
+		Roles:       mockStateRoles{},
+		Members:     mockStateMembers{},
+		VoiceStates: mockStateVoiceStates{},
+		DMChannels:  mockStateDMChannels{},
+	})
+	return m
+}
+
+func TestWSLifecycle_ReadyIsFollowedByGuildCreates(t *testing.T) {
+	guilds := &mockGuildRepo{
+		GetByUserIDFn: func(context.Context, int64) ([]models.Guild, error) {
+			return []models.Guild{{ID: 1, Name: "Guild A"}, {ID: 2, Name: "Guild B"}}, nil
+		},
+	}
+	m := newStateManager(t, guilds)
+	if err := m.redis.SetPresence(context.Background(), 44, "idle"); err != nil {
+		t.Fatalf("set presence: %v", err)
+	}
+	// Offline members are left out of GUILD_CREATE.
+	if err := m.redis.SetPresence(context.Background(), 45, "offline"); err != nil {
+		t.Fatalf("set presence: %v", err)
+	}
+	srv := setupWSServer(t, m)
+
+	token, err := m.tokens.GenerateAccessToken(42)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+	ws := dialWS(t, srv)
+	readPayload(t, ws) // HELLO
+	// A user client identifies without intents and still gets presences.
+	sendPayload(t, ws, OpIdentify, IdentifyData{Token: token})
+
+	p := readPayload(t, ws)
+	if p.Event == nil || *p.Event != EventReady {
+		t.Fatalf("event = %v, want %q", p.Event, EventReady)
+	}
+	var ready ReadyData
+	decodeData(t, p, &ready)
+	if ready.User == nil || ready.User.Username != "alice" {
+		t.Errorf("ready user = %+v, want alice", ready.User)
+	}
+	if len(ready.PrivateChannels) != 1 || ready.PrivateChannels[0].ID != 900 {
+		t.Errorf("ready private channels = %+v, want DM 900", ready.PrivateChannels)
+	}
+	want := []UnavailableGuild{{ID: 1, Unavailable: true}, {ID: 2, Unavailable: true}}
+	if len(ready.Guilds) != len(want) || ready.Guilds[0] != want[0] || ready.Guilds[1] != want[1] {
+		t.Errorf("ready guilds = %+v, want %+v", ready.Guilds, want)
+	}
+
+	for _, guildID := range []int64{1, 2} {
+		p := readPayload(t, ws)
+		if p.Event == nil || *p.Event != EventGuildCreate {
+			t.Fatalf("event = %v, want %q", p.Event, EventGuildCreate)
+		}
+		var state GuildCreateData
+		decodeData(t, p, &state)
+		if state.ID != guildID {
+			t.Errorf("GUILD_CREATE id = %d, want %d", state.ID, guildID)
+		}
+		if len(state.Roles) != 1 || state.Member == nil || state.Member.UserID != 42 {
+			t.Errorf("GUILD_CREATE roles = %+v, member = %+v", state.Roles, state.Member)
+		}
+		if len(state.VoiceStates) != 1 || state.VoiceStates[0].UserID != 43 {
+			t.Errorf("GUILD_CREATE voice states = %+v, want user 43", state.VoiceStates)
+		}
+
+		// Channel 12 is hidden from the user.
+		var channels []int64
+		for _, ch := range state.Channels {
+			channels = append(channels, ch.ID)
+		}
+		if guildID == 1 && (len(channels) != 1 || channels[0] != 11) {
+			t.Errorf("GUILD_CREATE channels = %v, want [11]", channels)
+		}
+
+		presences := make(map[int64]string)
+		for _, pr := range state.Presences {
+			presences[pr.UserID] = pr.Status
+		}
+		if len(presences) != 2 || presences[42] != "online" || presences[44] != "idle" {
+			t.Errorf("GUILD_CREATE presences = %v, want 42 online and 44 idle", presences)
+		}
+	}
+}
+
+func TestJoinGuild_SubscribesAndSendsGuildCreate(t *testing.T) {
+	guilds := &mockGuildRepo{
+		GetByIDFn: func(_ context.Context, id int64) (*models.Guild, error) {
+			return &models.Guild{ID: id, Name: "Joined"}, nil
+		},
+	}
+	m := newStateManager(t, guilds)
+	if err := m.redis.SetPresence(context.Background(), 44, "idle"); err != nil {
+		t.Fatalf("set presence: %v", err)
+	}
+
+	full := fakeConn(m, 42, "full")
+	defer func() { _ = full.Conn.Close() }()
+	quiet := &Connection{UserID: 42, SessionID: "quiet", encoding: testEncoding, Send: make(chan []byte, 16)}
+	m.register(quiet, IntentsDefault)
+
+	m.JoinGuild(42, 1)
+
+	m.mu.RLock()
+	subscribed := m.subscriptions[1][42]
+	m.mu.RUnlock()
+	if !subscribed {
+		t.Error("user 42 not subscribed to guild 1 after JoinGuild")
+	}
+
+	for _, tt := range []struct {
+		conn      *Connection
+		presences bool
+	}{{full, true}, {quiet, false}} {
+		got := drainEvents(tt.conn)
+		if len(got) != 1 || got[0].Event == nil || *got[0].Event != EventGuildCreate {
+			t.Fatalf("session %s received %d payloads, want one GUILD_CREATE", tt.conn.SessionID, len(got))
+		}
+		var state GuildCreateData
+		decodeData(t, got[0], &state)
+		if state.ID != 1 || state.Name != "Joined" {
+			t.Errorf("session %s GUILD_CREATE guild = %d %q, want 1 Joined", tt.conn.SessionID, state.ID, state.Name)
+		}
+		// Only the session with the presences intent gets presences.
+		if hasPresences := len(state.Presences) > 0; hasPresences != tt.presences {
+			t.Errorf("session %s GUILD_CREATE presences = %v, want presences %v", tt.conn.SessionID, state.Presences, tt.presences)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package gateway
+
+import (
+	"errors"
+	"net/url"
+)
+
+var (
+	errUnsupportedCompression = errors.New("unsupported compression")
+	errUnsupportedEncoding    = errors.New("unsupported encoding")
+)
+
+// transportOptions are the per-connection options a client picks with
+// /gateway query parameters.
+type transportOptions struct {
+	compress string
+	encoding string
+}
+
+// parseTransportOptions reads the transport options of a /gateway request.
+// Without options the connection exchanges uncompressed JSON text frames.
+func parseTransportOptions(query url.Values) (transportOptions, error) {
+	opts := transportOptions{
+		compress: query.Get("compress"),
+		encoding: query.Get("encoding"),
+	}
+	switch opts.compress {
+	case "", compressZlibStream:
+	default:
+		return transportOptions{}, errUnsupportedCompression
+	}
+	switch opts.encoding {
+	case "":
+		opts.encoding = encodingJSON
+	case encodingJSON, encodingMsgpack:
+	default:
+		return transportOptions{}, errUnsupportedEncoding
+	}
+	return opts, nil
+}
@@ -48,7 +48,7 @@ func (h *TypingHandler) Handle(c echo.Context) error {
 		return echo.NewHTTPError(500, "internal server error")
 	}
 
-	h.manager.DispatchToGuild(channel.GuildID, EventTypingStart, TypingStartData{
+	h.manager.DispatchToChannel(channel.GuildID, channelID, EventTypingStart, TypingStartData{
 		ChannelID: channelID,
 		GuildID:   channel.GuildID,
 		UserID:    userID,
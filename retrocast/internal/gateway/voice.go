@@ -0,0 +1,70 @@
+package gateway
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// VoiceStateUpdater applies the voice state changes clients request with
+// Op 4 VOICE_STATE_UPDATE.
+type VoiceStateUpdater interface {
+	// UpdateVoiceState joins, switches or, when channelID is nil, leaves a
+	// voice channel in a guild and sets the user's self mute and deafen. It
+	// returns the voice server to connect to when the user entered a
+	// channel, and nil otherwise.
+	UpdateVoiceState(ctx context.Context, guildID, userID int64, channelID *int64, selfMute, selfDeaf bool) (*VoiceServerUpdateData, error)
+}
+
+// SetVoiceStates sets what handles Op 4 VOICE_STATE_UPDATE. Without one the
+// op is ignored. It must be called before serving connections.
+func (m *Manager) SetVoiceStates(v VoiceStateUpdater) {
+	m.voice = v
+}
+
+// handleVoiceStateUpdate applies an Op 4 VOICE_STATE_UPDATE. The resulting
+// VOICE_STATE_UPDATE is broadcast to the guild by the updater; a
+// connection entering a channel is also sent a VOICE_SERVER_UPDATE. A
+// request the updater rejects is answered with the user's unchanged voice
+// state, so that the client can undo what it showed optimistically.
+func (m *Manager) handleVoiceStateUpdate(c *Connection, data []byte) {
+	if m.voice == nil {
+		return
+	}
+
+	var update ClientVoiceStateUpdate
+	if err := c.unmarshal(data, &update); err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	server, err := m.voice.UpdateVoiceState(ctx, update.GuildID, c.UserID, update.ChannelID, update.SelfMute, update.SelfDeaf)
+	if err != nil {
+		slog.Warn("voice state update rejected", "guildID", update.GuildID, "userID", c.UserID, "error", err)
+		m.sendVoiceState(ctx, c, update.GuildID)
+		return
+	}
+	if server != nil {
+		c.SendEvent(EventVoiceServerUpdate, server)
+	}
+}
+
+// sendVoiceState sends a connection its user's current voice state in a
+// guild, or a VoiceStateLeaveData if they are not in voice there.
+func (m *Manager) sendVoiceState(ctx context.Context, c *Connection, guildID int64) {
+	if m.state.VoiceStates == nil {
+		return
+	}
+	state, err := m.state.VoiceStates.GetByUser(ctx, guildID, c.UserID)
+	if err != nil {
+		slog.Error("failed to get voice state", "guildID", guildID, "userID", c.UserID, "error", err)
+		return
+	}
+	if state == nil {
+		c.SendEvent(EventVoiceStateUpdate, VoiceStateLeaveData{GuildID: guildID, UserID: c.UserID})
+		return
+	}
+	c.SendEvent(EventVoiceStateUpdate, state)
+}
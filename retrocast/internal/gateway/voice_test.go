@@ -0,0 +1,147 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/victorivanov/retrocast/internal/database"
+	"github.com/victorivanov/retrocast/internal/models"
+)
+
+type fakeVoiceStates struct {
+	calls  []ClientVoiceStateUpdate
+	server *VoiceServerUpdateData
+	err    error
+}
+
+func (f *fakeVoiceStates) UpdateVoiceState(_ context.Context, guildID, _ int64, channelID *int64, selfMute, selfDeaf bool) (*VoiceServerUpdateData, error) {
+	f.calls = append(f.calls, ClientVoiceStateUpdate{GuildID: guildID, ChannelID: channelID, SelfMute: selfMute, SelfDeaf: selfDeaf})
+	return f.server, f.err
+}
+
+func TestHandleVoiceStateUpdate(t *testing.T) {
+	channelID := int64(20)
+	server := &VoiceServerUpdateData{GuildID: 1, ChannelID: channelID, Token: "token", Endpoint: "wss://voice.test"}
+
+	tests := []struct {
+		name    string
+		voice   *fakeVoiceStates
+		update  ClientVoiceStateUpdate
+		replies int
+	}{
+		{"join", &fakeVoiceStates{server: server}, ClientVoiceStateUpdate{GuildID: 1, ChannelID: &channelID, SelfMute: true}, 1},
+		{"self deafen in the same channel", &fakeVoiceStates{}, ClientVoiceStateUpdate{GuildID: 1, ChannelID: &channelID, SelfDeaf: true}, 0},
+		{"leave", &fakeVoiceStates{}, ClientVoiceStateUpdate{GuildID: 1}, 0},
+		{"rejected", &fakeVoiceStates{err: errors.New("missing permissions")}, ClientVoiceStateUpdate{GuildID: 1, ChannelID: &channelID}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestManager(t, &mockGuildRepo{})
+			m.SetVoiceStates(tt.voice)
+			c := fakeConn(m, 42, "s1")
+			defer func() { _ = c.Conn.Close() }()
+
+			raw, err := c.marshal(tt.update)
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			m.handleVoiceStateUpdate(c, raw)
+
+			if len(tt.voice.calls) != 1 {
+				t.Fatalf("updater called %d times, want 1", len(tt.voice.calls))
+			}
+			got := tt.voice.calls[0]
+			if got.GuildID != tt.update.GuildID || (got.ChannelID == nil) != (tt.update.ChannelID == nil) ||
+				got.SelfMute != tt.update.SelfMute || got.SelfDeaf != tt.update.SelfDeaf {
+				t.Errorf("updater got %+v, want %+v", got, tt.update)
+			}
+
+			events := drainEvents(c)
+			if len(events) != tt.replies {
+				t.Fatalf("sent %d events, want %d", len(events), tt.replies)
+			}
+			if tt.replies == 0 {
+				return
+			}
+			if events[0].Event == nil || *events[0].Event != EventVoiceServerUpdate {
+				t.Fatalf("event = %v, want %s", events[0].Event, EventVoiceServerUpdate)
+			}
+			var data VoiceServerUpdateData
+			decodeData(t, events[0], &data)
+			if data != *server {
+				t.Errorf("VOICE_SERVER_UPDATE = %+v, want %+v", data, *server)
+			}
+		})
+	}
+}
+
+// voiceStatesByUser implements database.VoiceStateRepository's GetByUser
+// from a fixed set of states.
+type voiceStatesByUser struct {
+	database.VoiceStateRepository
+	states map[int64]*models.VoiceState
+}
+
+func (v voiceStatesByUser) GetByUser(_ context.Context, _, userID int64) (*models.VoiceState, error) {
+	return v.states[userID], nil
+}
+
+func TestHandleVoiceStateUpdate_RejectedSendsCurrentState(t *testing.T) {
+	channelID := int64(20)
+	otherChannelID := int64(21)
+
+	tests := []struct {
+		name  string
+		state *models.VoiceState
+	}{
+		{"in a channel", &models.VoiceState{GuildID: 1, ChannelID: channelID, UserID: 42, SelfMute: true}},
+		{"not in voice", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestManager(t, &mockGuildRepo{})
+			m.SetVoiceStates(&fakeVoiceStates{err: errors.New("missing permissions")})
+			m.SetStateRepositories(StateRepositories{VoiceStates: voiceStatesByUser{states: map[int64]*models.VoiceState{42: tt.state}}})
+			c := fakeConn(m, 42, "s1")
+			defer func() { _ = c.Conn.Close() }()
+
+			raw, err := c.marshal(ClientVoiceStateUpdate{GuildID: 1, ChannelID: &otherChannelID})
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			m.handleVoiceStateUpdate(c, raw)
+
+			events := drainEvents(c)
+			if len(events) != 1 || events[0].Event == nil || *events[0].Event != EventVoiceStateUpdate {
+				t.Fatalf("sent %d events, want one VOICE_STATE_UPDATE", len(events))
+			}
+			if tt.state == nil {
+				var got VoiceStateLeaveData
+				decodeData(t, events[0], &got)
+				if got.GuildID != 1 || got.UserID != 42 || got.ChannelID != nil {
+					t.Errorf("VOICE_STATE_UPDATE = %+v, want user 42 out of voice in guild 1", got)
+				}
+				return
+			}
+			var got models.VoiceState
+			decodeData(t, events[0], &got)
+			if got.GuildID != 1 || got.UserID != 42 || got.ChannelID != channelID || !got.SelfMute {
+				t.Errorf("VOICE_STATE_UPDATE = %+v, want the unchanged state %+v", got, *tt.state)
+			}
+		})
+	}
+}
+
+func TestHasSession(t *testing.T) {
+	m := newTestManager(t, &mockGuildRepo{})
+	c := fakeConn(m, 42, "s1")
+	defer func() { _ = c.Conn.Close() }()
+
+	if !m.HasSession(42) {
+		t.Error("a connected user should have a session")
+	}
+	if m.HasSession(43) {
+		t.Error("a user who never connected should have no session")
+	}
+}
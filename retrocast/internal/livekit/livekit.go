@@ -0,0 +1,134 @@
+// Package livekit is a small client for the LiveKit RoomService API, used to
+// size voice rooms and to enforce moderation on participants already
+// connected to them.
+package livekit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// RoomClient calls the RoomService Twirp endpoints of a LiveKit server.
+type RoomClient struct {
+	baseURL   string
+	apiKey    string
+	apiSecret string
+	http      *http.Client
+}
+
+// NewRoomClient creates a RoomClient. url is the server URL clients connect
+// to; ws:// and wss:// are mapped to http:// and https://.
+func NewRoomClient(url, apiKey, apiSecret string) *RoomClient {
+	switch {
+	case strings.HasPrefix(url, "ws://"):
+		url = "http://" + strings.TrimPrefix(url, "ws://")
+	case strings.HasPrefix(url, "wss://"):
+		url = "https://" + strings.TrimPrefix(url, "wss://")
+	}
+	return &RoomClient{
+		baseURL:   strings.TrimSuffix(url, "/"),
+		apiKey:    apiKey,
+		apiSecret: apiSecret,
+		http:      &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+type participantPermission struct {
+	CanSubscribe   bool `json:"canSubscribe"`
+	CanPublish     bool `json:"canPublish"`
+	CanPublishData bool `json:"canPublishData"`
+}
+
+// SetParticipantPermissions replaces what a participant may do in a room.
+// A participant who is not connected is not an error.
+func (c *RoomClient) SetParticipantPermissions(ctx context.Context, room, identity string, canPublish, canSubscribe bool) error {
+	return c.call(ctx, "UpdateParticipant", room, map[string]any{
+		"room":     room,
+		"identity": identity,
+		"permission": participantPermission{
+			CanSubscribe:   canSubscribe,
+			CanPublish:     canPublish,
+			CanPublishData: true,
+		},
+	})
+}
+
+// CreateRoom creates a room admitting at most maxParticipants, or sets the
+// limit of the room if it already exists.
+func (c *RoomClient) CreateRoom(ctx context.Context, room string, maxParticipants int) error {
+	return c.call(ctx, "CreateRoom", room, map[string]any{
+		"name":            room,
+		"maxParticipants": maxParticipants,
+	})
+}
+
+// RemoveParticipant disconnects a participant from a room. A participant who
+// is not connected is not an error.
+func (c *RoomClient) RemoveParticipant(ctx context.Context, room, identity string) error {
+	return c.call(ctx, "RemoveParticipant", room, map[string]any{
+		"room":     room,
+		"identity": identity,
+	})
+}
+
+// call posts a request to a RoomService method with an admin token for room.
+func (c *RoomClient) call(ctx context.Context, method, room string, body any) error {
+	token, err := c.adminToken(room)
+	if err != nil {
+		return fmt.Errorf("livekit token: %w", err)
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/twirp/livekit.RoomService/"+method, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("livekit %s: %w", method, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	var twirpErr struct {
+		Code string `json:"code"`
+		Msg  string `json:"msg"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&twirpErr)
+	if twirpErr.Code == "not_found" {
+		return nil
+	}
+	return fmt.Errorf("livekit %s: %d %s: %s", method, resp.StatusCode, twirpErr.Code, twirpErr.Msg)
+}
+
+// adminToken signs a short-lived token granting admin rights over room and
+// the right to create it.
+func (c *RoomClient) adminToken(room string) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss": c.apiKey,
+		"nbf": now.Unix(),
+		"exp": now.Add(time.Minute).Unix(),
+		"video": map[string]any{
+			"roomAdmin":  true,
+			"roomCreate": true,
+			"room":       room,
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(c.apiSecret))
+}
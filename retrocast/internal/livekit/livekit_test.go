@@ -0,0 +1,84 @@
+package livekit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestRoomClient(t *testing.T) {
+	var gotPath string
+	var gotBody map[string]any
+	var gotVideo map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		_ = json.NewDecoder(r.Body).Decode(&gotBody)
+
+		claims := jwt.MapClaims{}
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if _, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (any, error) { return []byte("secret"), nil }); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		gotVideo, _ = claims["video"].(map[string]any)
+
+		if gotBody["identity"] == "404" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"code":"not_found","msg":"participant not found"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	c := NewRoomClient("ws://"+strings.TrimPrefix(srv.URL, "http://"), "key", "secret")
+	ctx := context.Background()
+
+	if err := c.SetParticipantPermissions(ctx, "voice-1", "42", false, true); err != nil {
+		t.Fatalf("set permissions: %v", err)
+	}
+	if gotPath != "/twirp/livekit.RoomService/UpdateParticipant" {
+		t.Errorf("path = %q, want UpdateParticipant", gotPath)
+	}
+	if gotVideo["roomAdmin"] != true || gotVideo["room"] != "voice-1" {
+		t.Errorf("video grant = %v, want admin of voice-1", gotVideo)
+	}
+	perm, _ := gotBody["permission"].(map[string]any)
+	if gotBody["room"] != "voice-1" || gotBody["identity"] != "42" || perm["canPublish"] != false || perm["canSubscribe"] != true {
+		t.Errorf("body = %v, want publishing denied for 42 in voice-1", gotBody)
+	}
+
+	if err := c.CreateRoom(ctx, "voice-2", 5); err != nil {
+		t.Fatalf("create room: %v", err)
+	}
+	if gotPath != "/twirp/livekit.RoomService/CreateRoom" {
+		t.Errorf("path = %q, want CreateRoom", gotPath)
+	}
+	if gotVideo["roomCreate"] != true || gotVideo["room"] != "voice-2" {
+		t.Errorf("video grant = %v, want room creation for voice-2", gotVideo)
+	}
+	if gotBody["name"] != "voice-2" || gotBody["maxParticipants"] != float64(5) {
+		t.Errorf("body = %v, want voice-2 limited to 5", gotBody)
+	}
+
+	if err := c.RemoveParticipant(ctx, "voice-1", "42"); err != nil {
+		t.Fatalf("remove participant: %v", err)
+	}
+	if gotPath != "/twirp/livekit.RoomService/RemoveParticipant" {
+		t.Errorf("path = %q, want RemoveParticipant", gotPath)
+	}
+
+	if err := c.RemoveParticipant(ctx, "voice-1", "404"); err != nil {
+		t.Errorf("removing a participant who is not connected: %v", err)
+	}
+
+	bad := NewRoomClient(srv.URL, "key", "wrong-secret")
+	if err := bad.RemoveParticipant(ctx, "voice-1", "42"); err == nil {
+		t.Error("expected an error when the server rejects the token")
+	}
+}
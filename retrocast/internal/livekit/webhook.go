@@ -0,0 +1,76 @@
+package livekit
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Webhook event names.
+const (
+	EventParticipantJoined = "participant_joined"
+	EventParticipantLeft   = "participant_left"
+	EventRoomFinished      = "room_finished"
+)
+
+// ErrInvalidWebhook is returned for a webhook whose signature does not
+// check out.
+var ErrInvalidWebhook = errors.New("livekit: invalid webhook signature")
+
+// WebhookEvent is a notification the LiveKit server posts about its rooms.
+// Only the fields retrocast uses are decoded.
+type WebhookEvent struct {
+	ID          string       `json:"id"`
+	Event       string       `json:"event"`
+	Room        *Room        `json:"room,omitempty"`
+	Participant *Participant `json:"participant,omitempty"`
+}
+
+// Room identifies a LiveKit room.
+type Room struct {
+	Name string `json:"name"`
+}
+
+// Participant identifies a client connected to a room. JoinedAt is in Unix
+// seconds.
+type Participant struct {
+	Identity string `json:"identity"`
+	JoinedAt int64  `json:"joinedAt,string,omitempty"`
+}
+
+// VerifyWebhook checks that body was posted by the LiveKit server holding
+// apiKey and apiSecret, and decodes it. The Authorization header carries a
+// JWT issued by apiKey and signed with apiSecret whose sha256 claim is the
+// base64 SHA-256 of the body.
+func VerifyWebhook(body []byte, authorization, apiKey, apiSecret string) (*WebhookEvent, error) {
+	if apiSecret == "" {
+		return nil, fmt.Errorf("%w: no API secret configured", ErrInvalidWebhook)
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(strings.TrimPrefix(authorization, "Bearer "), claims, func(*jwt.Token) (any, error) {
+		return []byte(apiSecret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Name}), jwt.WithIssuer(apiKey))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWebhook, err)
+	}
+
+	sum := sha256.Sum256(body)
+	want := base64.StdEncoding.EncodeToString(sum[:])
+	got, _ := claims["sha256"].(string)
+	if subtle.ConstantTimeCompare([]byte(got), []byte(want)) != 1 {
+		return nil, fmt.Errorf("%w: body checksum mismatch", ErrInvalidWebhook)
+	}
+
+	var event WebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, fmt.Errorf("livekit: decode webhook: %w", err)
+	}
+	return &event, nil
+}
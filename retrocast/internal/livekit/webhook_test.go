@@ -0,0 +1,58 @@
+package livekit
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const fixtureWebhook = `{"event":"participant_left","room":{"sid":"RM_1","name":"voice-7000"},"participant":{"sid":"PA_1","identity":"3000","joinedAt":"1700000000"},"id":"EV_1","createdAt":"1700000100"}`
+
+func signFixture(t *testing.T, body, issuer, secret string) string {
+	t.Helper()
+	sum := sha256.Sum256([]byte(body))
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss":    issuer,
+		"exp":    time.Now().Add(5 * time.Minute).Unix(),
+		"sha256": base64.StdEncoding.EncodeToString(sum[:]),
+	}).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return token
+}
+
+func TestVerifyWebhook(t *testing.T) {
+	event, err := VerifyWebhook([]byte(fixtureWebhook), signFixture(t, fixtureWebhook, "key", "secret"), "key", "secret")
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if event.Event != EventParticipantLeft || event.Room == nil || event.Room.Name != "voice-7000" ||
+		event.Participant == nil || event.Participant.Identity != "3000" || event.Participant.JoinedAt != 1700000000 {
+		t.Errorf("event = %+v, want participant 3000 leaving voice-7000", event)
+	}
+
+	tests := []struct {
+		name          string
+		body          string
+		authorization string
+		key, secret   string
+	}{
+		{"wrong secret", fixtureWebhook, signFixture(t, fixtureWebhook, "key", "other"), "key", "secret"},
+		{"wrong issuer", fixtureWebhook, signFixture(t, fixtureWebhook, "other", "secret"), "key", "secret"},
+		{"tampered body", fixtureWebhook + " ", signFixture(t, fixtureWebhook, "key", "secret"), "key", "secret"},
+		{"no secret configured", fixtureWebhook, signFixture(t, fixtureWebhook, "key", ""), "key", ""},
+		{"missing token", fixtureWebhook, "", "key", "secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := VerifyWebhook([]byte(tt.body), tt.authorization, tt.key, tt.secret); !errors.Is(err, ErrInvalidWebhook) {
+				t.Errorf("err = %v, want ErrInvalidWebhook", err)
+			}
+		})
+	}
+}
@@ -1,12 +1,18 @@
 package models
 
-// Attachment represents a file attached to a message.
+import "time"
+
+// Attachment represents a file attached to a message. MessageID is zero until
+// the upload is claimed by a message.
 type Attachment struct {
-	ID          int64  `json:"id,string"`
-	MessageID   int64  `json:"message_id,string"`
-	Filename    string `json:"filename"`
-	ContentType string `json:"content_type"`
-	Size        int64  `json:"size"`
-	StorageKey  string `json:"-"`
-	URL         string `json:"url"`
+	ID          int64     `json:"id,string"`
+	MessageID   int64     `json:"message_id,string"`
+	ChannelID   int64     `json:"channel_id,string"`
+	UploaderID  int64     `json:"-"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	StorageKey  string    `json:"-"`
+	URL         string    `json:"url"`
+	CreatedAt   time.Time `json:"-"`
 }
@@ -0,0 +1,50 @@
+package models
+
+import "time"
+
+// AuditLogAction identifies the kind of moderation action an audit log entry
+// records.
+type AuditLogAction int
+
+const (
+	AuditLogGuildUpdate            AuditLogAction = 1
+	AuditLogChannelCreate          AuditLogAction = 10
+	AuditLogChannelUpdate          AuditLogAction = 11
+	AuditLogChannelDelete          AuditLogAction = 12
+	AuditLogChannelOverwriteCreate AuditLogAction = 13
+	AuditLogChannelOverwriteUpdate AuditLogAction = 14
+	AuditLogChannelOverwriteDelete AuditLogAction = 15
+	AuditLogMemberKick             AuditLogAction = 20
+	AuditLogMemberBanAdd           AuditLogAction = 22
+	AuditLogMemberBanRemove        AuditLogAction = 23
+	AuditLogMemberUpdate           AuditLogAction = 24
+	AuditLogMemberRoleUpdate       AuditLogAction = 25
+	AuditLogMemberMove             AuditLogAction = 26
+	AuditLogMemberDisconnect       AuditLogAction = 27
+	AuditLogRoleCreate             AuditLogAction = 30
+	AuditLogRoleUpdate             AuditLogAction = 31
+	AuditLogRoleDelete             AuditLogAction = 32
+)
+
+// AuditLogChange is one field changed by an audited action. OldValue is
+// omitted for creations and NewValue for deletions. Role assignments use the
+// keys "$add" and "$remove" with the role ID as the new value.
+type AuditLogChange struct {
+	Key      string `json:"key"`
+	OldValue any    `json:"old_value,omitempty"`
+	NewValue any    `json:"new_value,omitempty"`
+}
+
+// AuditLogEntry records a moderation action taken in a guild. UserID is the
+// actor; TargetID is the user, role or channel acted upon.
+type AuditLogEntry struct {
+	ID         int64             `json:"id,string"`
+	GuildID    int64             `json:"guild_id,string"`
+	UserID     int64             `json:"user_id,string"`
+	TargetID   *int64            `json:"target_id,string,omitempty"`
+	ActionType AuditLogAction    `json:"action_type"`
+	Changes    []AuditLogChange  `json:"changes"`
+	Options    map[string]string `json:"options,omitempty"`
+	Reason     *string           `json:"reason,omitempty"`
+	CreatedAt  time.Time         `json:"created_at"`
+}
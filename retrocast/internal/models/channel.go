@@ -1,19 +1,47 @@
 package models
 
+import "time"
+
 type ChannelType int
 
 const (
 	ChannelTypeText     ChannelType = 0
 	ChannelTypeVoice    ChannelType = 2
 	ChannelTypeCategory ChannelType = 4
+	ChannelTypeThread   ChannelType = 11
+	ChannelTypeStage    ChannelType = 13
 )
 
+// IsVoice reports whether users connect to channels of type t to talk.
+func (t ChannelType) IsVoice() bool {
+	return t == ChannelTypeVoice || t == ChannelTypeStage
+}
+
 type Channel struct {
-	ID       int64       `json:"id,string"`
-	GuildID  int64       `json:"guild_id,string"`
-	Name     string      `json:"name"`
-	Type     ChannelType `json:"type"`
-	Position int         `json:"position"`
-	Topic    *string     `json:"topic,omitempty"`
-	ParentID *int64      `json:"parent_id,string,omitempty"`
+	ID       int64           `json:"id,string"`
+	GuildID  int64           `json:"guild_id,string"`
+	Name     string          `json:"name"`
+	Type     ChannelType     `json:"type"`
+	Position int             `json:"position"`
+	Topic    *string         `json:"topic,omitempty"`
+	ParentID *int64          `json:"parent_id,string,omitempty"`
+	Thread   *ThreadMetadata `json:"thread_metadata,omitempty"`
+	// Bitrate is the audio bitrate of a voice channel, in bits per second.
+	Bitrate int `json:"bitrate,omitempty"`
+	// UserLimit is how many users may be in a voice channel at once; 0 means
+	// unlimited.
+	UserLimit int `json:"user_limit,omitempty"`
+}
+
+// ThreadMetadata holds the thread-specific fields of a thread channel.
+type ThreadMetadata struct {
+	OwnerID          int64  `json:"owner_id,string"`
+	StarterMessageID *int64 `json:"starter_message_id,string,omitempty"`
+	Archived         bool   `json:"archived"`
+	// AutoArchiveDuration is the number of minutes without messages after
+	// which the thread is archived.
+	AutoArchiveDuration int `json:"auto_archive_duration"`
+	// ArchiveTimestamp is when the archived flag last changed, or when the
+	// thread was created.
+	ArchiveTimestamp time.Time `json:"archive_timestamp"`
 }
@@ -1,8 +1,19 @@
 package models
 
+// OverrideType says whether a channel override targets a role or a member.
+type OverrideType int
+
+const (
+	OverrideTypeRole   OverrideType = 0
+	OverrideTypeMember OverrideType = 1
+)
+
+// ChannelOverride allows or denies permissions in one channel for a role or
+// a single member. TargetID is the role or user ID, depending on Type.
 type ChannelOverride struct {
-	ChannelID int64 `json:"channel_id,string"`
-	RoleID    int64 `json:"role_id,string"`
-	Allow     int64 `json:"allow,string"`
-	Deny      int64 `json:"deny,string"`
+	ChannelID int64        `json:"channel_id,string"`
+	TargetID  int64        `json:"id,string"`
+	Type      OverrideType `json:"type"`
+	Allow     int64        `json:"allow,string"`
+	Deny      int64        `json:"deny,string"`
 }
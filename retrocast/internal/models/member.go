@@ -8,4 +8,14 @@ type Member struct {
 	Nickname *string  `json:"nickname,omitempty"`
 	JoinedAt time.Time `json:"joined_at"`
 	Roles    []int64  `json:"roles"`
+
+	// Presence is set when members are listed or fetched over REST.
+	Presence *Presence `json:"presence,omitempty"`
+}
+
+// MemberWithUser is a member together with its user, as sent in
+// GUILD_MEMBERS_CHUNK.
+type MemberWithUser struct {
+	Member
+	User User `json:"user"`
 }
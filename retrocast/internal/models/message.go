@@ -3,12 +3,33 @@ package models
 import "time"
 
 type Message struct {
-	ID        int64      `json:"id,string"`
-	ChannelID int64      `json:"channel_id,string"`
-	AuthorID  int64      `json:"author_id,string"`
-	Content   string     `json:"content"`
-	CreatedAt time.Time  `json:"created_at"`
-	EditedAt  *time.Time `json:"edited_at,omitempty"`
+	ID               int64             `json:"id,string"`
+	ChannelID        int64             `json:"channel_id,string"`
+	AuthorID         int64             `json:"author_id,string"`
+	Content          string            `json:"content"`
+	CreatedAt        time.Time         `json:"created_at"`
+	EditedAt         *time.Time        `json:"edited_at,omitempty"`
+	Mentions         []int64           `json:"mentions"`
+	MentionRoles     []int64           `json:"mention_roles"`
+	MentionEveryone  bool              `json:"mention_everyone"`
+	MessageReference *MessageReference `json:"message_reference,omitempty"`
+}
+
+// MessageReference points a reply at the message it answers.
+type MessageReference struct {
+	ChannelID int64 `json:"channel_id,string"`
+	MessageID int64 `json:"message_id,string"`
+}
+
+// ReferencedMessage is the trimmed copy of a replied-to message embedded in
+// its replies.
+type ReferencedMessage struct {
+	ID                int64     `json:"id,string"`
+	AuthorID          int64     `json:"author_id,string"`
+	AuthorUsername    string    `json:"author_username"`
+	AuthorDisplayName string    `json:"author_display_name"`
+	Content           string    `json:"content"`
+	CreatedAt         time.Time `json:"created_at"`
 }
 
 type MessageWithAuthor struct {
@@ -17,4 +38,8 @@ type MessageWithAuthor struct {
 	AuthorDisplayName string       `json:"author_display_name"`
 	AuthorAvatarHash  *string      `json:"author_avatar_hash,omitempty"`
 	Attachments       []Attachment `json:"attachments"`
+	Pinned            bool         `json:"pinned"`
+	// ReferencedMessage is nil if the message is not a reply or the
+	// replied-to message has been deleted.
+	ReferencedMessage *ReferencedMessage `json:"referenced_message,omitempty"`
 }
@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// Activity types.
+const (
+	ActivityPlaying   = 0
+	ActivityListening = 2
+	ActivityWatching  = 3
+	ActivityCustom    = 4
+)
+
+// Presence is a user's online status together with their custom status and
+// activities, if they set any.
+type Presence struct {
+	Status       string        `json:"status"`
+	CustomStatus *CustomStatus `json:"custom_status,omitempty"`
+	Activities   []Activity    `json:"activities,omitempty"`
+}
+
+// CustomStatus is the text a user shows under their name. The server clears
+// it once ExpiresAt passes.
+type CustomStatus struct {
+	Text      string     `json:"text"`
+	Emoji     *string    `json:"emoji,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Expired reports whether the custom status has expired at now.
+func (s *CustomStatus) Expired(now time.Time) bool {
+	return s.ExpiresAt != nil && !s.ExpiresAt.After(now)
+}
+
+// Activity is something a user is doing, such as playing a game.
+type Activity struct {
+	Type int    `json:"type"`
+	Name string `json:"name"`
+}
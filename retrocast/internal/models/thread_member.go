@@ -0,0 +1,9 @@
+package models
+
+import "time"
+
+type ThreadMember struct {
+	ThreadID int64     `json:"thread_id,string"`
+	UserID   int64     `json:"user_id,string"`
+	JoinedAt time.Time `json:"joined_at"`
+}
@@ -8,5 +8,9 @@ type User struct {
 	DisplayName  string    `json:"display_name"`
 	AvatarHash   *string   `json:"avatar_hash,omitempty"`
 	PasswordHash string    `json:"-"`
+	Bot          bool      `json:"bot"`
 	CreatedAt    time.Time `json:"created_at"`
+
+	// Presence is set in GET /users/@me responses.
+	Presence *Presence `json:"presence,omitempty"`
 }
@@ -2,12 +2,19 @@ package models
 
 import "time"
 
+// VoiceState is a user's connection to a voice or stage channel. In a stage
+// channel, listeners are suppressed and may not speak; RequestToSpeakAt is
+// set while a listener has their hand raised.
 type VoiceState struct {
-	GuildID   int64     `json:"guild_id,string"`
-	ChannelID int64     `json:"channel_id,string"`
-	UserID    int64     `json:"user_id,string"`
-	SessionID string    `json:"session_id"`
-	SelfMute  bool      `json:"self_mute"`
-	SelfDeaf  bool      `json:"self_deaf"`
-	JoinedAt  time.Time `json:"joined_at"`
+	GuildID          int64      `json:"guild_id,string"`
+	ChannelID        int64      `json:"channel_id,string"`
+	UserID           int64      `json:"user_id,string"`
+	SessionID        string     `json:"session_id"`
+	SelfMute         bool       `json:"self_mute"`
+	SelfDeaf         bool       `json:"self_deaf"`
+	Mute             bool       `json:"mute"`
+	Deaf             bool       `json:"deaf"`
+	Suppress         bool       `json:"suppress"`
+	RequestToSpeakAt *time.Time `json:"request_to_speak_at"`
+	JoinedAt         time.Time  `json:"joined_at"`
 }
@@ -25,6 +25,8 @@ const (
 	PermCreateInvite       Permission = 1 << 16
 	PermChangeNickname     Permission = 1 << 17
 	PermManageNicknames    Permission = 1 << 18
+	PermManageThreads      Permission = 1 << 19
+	PermViewAuditLog       Permission = 1 << 20
 	PermAdministrator      Permission = 1 << 31 // bypasses all checks
 
 	// Convenience sets
@@ -66,6 +68,8 @@ var permNames = map[Permission]string{
 	PermCreateInvite:       "CREATE_INVITE",
 	PermChangeNickname:     "CHANGE_NICKNAME",
 	PermManageNicknames:    "MANAGE_NICKNAMES",
+	PermManageThreads:      "MANAGE_THREADS",
+	PermViewAuditLog:       "VIEW_AUDIT_LOG",
 	PermAdministrator:      "ADMINISTRATOR",
 }
 
@@ -24,8 +24,9 @@ func ComputeBasePermissions(everyoneRole models.Role, memberRoles []models.Role)
 //  2. If ADMINISTRATOR, return PermAll (skip overrides).
 //  3. Apply @everyone channel override: deny first, then allow.
 //  4. Apply role overrides: OR all role allows, OR all role denies, then deny, then allow.
-//  5. Return final permissions.
-func ComputeChannelPermissions(basePerms Permission, everyoneOverride *models.ChannelOverride, roleOverrides []models.ChannelOverride) Permission {
+//  5. Apply the member's own override: deny first, then allow.
+//  6. Return final permissions.
+func ComputeChannelPermissions(basePerms Permission, everyoneOverride *models.ChannelOverride, roleOverrides []models.ChannelOverride, memberOverride *models.ChannelOverride) Permission {
 	if basePerms.Has(PermAdministrator) {
 		return PermAll
 	}
@@ -48,5 +49,11 @@ func ComputeChannelPermissions(basePerms Permission, everyoneOverride *models.Ch
 	perms = perms.Remove(roleDeny)
 	perms = perms.Add(roleAllow)
 
+	// The member override has the last word.
+	if memberOverride != nil {
+		perms = perms.Remove(Permission(memberOverride.Deny))
+		perms = perms.Add(Permission(memberOverride.Allow))
+	}
+
 	return perms
 }
@@ -62,7 +62,7 @@ func TestComputeBasePermissions_AdministratorOnEveryone(t *testing.T) {
 
 func TestComputeChannelPermissions_NoOverrides(t *testing.T) {
 	base := PermViewChannel | PermSendMessages
-	perms := ComputeChannelPermissions(base, nil, nil)
+	perms := ComputeChannelPermissions(base, nil, nil, nil)
 	if perms != base {
 		t.Error("with no overrides, channel perms should equal base perms")
 	}
@@ -73,7 +73,7 @@ func TestComputeChannelPermissions_AdministratorBypass(t *testing.T) {
 	everyone := &models.ChannelOverride{
 		Deny: int64(PermViewChannel),
 	}
-	perms := ComputeChannelPermissions(base, everyone, nil)
+	perms := ComputeChannelPermissions(base, everyone, nil, nil)
 	if perms != PermAll {
 		t.Error("Administrator should bypass channel overrides and return PermAll")
 	}
@@ -84,7 +84,7 @@ func TestComputeChannelPermissions_EveryoneOverrideDeny(t *testing.T) {
 	everyone := &models.ChannelOverride{
 		Deny: int64(PermSendMessages),
 	}
-	perms := ComputeChannelPermissions(base, everyone, nil)
+	perms := ComputeChannelPermissions(base, everyone, nil, nil)
 	if perms.Has(PermSendMessages) {
 		t.Error("@everyone deny should remove SendMessages")
 	}
@@ -98,7 +98,7 @@ func TestComputeChannelPermissions_EveryoneOverrideAllow(t *testing.T) {
 	everyone := &models.ChannelOverride{
 		Allow: int64(PermManageMessages),
 	}
-	perms := ComputeChannelPermissions(base, everyone, nil)
+	perms := ComputeChannelPermissions(base, everyone, nil, nil)
 	if !perms.Has(PermManageMessages) {
 		t.Error("@everyone allow should add ManageMessages")
 	}
@@ -112,7 +112,7 @@ func TestComputeChannelPermissions_EveryoneOverrideDenyThenAllow(t *testing.T) {
 		Deny:  int64(PermSendMessages),
 		Allow: int64(PermSendMessages),
 	}
-	perms := ComputeChannelPermissions(base, everyone, nil)
+	perms := ComputeChannelPermissions(base, everyone, nil, nil)
 	if !perms.Has(PermSendMessages) {
 		t.Error("allow should override deny for @everyone (allow applied after deny)")
 	}
@@ -121,9 +121,9 @@ func TestComputeChannelPermissions_EveryoneOverrideDenyThenAllow(t *testing.T) {
 func TestComputeChannelPermissions_RoleOverrideDeny(t *testing.T) {
 	base := PermViewChannel | PermSendMessages | PermManageMessages
 	roleOverrides := []models.ChannelOverride{
-		{RoleID: 1, Deny: int64(PermManageMessages)},
+		{TargetID: 1, Deny: int64(PermManageMessages)},
 	}
-	perms := ComputeChannelPermissions(base, nil, roleOverrides)
+	perms := ComputeChannelPermissions(base, nil, roleOverrides, nil)
 	if perms.Has(PermManageMessages) {
 		t.Error("role deny should remove ManageMessages")
 	}
@@ -135,9 +135,9 @@ func TestComputeChannelPermissions_RoleOverrideDeny(t *testing.T) {
 func TestComputeChannelPermissions_RoleOverrideAllow(t *testing.T) {
 	base := PermViewChannel
 	roleOverrides := []models.ChannelOverride{
-		{RoleID: 1, Allow: int64(PermAttachFiles)},
+		{TargetID: 1, Allow: int64(PermAttachFiles)},
 	}
-	perms := ComputeChannelPermissions(base, nil, roleOverrides)
+	perms := ComputeChannelPermissions(base, nil, roleOverrides, nil)
 	if !perms.Has(PermAttachFiles) {
 		t.Error("role allow should add AttachFiles")
 	}
@@ -146,10 +146,10 @@ func TestComputeChannelPermissions_RoleOverrideAllow(t *testing.T) {
 func TestComputeChannelPermissions_MultipleRoleOverrides(t *testing.T) {
 	base := PermViewChannel | PermSendMessages | PermManageMessages
 	roleOverrides := []models.ChannelOverride{
-		{RoleID: 1, Allow: int64(PermAttachFiles), Deny: int64(PermManageMessages)},
-		{RoleID: 2, Allow: int64(PermMentionEveryone)},
+		{TargetID: 1, Allow: int64(PermAttachFiles), Deny: int64(PermManageMessages)},
+		{TargetID: 2, Allow: int64(PermMentionEveryone)},
 	}
-	perms := ComputeChannelPermissions(base, nil, roleOverrides)
+	perms := ComputeChannelPermissions(base, nil, roleOverrides, nil)
 	if perms.Has(PermManageMessages) {
 		t.Error("deny from any role override should remove ManageMessages")
 	}
@@ -166,10 +166,10 @@ func TestComputeChannelPermissions_RoleAllowOverridesDeny(t *testing.T) {
 	// the allow wins because allows are applied after denies.
 	base := PermViewChannel | PermSendMessages
 	roleOverrides := []models.ChannelOverride{
-		{RoleID: 1, Deny: int64(PermSendMessages)},
-		{RoleID: 2, Allow: int64(PermSendMessages)},
+		{TargetID: 1, Deny: int64(PermSendMessages)},
+		{TargetID: 2, Allow: int64(PermSendMessages)},
 	}
-	perms := ComputeChannelPermissions(base, nil, roleOverrides)
+	perms := ComputeChannelPermissions(base, nil, roleOverrides, nil)
 	if !perms.Has(PermSendMessages) {
 		t.Error("role allow should override role deny (allow applied after deny)")
 	}
@@ -183,9 +183,9 @@ func TestComputeChannelPermissions_EveryoneBeforeRoles(t *testing.T) {
 		Deny: int64(PermSendMessages),
 	}
 	roleOverrides := []models.ChannelOverride{
-		{RoleID: 1, Allow: int64(PermSendMessages)},
+		{TargetID: 1, Allow: int64(PermSendMessages)},
 	}
-	perms := ComputeChannelPermissions(base, everyone, roleOverrides)
+	perms := ComputeChannelPermissions(base, everyone, roleOverrides, nil)
 	if !perms.Has(PermSendMessages) {
 		t.Error("role allow should restore permission denied by @everyone")
 	}
@@ -202,11 +202,11 @@ func TestComputeChannelPermissions_FullScenario(t *testing.T) {
 
 	// Role overrides: role 1 allows manage messages, role 2 denies send messages
 	roleOverrides := []models.ChannelOverride{
-		{RoleID: 1, Allow: int64(PermManageMessages)},
-		{RoleID: 2, Deny: int64(PermSendMessages)},
+		{TargetID: 1, Allow: int64(PermManageMessages)},
+		{TargetID: 2, Deny: int64(PermSendMessages)},
 	}
 
-	perms := ComputeChannelPermissions(base, everyone, roleOverrides)
+	perms := ComputeChannelPermissions(base, everyone, roleOverrides, nil)
 
 	if !perms.Has(PermViewChannel) {
 		t.Error("ViewChannel should remain")
@@ -227,3 +227,56 @@ func TestComputeChannelPermissions_FullScenario(t *testing.T) {
 		t.Error("Connect should remain")
 	}
 }
+
+func TestComputeChannelPermissions_MemberOverrideAllowBeatsRoleDeny(t *testing.T) {
+	base := PermViewChannel | PermSendMessages
+	everyone := &models.ChannelOverride{Deny: int64(PermSendMessages)}
+	roleOverrides := []models.ChannelOverride{
+		{TargetID: 1, Deny: int64(PermSendMessages)},
+	}
+	member := &models.ChannelOverride{TargetID: 100, Type: models.OverrideTypeMember, Allow: int64(PermSendMessages)}
+
+	perms := ComputeChannelPermissions(base, everyone, roleOverrides, member)
+	if !perms.Has(PermSendMessages) {
+		t.Error("member allow should restore a permission denied by @everyone and role overrides")
+	}
+}
+
+func TestComputeChannelPermissions_MemberOverrideDenyBeatsRoleAllow(t *testing.T) {
+	base := PermViewChannel
+	everyone := &models.ChannelOverride{Allow: int64(PermSendMessages)}
+	roleOverrides := []models.ChannelOverride{
+		{TargetID: 1, Allow: int64(PermSendMessages | PermAttachFiles)},
+	}
+	member := &models.ChannelOverride{TargetID: 100, Type: models.OverrideTypeMember, Deny: int64(PermSendMessages)}
+
+	perms := ComputeChannelPermissions(base, everyone, roleOverrides, member)
+	if perms.Has(PermSendMessages) {
+		t.Error("member deny should remove SendMessages allowed by @everyone and roles")
+	}
+	if !perms.Has(PermAttachFiles) {
+		t.Error("role allow not touched by the member override should remain")
+	}
+}
+
+func TestComputeChannelPermissions_MemberOverrideDenyThenAllow(t *testing.T) {
+	base := PermViewChannel | PermSendMessages
+	member := &models.ChannelOverride{
+		TargetID: 100,
+		Type:     models.OverrideTypeMember,
+		Deny:     int64(PermSendMessages),
+		Allow:    int64(PermSendMessages),
+	}
+	perms := ComputeChannelPermissions(base, nil, nil, member)
+	if !perms.Has(PermSendMessages) {
+		t.Error("allow should override deny within the member override")
+	}
+}
+
+func TestComputeChannelPermissions_AdministratorIgnoresMemberOverride(t *testing.T) {
+	base := PermAdministrator
+	member := &models.ChannelOverride{TargetID: 100, Type: models.OverrideTypeMember, Deny: int64(PermViewChannel)}
+	if perms := ComputeChannelPermissions(base, nil, nil, member); perms != PermAll {
+		t.Error("Administrator should bypass member overrides")
+	}
+}
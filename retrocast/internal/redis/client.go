@@ -42,11 +42,13 @@ func (c *Client) Close() error {
 }
 
 const (
-	refreshTokenPrefix = "refresh:"
-	presencePrefix     = "presence:"
-	typingPrefix       = "typing:"
-	presenceTTL        = 5 * time.Minute
-	typingTTL          = 10 * time.Second
+	refreshTokenPrefix    = "refresh:"
+	presencePrefix        = "presence:"
+	presenceDetailsPrefix = "presence:details:"
+	typingPrefix          = "typing:"
+	gatewaySessionsPrefix = "gateway:sessions:"
+	presenceTTL           = 5 * time.Minute
+	typingTTL             = 10 * time.Second
 )
 
 // StoreRefreshToken stores a refresh token mapped to a user ID with an expiry.
@@ -122,10 +124,67 @@ func (c *Client) GetPresence(ctx context.Context, userID int64) (string, error)
 	return val, nil
 }
 
-// DeletePresence removes a user's presence status.
+// GetPresences returns the presence status of each of the given users
+// that has one.
+func (c *Client) GetPresences(ctx context.Context, userIDs []int64) (map[int64]string, error) {
+	statuses := make(map[int64]string)
+	if len(userIDs) == 0 {
+		return statuses, nil
+	}
+	keys := make([]string, len(userIDs))
+	for i, id := range userIDs {
+		keys[i] = presencePrefix + strconv.FormatInt(id, 10)
+	}
+	vals, err := c.rdb.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("getting presences: %w", err)
+	}
+	for i, v := range vals {
+		if status, ok := v.(string); ok && status != "" {
+			statuses[userIDs[i]] = status
+		}
+	}
+	return statuses, nil
+}
+
+// DeletePresence removes a user's presence status and details.
 func (c *Client) DeletePresence(ctx context.Context, userID int64) error {
-	key := presencePrefix + strconv.FormatInt(userID, 10)
-	return c.rdb.Del(ctx, key).Err()
+	id := strconv.FormatInt(userID, 10)
+	return c.rdb.Del(ctx, presencePrefix+id, presenceDetailsPrefix+id).Err()
+}
+
+// SetPresenceDetails stores the encoded custom status and activities of a
+// user's presence next to their status, with the same TTL. Empty details
+// are deleted.
+func (c *Client) SetPresenceDetails(ctx context.Context, userID int64, details []byte) error {
+	key := presenceDetailsPrefix + strconv.FormatInt(userID, 10)
+	if len(details) == 0 {
+		return c.rdb.Del(ctx, key).Err()
+	}
+	return c.rdb.Set(ctx, key, details, presenceTTL).Err()
+}
+
+// GetPresenceDetails returns the encoded presence details of each of the
+// given users that has some.
+func (c *Client) GetPresenceDetails(ctx context.Context, userIDs []int64) (map[int64][]byte, error) {
+	details := make(map[int64][]byte)
+	if len(userIDs) == 0 {
+		return details, nil
+	}
+	keys := make([]string, len(userIDs))
+	for i, id := range userIDs {
+		keys[i] = presenceDetailsPrefix + strconv.FormatInt(id, 10)
+	}
+	vals, err := c.rdb.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("getting presence details: %w", err)
+	}
+	for i, v := range vals {
+		if s, ok := v.(string); ok && s != "" {
+			details[userIDs[i]] = []byte(s)
+		}
+	}
+	return details, nil
 }
 
 // SetTyping marks a user as typing in a channel with a short TTL.
@@ -161,3 +220,77 @@ func (c *Client) GetTyping(ctx context.Context, channelID int64) ([]int64, error
 	}
 	return userIDs, nil
 }
+
+// AddGatewaySession records a live gateway session for a user, or refreshes
+// one already recorded. Each session is scored by when it was last seen; one
+// not refreshed within ttl is treated as gone, so the sessions of a crashed
+// node cannot pin a user online.
+func (c *Client) AddGatewaySession(ctx context.Context, userID int64, sessionID string, ttl time.Duration) error {
+	key := gatewaySessionsPrefix + strconv.FormatInt(userID, 10)
+	pipe := c.rdb.TxPipeline()
+	pipe.ZAdd(ctx, key, goredis.Z{Score: float64(time.Now().UnixMilli()), Member: sessionID})
+	pipe.Expire(ctx, key, ttl)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// RemoveGatewaySession removes a gateway session for a user.
+func (c *Client) RemoveGatewaySession(ctx context.Context, userID int64, sessionID string) error {
+	key := gatewaySessionsPrefix + strconv.FormatInt(userID, 10)
+	return c.rdb.ZRem(ctx, key, sessionID).Err()
+}
+
+// CountGatewaySessions returns the number of gateway sessions a user has
+// across all nodes that were seen within ttl. Older sessions are removed.
+func (c *Client) CountGatewaySessions(ctx context.Context, userID int64, ttl time.Duration) (int64, error) {
+	key := gatewaySessionsPrefix + strconv.FormatInt(userID, 10)
+	staleBefore := strconv.FormatInt(time.Now().Add(-ttl).UnixMilli(), 10)
+	pipe := c.rdb.TxPipeline()
+	pipe.ZRemRangeByScore(ctx, key, "-inf", "("+staleBefore)
+	card := pipe.ZCard(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("counting gateway sessions: %w", err)
+	}
+	return card.Val(), nil
+}
+
+// Publish sends a message on a pub/sub channel.
+func (c *Client) Publish(ctx context.Context, channel string, message []byte) error {
+	return c.rdb.Publish(ctx, channel, message).Err()
+}
+
+// Subscription is an active pub/sub subscription.
+type Subscription struct {
+	ps       *goredis.PubSub
+	messages chan []byte
+}
+
+// Subscribe subscribes to a pub/sub channel. It returns once the subscription
+// is confirmed by the server, so messages published afterwards are delivered.
+func (c *Client) Subscribe(ctx context.Context, channel string) (*Subscription, error) {
+	ps := c.rdb.Subscribe(ctx, channel)
+	if _, err := ps.Receive(ctx); err != nil {
+		_ = ps.Close()
+		return nil, fmt.Errorf("subscribing to %s: %w", channel, err)
+	}
+
+	sub := &Subscription{ps: ps, messages: make(chan []byte)}
+	go func() {
+		defer close(sub.messages)
+		for msg := range ps.Channel() {
+			sub.messages <- []byte(msg.Payload)
+		}
+	}()
+	return sub, nil
+}
+
+// Messages returns the channel on which message payloads are delivered. It is
+// closed once the subscription is closed.
+func (s *Subscription) Messages() <-chan []byte {
+	return s.messages
+}
+
+// Close unsubscribes and releases the subscription's connection.
+func (s *Subscription) Close() error {
+	return s.ps.Close()
+}
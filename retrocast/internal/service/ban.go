@@ -18,6 +18,7 @@ type BanService struct {
 	bans    database.BanRepository
 	gateway gateway.Dispatcher
 	perms   *PermissionChecker
+	audit   *AuditLogService
 }
 
 // NewBanService creates a BanService.
@@ -28,6 +29,7 @@ func NewBanService(
 	bans database.BanRepository,
 	gw gateway.Dispatcher,
 	perms *PermissionChecker,
+	audit *AuditLogService,
 ) *BanService {
 	return &BanService{
 		guilds:  guilds,
@@ -36,6 +38,7 @@ func NewBanService(
 		bans:    bans,
 		gateway: gw,
 		perms:   perms,
+		audit:   audit,
 	}
 }
 
@@ -86,6 +89,13 @@ func (s *BanService) BanMember(ctx context.Context, guildID, callerID, targetUse
 	}
 
 	_ = s.members.Delete(ctx, guildID, targetUserID)
+	s.gateway.InvalidateMemberPermissions(guildID, targetUserID)
+
+	// The ban's own reason stands in when no audit log reason was given.
+	if reason != nil && auditLogReason(ctx) == nil {
+		ctx = WithAuditLogReason(ctx, *reason)
+	}
+	s.audit.record(ctx, guildID, callerID, models.AuditLogMemberBanAdd, targetUserID, nil, nil)
 
 	s.gateway.DispatchToGuild(guildID, gateway.EventGuildBanAdd, ban)
 	s.gateway.DispatchToGuild(guildID, gateway.EventGuildMemberRemove, map[string]any{"guild_id": guildID, "user_id": targetUserID})
@@ -103,6 +113,8 @@ func (s *BanService) UnbanMember(ctx context.Context, guildID, callerID, targetU
 		return Internal("INTERNAL", "internal server error")
 	}
 
+	s.audit.record(ctx, guildID, callerID, models.AuditLogMemberBanRemove, targetUserID, nil, nil)
+
 	s.gateway.DispatchToGuild(guildID, gateway.EventGuildBanRemove, map[string]any{"guild_id": guildID, "user_id": targetUserID})
 
 	return nil
@@ -10,6 +10,14 @@ import (
 	"github.com/victorivanov/retrocast/internal/snowflake"
 )
 
+// Voice channel settings.
+const (
+	defaultVoiceBitrate = 64000
+	minVoiceBitrate     = 8000
+	maxVoiceBitrate     = 96000
+	maxVoiceUserLimit   = 99
+)
+
 // ChannelService handles channel business logic.
 type ChannelService struct {
 	channels  database.ChannelRepository
@@ -17,6 +25,7 @@ type ChannelService struct {
 	snowflake *snowflake.Generator
 	gateway   gateway.Dispatcher
 	perms     *PermissionChecker
+	audit     *AuditLogService
 }
 
 // NewChannelService creates a ChannelService.
@@ -26,6 +35,7 @@ func NewChannelService(
 	sf *snowflake.Generator,
 	gw gateway.Dispatcher,
 	perms *PermissionChecker,
+	audit *AuditLogService,
 ) *ChannelService {
 	return &ChannelService{
 		channels:  channels,
@@ -33,11 +43,13 @@ func NewChannelService(
 		snowflake: sf,
 		gateway:   gw,
 		perms:     perms,
+		audit:     audit,
 	}
 }
 
-// CreateChannel creates a channel in the given guild.
-func (s *ChannelService) CreateChannel(ctx context.Context, guildID, userID int64, name string, chType models.ChannelType, topic *string, parentID *int64) (*models.Channel, error) {
+// CreateChannel creates a channel in the given guild. bitrate and userLimit
+// only apply to voice and stage channels.
+func (s *ChannelService) CreateChannel(ctx context.Context, guildID, userID int64, name string, chType models.ChannelType, topic *string, parentID *int64, bitrate, userLimit *int) (*models.Channel, error) {
 	if err := s.perms.RequireGuildPermission(ctx, guildID, userID, int64(permissions.PermManageChannels)); err != nil {
 		return nil, err
 	}
@@ -47,9 +59,12 @@ func (s *ChannelService) CreateChannel(ctx context.Context, guildID, userID int6
 	}
 
 	switch chType {
-	case models.ChannelTypeText, models.ChannelTypeVoice, models.ChannelTypeCategory:
+	case models.ChannelTypeText, models.ChannelTypeVoice, models.ChannelTypeCategory, models.ChannelTypeStage:
 	default:
-		return nil, BadRequest("INVALID_TYPE", "channel type must be 0 (text), 2 (voice), or 4 (category)")
+		return nil, BadRequest("INVALID_TYPE", "channel type must be 0 (text), 2 (voice), 4 (category), or 13 (stage)")
+	}
+	if !chType.IsVoice() && (bitrate != nil || userLimit != nil) {
+		return nil, BadRequest("INVALID_VOICE_SETTINGS", "bitrate and user_limit only apply to voice and stage channels")
 	}
 
 	existing, err := s.channels.GetByGuildID(ctx, guildID)
@@ -66,12 +81,32 @@ func (s *ChannelService) CreateChannel(ctx context.Context, guildID, userID int6
 		Topic:    topic,
 		ParentID: parentID,
 	}
+	if chType.IsVoice() {
+		ch.Bitrate = defaultVoiceBitrate
+		if err := applyVoiceSettings(ch, bitrate, userLimit); err != nil {
+			return nil, err
+		}
+	}
 
 	if err := s.channels.Create(ctx, ch); err != nil {
 		return nil, Internal("INTERNAL", "internal server error")
 	}
 
-	s.gateway.DispatchToGuild(guildID, gateway.EventChannelCreate, ch)
+	changes := auditDiff{}.
+		change("name", nil, ch.Name).
+		change("type", nil, int(ch.Type)).
+		change("topic", nil, auditOptionalString(ch.Topic))
+	if ch.ParentID != nil {
+		changes = changes.change("parent_id", nil, auditID(*ch.ParentID))
+	}
+	if ch.Type.IsVoice() {
+		changes = changes.
+			change("bitrate", nil, ch.Bitrate).
+			change("user_limit", nil, ch.UserLimit)
+	}
+	s.audit.record(ctx, guildID, userID, models.AuditLogChannelCreate, ch.ID, changes, nil)
+
+	s.gateway.DispatchToChannel(guildID, ch.ID, gateway.EventChannelCreate, ch)
 	return ch, nil
 }
 
@@ -117,8 +152,9 @@ func (s *ChannelService) GetChannel(ctx context.Context, channelID, userID int64
 	return ch, nil
 }
 
-// UpdateChannel updates channel name, topic, and/or position.
-func (s *ChannelService) UpdateChannel(ctx context.Context, channelID, userID int64, name *string, topic *string, position *int) (*models.Channel, error) {
+// UpdateChannel updates channel name, topic, position, and/or, for voice and
+// stage channels, bitrate and user limit.
+func (s *ChannelService) UpdateChannel(ctx context.Context, channelID, userID int64, name *string, topic *string, position *int, bitrate, userLimit *int) (*models.Channel, error) {
 	ch, err := s.channels.GetByID(ctx, channelID)
 	if err != nil {
 		return nil, Internal("INTERNAL", "internal server error")
@@ -131,6 +167,7 @@ func (s *ChannelService) UpdateChannel(ctx context.Context, channelID, userID in
 		return nil, err
 	}
 
+	old := *ch
 	if name != nil {
 		if len(*name) < 1 || len(*name) > 100 {
 			return nil, BadRequest("INVALID_NAME", "channel name must be 1-100 characters")
@@ -143,15 +180,48 @@ func (s *ChannelService) UpdateChannel(ctx context.Context, channelID, userID in
 	if position != nil {
 		ch.Position = *position
 	}
+	if bitrate != nil || userLimit != nil {
+		if !ch.Type.IsVoice() {
+			return nil, BadRequest("INVALID_VOICE_SETTINGS", "bitrate and user_limit only apply to voice and stage channels")
+		}
+		if err := applyVoiceSettings(ch, bitrate, userLimit); err != nil {
+			return nil, err
+		}
+	}
 
 	if err := s.channels.Update(ctx, ch); err != nil {
 		return nil, Internal("INTERNAL", "internal server error")
 	}
 
-	s.gateway.DispatchToGuild(ch.GuildID, gateway.EventChannelUpdate, ch)
+	changes := auditDiff{}.
+		change("name", old.Name, ch.Name).
+		change("topic", auditOptionalString(old.Topic), auditOptionalString(ch.Topic)).
+		change("position", old.Position, ch.Position).
+		change("bitrate", old.Bitrate, ch.Bitrate).
+		change("user_limit", old.UserLimit, ch.UserLimit)
+	s.audit.record(ctx, ch.GuildID, userID, models.AuditLogChannelUpdate, channelID, changes, nil)
+
+	s.gateway.DispatchToChannel(ch.GuildID, ch.ID, gateway.EventChannelUpdate, ch)
 	return ch, nil
 }
 
+// applyVoiceSettings validates and sets the given voice settings on ch.
+func applyVoiceSettings(ch *models.Channel, bitrate, userLimit *int) error {
+	if bitrate != nil {
+		if *bitrate < minVoiceBitrate || *bitrate > maxVoiceBitrate {
+			return BadRequest("INVALID_BITRATE", "bitrate must be 8000-96000")
+		}
+		ch.Bitrate = *bitrate
+	}
+	if userLimit != nil {
+		if *userLimit < 0 || *userLimit > maxVoiceUserLimit {
+			return BadRequest("INVALID_USER_LIMIT", "user_limit must be 0-99")
+		}
+		ch.UserLimit = *userLimit
+	}
+	return nil
+}
+
 // DeleteChannel deletes a channel.
 func (s *ChannelService) DeleteChannel(ctx context.Context, channelID, userID int64) error {
 	ch, err := s.channels.GetByID(ctx, channelID)
@@ -166,10 +236,31 @@ func (s *ChannelService) DeleteChannel(ctx context.Context, channelID, userID in
 		return err
 	}
 
+	// The channel's overrides go with it, so who could see it has to be
+	// resolved before the delete.
+	viewers, err := s.channelViewers(ctx, ch)
+	if err != nil {
+		return err
+	}
+
 	if err := s.channels.Delete(ctx, channelID); err != nil {
 		return Internal("INTERNAL", "internal server error")
 	}
 
-	s.gateway.DispatchToGuild(ch.GuildID, gateway.EventChannelDelete, map[string]any{"id": channelID, "guild_id": ch.GuildID})
+	changes := auditDiff{}.
+		change("name", ch.Name, nil).
+		change("type", int(ch.Type), nil)
+	s.audit.record(ctx, ch.GuildID, userID, models.AuditLogChannelDelete, channelID, changes, nil)
+
+	s.gateway.DispatchToGuildMembers(ch.GuildID, viewers, gateway.EventChannelDelete, map[string]any{"id": channelID, "guild_id": ch.GuildID})
 	return nil
 }
+
+// channelViewers returns the guild members allowed to view a channel.
+func (s *ChannelService) channelViewers(ctx context.Context, ch *models.Channel) ([]int64, error) {
+	memberIDs, err := s.members.GetUserIDsByGuild(ctx, ch.GuildID)
+	if err != nil {
+		return nil, Internal("INTERNAL", "internal server error")
+	}
+	return s.perms.FilterChannelPermission(ctx, ch.GuildID, ch.ID, memberIDs, permissions.PermViewChannel)
+}
@@ -20,6 +20,7 @@ type GuildService struct {
 	snowflake *snowflake.Generator
 	gateway   gateway.Dispatcher
 	perms     *PermissionChecker
+	audit     *AuditLogService
 }
 
 // NewGuildService creates a GuildService.
@@ -31,6 +32,7 @@ func NewGuildService(
 	sf *snowflake.Generator,
 	gw gateway.Dispatcher,
 	perms *PermissionChecker,
+	audit *AuditLogService,
 ) *GuildService {
 	return &GuildService{
 		guilds:    guilds,
@@ -40,6 +42,7 @@ func NewGuildService(
 		snowflake: sf,
 		gateway:   gw,
 		perms:     perms,
+		audit:     audit,
 	}
 }
 
@@ -117,12 +120,13 @@ func (s *GuildService) CreateGuild(ctx context.Context, userID int64, name strin
 		Name:     "General",
 		Type:     models.ChannelTypeVoice,
 		Position: 1,
+		Bitrate:  defaultVoiceBitrate,
 	}
 	if err := s.channels.Create(ctx, generalVoice); err != nil {
 		return nil, Internal("INTERNAL", "internal server error")
 	}
 
-	s.gateway.DispatchToUser(userID, gateway.EventGuildCreate, guild)
+	s.gateway.JoinGuild(userID, guild.ID)
 	return guild, nil
 }
 
@@ -161,6 +165,7 @@ func (s *GuildService) UpdateGuild(ctx context.Context, guildID, userID int64, n
 		return nil, NotFound("NOT_FOUND", "guild not found")
 	}
 
+	old := *guild
 	if name != nil {
 		if len(*name) < 2 || len(*name) > 100 {
 			return nil, BadRequest("INVALID_NAME", "guild name must be 2-100 characters")
@@ -175,6 +180,11 @@ func (s *GuildService) UpdateGuild(ctx context.Context, guildID, userID int64, n
 		return nil, Internal("INTERNAL", "internal server error")
 	}
 
+	changes := auditDiff{}.
+		change("name", old.Name, guild.Name).
+		change("icon_hash", auditOptionalString(old.IconHash), auditOptionalString(guild.IconHash))
+	s.audit.record(ctx, guildID, userID, models.AuditLogGuildUpdate, guildID, changes, nil)
+
 	s.gateway.DispatchToGuild(guildID, gateway.EventGuildUpdate, guild)
 	return guild, nil
 }
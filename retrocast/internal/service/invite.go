@@ -179,6 +179,7 @@ func (s *InviteService) AcceptInvite(ctx context.Context, code string, userID in
 	if err := s.members.Create(ctx, member); err != nil {
 		return nil, Internal("INTERNAL", "internal server error")
 	}
+	s.gateway.InvalidateMemberPermissions(invite.GuildID, userID)
 
 	if err := s.invites.IncrementUses(ctx, code); err != nil {
 		return nil, Internal("INTERNAL", "internal server error")
@@ -190,6 +191,7 @@ func (s *InviteService) AcceptInvite(ctx context.Context, code string, userID in
 	}
 
 	s.gateway.DispatchToGuild(invite.GuildID, gateway.EventGuildMemberAdd, member)
+	s.gateway.JoinGuild(userID, invite.GuildID)
 
 	return guild, nil
 }
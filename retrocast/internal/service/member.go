@@ -16,26 +16,34 @@ type MemberService struct {
 	roles   database.RoleRepository
 	gateway gateway.Dispatcher
 	perms   *PermissionChecker
+	audit   *AuditLogService
+
+	presences PresenceLoader
 }
 
-// NewMemberService creates a MemberService.
+// NewMemberService creates a MemberService. presences may be nil.
 func NewMemberService(
 	members database.MemberRepository,
 	guilds database.GuildRepository,
 	roles database.RoleRepository,
 	gw gateway.Dispatcher,
 	perms *PermissionChecker,
+	audit *AuditLogService,
+	presences PresenceLoader,
 ) *MemberService {
 	return &MemberService{
-		members: members,
-		guilds:  guilds,
-		roles:   roles,
-		gateway: gw,
-		perms:   perms,
+		members:   members,
+		guilds:    guilds,
+		roles:     roles,
+		gateway:   gw,
+		perms:     perms,
+		audit:     audit,
+		presences: presences,
 	}
 }
 
-// ListMembers returns members of a guild. Caller must be a member.
+// ListMembers returns members of a guild with their presences. Caller must
+// be a member.
 func (s *MemberService) ListMembers(ctx context.Context, guildID, userID int64, limit, offset int) ([]models.Member, error) {
 	member, err := s.members.GetByGuildAndUser(ctx, guildID, userID)
 	if err != nil {
@@ -59,10 +67,22 @@ func (s *MemberService) ListMembers(ctx context.Context, guildID, userID int64,
 	if members == nil {
 		members = []models.Member{}
 	}
+
+	userIDs := make([]int64, len(members))
+	for i, mem := range members {
+		userIDs[i] = mem.UserID
+	}
+	presences := loadPresences(ctx, s.presences, userIDs)
+	for i := range members {
+		if p, ok := presences[members[i].UserID]; ok {
+			members[i].Presence = &p
+		}
+	}
 	return members, nil
 }
 
-// GetMember returns a specific member. Caller must be a member.
+// GetMember returns a specific member with their presence. Caller must be a
+// member.
 func (s *MemberService) GetMember(ctx context.Context, guildID, callerID, targetUserID int64) (*models.Member, error) {
 	callerMember, err := s.members.GetByGuildAndUser(ctx, guildID, callerID)
 	if err != nil {
@@ -79,6 +99,9 @@ func (s *MemberService) GetMember(ctx context.Context, guildID, callerID, target
 	if member == nil {
 		return nil, NotFound("NOT_FOUND", "member not found")
 	}
+	if p, ok := loadPresences(ctx, s.presences, []int64{targetUserID})[targetUserID]; ok {
+		member.Presence = &p
+	}
 
 	return member, nil
 }
@@ -181,6 +204,7 @@ func (s *MemberService) UpdateMember(ctx context.Context, guildID, callerID, tar
 		if err != nil {
 			return nil, Internal("INTERNAL", "internal server error")
 		}
+		s.gateway.InvalidateMemberPermissions(guildID, targetUserID)
 	}
 
 	s.gateway.DispatchToGuild(guildID, gateway.EventGuildMemberUpdate, member)
@@ -212,6 +236,9 @@ func (s *MemberService) KickMember(ctx context.Context, guildID, callerID, targe
 	if err := s.members.Delete(ctx, guildID, targetUserID); err != nil {
 		return Internal("INTERNAL", "internal server error")
 	}
+	s.gateway.InvalidateMemberPermissions(guildID, targetUserID)
+
+	s.audit.record(ctx, guildID, callerID, models.AuditLogMemberKick, targetUserID, nil, nil)
 
 	s.gateway.DispatchToGuild(guildID, gateway.EventGuildMemberRemove, map[string]any{"guild_id": guildID, "user_id": targetUserID})
 	return nil
@@ -238,6 +265,7 @@ func (s *MemberService) LeaveGuild(ctx context.Context, guildID, userID int64) e
 	if err := s.members.Delete(ctx, guildID, userID); err != nil {
 		return Internal("INTERNAL", "internal server error")
 	}
+	s.gateway.InvalidateMemberPermissions(guildID, userID)
 
 	s.gateway.DispatchToGuild(guildID, gateway.EventGuildMemberRemove, map[string]any{"guild_id": guildID, "user_id": userID})
 	return nil
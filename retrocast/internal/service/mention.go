@@ -0,0 +1,244 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"regexp"
+	"strconv"
+
+	"github.com/victorivanov/retrocast/internal/models"
+	"github.com/victorivanov/retrocast/internal/permissions"
+)
+
+var (
+	userMentionRe     = regexp.MustCompile(`<@!?(\d+)>`)
+	roleMentionRe     = regexp.MustCompile(`<@&(\d+)>`)
+	everyoneMentionRe = regexp.MustCompile(`@everyone\b`)
+	hereMentionRe     = regexp.MustCompile(`@here\b`)
+)
+
+// PresenceReader reports users' current presence status. It is used to
+// resolve @here mentions to the members that are online.
+type PresenceReader interface {
+	GetStatuses(ctx context.Context, userIDs []int64) (map[int64]string, error)
+}
+
+// parsedMentions holds the mentions found in message content.
+type parsedMentions struct {
+	users    []int64
+	roles    []int64
+	everyone bool
+	here     bool
+}
+
+// parseMentions extracts <@user>, <@&role>, @everyone and @here mentions
+// from message content. IDs are deduplicated in order of appearance.
+func parseMentions(content string) parsedMentions {
+	return parsedMentions{
+		users:    mentionIDs(userMentionRe, content),
+		roles:    mentionIDs(roleMentionRe, content),
+		everyone: everyoneMentionRe.MatchString(content),
+		here:     hereMentionRe.MatchString(content),
+	}
+}
+
+func mentionIDs(re *regexp.Regexp, content string) []int64 {
+	var ids []int64
+	seen := make(map[int64]bool)
+	for _, m := range re.FindAllStringSubmatch(content, -1) {
+		id, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil || seen[id] {
+			continue
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// resolveMentions fills in msg's mention fields from its content and returns
+// the users to notify: everyone mentioned directly, through a role or through
+// @everyone/@here who can view the channel, except the author. @everyone and
+// @here only count if the author has MENTION_EVERYONE. channel is nil for DMs,
+// where only recipients can be mentioned.
+func (s *MessageService) resolveMentions(ctx context.Context, channel *models.Channel, msg *models.Message) ([]int64, error) {
+	parsed := parseMentions(msg.Content)
+	msg.Mentions = []int64{}
+	msg.MentionRoles = []int64{}
+	msg.MentionEveryone = false
+
+	if channel == nil {
+		return s.resolveDMMentions(ctx, msg, parsed)
+	}
+
+	massMention := false
+	if parsed.everyone || parsed.here {
+		ok, err := s.perms.HasChannelPermission(ctx, channel.GuildID, channel.ID, msg.AuthorID, permissions.PermMentionEveryone)
+		if err != nil {
+			return nil, err
+		}
+		massMention = ok
+	}
+
+	mentioned, err := s.perms.FilterChannelPermission(ctx, channel.GuildID, channel.ID, parsed.users, permissions.PermViewChannel)
+	if err != nil {
+		return nil, err
+	}
+	if mentioned != nil {
+		msg.Mentions = mentioned
+	}
+
+	if len(parsed.roles) > 0 {
+		guildRoles, err := s.roles.GetByGuildID(ctx, channel.GuildID)
+		if err != nil {
+			return nil, Internal("INTERNAL", "internal server error")
+		}
+		valid := make(map[int64]bool, len(guildRoles))
+		for _, r := range guildRoles {
+			if !r.IsDefault {
+				valid[r.ID] = true
+			}
+		}
+		for _, id := range parsed.roles {
+			if valid[id] {
+				msg.MentionRoles = append(msg.MentionRoles, id)
+			}
+		}
+	}
+
+	var expanded []int64
+	if massMention {
+		msg.MentionEveryone = true
+		ids, err := s.members.GetUserIDsByGuild(ctx, channel.GuildID)
+		if err != nil {
+			return nil, Internal("INTERNAL", "internal server error")
+		}
+		if !parsed.everyone {
+			ids = s.onlineUsers(ctx, ids)
+		}
+		expanded = append(expanded, ids...)
+	}
+	if len(msg.MentionRoles) > 0 {
+		ids, err := s.members.GetUserIDsByRoles(ctx, channel.GuildID, msg.MentionRoles)
+		if err != nil {
+			return nil, Internal("INTERNAL", "internal server error")
+		}
+		expanded = append(expanded, ids...)
+	}
+
+	// Direct mentions were already checked for channel access.
+	if len(expanded) == 0 {
+		return withoutUser(msg.Mentions, msg.AuthorID), nil
+	}
+	candidates := uniqueIDs(append(append([]int64(nil), msg.Mentions...), expanded...))
+	return s.perms.FilterChannelPermission(ctx, channel.GuildID, channel.ID, withoutUser(candidates, msg.AuthorID), permissions.PermViewChannel)
+}
+
+// resolveDMMentions keeps the direct mentions of DM recipients.
+func (s *MessageService) resolveDMMentions(ctx context.Context, msg *models.Message, parsed parsedMentions) ([]int64, error) {
+	if len(parsed.users) == 0 {
+		return nil, nil
+	}
+	recipients, err := s.dmChannels.GetRecipientIDs(ctx, msg.ChannelID)
+	if err != nil {
+		return nil, Internal("INTERNAL", "internal server error")
+	}
+	isRecipient := make(map[int64]bool, len(recipients))
+	for _, id := range recipients {
+		isRecipient[id] = true
+	}
+	for _, id := range parsed.users {
+		if isRecipient[id] {
+			msg.Mentions = append(msg.Mentions, id)
+		}
+	}
+	return withoutUser(msg.Mentions, msg.AuthorID), nil
+}
+
+// mentionRepliedUser adds the author of a replied-to message to msg's
+// mentions and to notify, provided they can still see the channel.
+func (s *MessageService) mentionRepliedUser(ctx context.Context, channel *models.Channel, msg *models.Message, authorID int64, notify []int64) ([]int64, error) {
+	if authorID == msg.AuthorID || containsID(msg.Mentions, authorID) {
+		return notify, nil
+	}
+
+	if channel != nil {
+		allowed, err := s.perms.HasChannelPermission(ctx, channel.GuildID, channel.ID, authorID, permissions.PermViewChannel)
+		if err != nil || !allowed {
+			return notify, err
+		}
+	} else {
+		ok, err := s.dmChannels.IsRecipient(ctx, msg.ChannelID, authorID)
+		if err != nil {
+			return nil, Internal("INTERNAL", "internal server error")
+		}
+		if !ok {
+			return notify, nil
+		}
+	}
+
+	msg.Mentions = append(msg.Mentions, authorID)
+	return append(notify, authorID), nil
+}
+
+// notifyMentions increments the unread mention count of each user for the
+// channel. Failures are logged rather than failing the send.
+func (s *MessageService) notifyMentions(ctx context.Context, channelID int64, userIDs []int64) {
+	if len(userIDs) == 0 {
+		return
+	}
+	if err := s.readStates.IncrementMentionCounts(ctx, channelID, userIDs); err != nil {
+		slog.Error("failed to increment mention counts", "channelID", channelID, "users", len(userIDs), "error", err)
+	}
+}
+
+// onlineUsers returns the users whose presence is not offline. If presence
+// cannot be read, nobody is treated as online.
+func (s *MessageService) onlineUsers(ctx context.Context, userIDs []int64) []int64 {
+	if s.presence == nil {
+		return nil
+	}
+	statuses, err := s.presence.GetStatuses(ctx, userIDs)
+	if err != nil {
+		slog.Error("failed to get presences for @here", "error", err)
+		return nil
+	}
+	var online []int64
+	for _, id := range userIDs {
+		if status := statuses[id]; status != "" && status != "offline" {
+			online = append(online, id)
+		}
+	}
+	return online
+}
+
+func uniqueIDs(ids []int64) []int64 {
+	seen := make(map[int64]bool, len(ids))
+	out := ids[:0]
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+func containsID(ids []int64, id int64) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+func withoutUser(ids []int64, userID int64) []int64 {
+	out := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if id != userID {
+			out = append(out, id)
+		}
+	}
+	return out
+}
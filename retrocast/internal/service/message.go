@@ -2,6 +2,8 @@ package service
 
 import (
 	"context"
+	"errors"
+	"strconv"
 	"time"
 
 	"github.com/victorivanov/retrocast/internal/database"
@@ -11,73 +13,149 @@ import (
 	"github.com/victorivanov/retrocast/internal/snowflake"
 )
 
+const (
+	maxAttachmentsPerMessage = 10
+	maxPinsPerChannel        = 50
+)
+
 // MessageService handles message business logic for both guild and DM channels.
 type MessageService struct {
-	messages   database.MessageRepository
-	channels   database.ChannelRepository
-	dmChannels database.DMChannelRepository
-	snowflake  *snowflake.Generator
-	gateway    gateway.Dispatcher
-	perms      *PermissionChecker
+	messages    database.MessageRepository
+	attachments database.AttachmentRepository
+	channels    database.ChannelRepository
+	dmChannels  database.DMChannelRepository
+	members     database.MemberRepository
+	roles       database.RoleRepository
+	readStates  database.ReadStateRepository
+	snowflake   *snowflake.Generator
+	storage     FileStorage
+	gateway     gateway.Dispatcher
+	perms       *PermissionChecker
+	presence    PresenceReader
 }
 
 // NewMessageService creates a MessageService.
 func NewMessageService(
 	messages database.MessageRepository,
+	attachments database.AttachmentRepository,
 	channels database.ChannelRepository,
 	dmChannels database.DMChannelRepository,
+	members database.MemberRepository,
+	roles database.RoleRepository,
+	readStates database.ReadStateRepository,
 	sf *snowflake.Generator,
+	storage FileStorage,
 	gw gateway.Dispatcher,
 	perms *PermissionChecker,
+	presence PresenceReader,
 ) *MessageService {
 	return &MessageService{
-		messages:   messages,
-		channels:   channels,
-		dmChannels: dmChannels,
-		snowflake:  sf,
-		gateway:    gw,
-		perms:      perms,
+		messages:    messages,
+		attachments: attachments,
+		channels:    channels,
+		dmChannels:  dmChannels,
+		members:     members,
+		roles:       roles,
+		readStates:  readStates,
+		snowflake:   sf,
+		storage:     storage,
+		gateway:     gw,
+		perms:       perms,
+		presence:    presence,
 	}
 }
 
-// SendMessage creates a message in a guild or DM channel.
-func (s *MessageService) SendMessage(ctx context.Context, channelID, userID int64, content string) (*models.MessageWithAuthor, error) {
+// SendMessage creates a message in a guild or DM channel. attachmentIDStrs
+// lists previously uploaded attachments to bind to the message; a message
+// with at least one attachment may have empty content. Mentioned users that
+// can see the channel get their unread mention count incremented. A non-nil
+// reference makes the message a reply, which also mentions the author of the
+// replied-to message.
+func (s *MessageService) SendMessage(ctx context.Context, channelID, userID int64, content string, attachmentIDStrs []string, reference *models.MessageReference) (*models.MessageWithAuthor, error) {
 	channel, isDM, err := s.resolveChannelAccess(ctx, channelID, userID)
 	if err != nil {
 		return nil, err
 	}
 
+	attachmentIDs, err := parseAttachmentIDs(attachmentIDStrs)
+	if err != nil {
+		return nil, err
+	}
+
 	if !isDM {
 		if err := s.perms.RequireChannelPermission(ctx, channel.GuildID, channelID, userID, permissions.PermSendMessages); err != nil {
 			return nil, err
 		}
+		if len(attachmentIDs) > 0 {
+			if err := s.perms.RequireChannelPermission(ctx, channel.GuildID, channelID, userID, permissions.PermAttachFiles); err != nil {
+				return nil, err
+			}
+		}
 	}
 
-	if len(content) == 0 || len(content) > 2000 {
+	if len(content) > 2000 || (len(content) == 0 && len(attachmentIDs) == 0) {
 		return nil, BadRequest("INVALID_CONTENT", "message content must be 1-2000 characters")
 	}
 
+	var replyTo *models.MessageWithAuthor
+	if reference != nil {
+		replyTo, err = s.resolveReference(ctx, channel, channelID, userID, reference)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	msg := &models.Message{
-		ID:        s.snowflake.Generate().Int64(),
-		ChannelID: channelID,
-		AuthorID:  userID,
-		Content:   content,
-		CreatedAt: time.Now(),
+		ID:               s.snowflake.Generate().Int64(),
+		ChannelID:        channelID,
+		AuthorID:         userID,
+		Content:          content,
+		CreatedAt:        time.Now(),
+		MessageReference: reference,
+	}
+
+	notify, err := s.resolveMentions(ctx, channel, msg)
+	if err != nil {
+		return nil, err
+	}
+	if replyTo != nil {
+		notify, err = s.mentionRepliedUser(ctx, channel, msg, replyTo.AuthorID, notify)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	if err := s.messages.Create(ctx, msg); err != nil {
+	if len(attachmentIDs) == 0 {
+		err = s.messages.Create(ctx, msg)
+	} else {
+		err = s.messages.CreateWithAttachments(ctx, msg, attachmentIDs)
+	}
+	if errors.Is(err, database.ErrAttachmentsUnavailable) {
+		return nil, BadRequest("INVALID_ATTACHMENTS", "one or more attachments are invalid or already in use")
+	}
+	if err != nil {
 		return nil, Internal("INTERNAL", "internal server error")
 	}
 
+	s.notifyMentions(ctx, channelID, notify)
+
+	// Posting in an archived thread brings it back.
+	if channel != nil && channel.Thread != nil && channel.Thread.Archived {
+		reopenThread(ctx, s.channels, s.gateway, channel)
+	}
+
 	full, err := s.messages.GetByID(ctx, msg.ID)
 	if err != nil || full == nil {
 		return nil, Internal("INTERNAL", "internal server error")
 	}
+	if err := s.populateAttachments(ctx, full); err != nil {
+		return nil, Internal("INTERNAL", "internal server error")
+	}
 
 	if isDM {
 		s.dispatchToDM(ctx, channelID, gateway.EventMessageCreate, full)
 	} else {
-		s.gateway.DispatchToGuild(channel.GuildID, gateway.EventMessageCreate, full)
+		s.gateway.DispatchToChannel(channel.GuildID, channelID, gateway.EventMessageCreate, full)
 	}
 
 	return full, nil
@@ -103,6 +181,14 @@ func (s *MessageService) GetMessages(ctx context.Context, channelID, userID int6
 	if messages == nil {
 		messages = []models.MessageWithAuthor{}
 	}
+
+	ptrs := make([]*models.MessageWithAuthor, len(messages))
+	for i := range messages {
+		ptrs[i] = &messages[i]
+	}
+	if err := s.populateAttachments(ctx, ptrs...); err != nil {
+		return nil, Internal("INTERNAL", "internal server error")
+	}
 	return messages, nil
 }
 
@@ -126,6 +212,9 @@ func (s *MessageService) GetMessage(ctx context.Context, channelID, msgID, userI
 	if msg == nil || msg.ChannelID != channelID {
 		return nil, NotFound("NOT_FOUND", "message not found")
 	}
+	if err := s.populateAttachments(ctx, msg); err != nil {
+		return nil, Internal("INTERNAL", "internal server error")
+	}
 
 	return msg, nil
 }
@@ -148,16 +237,31 @@ func (s *MessageService) EditMessage(ctx context.Context, channelID, msgID, user
 	if msg.AuthorID != userID {
 		return nil, Forbidden("FORBIDDEN", "you can only edit your own messages")
 	}
+	if err := s.populateAttachments(ctx, msg); err != nil {
+		return nil, Internal("INTERNAL", "internal server error")
+	}
 
-	if len(content) == 0 || len(content) > 2000 {
+	// Attachment-only messages may have their content cleared.
+	if len(content) > 2000 || (len(content) == 0 && len(msg.Attachments) == 0) {
 		return nil, BadRequest("INVALID_CONTENT", "message content must be 1-2000 characters")
 	}
 
 	now := time.Now()
 	updated := &models.Message{
-		ID:       msgID,
-		Content:  content,
-		EditedAt: &now,
+		ID:        msgID,
+		ChannelID: channelID,
+		AuthorID:  userID,
+		Content:   content,
+		EditedAt:  &now,
+	}
+
+	// Edits refresh the stored mentions but do not notify anyone again. The
+	// reply mention of the original author is kept.
+	if _, err := s.resolveMentions(ctx, channel, updated); err != nil {
+		return nil, err
+	}
+	if ref := msg.ReferencedMessage; ref != nil && containsID(msg.Mentions, ref.AuthorID) && !containsID(updated.Mentions, ref.AuthorID) {
+		updated.Mentions = append(updated.Mentions, ref.AuthorID)
 	}
 
 	if err := s.messages.Update(ctx, updated); err != nil {
@@ -168,11 +272,14 @@ func (s *MessageService) EditMessage(ctx context.Context, channelID, msgID, user
 	if err != nil || full == nil {
 		return nil, Internal("INTERNAL", "internal server error")
 	}
+	if err := s.populateAttachments(ctx, full); err != nil {
+		return nil, Internal("INTERNAL", "internal server error")
+	}
 
 	if isDM {
 		s.dispatchToDM(ctx, channelID, gateway.EventMessageUpdate, full)
 	} else {
-		s.gateway.DispatchToGuild(channel.GuildID, gateway.EventMessageUpdate, full)
+		s.gateway.DispatchToChannel(channel.GuildID, channelID, gateway.EventMessageUpdate, full)
 	}
 
 	return full, nil
@@ -215,12 +322,121 @@ func (s *MessageService) DeleteMessage(ctx context.Context, channelID, msgID, us
 	if isDM {
 		s.dispatchToDM(ctx, channelID, gateway.EventMessageDelete, deletePayload)
 	} else {
-		s.gateway.DispatchToGuild(channel.GuildID, gateway.EventMessageDelete, deletePayload)
+		s.gateway.DispatchToChannel(channel.GuildID, channelID, gateway.EventMessageDelete, deletePayload)
 	}
 
 	return nil
 }
 
+// PinMessage pins a message in its channel. Guild channels require
+// MANAGE_MESSAGES; any DM recipient may pin. A channel holds at most
+// maxPinsPerChannel pins.
+func (s *MessageService) PinMessage(ctx context.Context, channelID, msgID, userID int64) error {
+	channel, isDM, msg, err := s.resolvePinTarget(ctx, channelID, msgID, userID)
+	if err != nil {
+		return err
+	}
+	if msg.Pinned {
+		return nil
+	}
+
+	err = s.messages.Pin(ctx, channelID, msgID, maxPinsPerChannel)
+	if errors.Is(err, database.ErrPinLimitReached) {
+		return BadRequest("MAX_PINS_REACHED", "a channel can have at most 50 pinned messages")
+	}
+	if err != nil {
+		return Internal("INTERNAL", "internal server error")
+	}
+
+	s.dispatchPinsUpdate(ctx, channel, isDM, channelID)
+	return nil
+}
+
+// UnpinMessage unpins a message, with the same permissions as PinMessage.
+func (s *MessageService) UnpinMessage(ctx context.Context, channelID, msgID, userID int64) error {
+	channel, isDM, _, err := s.resolvePinTarget(ctx, channelID, msgID, userID)
+	if err != nil {
+		return err
+	}
+
+	unpinned, err := s.messages.Unpin(ctx, msgID)
+	if err != nil {
+		return Internal("INTERNAL", "internal server error")
+	}
+	if unpinned {
+		s.dispatchPinsUpdate(ctx, channel, isDM, channelID)
+	}
+	return nil
+}
+
+// GetPinnedMessages returns a channel's pinned messages, most recently
+// pinned first.
+func (s *MessageService) GetPinnedMessages(ctx context.Context, channelID, userID int64) ([]models.MessageWithAuthor, error) {
+	channel, isDM, err := s.resolveChannelAccess(ctx, channelID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isDM {
+		if err := s.perms.RequireChannelPermission(ctx, channel.GuildID, channelID, userID, permissions.PermReadMessageHistory); err != nil {
+			return nil, err
+		}
+	}
+
+	messages, err := s.messages.GetPinned(ctx, channelID)
+	if err != nil {
+		return nil, Internal("INTERNAL", "internal server error")
+	}
+	if messages == nil {
+		messages = []models.MessageWithAuthor{}
+	}
+
+	ptrs := make([]*models.MessageWithAuthor, len(messages))
+	for i := range messages {
+		ptrs[i] = &messages[i]
+	}
+	if err := s.populateAttachments(ctx, ptrs...); err != nil {
+		return nil, Internal("INTERNAL", "internal server error")
+	}
+	return messages, nil
+}
+
+// resolvePinTarget checks that the user may manage pins in the channel and
+// loads the message to pin or unpin.
+func (s *MessageService) resolvePinTarget(ctx context.Context, channelID, msgID, userID int64) (*models.Channel, bool, *models.MessageWithAuthor, error) {
+	channel, isDM, err := s.resolveChannelAccess(ctx, channelID, userID)
+	if err != nil {
+		return nil, false, nil, err
+	}
+
+	if !isDM {
+		if err := s.perms.RequireChannelPermission(ctx, channel.GuildID, channelID, userID, permissions.PermManageMessages); err != nil {
+			return nil, false, nil, err
+		}
+	}
+
+	msg, err := s.messages.GetByID(ctx, msgID)
+	if err != nil {
+		return nil, false, nil, Internal("INTERNAL", "internal server error")
+	}
+	if msg == nil || msg.ChannelID != channelID {
+		return nil, false, nil, NotFound("NOT_FOUND", "message not found")
+	}
+	return channel, isDM, msg, nil
+}
+
+// dispatchPinsUpdate tells everyone who can see the channel that its pins
+// changed.
+func (s *MessageService) dispatchPinsUpdate(ctx context.Context, channel *models.Channel, isDM bool, channelID int64) {
+	data := gateway.ChannelPinsUpdateData{ChannelID: channelID}
+	if isDM {
+		s.dispatchToDM(ctx, channelID, gateway.EventChannelPinsUpdate, data)
+		return
+	}
+	data.GuildID = channel.GuildID
+	s.gateway.DispatchToChannel(channel.GuildID, channelID, gateway.EventChannelPinsUpdate, data)
+}
+
 // Typing dispatches a typing indicator event.
 func (s *MessageService) Typing(ctx context.Context, channelID, userID int64) error {
 	channel, isDM, err := s.resolveChannelAccess(ctx, channelID, userID)
@@ -251,7 +467,7 @@ func (s *MessageService) Typing(ctx context.Context, channelID, userID int64) er
 		}
 	} else {
 		typingData.GuildID = channel.GuildID
-		s.gateway.DispatchToGuild(channel.GuildID, gateway.EventTypingStart, typingData)
+		s.gateway.DispatchToChannel(channel.GuildID, channelID, gateway.EventTypingStart, typingData)
 	}
 
 	return nil
@@ -288,6 +504,33 @@ func (s *MessageService) resolveChannelAccess(ctx context.Context, channelID, us
 	return channel, false, nil
 }
 
+// resolveReference validates the message a reply points at: it must be in the
+// same channel and the caller must be able to read the channel's history.
+// A reference without a channel ID defaults to the current channel.
+func (s *MessageService) resolveReference(ctx context.Context, channel *models.Channel, channelID, userID int64, ref *models.MessageReference) (*models.MessageWithAuthor, error) {
+	if ref.ChannelID == 0 {
+		ref.ChannelID = channelID
+	}
+	if ref.ChannelID != channelID || ref.MessageID == 0 {
+		return nil, BadRequest("INVALID_MESSAGE_REFERENCE", "replies must reference a message in the same channel")
+	}
+
+	if channel != nil {
+		if err := s.perms.RequireChannelPermission(ctx, channel.GuildID, channelID, userID, permissions.PermReadMessageHistory); err != nil {
+			return nil, err
+		}
+	}
+
+	target, err := s.messages.GetByID(ctx, ref.MessageID)
+	if err != nil {
+		return nil, Internal("INTERNAL", "internal server error")
+	}
+	if target == nil || target.ChannelID != channelID {
+		return nil, BadRequest("INVALID_MESSAGE_REFERENCE", "referenced message not found")
+	}
+	return target, nil
+}
+
 // dispatchToDM dispatches an event to all DM recipients.
 func (s *MessageService) dispatchToDM(ctx context.Context, channelID int64, event string, data any) {
 	dm, _ := s.dmChannels.GetByID(ctx, channelID)
@@ -297,3 +540,56 @@ func (s *MessageService) dispatchToDM(ctx context.Context, channelID int64, even
 		}
 	}
 }
+
+// populateAttachments loads the attachments bound to each message and fills
+// in their public URLs. Messages without attachments get an empty slice.
+func (s *MessageService) populateAttachments(ctx context.Context, msgs ...*models.MessageWithAuthor) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(msgs))
+	byID := make(map[int64]*models.MessageWithAuthor, len(msgs))
+	for i, m := range msgs {
+		ids[i] = m.ID
+		byID[m.ID] = m
+		m.Attachments = []models.Attachment{}
+	}
+
+	attachments, err := s.attachments.GetByMessageIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for _, a := range attachments {
+		m, ok := byID[a.MessageID]
+		if !ok {
+			continue
+		}
+		a.URL = s.storage.GetURL(a.StorageKey)
+		m.Attachments = append(m.Attachments, a)
+	}
+	return nil
+}
+
+// parseAttachmentIDs validates and deduplicates the attachment IDs supplied
+// with a new message.
+func parseAttachmentIDs(idStrs []string) ([]int64, error) {
+	if len(idStrs) > maxAttachmentsPerMessage {
+		return nil, BadRequest("INVALID_ATTACHMENTS", "too many attachments (max 10)")
+	}
+
+	ids := make([]int64, 0, len(idStrs))
+	seen := make(map[int64]bool, len(idStrs))
+	for _, idStr := range idStrs {
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil || id == 0 {
+			return nil, BadRequest("INVALID_ATTACHMENTS", "invalid attachment id")
+		}
+		if seen[id] {
+			return nil, BadRequest("INVALID_ATTACHMENTS", "duplicate attachment id")
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
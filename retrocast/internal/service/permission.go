@@ -14,6 +14,7 @@ type PermissionChecker struct {
 	members   database.MemberRepository
 	roles     database.RoleRepository
 	overrides database.ChannelOverrideRepository
+	channels  database.ChannelRepository
 }
 
 // NewPermissionChecker creates a PermissionChecker.
@@ -22,12 +23,14 @@ func NewPermissionChecker(
 	members database.MemberRepository,
 	roles database.RoleRepository,
 	overrides database.ChannelOverrideRepository,
+	channels database.ChannelRepository,
 ) *PermissionChecker {
 	return &PermissionChecker{
 		guilds:    guilds,
 		members:   members,
 		roles:     roles,
 		overrides: overrides,
+		channels:  channels,
 	}
 }
 
@@ -95,14 +98,164 @@ func (p *PermissionChecker) RequireChannelPermission(ctx context.Context, guildI
 		return Forbidden("FORBIDDEN", "you are not a member of this guild")
 	}
 
+	everyoneRole, channelOverrides, err := p.loadChannelContext(ctx, guildID, channelID)
+	if err != nil {
+		return err
+	}
+
 	memberRoles, err := p.roles.GetByMember(ctx, guildID, userID)
 	if err != nil {
 		return Internal("INTERNAL", "internal server error")
 	}
 
+	computed := computeChannelPermissions(everyoneRole, memberRoles, userID, channelOverrides)
+	if !computed.Has(perm) {
+		return Forbidden("MISSING_PERMISSIONS", "you do not have the required permissions")
+	}
+
+	return nil
+}
+
+// HasChannelPermission reports whether the user has the given permission in a
+// channel. Unlike RequireChannelPermission, a missing permission or
+// membership is not an error.
+func (p *PermissionChecker) HasChannelPermission(ctx context.Context, guildID, channelID, userID int64, perm permissions.Permission) (bool, error) {
+	allowed, err := p.FilterChannelPermission(ctx, guildID, channelID, []int64{userID}, perm)
+	if err != nil {
+		return false, err
+	}
+	return len(allowed) == 1, nil
+}
+
+// FilterChannelPermission returns the users among userIDs that are guild
+// members holding the given permission in a channel. Guild-wide data,
+// memberships and member roles are each loaded in a single query, so it is
+// suited to checking many users at a time.
+func (p *PermissionChecker) FilterChannelPermission(ctx context.Context, guildID, channelID int64, userIDs []int64, perm permissions.Permission) ([]int64, error) {
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+
+	guild, err := p.guilds.GetByID(ctx, guildID)
+	if err != nil {
+		return nil, Internal("INTERNAL", "internal server error")
+	}
+	if guild == nil {
+		return nil, NotFound("NOT_FOUND", "guild not found")
+	}
+
+	everyoneRole, channelOverrides, err := p.loadChannelContext(ctx, guildID, channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	memberIDs, err := p.members.FilterUserIDs(ctx, guildID, userIDs)
+	if err != nil {
+		return nil, Internal("INTERNAL", "internal server error")
+	}
+	memberRoles, err := p.roles.GetByMembers(ctx, guildID, memberIDs)
+	if err != nil {
+		return nil, Internal("INTERNAL", "internal server error")
+	}
+
+	isMember := make(map[int64]bool, len(memberIDs))
+	for _, id := range memberIDs {
+		isMember[id] = true
+	}
+
+	var allowed []int64
+	for _, userID := range userIDs {
+		if userID == guild.OwnerID {
+			allowed = append(allowed, userID)
+			continue
+		}
+		if !isMember[userID] {
+			continue
+		}
+		if computeChannelPermissions(everyoneRole, memberRoles[userID], userID, channelOverrides).Has(perm) {
+			allowed = append(allowed, userID)
+		}
+	}
+	return allowed, nil
+}
+
+// FilterChannels returns the channels among channels in which the user holds
+// the given permission. The member, their roles and the overrides of every
+// channel are loaded once, so it is suited to checking a whole guild's
+// channel list. A user who isn't a member gets no channels.
+func (p *PermissionChecker) FilterChannels(ctx context.Context, guildID, userID int64, channels []models.Channel, perm permissions.Permission) ([]models.Channel, error) {
+	if len(channels) == 0 {
+		return nil, nil
+	}
+
+	guild, err := p.guilds.GetByID(ctx, guildID)
+	if err != nil {
+		return nil, Internal("INTERNAL", "internal server error")
+	}
+	if guild == nil {
+		return nil, NotFound("NOT_FOUND", "guild not found")
+	}
+	if guild.OwnerID == userID {
+		return channels, nil
+	}
+
+	member, err := p.members.GetByGuildAndUser(ctx, guildID, userID)
+	if err != nil {
+		return nil, Internal("INTERNAL", "internal server error")
+	}
+	if member == nil {
+		return nil, nil
+	}
+
 	allRoles, err := p.roles.GetByGuildID(ctx, guildID)
 	if err != nil {
-		return Internal("INTERNAL", "internal server error")
+		return nil, Internal("INTERNAL", "internal server error")
+	}
+	var everyoneRole models.Role
+	for _, r := range allRoles {
+		if r.IsDefault {
+			everyoneRole = r
+			break
+		}
+	}
+	memberRoles, err := p.roles.GetByMember(ctx, guildID, userID)
+	if err != nil {
+		return nil, Internal("INTERNAL", "internal server error")
+	}
+
+	// Threads have no overrides of their own and use their parent's.
+	sourceIDs := make([]int64, len(channels))
+	for i, ch := range channels {
+		sourceIDs[i] = ch.ID
+		if ch.Type == models.ChannelTypeThread && ch.ParentID != nil {
+			sourceIDs[i] = *ch.ParentID
+		}
+	}
+	overrides, err := p.overrides.GetByChannels(ctx, sourceIDs)
+	if err != nil {
+		return nil, Internal("INTERNAL", "internal server error")
+	}
+	byChannel := make(map[int64][]models.ChannelOverride)
+	for _, o := range overrides {
+		byChannel[o.ChannelID] = append(byChannel[o.ChannelID], o)
+	}
+
+	var allowed []models.Channel
+	for i, ch := range channels {
+		if computeChannelPermissions(everyoneRole, memberRoles, userID, byChannel[sourceIDs[i]]).Has(perm) {
+			allowed = append(allowed, ch)
+		}
+	}
+	return allowed, nil
+}
+
+// loadChannelContext fetches the guild's @everyone role and the channel's
+// permission overrides. Threads have no overrides of their own and use their
+// parent channel's.
+func (p *PermissionChecker) loadChannelContext(ctx context.Context, guildID, channelID int64) (models.Role, []models.ChannelOverride, error) {
+	allRoles, err := p.roles.GetByGuildID(ctx, guildID)
+	if err != nil {
+		return models.Role{}, nil, Internal("INTERNAL", "internal server error")
 	}
 
 	var everyoneRole models.Role
@@ -113,14 +266,37 @@ func (p *PermissionChecker) RequireChannelPermission(ctx context.Context, guildI
 		}
 	}
 
-	basePerms := permissions.ComputeBasePermissions(everyoneRole, memberRoles)
+	overrideChannelID, err := p.overrideSource(ctx, channelID)
+	if err != nil {
+		return models.Role{}, nil, err
+	}
 
-	channelOverrides, err := p.overrides.GetByChannel(ctx, channelID)
+	channelOverrides, err := p.overrides.GetByChannel(ctx, overrideChannelID)
 	if err != nil {
-		return Internal("INTERNAL", "internal server error")
+		return models.Role{}, nil, Internal("INTERNAL", "internal server error")
+	}
+	return everyoneRole, channelOverrides, nil
+}
+
+// overrideSource returns the channel whose overrides apply to channelID: the
+// parent for threads, the channel itself otherwise.
+func (p *PermissionChecker) overrideSource(ctx context.Context, channelID int64) (int64, error) {
+	ch, err := p.channels.GetByID(ctx, channelID)
+	if err != nil {
+		return 0, Internal("INTERNAL", "internal server error")
 	}
+	if ch != nil && ch.Type == models.ChannelTypeThread && ch.ParentID != nil {
+		return *ch.ParentID, nil
+	}
+	return channelID, nil
+}
+
+// computeChannelPermissions applies the channel overrides that concern a
+// member on top of their guild-level base permissions.
+func computeChannelPermissions(everyoneRole models.Role, memberRoles []models.Role, userID int64, channelOverrides []models.ChannelOverride) permissions.Permission {
+	basePerms := permissions.ComputeBasePermissions(everyoneRole, memberRoles)
 
-	var everyoneOverride *models.ChannelOverride
+	var everyoneOverride, memberOverride *models.ChannelOverride
 	var roleOverrides []models.ChannelOverride
 
 	memberRoleIDs := make(map[int64]bool, len(memberRoles))
@@ -129,19 +305,20 @@ func (p *PermissionChecker) RequireChannelPermission(ctx context.Context, guildI
 	}
 
 	for i := range channelOverrides {
-		if channelOverrides[i].RoleID == everyoneRole.ID {
-			everyoneOverride = &channelOverrides[i]
-		} else if memberRoleIDs[channelOverrides[i].RoleID] {
-			roleOverrides = append(roleOverrides, channelOverrides[i])
+		o := &channelOverrides[i]
+		switch {
+		case o.Type == models.OverrideTypeMember:
+			if o.TargetID == userID {
+				memberOverride = o
+			}
+		case o.TargetID == everyoneRole.ID:
+			everyoneOverride = o
+		case memberRoleIDs[o.TargetID]:
+			roleOverrides = append(roleOverrides, *o)
 		}
 	}
 
-	computed := permissions.ComputeChannelPermissions(basePerms, everyoneOverride, roleOverrides)
-	if !computed.Has(perm) {
-		return Forbidden("MISSING_PERMISSIONS", "you do not have the required permissions")
-	}
-
-	return nil
+	return permissions.ComputeChannelPermissions(basePerms, everyoneOverride, roleOverrides, memberOverride)
 }
 
 // RequireGuildPermissionByPerm is like RequireGuildPermission but uses permissions.Permission type.
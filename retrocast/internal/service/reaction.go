@@ -87,7 +87,7 @@ func (s *ReactionService) AddReaction(ctx context.Context, channelID, messageID,
 		s.dispatchToDM(ctx, channelID, gateway.EventMessageReactionAdd, event)
 	} else {
 		event.GuildID = channel.GuildID
-		s.gateway.DispatchToGuild(channel.GuildID, gateway.EventMessageReactionAdd, event)
+		s.gateway.DispatchToChannel(channel.GuildID, channelID, gateway.EventMessageReactionAdd, event)
 	}
 
 	return nil
@@ -125,7 +125,7 @@ func (s *ReactionService) RemoveReaction(ctx context.Context, channelID, message
 		s.dispatchToDM(ctx, channelID, gateway.EventMessageReactionRemove, event)
 	} else {
 		event.GuildID = channel.GuildID
-		s.gateway.DispatchToGuild(channel.GuildID, gateway.EventMessageReactionRemove, event)
+		s.gateway.DispatchToChannel(channel.GuildID, channelID, gateway.EventMessageReactionRemove, event)
 	}
 
 	return nil
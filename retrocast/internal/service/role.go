@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"strconv"
 
 	"github.com/victorivanov/retrocast/internal/database"
 	"github.com/victorivanov/retrocast/internal/gateway"
@@ -19,6 +20,7 @@ type RoleService struct {
 	snowflake *snowflake.Generator
 	gateway   gateway.Dispatcher
 	perms     *PermissionChecker
+	audit     *AuditLogService
 }
 
 // NewRoleService creates a RoleService.
@@ -31,6 +33,7 @@ func NewRoleService(
 	sf *snowflake.Generator,
 	gw gateway.Dispatcher,
 	perms *PermissionChecker,
+	audit *AuditLogService,
 ) *RoleService {
 	return &RoleService{
 		guilds:    guilds,
@@ -41,6 +44,7 @@ func NewRoleService(
 		snowflake: sf,
 		gateway:   gw,
 		perms:     perms,
+		audit:     audit,
 	}
 }
 
@@ -77,6 +81,13 @@ func (s *RoleService) CreateRole(ctx context.Context, guildID, actorID int64, na
 		return nil, Internal("INTERNAL", "internal server error")
 	}
 
+	changes := auditDiff{}.
+		change("name", nil, role.Name).
+		change("color", nil, role.Color).
+		change("permissions", nil, auditID(role.Permissions)).
+		change("position", nil, role.Position)
+	s.audit.record(ctx, guildID, actorID, models.AuditLogRoleCreate, role.ID, changes, nil)
+
 	s.gateway.DispatchToGuild(guildID, gateway.EventGuildRoleCreate, map[string]any{"guild_id": guildID, "role": role})
 	return role, nil
 }
@@ -117,6 +128,7 @@ func (s *RoleService) UpdateRole(ctx context.Context, guildID, actorID, roleID i
 		}
 	}
 
+	old := *role
 	if name != nil {
 		if *name == "" || len(*name) > 100 {
 			return nil, BadRequest("INVALID_NAME", "name must be 1-100 characters")
@@ -137,6 +149,14 @@ func (s *RoleService) UpdateRole(ctx context.Context, guildID, actorID, roleID i
 		return nil, Internal("INTERNAL", "internal server error")
 	}
 
+	changes := auditDiff{}.
+		change("name", old.Name, role.Name).
+		change("color", old.Color, role.Color).
+		change("permissions", auditID(old.Permissions), auditID(role.Permissions)).
+		change("position", old.Position, role.Position)
+	s.audit.record(ctx, guildID, actorID, models.AuditLogRoleUpdate, roleID, changes, nil)
+
+	s.gateway.InvalidateGuildPermissions(guildID)
 	s.gateway.DispatchToGuild(guildID, gateway.EventGuildRoleUpdate, map[string]any{"guild_id": guildID, "role": role})
 	return role, nil
 }
@@ -172,6 +192,13 @@ func (s *RoleService) DeleteRole(ctx context.Context, guildID, actorID, roleID i
 		return Internal("INTERNAL", "internal server error")
 	}
 
+	changes := auditDiff{}.
+		change("name", role.Name, nil).
+		change("color", role.Color, nil).
+		change("permissions", auditID(role.Permissions), nil)
+	s.audit.record(ctx, guildID, actorID, models.AuditLogRoleDelete, roleID, changes, nil)
+
+	s.gateway.InvalidateGuildPermissions(guildID)
 	s.gateway.DispatchToGuild(guildID, gateway.EventGuildRoleDelete, map[string]any{"guild_id": guildID, "role_id": roleID})
 	return nil
 }
@@ -211,6 +238,10 @@ func (s *RoleService) AssignRole(ctx context.Context, guildID, actorID, userID,
 	if err := s.members.AddRole(ctx, guildID, userID, roleID); err != nil {
 		return Internal("INTERNAL", "internal server error")
 	}
+	s.gateway.InvalidateMemberPermissions(guildID, userID)
+
+	changes := auditDiff{}.change("$add", nil, auditID(roleID))
+	s.audit.record(ctx, guildID, actorID, models.AuditLogMemberRoleUpdate, userID, changes, nil)
 
 	return nil
 }
@@ -240,12 +271,17 @@ func (s *RoleService) RemoveRole(ctx context.Context, guildID, actorID, userID,
 	if err := s.members.RemoveRole(ctx, guildID, userID, roleID); err != nil {
 		return Internal("INTERNAL", "internal server error")
 	}
+	s.gateway.InvalidateMemberPermissions(guildID, userID)
+
+	changes := auditDiff{}.change("$remove", nil, auditID(roleID))
+	s.audit.record(ctx, guildID, actorID, models.AuditLogMemberRoleUpdate, userID, changes, nil)
 
 	return nil
 }
 
-// SetChannelOverride creates or updates a channel permission override.
-func (s *RoleService) SetChannelOverride(ctx context.Context, channelID, roleID, allow, deny int64) (*models.ChannelOverride, error) {
+// SetChannelOverride creates or updates a channel permission override for a
+// role or a member of the channel's guild.
+func (s *RoleService) SetChannelOverride(ctx context.Context, channelID, actorID, targetID int64, overrideType models.OverrideType, allow, deny int64) (*models.ChannelOverride, error) {
 	ch, err := s.channels.GetByID(ctx, channelID)
 	if err != nil {
 		return nil, Internal("INTERNAL", "internal server error")
@@ -253,10 +289,23 @@ func (s *RoleService) SetChannelOverride(ctx context.Context, channelID, roleID,
 	if ch == nil {
 		return nil, NotFound("NOT_FOUND", "channel not found")
 	}
+	if ch.Type == models.ChannelTypeThread {
+		return nil, BadRequest("INVALID_CHANNEL_TYPE", "threads inherit their parent channel's overrides")
+	}
+
+	if err := s.validateOverrideTarget(ctx, ch.GuildID, targetID, overrideType); err != nil {
+		return nil, err
+	}
+
+	existing, err := s.findOverride(ctx, channelID, targetID)
+	if err != nil {
+		return nil, err
+	}
 
 	override := &models.ChannelOverride{
 		ChannelID: channelID,
-		RoleID:    roleID,
+		TargetID:  targetID,
+		Type:      overrideType,
 		Allow:     allow,
 		Deny:      deny,
 	}
@@ -264,14 +313,97 @@ func (s *RoleService) SetChannelOverride(ctx context.Context, channelID, roleID,
 	if err := s.overrides.Set(ctx, override); err != nil {
 		return nil, Internal("INTERNAL", "internal server error")
 	}
+	s.gateway.InvalidateGuildPermissions(ch.GuildID)
+
+	action := models.AuditLogChannelOverwriteCreate
+	changes := auditDiff{}
+	if existing != nil {
+		action = models.AuditLogChannelOverwriteUpdate
+		changes = changes.
+			change("allow", auditID(existing.Allow), auditID(allow)).
+			change("deny", auditID(existing.Deny), auditID(deny))
+	} else {
+		changes = changes.
+			change("allow", nil, auditID(allow)).
+			change("deny", nil, auditID(deny))
+	}
+	s.audit.record(ctx, ch.GuildID, actorID, action, channelID, changes, overrideAuditOptions(override))
 
 	return override, nil
 }
 
 // DeleteChannelOverride removes a channel permission override.
-func (s *RoleService) DeleteChannelOverride(ctx context.Context, channelID, roleID int64) error {
-	if err := s.overrides.Delete(ctx, channelID, roleID); err != nil {
+func (s *RoleService) DeleteChannelOverride(ctx context.Context, channelID, actorID, targetID int64) error {
+	ch, err := s.channels.GetByID(ctx, channelID)
+	if err != nil {
 		return Internal("INTERNAL", "internal server error")
 	}
+	if ch == nil {
+		return NotFound("NOT_FOUND", "channel not found")
+	}
+
+	existing, err := s.findOverride(ctx, channelID, targetID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.overrides.Delete(ctx, channelID, targetID); err != nil {
+		return Internal("INTERNAL", "internal server error")
+	}
+	s.gateway.InvalidateGuildPermissions(ch.GuildID)
+
+	if existing != nil {
+		changes := auditDiff{}.
+			change("allow", auditID(existing.Allow), nil).
+			change("deny", auditID(existing.Deny), nil)
+		s.audit.record(ctx, ch.GuildID, actorID, models.AuditLogChannelOverwriteDelete, channelID, changes, overrideAuditOptions(existing))
+	}
+	return nil
+}
+
+// validateOverrideTarget checks that targetID is a role of the guild or one
+// of its members, as overrideType says.
+func (s *RoleService) validateOverrideTarget(ctx context.Context, guildID, targetID int64, overrideType models.OverrideType) error {
+	switch overrideType {
+	case models.OverrideTypeRole:
+		role, err := s.roles.GetByID(ctx, targetID)
+		if err != nil {
+			return Internal("INTERNAL", "internal server error")
+		}
+		if role == nil || role.GuildID != guildID {
+			return NotFound("NOT_FOUND", "role not found")
+		}
+	case models.OverrideTypeMember:
+		member, err := s.members.GetByGuildAndUser(ctx, guildID, targetID)
+		if err != nil {
+			return Internal("INTERNAL", "internal server error")
+		}
+		if member == nil {
+			return NotFound("NOT_FOUND", "member not found")
+		}
+	default:
+		return BadRequest("INVALID_OVERRIDE_TYPE", "type must be 0 (role) or 1 (member)")
+	}
 	return nil
 }
+
+// findOverride returns the channel's override for targetID, or nil if there
+// is none.
+func (s *RoleService) findOverride(ctx context.Context, channelID, targetID int64) (*models.ChannelOverride, error) {
+	overrides, err := s.overrides.GetByChannel(ctx, channelID)
+	if err != nil {
+		return nil, Internal("INTERNAL", "internal server error")
+	}
+	for i := range overrides {
+		if overrides[i].TargetID == targetID {
+			return &overrides[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// overrideAuditOptions identifies the override an audit log entry is about;
+// the entry's target is the channel.
+func overrideAuditOptions(o *models.ChannelOverride) map[string]string {
+	return map[string]string{"id": auditID(o.TargetID), "type": strconv.Itoa(int(o.Type))}
+}
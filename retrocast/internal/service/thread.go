@@ -0,0 +1,377 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+	"unicode/utf8"
+
+	"github.com/victorivanov/retrocast/internal/database"
+	"github.com/victorivanov/retrocast/internal/gateway"
+	"github.com/victorivanov/retrocast/internal/models"
+	"github.com/victorivanov/retrocast/internal/permissions"
+	"github.com/victorivanov/retrocast/internal/snowflake"
+)
+
+const (
+	// defaultAutoArchiveDuration is used when a thread is created without
+	// an auto_archive_duration, in minutes.
+	defaultAutoArchiveDuration = 1440
+	threadArchiverInterval     = time.Minute
+)
+
+// autoArchiveDurations are the allowed inactivity periods, in minutes: one
+// hour, one day, three days and one week.
+var autoArchiveDurations = map[int]bool{60: true, 1440: true, 4320: true, 10080: true}
+
+// ThreadService handles threads: channels spawned under a text channel,
+// optionally from one of its messages.
+type ThreadService struct {
+	channels      database.ChannelRepository
+	messages      database.MessageRepository
+	threadMembers database.ThreadMemberRepository
+	snowflake     *snowflake.Generator
+	gateway       gateway.Dispatcher
+	perms         *PermissionChecker
+}
+
+// NewThreadService creates a ThreadService.
+func NewThreadService(
+	channels database.ChannelRepository,
+	messages database.MessageRepository,
+	threadMembers database.ThreadMemberRepository,
+	sf *snowflake.Generator,
+	gw gateway.Dispatcher,
+	perms *PermissionChecker,
+) *ThreadService {
+	return &ThreadService{
+		channels:      channels,
+		messages:      messages,
+		threadMembers: threadMembers,
+		snowflake:     sf,
+		gateway:       gw,
+		perms:         perms,
+	}
+}
+
+// CreateThread starts a standalone thread in a text channel. The creator
+// becomes the thread's owner and first member.
+func (s *ThreadService) CreateThread(ctx context.Context, parentID, userID int64, name string, autoArchiveDuration *int) (*models.Channel, error) {
+	parent, err := s.loadParent(ctx, parentID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.createThread(ctx, parent, userID, name, autoArchiveDuration, nil)
+}
+
+// CreateThreadFromMessage starts a thread from a message in a text channel.
+// Each message can start at most one thread. An empty name defaults to the
+// start of the message's content.
+func (s *ThreadService) CreateThreadFromMessage(ctx context.Context, parentID, messageID, userID int64, name string, autoArchiveDuration *int) (*models.Channel, error) {
+	parent, err := s.loadParent(ctx, parentID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := s.messages.GetByID(ctx, messageID)
+	if err != nil {
+		return nil, Internal("INTERNAL", "internal server error")
+	}
+	if msg == nil || msg.ChannelID != parentID {
+		return nil, NotFound("NOT_FOUND", "message not found")
+	}
+
+	existing, err := s.channels.GetThreadByStarterMessage(ctx, messageID)
+	if err != nil {
+		return nil, Internal("INTERNAL", "internal server error")
+	}
+	if existing != nil {
+		return nil, Conflict("THREAD_ALREADY_EXISTS", "a thread has already been started from this message")
+	}
+
+	if name == "" {
+		name = threadNameFromContent(msg.Content)
+	}
+	return s.createThread(ctx, parent, userID, name, autoArchiveDuration, &messageID)
+}
+
+func (s *ThreadService) createThread(ctx context.Context, parent *models.Channel, userID int64, name string, autoArchiveDuration *int, starterMessageID *int64) (*models.Channel, error) {
+	if len(name) < 1 || len(name) > 100 {
+		return nil, BadRequest("INVALID_NAME", "thread name must be 1-100 characters")
+	}
+
+	duration := defaultAutoArchiveDuration
+	if autoArchiveDuration != nil {
+		duration = *autoArchiveDuration
+	}
+	if !autoArchiveDurations[duration] {
+		return nil, BadRequest("INVALID_AUTO_ARCHIVE_DURATION", "auto_archive_duration must be 60, 1440, 4320 or 10080")
+	}
+
+	thread := &models.Channel{
+		ID:       s.snowflake.Generate().Int64(),
+		GuildID:  parent.GuildID,
+		Name:     name,
+		Type:     models.ChannelTypeThread,
+		ParentID: &parent.ID,
+		Thread: &models.ThreadMetadata{
+			OwnerID:             userID,
+			StarterMessageID:    starterMessageID,
+			AutoArchiveDuration: duration,
+			ArchiveTimestamp:    time.Now(),
+		},
+	}
+
+	if err := s.channels.Create(ctx, thread); err != nil {
+		if errors.Is(err, database.ErrThreadAlreadyExists) {
+			// Lost a race with another request starting the same thread.
+			return nil, Conflict("THREAD_ALREADY_EXISTS", "a thread has already been started from this message")
+		}
+		return nil, Internal("INTERNAL", "internal server error")
+	}
+	if _, err := s.threadMembers.Add(ctx, thread.ID, userID); err != nil {
+		return nil, Internal("INTERNAL", "internal server error")
+	}
+
+	s.gateway.DispatchToChannel(thread.GuildID, thread.ID, gateway.EventThreadCreate, thread)
+	s.dispatchMembersUpdate(ctx, thread, []int64{userID}, nil)
+	return thread, nil
+}
+
+// ListThreads returns the active threads of a channel, or the archived ones
+// if archived is set.
+func (s *ThreadService) ListThreads(ctx context.Context, parentID, userID int64, archived bool) ([]models.Channel, error) {
+	parent, err := s.channels.GetByID(ctx, parentID)
+	if err != nil {
+		return nil, Internal("INTERNAL", "internal server error")
+	}
+	if parent == nil {
+		return nil, NotFound("NOT_FOUND", "channel not found")
+	}
+	if err := s.perms.RequireChannelPermission(ctx, parent.GuildID, parentID, userID, permissions.PermViewChannel); err != nil {
+		return nil, err
+	}
+
+	threads, err := s.channels.GetThreadsByParent(ctx, parentID, archived)
+	if err != nil {
+		return nil, Internal("INTERNAL", "internal server error")
+	}
+	if threads == nil {
+		threads = []models.Channel{}
+	}
+	return threads, nil
+}
+
+// UpdateThread renames, archives, unarchives or changes the auto-archive
+// duration of a thread. Only the thread's owner or members with
+// MANAGE_THREADS may do so.
+func (s *ThreadService) UpdateThread(ctx context.Context, threadID, userID int64, name *string, archived *bool, autoArchiveDuration *int) (*models.Channel, error) {
+	thread, err := s.loadThread(ctx, threadID)
+	if err != nil {
+		return nil, err
+	}
+
+	if thread.Thread.OwnerID != userID {
+		if err := s.perms.RequireChannelPermission(ctx, thread.GuildID, threadID, userID, permissions.PermManageThreads); err != nil {
+			return nil, err
+		}
+	}
+
+	if name != nil {
+		if len(*name) < 1 || len(*name) > 100 {
+			return nil, BadRequest("INVALID_NAME", "thread name must be 1-100 characters")
+		}
+		thread.Name = *name
+	}
+	if autoArchiveDuration != nil {
+		if !autoArchiveDurations[*autoArchiveDuration] {
+			return nil, BadRequest("INVALID_AUTO_ARCHIVE_DURATION", "auto_archive_duration must be 60, 1440, 4320 or 10080")
+		}
+		thread.Thread.AutoArchiveDuration = *autoArchiveDuration
+	}
+	if archived != nil && *archived != thread.Thread.Archived {
+		thread.Thread.Archived = *archived
+		thread.Thread.ArchiveTimestamp = time.Now()
+	}
+
+	if err := s.channels.Update(ctx, thread); err != nil {
+		return nil, Internal("INTERNAL", "internal server error")
+	}
+
+	s.gateway.DispatchToChannel(thread.GuildID, thread.ID, gateway.EventThreadUpdate, thread)
+	return thread, nil
+}
+
+// JoinThread adds the user to a thread they can see.
+func (s *ThreadService) JoinThread(ctx context.Context, threadID, userID int64) error {
+	thread, err := s.loadThread(ctx, threadID)
+	if err != nil {
+		return err
+	}
+	if err := s.perms.RequireChannelPermission(ctx, thread.GuildID, threadID, userID, permissions.PermViewChannel); err != nil {
+		return err
+	}
+
+	added, err := s.threadMembers.Add(ctx, threadID, userID)
+	if err != nil {
+		return Internal("INTERNAL", "internal server error")
+	}
+	if added {
+		s.dispatchMembersUpdate(ctx, thread, []int64{userID}, nil)
+	}
+	return nil
+}
+
+// LeaveThread removes the user from a thread.
+func (s *ThreadService) LeaveThread(ctx context.Context, threadID, userID int64) error {
+	thread, err := s.loadThread(ctx, threadID)
+	if err != nil {
+		return err
+	}
+
+	removed, err := s.threadMembers.Remove(ctx, threadID, userID)
+	if err != nil {
+		return Internal("INTERNAL", "internal server error")
+	}
+	if removed {
+		s.dispatchMembersUpdate(ctx, thread, nil, []int64{userID})
+	}
+	return nil
+}
+
+// ListThreadMembers returns the members of a thread the user can see.
+func (s *ThreadService) ListThreadMembers(ctx context.Context, threadID, userID int64) ([]models.ThreadMember, error) {
+	thread, err := s.loadThread(ctx, threadID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.perms.RequireChannelPermission(ctx, thread.GuildID, threadID, userID, permissions.PermViewChannel); err != nil {
+		return nil, err
+	}
+
+	members, err := s.threadMembers.GetByThread(ctx, threadID)
+	if err != nil {
+		return nil, Internal("INTERNAL", "internal server error")
+	}
+	if members == nil {
+		members = []models.ThreadMember{}
+	}
+	return members, nil
+}
+
+// ArchiveInactiveThreads archives the threads that have been inactive for
+// longer than their auto-archive duration and returns how many it archived.
+func (s *ThreadService) ArchiveInactiveThreads(ctx context.Context, now time.Time) (int, error) {
+	archived, err := s.channels.ArchiveInactiveThreads(ctx, now)
+	if err != nil {
+		return 0, err
+	}
+	for i := range archived {
+		s.gateway.DispatchToChannel(archived[i].GuildID, archived[i].ID, gateway.EventThreadUpdate, &archived[i])
+	}
+	return len(archived), nil
+}
+
+// RunThreadArchiver periodically archives inactive threads until ctx is
+// cancelled.
+func (s *ThreadService) RunThreadArchiver(ctx context.Context) {
+	ticker := time.NewTicker(threadArchiverInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			archived, err := s.ArchiveInactiveThreads(ctx, time.Now())
+			if err != nil {
+				slog.Error("thread archiver failed", "error", err)
+			}
+			if archived > 0 {
+				slog.Info("archived inactive threads", "count", archived)
+			}
+		}
+	}
+}
+
+// loadParent loads a channel that threads can be created in and checks that
+// the user may post in it.
+func (s *ThreadService) loadParent(ctx context.Context, parentID, userID int64) (*models.Channel, error) {
+	parent, err := s.channels.GetByID(ctx, parentID)
+	if err != nil {
+		return nil, Internal("INTERNAL", "internal server error")
+	}
+	if parent == nil {
+		return nil, NotFound("NOT_FOUND", "channel not found")
+	}
+	if parent.Type != models.ChannelTypeText {
+		return nil, BadRequest("INVALID_CHANNEL_TYPE", "threads can only be created in text channels")
+	}
+	if err := s.perms.RequireChannelPermission(ctx, parent.GuildID, parentID, userID, permissions.PermSendMessages); err != nil {
+		return nil, err
+	}
+	return parent, nil
+}
+
+func (s *ThreadService) loadThread(ctx context.Context, threadID int64) (*models.Channel, error) {
+	thread, err := s.channels.GetByID(ctx, threadID)
+	if err != nil {
+		return nil, Internal("INTERNAL", "internal server error")
+	}
+	if thread == nil || thread.Type != models.ChannelTypeThread || thread.Thread == nil {
+		return nil, NotFound("NOT_FOUND", "thread not found")
+	}
+	return thread, nil
+}
+
+// dispatchMembersUpdate sends THREAD_MEMBERS_UPDATE for users that joined or
+// left a thread. Failures to load the member list are logged.
+func (s *ThreadService) dispatchMembersUpdate(ctx context.Context, thread *models.Channel, addedIDs, removedIDs []int64) {
+	members, err := s.threadMembers.GetByThread(ctx, thread.ID)
+	if err != nil {
+		slog.Error("failed to load thread members", "threadID", thread.ID, "error", err)
+		return
+	}
+
+	data := gateway.ThreadMembersUpdateData{
+		ID:               thread.ID,
+		GuildID:          thread.GuildID,
+		MemberCount:      len(members),
+		RemovedMemberIDs: removedIDs,
+	}
+	for _, m := range members {
+		if containsID(addedIDs, m.UserID) {
+			data.AddedMembers = append(data.AddedMembers, m)
+		}
+	}
+	s.gateway.DispatchToChannel(thread.GuildID, thread.ID, gateway.EventThreadMembersUpdate, data)
+}
+
+// reopenThread unarchives a thread that received a new message. The message
+// has already been sent, so failures are only logged.
+func reopenThread(ctx context.Context, channels database.ChannelRepository, gw gateway.Dispatcher, thread *models.Channel) {
+	thread.Thread.Archived = false
+	thread.Thread.ArchiveTimestamp = time.Now()
+	if err := channels.Update(ctx, thread); err != nil {
+		slog.Error("failed to unarchive thread", "threadID", thread.ID, "error", err)
+		return
+	}
+	gw.DispatchToChannel(thread.GuildID, thread.ID, gateway.EventThreadUpdate, thread)
+}
+
+// threadNameFromContent derives a thread name from a message's content,
+// truncated to 100 bytes without splitting a character.
+func threadNameFromContent(content string) string {
+	if content == "" {
+		return "thread"
+	}
+	if len(content) <= 100 {
+		return content
+	}
+	cut := 100
+	for cut > 0 && !utf8.RuneStart(content[cut]) {
+		cut--
+	}
+	return content[:cut]
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"log/slog"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/victorivanov/retrocast/internal/database"
 	"github.com/victorivanov/retrocast/internal/models"
@@ -13,7 +15,15 @@ import (
 	"github.com/victorivanov/retrocast/internal/snowflake"
 )
 
-const maxUploadSize = 10 << 20 // 10 MB
+const (
+	maxUploadSize = 10 << 20 // 10 MB
+
+	// Uploads that no message claims within unclaimedAttachmentTTL are
+	// removed by the attachment janitor.
+	unclaimedAttachmentTTL    = 24 * time.Hour
+	attachmentJanitorInterval = 15 * time.Minute
+	attachmentJanitorBatch    = 100
+)
 
 var allowedContentTypes = map[string]bool{
 	"image/jpeg":      true,
@@ -90,11 +100,14 @@ func (s *UploadService) UploadFile(ctx context.Context, channelID, userID int64,
 	attachment := &models.Attachment{
 		ID:          attachmentID,
 		MessageID:   0,
+		ChannelID:   channelID,
+		UploaderID:  userID,
 		Filename:    cleanFilename,
 		ContentType: contentType,
 		Size:        size,
 		StorageKey:  storageKey,
 		URL:         s.storage.GetURL(storageKey),
+		CreatedAt:   time.Now(),
 	}
 
 	if err := s.attachments.Create(ctx, attachment); err != nil {
@@ -104,6 +117,69 @@ func (s *UploadService) UploadFile(ctx context.Context, channelID, userID int64,
 	return attachment, nil
 }
 
+// PruneUnclaimedAttachments removes attachments uploaded before cutoff that
+// were never bound to a message, deleting both the stored object and the
+// database row. The row is first marked pending deletion, and only while
+// still unclaimed, so a message sent meanwhile keeps its file. It is dropped
+// once the object is gone; if deleting the object fails the row stays
+// marked and the next run retries. It returns the number of attachments
+// removed.
+func (s *UploadService) PruneUnclaimedAttachments(ctx context.Context, cutoff time.Time) (int, error) {
+	removed := 0
+	for {
+		stale, err := s.attachments.GetUnclaimedBefore(ctx, cutoff, attachmentJanitorBatch)
+		if err != nil {
+			return removed, err
+		}
+
+		deleted := 0
+		for _, a := range stale {
+			ok, err := s.attachments.MarkUnclaimedForDeletion(ctx, a.ID)
+			if err != nil {
+				return removed, err
+			}
+			if !ok {
+				continue // claimed by a message since it was listed
+			}
+			if err := s.storage.Delete(ctx, a.StorageKey); err != nil {
+				slog.Error("failed to delete unclaimed attachment object", "attachmentID", a.ID, "key", a.StorageKey, "error", err)
+				continue
+			}
+			if err := s.attachments.Delete(ctx, a.ID); err != nil {
+				return removed, err
+			}
+			deleted++
+		}
+		removed += deleted
+
+		if len(stale) < attachmentJanitorBatch || deleted == 0 {
+			return removed, nil
+		}
+	}
+}
+
+// RunAttachmentJanitor periodically prunes unclaimed attachments until ctx is
+// cancelled.
+func (s *UploadService) RunAttachmentJanitor(ctx context.Context) {
+	ticker := time.NewTicker(attachmentJanitorInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			removed, err := s.PruneUnclaimedAttachments(ctx, time.Now().Add(-unclaimedAttachmentTTL))
+			if err != nil {
+				slog.Error("attachment janitor failed", "error", err)
+			}
+			if removed > 0 {
+				slog.Info("pruned unclaimed attachments", "count", removed)
+			}
+		}
+	}
+}
+
 func isAllowedContentType(ct string) bool {
 	if allowedContentTypes[ct] {
 		return true
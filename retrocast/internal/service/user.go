@@ -2,22 +2,44 @@ package service
 
 import (
 	"context"
+	"log/slog"
 
 	"github.com/victorivanov/retrocast/internal/database"
 	"github.com/victorivanov/retrocast/internal/models"
 )
 
+// PresenceLoader loads the presences returned in user and member payloads.
+// gateway.PresenceService implements it.
+type PresenceLoader interface {
+	GetPresences(ctx context.Context, userIDs []int64) (map[int64]models.Presence, error)
+}
+
+// loadPresences returns the presences of the given users. Presences are
+// best effort: if they can't be loaded the payloads go out without them.
+func loadPresences(ctx context.Context, presences PresenceLoader, userIDs []int64) map[int64]models.Presence {
+	if presences == nil || len(userIDs) == 0 {
+		return nil
+	}
+	loaded, err := presences.GetPresences(ctx, userIDs)
+	if err != nil {
+		slog.Error("failed to load presences", "error", err)
+		return nil
+	}
+	return loaded
+}
+
 // UserService handles user profile business logic.
 type UserService struct {
-	users database.UserRepository
+	users     database.UserRepository
+	presences PresenceLoader
 }
 
-// NewUserService creates a UserService.
-func NewUserService(users database.UserRepository) *UserService {
-	return &UserService{users: users}
+// NewUserService creates a UserService. presences may be nil.
+func NewUserService(users database.UserRepository, presences PresenceLoader) *UserService {
+	return &UserService{users: users, presences: presences}
 }
 
-// GetByID returns the user with the given ID.
+// GetByID returns the user with the given ID, with their presence.
 func (s *UserService) GetByID(ctx context.Context, userID int64) (*models.User, error) {
 	user, err := s.users.GetByID(ctx, userID)
 	if err != nil {
@@ -26,6 +48,9 @@ func (s *UserService) GetByID(ctx context.Context, userID int64) (*models.User,
 	if user == nil {
 		return nil, NotFound("NOT_FOUND", "user not found")
 	}
+	if p, ok := loadPresences(ctx, s.presences, []int64{userID})[userID]; ok {
+		user.Presence = &p
+	}
 	return user, nil
 }
 
@@ -2,23 +2,54 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/victorivanov/retrocast/internal/database"
 	"github.com/victorivanov/retrocast/internal/gateway"
+	"github.com/victorivanov/retrocast/internal/livekit"
 	"github.com/victorivanov/retrocast/internal/models"
 	"github.com/victorivanov/retrocast/internal/permissions"
 )
 
+const (
+	voiceSweepInterval = time.Minute
+	// voiceGhostGrace is how long a voice state may go without a gateway
+	// session before the sweep removes it, so that clients joining voice
+	// before they connect to the gateway are not swept.
+	voiceGhostGrace = time.Minute
+)
+
+// SessionTracker reports whether a user is connected to the gateway.
+type SessionTracker interface {
+	HasSession(userID int64) bool
+}
+
+// VoiceRooms controls rooms and participants on the media server, so that
+// user limits hold there and moderation takes effect on clients already in
+// a room.
+type VoiceRooms interface {
+	CreateRoom(ctx context.Context, room string, maxParticipants int) error
+	SetParticipantPermissions(ctx context.Context, room, identity string, canPublish, canSubscribe bool) error
+	RemoveParticipant(ctx context.Context, room, identity string) error
+}
+
 // VoiceService handles voice channel business logic.
 type VoiceService struct {
 	voiceStates database.VoiceStateRepository
 	channels    database.ChannelRepository
 	users       database.UserRepository
 	gateway     gateway.Dispatcher
+	sessions    SessionTracker
 	perms       *PermissionChecker
+	audit       *AuditLogService
+	rooms       VoiceRooms
+	url         string
 	apiKey      string
 	apiSecret   string
 }
@@ -29,28 +60,125 @@ func NewVoiceService(
 	channels database.ChannelRepository,
 	users database.UserRepository,
 	gw gateway.Dispatcher,
+	sessions SessionTracker,
 	perms *PermissionChecker,
-	apiKey, apiSecret string,
+	audit *AuditLogService,
+	rooms VoiceRooms,
+	url, apiKey, apiSecret string,
 ) *VoiceService {
 	return &VoiceService{
 		voiceStates: voiceStates,
 		channels:    channels,
 		users:       users,
 		gateway:     gw,
+		sessions:    sessions,
 		perms:       perms,
+		audit:       audit,
+		rooms:       rooms,
+		url:         url,
 		apiKey:      apiKey,
 		apiSecret:   apiSecret,
 	}
 }
 
-// JoinChannelResponse is returned when a user joins a voice channel.
+// JoinChannelResponse is returned when a user joins a voice channel. Bitrate
+// is the channel's audio bitrate for the client to encode at.
 type JoinChannelResponse struct {
 	Token       string              `json:"token"`
+	Bitrate     int                 `json:"bitrate"`
 	VoiceStates []models.VoiceState `json:"voice_states"`
 }
 
 // JoinChannel connects a user to a voice channel.
 func (s *VoiceService) JoinChannel(ctx context.Context, channelID, userID int64) (*JoinChannelResponse, error) {
+	channel, err := s.voiceChannel(ctx, channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := s.voiceStates.GetByUser(ctx, channel.GuildID, userID)
+	if err != nil {
+		return nil, Internal("INTERNAL", "internal server error")
+	}
+
+	_, token, err := s.join(ctx, channel, userID, existing, false, false)
+	if err != nil {
+		return nil, err
+	}
+
+	states, err := s.voiceStates.GetByChannel(ctx, channelID)
+	if err != nil {
+		return nil, Internal("INTERNAL", "internal server error")
+	}
+	if states == nil {
+		states = []models.VoiceState{}
+	}
+
+	return &JoinChannelResponse{
+		Token:       token,
+		Bitrate:     channel.Bitrate,
+		VoiceStates: states,
+	}, nil
+}
+
+// UpdateVoiceState applies an Op 4 VOICE_STATE_UPDATE from the gateway: it
+// joins or switches to channelID, leaves voice in the guild when channelID
+// is nil, and sets the user's self mute and deafen. Entering a channel
+// returns the LiveKit server and token to connect with.
+func (s *VoiceService) UpdateVoiceState(ctx context.Context, guildID, userID int64, channelID *int64, selfMute, selfDeaf bool) (*gateway.VoiceServerUpdateData, error) {
+	existing, err := s.voiceStates.GetByUser(ctx, guildID, userID)
+	if err != nil {
+		return nil, Internal("INTERNAL", "internal server error")
+	}
+
+	if channelID == nil {
+		if existing == nil {
+			return nil, nil
+		}
+		if err := s.voiceStates.Delete(ctx, guildID, userID); err != nil {
+			return nil, Internal("INTERNAL", "internal server error")
+		}
+		s.removeParticipant(ctx, existing.SessionID, userID)
+		s.dispatchLeave(guildID, userID)
+		return nil, nil
+	}
+
+	if existing != nil && existing.ChannelID == *channelID {
+		if existing.SelfMute == selfMute && existing.SelfDeaf == selfDeaf {
+			return nil, nil
+		}
+		existing.SelfMute, existing.SelfDeaf = selfMute, selfDeaf
+		if err := s.voiceStates.Upsert(ctx, existing); err != nil {
+			return nil, Internal("INTERNAL", "internal server error")
+		}
+		s.gateway.DispatchToGuild(guildID, gateway.EventVoiceStateUpdate, existing)
+		return nil, nil
+	}
+
+	channel, err := s.voiceChannel(ctx, *channelID)
+	if err != nil {
+		return nil, err
+	}
+	if channel.GuildID != guildID {
+		return nil, NotFound("NOT_FOUND", "channel not found")
+	}
+
+	state, token, err := s.join(ctx, channel, userID, existing, selfMute, selfDeaf)
+	if err != nil {
+		return nil, err
+	}
+
+	return &gateway.VoiceServerUpdateData{
+		GuildID:   state.GuildID,
+		ChannelID: state.ChannelID,
+		Token:     token,
+		Endpoint:  s.url,
+		Bitrate:   channel.Bitrate,
+	}, nil
+}
+
+// voiceChannel loads a channel a user wants to join.
+func (s *VoiceService) voiceChannel(ctx context.Context, channelID int64) (*models.Channel, error) {
 	channel, err := s.channels.GetByID(ctx, channelID)
 	if err != nil {
 		return nil, Internal("INTERNAL", "internal server error")
@@ -59,56 +187,91 @@ func (s *VoiceService) JoinChannel(ctx context.Context, channelID, userID int64)
 		return nil, NotFound("NOT_FOUND", "channel not found")
 	}
 
-	if channel.Type != models.ChannelTypeVoice {
+	if !channel.Type.IsVoice() {
 		return nil, BadRequest("NOT_VOICE_CHANNEL", "channel is not a voice channel")
 	}
+	return channel, nil
+}
 
-	if err := s.perms.RequireChannelPermission(ctx, channel.GuildID, channelID, userID, permissions.PermConnect); err != nil {
-		return nil, err
+// join puts a user in a voice channel, replacing existing, their current
+// voice state in the guild if any, and returns the new state with a LiveKit
+// token for the channel's room.
+func (s *VoiceService) join(ctx context.Context, channel *models.Channel, userID int64, existing *models.VoiceState, selfMute, selfDeaf bool) (*models.VoiceState, string, error) {
+	if err := s.perms.RequireChannelPermission(ctx, channel.GuildID, channel.ID, userID, permissions.PermConnect); err != nil {
+		return nil, "", err
+	}
+	if existing == nil || existing.ChannelID != channel.ID {
+		if err := s.checkChannelFull(ctx, channel, userID); err != nil {
+			return nil, "", err
+		}
 	}
 
 	user, err := s.users.GetByID(ctx, userID)
 	if err != nil {
-		return nil, Internal("INTERNAL", "internal server error")
+		return nil, "", Internal("INTERNAL", "internal server error")
 	}
 	if user == nil {
-		return nil, NotFound("NOT_FOUND", "user not found")
-	}
-
-	roomName := fmt.Sprintf("voice-%d", channelID)
-	token, err := s.generateLiveKitToken(roomName, userID, user.Username)
-	if err != nil {
-		return nil, Internal("INTERNAL", "failed to generate voice token")
+		return nil, "", NotFound("NOT_FOUND", "user not found")
 	}
 
+	roomName := voiceRoomName(channel.ID)
 	state := &models.VoiceState{
 		GuildID:   channel.GuildID,
-		ChannelID: channelID,
+		ChannelID: channel.ID,
 		UserID:    userID,
 		SessionID: roomName,
-		SelfMute:  false,
-		SelfDeaf:  false,
+		SelfMute:  selfMute,
+		SelfDeaf:  selfDeaf,
 		JoinedAt:  time.Now(),
 	}
+	// A server mute or deafen follows the user between channels.
+	if existing != nil {
+		state.Mute, state.Deaf = existing.Mute, existing.Deaf
+	}
+	// Everyone enters a stage in the audience, but rejoining keeps their
+	// place.
+	if channel.Type == models.ChannelTypeStage {
+		state.Suppress = true
+		if existing != nil && existing.ChannelID == channel.ID {
+			state.Suppress, state.RequestToSpeakAt = existing.Suppress, existing.RequestToSpeakAt
+		}
+	}
+
+	token, err := s.generateLiveKitToken(channel, userID, user.Username, canPublish(state), !state.Deaf)
+	if err != nil {
+		return nil, "", Internal("INTERNAL", "failed to generate voice token")
+	}
 
 	if err := s.voiceStates.Upsert(ctx, state); err != nil {
-		return nil, Internal("INTERNAL", "internal server error")
+		return nil, "", Internal("INTERNAL", "internal server error")
 	}
+	s.limitRoom(ctx, channel)
 
 	s.gateway.DispatchToGuild(channel.GuildID, gateway.EventVoiceStateUpdate, state)
+	return state, token, nil
+}
 
-	states, err := s.voiceStates.GetByChannel(ctx, channelID)
+// checkChannelFull rejects a user entering a voice channel that has reached
+// its user limit, unless they may move members.
+func (s *VoiceService) checkChannelFull(ctx context.Context, channel *models.Channel, userID int64) error {
+	if channel.UserLimit == 0 {
+		return nil
+	}
+	states, err := s.voiceStates.GetByChannel(ctx, channel.ID)
 	if err != nil {
-		return nil, Internal("INTERNAL", "internal server error")
+		return Internal("INTERNAL", "internal server error")
 	}
-	if states == nil {
-		states = []models.VoiceState{}
+	if len(states) < channel.UserLimit {
+		return nil
 	}
-
-	return &JoinChannelResponse{
-		Token:       token,
-		VoiceStates: states,
-	}, nil
+	canMove, err := s.perms.HasChannelPermission(ctx, channel.GuildID, channel.ID, userID, permissions.PermMoveMembers)
+	if err != nil {
+		return err
+	}
+	if !canMove {
+		return Forbidden("CHANNEL_FULL", "voice channel is full")
+	}
+	return nil
 }
 
 // LeaveChannel disconnects a user from their voice channel in the guild.
@@ -133,21 +296,498 @@ func (s *VoiceService) LeaveChannel(ctx context.Context, channelID, userID int64
 		return Internal("INTERNAL", "internal server error")
 	}
 
-	leavePayload := struct {
-		GuildID   int64  `json:"guild_id,string"`
-		ChannelID *int64 `json:"channel_id"`
-		UserID    int64  `json:"user_id,string"`
-	}{
-		GuildID:   channel.GuildID,
-		ChannelID: nil,
-		UserID:    userID,
+	s.dispatchLeave(channel.GuildID, userID)
+
+	return nil
+}
+
+// dispatchLeave tells the guild a user is no longer in a voice channel.
+func (s *VoiceService) dispatchLeave(guildID, userID int64) {
+	s.gateway.DispatchToGuild(guildID, gateway.EventVoiceStateUpdate, gateway.VoiceStateLeaveData{
+		GuildID: guildID,
+		UserID:  userID,
+	})
+}
+
+// UpdateVoiceStateParams holds the moderator-controlled fields of a member's
+// voice state. Nil fields are left unchanged.
+type UpdateVoiceStateParams struct {
+	Mute      *bool
+	Deaf      *bool
+	Suppress  *bool
+	ChannelID *int64
+}
+
+// UpdateMemberVoiceState server-mutes, server-deafens or moves a member
+// connected to a voice channel in the guild, or invites a stage listener to
+// speak and returns a speaker to the audience. Muting needs MUTE_MEMBERS,
+// deafening DEAFEN_MEMBERS and moving MOVE_MEMBERS in the member's current
+// channel; a move also needs CONNECT in the destination, and the member is
+// sent a VOICE_SERVER_UPDATE to reconnect with. Setting suppress needs
+// MUTE_MEMBERS in the stage and answers any raised hand.
+func (s *VoiceService) UpdateMemberVoiceState(ctx context.Context, guildID, callerID, targetUserID int64, params UpdateVoiceStateParams) (*models.VoiceState, error) {
+	if params.Mute == nil && params.Deaf == nil && params.Suppress == nil && params.ChannelID == nil {
+		return nil, BadRequest("INVALID_BODY", "one of mute, deaf, suppress or channel_id is required")
+	}
+
+	state, err := s.voiceStates.GetByUser(ctx, guildID, targetUserID)
+	if err != nil {
+		return nil, Internal("INTERNAL", "internal server error")
+	}
+	if state == nil {
+		return nil, NotFound("NOT_FOUND", "member is not in a voice channel")
+	}
+
+	if params.Mute != nil {
+		if err := s.perms.RequireChannelPermission(ctx, guildID, state.ChannelID, callerID, permissions.PermMuteMembers); err != nil {
+			return nil, err
+		}
+	}
+	if params.Deaf != nil {
+		if err := s.perms.RequireChannelPermission(ctx, guildID, state.ChannelID, callerID, permissions.PermDeafenMembers); err != nil {
+			return nil, err
+		}
+	}
+	var dest *models.Channel
+	if params.ChannelID != nil {
+		if err := s.perms.RequireChannelPermission(ctx, guildID, state.ChannelID, callerID, permissions.PermMoveMembers); err != nil {
+			return nil, err
+		}
+		dest, err = s.channels.GetByID(ctx, *params.ChannelID)
+		if err != nil {
+			return nil, Internal("INTERNAL", "internal server error")
+		}
+		if dest == nil || dest.GuildID != guildID {
+			return nil, NotFound("NOT_FOUND", "channel not found")
+		}
+		if !dest.Type.IsVoice() {
+			return nil, BadRequest("NOT_VOICE_CHANNEL", "channel is not a voice channel")
+		}
+		if err := s.perms.RequireChannelPermission(ctx, guildID, dest.ID, callerID, permissions.PermConnect); err != nil {
+			return nil, err
+		}
+	}
+	// Suppress applies to the channel the member ends up in.
+	if params.Suppress != nil {
+		stage := dest
+		if stage == nil {
+			if stage, err = s.channels.GetByID(ctx, state.ChannelID); err != nil {
+				return nil, Internal("INTERNAL", "internal server error")
+			}
+		}
+		if stage == nil || stage.Type != models.ChannelTypeStage {
+			return nil, BadRequest("NOT_STAGE_CHANNEL", "member is not in a stage channel")
+		}
+		if err := s.perms.RequireChannelPermission(ctx, guildID, stage.ID, callerID, permissions.PermMuteMembers); err != nil {
+			return nil, err
+		}
+	}
+
+	// Inviting a listener to speak takes nothing away from them, so it is
+	// not held to the role hierarchy.
+	if params.Mute != nil || params.Deaf != nil || params.ChannelID != nil || (params.Suppress != nil && *params.Suppress) {
+		if err := s.checkVoiceHierarchy(ctx, guildID, callerID, targetUserID); err != nil {
+			return nil, err
+		}
+	}
+
+	old := *state
+	if params.Mute != nil {
+		state.Mute = *params.Mute
+	}
+	if params.Deaf != nil {
+		state.Deaf = *params.Deaf
+	}
+	moved := params.ChannelID != nil && *params.ChannelID != old.ChannelID
+	if moved {
+		state.ChannelID = *params.ChannelID
+		state.SessionID = voiceRoomName(state.ChannelID)
+		state.Suppress = dest.Type == models.ChannelTypeStage
+		state.RequestToSpeakAt = nil
+	}
+	if params.Suppress != nil {
+		state.Suppress = *params.Suppress
+		state.RequestToSpeakAt = nil
 	}
 
-	s.gateway.DispatchToGuild(channel.GuildID, gateway.EventVoiceStateUpdate, leavePayload)
+	// A moved member's client is sent to the new room with a fresh token.
+	var server *gateway.VoiceServerUpdateData
+	if moved {
+		user, err := s.users.GetByID(ctx, targetUserID)
+		if err != nil {
+			return nil, Internal("INTERNAL", "internal server error")
+		}
+		if user == nil {
+			return nil, NotFound("NOT_FOUND", "user not found")
+		}
+		token, err := s.generateLiveKitToken(dest, targetUserID, user.Username, canPublish(state), !state.Deaf)
+		if err != nil {
+			return nil, Internal("INTERNAL", "failed to generate voice token")
+		}
+		server = &gateway.VoiceServerUpdateData{
+			GuildID:   guildID,
+			ChannelID: dest.ID,
+			Token:     token,
+			Endpoint:  s.url,
+			Bitrate:   dest.Bitrate,
+		}
+	}
+
+	if err := s.voiceStates.Upsert(ctx, state); err != nil {
+		return nil, Internal("INTERNAL", "internal server error")
+	}
+
+	// A moved member rejoins with a token carrying their current mute and
+	// deafen; one who stays has their permissions in the room changed.
+	if moved {
+		s.limitRoom(ctx, dest)
+		s.removeParticipant(ctx, old.SessionID, targetUserID)
+	} else {
+		s.updateParticipant(ctx, &old, state)
+	}
+
+	changes := auditDiff{}.change("mute", old.Mute, state.Mute).change("deaf", old.Deaf, state.Deaf)
+	if params.Suppress != nil {
+		changes = changes.change("suppress", old.Suppress, state.Suppress)
+	}
+	if len(changes) > 0 {
+		s.audit.record(ctx, guildID, callerID, models.AuditLogMemberUpdate, targetUserID, changes, nil)
+	}
+	if moved {
+		s.audit.record(ctx, guildID, callerID, models.AuditLogMemberMove, targetUserID, nil, map[string]string{"channel_id": auditID(state.ChannelID)})
+	}
 
+	s.gateway.DispatchToGuild(guildID, gateway.EventVoiceStateUpdate, state)
+	if server != nil {
+		s.gateway.DispatchToUser(targetUserID, gateway.EventVoiceServerUpdate, server)
+	}
+	return state, nil
+}
+
+// UpdateSelfVoiceStateParams holds the fields a user may set on their own
+// voice state in a stage channel. Nil fields are left unchanged.
+type UpdateSelfVoiceStateParams struct {
+	RequestToSpeak *bool
+	Suppress       *bool
+}
+
+// UpdateSelfVoiceState raises or lowers the user's hand in a stage channel,
+// or moves them between the audience and the speakers. Anyone may raise
+// their hand or return to the audience; speaking without being invited
+// needs MUTE_MEMBERS.
+func (s *VoiceService) UpdateSelfVoiceState(ctx context.Context, guildID, userID int64, params UpdateSelfVoiceStateParams) (*models.VoiceState, error) {
+	if params.RequestToSpeak == nil && params.Suppress == nil {
+		return nil, BadRequest("INVALID_BODY", "one of request_to_speak or suppress is required")
+	}
+
+	state, err := s.voiceStates.GetByUser(ctx, guildID, userID)
+	if err != nil {
+		return nil, Internal("INTERNAL", "internal server error")
+	}
+	if state == nil {
+		return nil, NotFound("NOT_FOUND", "not in a voice channel")
+	}
+
+	channel, err := s.channels.GetByID(ctx, state.ChannelID)
+	if err != nil {
+		return nil, Internal("INTERNAL", "internal server error")
+	}
+	if channel == nil || channel.Type != models.ChannelTypeStage {
+		return nil, BadRequest("NOT_STAGE_CHANNEL", "not in a stage channel")
+	}
+
+	if params.Suppress != nil && !*params.Suppress {
+		if err := s.perms.RequireChannelPermission(ctx, guildID, channel.ID, userID, permissions.PermMuteMembers); err != nil {
+			return nil, err
+		}
+	}
+
+	old := *state
+	if params.Suppress != nil {
+		state.Suppress = *params.Suppress
+		state.RequestToSpeakAt = nil
+	}
+	if params.RequestToSpeak != nil {
+		switch {
+		case !*params.RequestToSpeak:
+			state.RequestToSpeakAt = nil
+		case !state.Suppress:
+			return nil, BadRequest("ALREADY_SPEAKER", "speakers cannot request to speak")
+		case state.RequestToSpeakAt == nil:
+			// A hand raised again keeps its place in the queue.
+			now := time.Now()
+			state.RequestToSpeakAt = &now
+		}
+	}
+
+	if state.Suppress == old.Suppress && (state.RequestToSpeakAt == nil) == (old.RequestToSpeakAt == nil) {
+		return state, nil
+	}
+
+	if err := s.voiceStates.Upsert(ctx, state); err != nil {
+		return nil, Internal("INTERNAL", "internal server error")
+	}
+	s.updateParticipant(ctx, &old, state)
+
+	s.gateway.DispatchToGuild(guildID, gateway.EventVoiceStateUpdate, state)
+	return state, nil
+}
+
+// DisconnectMember removes a member from their voice channel in the guild.
+// It needs MOVE_MEMBERS in the member's channel.
+func (s *VoiceService) DisconnectMember(ctx context.Context, guildID, callerID, targetUserID int64) error {
+	state, err := s.voiceStates.GetByUser(ctx, guildID, targetUserID)
+	if err != nil {
+		return Internal("INTERNAL", "internal server error")
+	}
+	if state == nil {
+		return NotFound("NOT_FOUND", "member is not in a voice channel")
+	}
+
+	if err := s.perms.RequireChannelPermission(ctx, guildID, state.ChannelID, callerID, permissions.PermMoveMembers); err != nil {
+		return err
+	}
+	if err := s.checkVoiceHierarchy(ctx, guildID, callerID, targetUserID); err != nil {
+		return err
+	}
+
+	if err := s.voiceStates.Delete(ctx, guildID, targetUserID); err != nil {
+		return Internal("INTERNAL", "internal server error")
+	}
+	s.removeParticipant(ctx, state.SessionID, targetUserID)
+
+	s.audit.record(ctx, guildID, callerID, models.AuditLogMemberDisconnect, targetUserID, nil, map[string]string{"channel_id": auditID(state.ChannelID)})
+
+	s.dispatchLeave(guildID, targetUserID)
+	return nil
+}
+
+// checkVoiceHierarchy enforces that a moderator outranks the member they
+// act on. Members may always act on themselves; nobody else may act on the
+// guild owner.
+func (s *VoiceService) checkVoiceHierarchy(ctx context.Context, guildID, callerID, targetUserID int64) error {
+	if callerID == targetUserID {
+		return nil
+	}
+
+	targetIsOwner, err := s.perms.IsGuildOwner(ctx, guildID, targetUserID)
+	if err != nil {
+		return err
+	}
+	if targetIsOwner {
+		return Forbidden("FORBIDDEN", "cannot moderate the guild owner")
+	}
+
+	callerIsOwner, err := s.perms.IsGuildOwner(ctx, guildID, callerID)
+	if err != nil {
+		return err
+	}
+	if callerIsOwner {
+		return nil
+	}
+
+	callerHighest, err := s.perms.HighestRolePosition(ctx, guildID, callerID)
+	if err != nil {
+		return err
+	}
+	targetHighest, err := s.perms.HighestRolePosition(ctx, guildID, targetUserID)
+	if err != nil {
+		return err
+	}
+	if targetHighest >= callerHighest {
+		return RoleHierarchyError("your highest role must be above the target's highest role")
+	}
 	return nil
 }
 
+// canPublish reports whether a user may send audio to their room: they are
+// neither server-muted nor a stage listener.
+func canPublish(state *models.VoiceState) bool {
+	return !state.Mute && !state.Suppress
+}
+
+// updateParticipant applies a change in what a user may do in their room to
+// their connected client. The voice state is already stored, so a failure is
+// only logged.
+func (s *VoiceService) updateParticipant(ctx context.Context, old, state *models.VoiceState) {
+	if s.rooms == nil || (canPublish(old) == canPublish(state) && old.Deaf == state.Deaf) {
+		return
+	}
+	if err := s.rooms.SetParticipantPermissions(ctx, state.SessionID, participantIdentity(state.UserID), canPublish(state), !state.Deaf); err != nil {
+		slog.Error("failed to update voice participant", "room", state.SessionID, "userID", state.UserID, "error", err)
+	}
+}
+
+// limitRoom sets the channel's user limit as its room's maxParticipants
+// before a client connects to it. Members who may move others can exceed the
+// limit, so the room admits everyone already in the channel. The voice state
+// is already stored, so a failure is only logged.
+func (s *VoiceService) limitRoom(ctx context.Context, channel *models.Channel) {
+	if s.rooms == nil || channel.UserLimit == 0 {
+		return
+	}
+	states, err := s.voiceStates.GetByChannel(ctx, channel.ID)
+	if err != nil {
+		slog.Error("failed to load voice states for room limit", "channelID", channel.ID, "error", err)
+		return
+	}
+	room := voiceRoomName(channel.ID)
+	if err := s.rooms.CreateRoom(ctx, room, max(channel.UserLimit, len(states))); err != nil {
+		slog.Error("failed to set voice room limit", "room", room, "error", err)
+	}
+}
+
+// removeParticipant disconnects a user's client from a room. The voice state
+// is already gone, so a failure is only logged.
+func (s *VoiceService) removeParticipant(ctx context.Context, room string, userID int64) {
+	if s.rooms == nil {
+		return
+	}
+	if err := s.rooms.RemoveParticipant(ctx, room, participantIdentity(userID)); err != nil {
+		slog.Error("failed to remove voice participant", "room", room, "userID", userID, "error", err)
+	}
+}
+
+// HandleLiveKitWebhook verifies a webhook posted by the LiveKit server and
+// reconciles voice states with it: a participant who left takes their voice
+// state with them, a finished room empties its channel, and a participant
+// who joined a room without a matching voice state is removed from it.
+func (s *VoiceService) HandleLiveKitWebhook(ctx context.Context, body []byte, authorization string) error {
+	event, err := livekit.VerifyWebhook(body, authorization, s.apiKey, s.apiSecret)
+	if errors.Is(err, livekit.ErrInvalidWebhook) {
+		return Unauthorized("INVALID_SIGNATURE", "invalid webhook signature")
+	}
+	if err != nil {
+		return BadRequest("INVALID_BODY", "invalid webhook body")
+	}
+	if event.Room == nil {
+		return nil
+	}
+	channelID, ok := parseVoiceRoomName(event.Room.Name)
+	if !ok {
+		return nil
+	}
+
+	if event.Event == livekit.EventRoomFinished {
+		removed, err := s.voiceStates.DeleteByChannel(ctx, channelID)
+		if err != nil {
+			return Internal("INTERNAL", "internal server error")
+		}
+		for _, state := range removed {
+			s.dispatchLeave(state.GuildID, state.UserID)
+		}
+		return nil
+	}
+
+	if event.Participant == nil || (event.Event != livekit.EventParticipantJoined && event.Event != livekit.EventParticipantLeft) {
+		return nil
+	}
+	userID, err := strconv.ParseInt(event.Participant.Identity, 10, 64)
+	if err != nil {
+		return nil
+	}
+	channel, err := s.channels.GetByID(ctx, channelID)
+	if err != nil {
+		return Internal("INTERNAL", "internal server error")
+	}
+	if channel == nil {
+		return nil
+	}
+	state, err := s.voiceStates.GetByUser(ctx, channel.GuildID, userID)
+	if err != nil {
+		return Internal("INTERNAL", "internal server error")
+	}
+	inRoom := state != nil && state.SessionID == event.Room.Name
+
+	switch event.Event {
+	case livekit.EventParticipantJoined:
+		if !inRoom {
+			s.removeParticipant(ctx, event.Room.Name, userID)
+		}
+	case livekit.EventParticipantLeft:
+		// A state written after the participant joined belongs to a client
+		// that has since rejoined.
+		joinedAt := event.Participant.JoinedAt
+		if inRoom && (joinedAt == 0 || state.JoinedAt.Unix() <= joinedAt) {
+			if err := s.voiceStates.Delete(ctx, channel.GuildID, userID); err != nil {
+				return Internal("INTERNAL", "internal server error")
+			}
+			s.dispatchLeave(channel.GuildID, userID)
+		}
+	}
+	return nil
+}
+
+// SweepGhostVoiceStates removes the voice states of users who joined before
+// joinedBefore and have no gateway session, such as crashed clients, and
+// returns how many it removed.
+func (s *VoiceService) SweepGhostVoiceStates(ctx context.Context, joinedBefore time.Time) (int, error) {
+	if s.sessions == nil {
+		return 0, nil
+	}
+
+	states, err := s.voiceStates.GetJoinedBefore(ctx, joinedBefore)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, state := range states {
+		if s.sessions.HasSession(state.UserID) {
+			continue
+		}
+		if err := s.voiceStates.Delete(ctx, state.GuildID, state.UserID); err != nil {
+			return removed, err
+		}
+		s.removeParticipant(ctx, state.SessionID, state.UserID)
+		s.dispatchLeave(state.GuildID, state.UserID)
+		removed++
+	}
+	return removed, nil
+}
+
+// RunVoiceStateSweeper periodically removes ghost voice states until ctx is
+// cancelled.
+func (s *VoiceService) RunVoiceStateSweeper(ctx context.Context) {
+	ticker := time.NewTicker(voiceSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			removed, err := s.SweepGhostVoiceStates(ctx, time.Now().Add(-voiceGhostGrace))
+			if err != nil {
+				slog.Error("voice state sweeper failed", "error", err)
+			}
+			if removed > 0 {
+				slog.Info("removed ghost voice states", "count", removed)
+			}
+		}
+	}
+}
+
+// voiceRoomName is the media server room of a voice channel.
+func voiceRoomName(channelID int64) string {
+	return fmt.Sprintf("voice-%d", channelID)
+}
+
+// parseVoiceRoomName returns the channel of a room named by voiceRoomName.
+func parseVoiceRoomName(room string) (int64, bool) {
+	id, ok := strings.CutPrefix(room, "voice-")
+	if !ok {
+		return 0, false
+	}
+	channelID, err := strconv.ParseInt(id, 10, 64)
+	return channelID, err == nil
+}
+
+// participantIdentity is a user's identity in a media server room.
+func participantIdentity(userID int64) string {
+	return fmt.Sprintf("%d", userID)
+}
+
 // GetChannelVoiceStates returns all voice states for a channel.
 func (s *VoiceService) GetChannelVoiceStates(ctx context.Context, channelID, userID int64) ([]models.VoiceState, error) {
 	channel, err := s.channels.GetByID(ctx, channelID)
@@ -174,21 +814,26 @@ func (s *VoiceService) GetChannelVoiceStates(ctx context.Context, channelID, use
 }
 
 // generateLiveKitToken creates a LiveKit-compatible access token using the standard JWT library.
-// LiveKit tokens use HS256 with the API secret and include a "video" grant.
-func (s *VoiceService) generateLiveKitToken(roomName string, userID int64, username string) (string, error) {
+// LiveKit tokens use HS256 with the API secret and include a "video" grant;
+// server-muted users and stage listeners may not publish, and server-deafened
+// users may not subscribe.
+func (s *VoiceService) generateLiveKitToken(channel *models.Channel, userID int64, username string, canPublish, canSubscribe bool) (string, error) {
 	now := time.Now()
-	identity := fmt.Sprintf("%d", userID)
+	identity := participantIdentity(userID)
 
 	claims := jwt.MapClaims{
-		"iss":   s.apiKey,
-		"sub":   identity,
-		"iat":   now.Unix(),
-		"nbf":   now.Unix(),
-		"exp":   now.Add(24 * time.Hour).Unix(),
-		"name":  username,
+		"iss":  s.apiKey,
+		"sub":  identity,
+		"iat":  now.Unix(),
+		"nbf":  now.Unix(),
+		"exp":  now.Add(24 * time.Hour).Unix(),
+		"name": username,
 		"video": map[string]interface{}{
-			"roomJoin": true,
-			"room":     roomName,
+			"roomJoin":       true,
+			"room":           voiceRoomName(channel.ID),
+			"canPublish":     canPublish,
+			"canSubscribe":   canSubscribe,
+			"canPublishData": true,
 		},
 	}
 
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_attachments_unclaimed;
+DROP INDEX IF EXISTS idx_attachments_message_id;
+DELETE FROM attachments WHERE message_id IS NULL;
+ALTER TABLE attachments DROP COLUMN IF EXISTS created_at;
+ALTER TABLE attachments DROP COLUMN IF EXISTS uploader_id;
+ALTER TABLE attachments DROP COLUMN IF EXISTS channel_id;
+ALTER TABLE attachments ALTER COLUMN message_id SET NOT NULL;
@@ -0,0 +1,9 @@
+-- Attachments are uploaded before the message that carries them exists, so
+-- message_id starts out NULL and is filled in when a message claims the upload.
+ALTER TABLE attachments ALTER COLUMN message_id DROP NOT NULL;
+ALTER TABLE attachments ADD COLUMN channel_id BIGINT;
+ALTER TABLE attachments ADD COLUMN uploader_id BIGINT REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE attachments ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+CREATE INDEX idx_attachments_message_id ON attachments(message_id);
+CREATE INDEX idx_attachments_unclaimed ON attachments(created_at) WHERE message_id IS NULL;
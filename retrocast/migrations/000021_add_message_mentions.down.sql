@@ -0,0 +1,3 @@
+ALTER TABLE messages DROP COLUMN IF EXISTS mention_everyone;
+ALTER TABLE messages DROP COLUMN IF EXISTS mention_roles;
+ALTER TABLE messages DROP COLUMN IF EXISTS mentions;
@@ -0,0 +1,6 @@
+-- Users and roles mentioned by a message, plus whether it pinged @everyone
+-- or @here. Stored on the message so clients can render highlights without
+-- re-parsing content.
+ALTER TABLE messages ADD COLUMN mentions BIGINT[] NOT NULL DEFAULT '{}';
+ALTER TABLE messages ADD COLUMN mention_roles BIGINT[] NOT NULL DEFAULT '{}';
+ALTER TABLE messages ADD COLUMN mention_everyone BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1 @@
+ALTER TABLE messages DROP COLUMN IF EXISTS reference_message_id;
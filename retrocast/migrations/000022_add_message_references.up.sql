@@ -0,0 +1,4 @@
+-- Replies point at an earlier message in the same channel. There is no
+-- foreign key: the reference survives deletion of the original so clients
+-- can show that the replied-to message was deleted.
+ALTER TABLE messages ADD COLUMN reference_message_id BIGINT;
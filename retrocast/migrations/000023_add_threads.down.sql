@@ -0,0 +1,12 @@
+DROP TABLE IF EXISTS thread_members;
+DELETE FROM channels WHERE type = 11;
+
+DROP INDEX IF EXISTS idx_channels_threads;
+ALTER TABLE channels DROP COLUMN IF EXISTS archive_timestamp;
+ALTER TABLE channels DROP COLUMN IF EXISTS auto_archive_duration;
+ALTER TABLE channels DROP COLUMN IF EXISTS archived;
+ALTER TABLE channels DROP COLUMN IF EXISTS starter_message_id;
+ALTER TABLE channels DROP COLUMN IF EXISTS owner_id;
+
+DROP INDEX IF EXISTS channels_guild_id_name_key;
+ALTER TABLE channels ADD CONSTRAINT channels_guild_id_name_key UNIQUE (guild_id, name);
@@ -0,0 +1,22 @@
+-- Threads are channels of type 11 whose parent_id is the text channel they
+-- live in. They are named freely, so channel names only have to be unique
+-- among non-thread channels.
+ALTER TABLE channels DROP CONSTRAINT channels_guild_id_name_key;
+CREATE UNIQUE INDEX channels_guild_id_name_key ON channels(guild_id, name) WHERE type <> 11;
+
+ALTER TABLE channels ADD COLUMN owner_id BIGINT REFERENCES users(id) ON DELETE SET NULL;
+-- At most one thread per message. No foreign key, like message references.
+ALTER TABLE channels ADD COLUMN starter_message_id BIGINT UNIQUE;
+ALTER TABLE channels ADD COLUMN archived BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE channels ADD COLUMN auto_archive_duration INT;
+ALTER TABLE channels ADD COLUMN archive_timestamp TIMESTAMPTZ;
+
+CREATE INDEX idx_channels_threads ON channels(parent_id) WHERE type = 11;
+
+CREATE TABLE thread_members (
+    thread_id BIGINT NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+    user_id   BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    joined_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (thread_id, user_id)
+);
+CREATE INDEX idx_thread_members_user ON thread_members(user_id);
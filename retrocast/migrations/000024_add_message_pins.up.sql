@@ -0,0 +1,5 @@
+-- A message is pinned while pinned_at is set. The per-channel cap is
+-- enforced by the application.
+ALTER TABLE messages ADD COLUMN pinned_at TIMESTAMPTZ;
+
+CREATE INDEX idx_messages_pinned ON messages(channel_id, pinned_at DESC) WHERE pinned_at IS NOT NULL;
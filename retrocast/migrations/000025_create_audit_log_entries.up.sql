@@ -0,0 +1,15 @@
+-- Actor and target are plain IDs so entries outlive the users, roles and
+-- channels they describe.
+CREATE TABLE audit_log_entries (
+    id          BIGINT PRIMARY KEY,
+    guild_id    BIGINT NOT NULL REFERENCES guilds(id) ON DELETE CASCADE,
+    user_id     BIGINT NOT NULL,
+    target_id   BIGINT,
+    action_type INT NOT NULL,
+    changes     JSONB NOT NULL DEFAULT '[]',
+    options     JSONB,
+    reason      TEXT,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_audit_log_entries_guild ON audit_log_entries(guild_id, id DESC);
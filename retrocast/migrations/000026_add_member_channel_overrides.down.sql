@@ -0,0 +1,7 @@
+DELETE FROM channel_overrides WHERE user_id IS NOT NULL;
+
+DROP INDEX IF EXISTS channel_overrides_target_key;
+ALTER TABLE channel_overrides DROP CONSTRAINT IF EXISTS channel_overrides_target_check;
+ALTER TABLE channel_overrides DROP COLUMN IF EXISTS user_id;
+ALTER TABLE channel_overrides ALTER COLUMN role_id SET NOT NULL;
+ALTER TABLE channel_overrides ADD PRIMARY KEY (channel_id, role_id);
@@ -0,0 +1,9 @@
+-- An override targets either a role or a member. Each target keeps its own
+-- foreign key so overrides go away with the role or user they apply to.
+ALTER TABLE channel_overrides DROP CONSTRAINT channel_overrides_pkey;
+ALTER TABLE channel_overrides ALTER COLUMN role_id DROP NOT NULL;
+ALTER TABLE channel_overrides ADD COLUMN user_id BIGINT REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE channel_overrides ADD CONSTRAINT channel_overrides_target_check
+    CHECK ((role_id IS NULL) <> (user_id IS NULL));
+
+CREATE UNIQUE INDEX channel_overrides_target_key ON channel_overrides(channel_id, COALESCE(role_id, user_id));
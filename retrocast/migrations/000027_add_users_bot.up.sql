@@ -0,0 +1,2 @@
+-- Bot accounts may request privileged gateway intents.
+ALTER TABLE users ADD COLUMN bot BOOLEAN NOT NULL DEFAULT FALSE;
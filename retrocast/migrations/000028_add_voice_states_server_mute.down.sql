@@ -0,0 +1,2 @@
+ALTER TABLE voice_states DROP COLUMN IF EXISTS deaf;
+ALTER TABLE voice_states DROP COLUMN IF EXISTS mute;
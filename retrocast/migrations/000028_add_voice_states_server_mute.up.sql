@@ -0,0 +1,3 @@
+-- Server mute and deafen, set by moderators, alongside the user's own.
+ALTER TABLE voice_states ADD COLUMN mute BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE voice_states ADD COLUMN deaf BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,2 @@
+ALTER TABLE channels DROP COLUMN IF EXISTS user_limit;
+ALTER TABLE channels DROP COLUMN IF EXISTS bitrate;
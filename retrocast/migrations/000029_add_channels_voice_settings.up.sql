@@ -0,0 +1,4 @@
+-- Voice channel settings. A user limit of 0 means unlimited.
+ALTER TABLE channels ADD COLUMN bitrate INT NOT NULL DEFAULT 0;
+ALTER TABLE channels ADD COLUMN user_limit INT NOT NULL DEFAULT 0;
+UPDATE channels SET bitrate = 64000 WHERE type = 2;
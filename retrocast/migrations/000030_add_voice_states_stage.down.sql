@@ -0,0 +1,2 @@
+ALTER TABLE voice_states DROP COLUMN IF EXISTS request_to_speak_at;
+ALTER TABLE voice_states DROP COLUMN IF EXISTS suppress;
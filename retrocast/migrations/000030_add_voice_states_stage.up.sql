@@ -0,0 +1,3 @@
+-- Stage channels: listeners are suppressed and may raise their hand.
+ALTER TABLE voice_states ADD COLUMN suppress BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE voice_states ADD COLUMN request_to_speak_at TIMESTAMPTZ;
@@ -0,0 +1,4 @@
+-- The janitor marks an unclaimed upload before deleting its stored object and
+-- only drops the row once the object is gone, so a failed delete is retried.
+-- A marked upload can no longer be claimed by a message.
+ALTER TABLE attachments ADD COLUMN pending_deletion BOOLEAN NOT NULL DEFAULT FALSE;